@@ -16,14 +16,29 @@ limitations under the License.
 
 #include <uapi/linux/ptrace.h>
 #include <uapi/linux/bpf_perf_event.h>
+#include <linux/sched.h>
 
+// the number of possible CPUs, set by the loader
 #ifndef NUM_CPUS
 #define NUM_CPUS 128
 #endif
 
-// we cannot define it dynamically as NUM_CPUS because the golang needs to know this
-// size at compiler time for decoding
-#define CPU_VECTOR_SIZE 128
+// the hardware counters are configured by the user, NUM_COUNTERS of the MAX_COUNTERS slots are used
+// MAX_COUNTERS must be in sync with attacher.MaxCounters
+#define MAX_COUNTERS 8
+#ifndef NUM_COUNTERS
+#define NUM_COUNTERS 3
+#endif
+
+// the indexes of irq_time, the network softirqs are also counted in IRQ_TIME_SOFTIRQ
+// the indexes must be in sync with the collector
+#define IRQ_TIME_HARDIRQ 0
+#define IRQ_TIME_SOFTIRQ 1
+#define IRQ_TIME_NET_SOFTIRQ 2
+#define IRQ_TIME_SIZE 3
+
+#define NET_TX_SOFTIRQ 2
+#define NET_RX_SOFTIRQ 3
 
 typedef struct switch_args
 {
@@ -37,19 +52,52 @@ typedef struct switch_args
     int next_prio;
 } switch_args;
 
+typedef struct fork_args
+{
+    u64 pad;
+    char parent_comm[16];
+    int parent_pid;
+    char child_comm[16];
+    int child_pid;
+} fork_args;
+
+typedef struct exec_args
+{
+    u64 pad;
+    int filename_loc;
+    int pid;
+    int old_pid;
+} exec_args;
+
+typedef struct exit_args
+{
+    u64 pad;
+    char comm[16];
+    int pid;
+    int prio;
+} exit_args;
+
+typedef struct softirq_args
+{
+    u64 pad;
+    unsigned int vec;
+} softirq_args;
+
 typedef struct process_time_t
 {
     u64 cgroup_id;
     u64 pid;
+    // the process that forked this process, its container is the fallback when the process exited before it was resolved
+    u64 parent_pid;
     u64 process_run_time;
-    u64 cpu_cycles;
-    u64 cpu_instr;
-    u64 cache_misses;
+    u64 counters[MAX_COUNTERS];
     char comm[16];
-    //u64 pad;
-    // the max eBPF stack limit is 512 bytes, which is a vector of u16 with 128 elements
-    // the time is calculated in miliseconds, uint16 max size is 65K, ~1mim
-    u16 cpu_time[CPU_VECTOR_SIZE];
+    // set when the process exited, the cgroup ID is the one at exit
+    u64 exited;
+    // set when the process is a kernel thread, e.g. kworker, ksoftirqd or the idle task
+    u64 kernel_thread;
+    // the part of process_run_time when the sibling hyperthread of the CPU was busy, the physical core was shared
+    u64 shared_run_time;
 }  process_time_t;
 
 typedef struct pid_time_t
@@ -57,31 +105,201 @@ typedef struct pid_time_t
     int pid;
 } pid_time_t;
 
+// the busy state of each CPU, the CPUs read the entry of their sibling hyperthread
+typedef struct cpu_busy_t
+{
+    // set when the CPU runs a task other than the idle task
+    u64 busy;
+    // the time of the last context switch
+    u64 last_switch;
+    // the time that the CPU was busy until the last context switch
+    u64 busy_time;
+    // the busy time of the sibling hyperthread when the current task was scheduled or last accounted
+    u64 sibling_start;
+} cpu_busy_t;
+
 BPF_PERF_OUTPUT(events);
 
 // processes and pid time
 BPF_HASH(processes, u64, process_time_t);
 BPF_HASH(pid_time, pid_time_t);
+// the time in nanoseconds that each process ran on each CPU
+BPF_PERCPU_HASH(cpu_time, u64, u64);
+// the parent process of the forked tasks, the entries are removed when the task exits
+BPF_TABLE("lru_hash", u64, u64, parent_pids, 10240);
 
-// perf counters
-BPF_PERF_ARRAY(cpu_cycles, NUM_CPUS);
-BPF_PERF_ARRAY(cpu_instr, NUM_CPUS);
-BPF_PERF_ARRAY(cache_miss, NUM_CPUS);
+// the sibling hyperthread of each CPU plus one, 0 if the CPU has no sibling, set by the loader
+BPF_ARRAY(cpu_siblings, u32, NUM_CPUS);
+// the busy state of each CPU
+BPF_ARRAY(cpu_busy, cpu_busy_t, NUM_CPUS);
+
+// the time in nanoseconds that each CPU spent in interrupts since it started, indexed by IRQ_TIME_*
+BPF_PERCPU_ARRAY(irq_time, u64, IRQ_TIME_SIZE);
+// the start time of the hard IRQ (0) and of the softirq (1) that the CPU is serving
+BPF_PERCPU_ARRAY(irq_start, u64, 2);
+// the interrupt time since the last context switch, it is not charged to the process that was interrupted
+BPF_PERCPU_ARRAY(irq_since_switch, u64, 1);
+
+// perf counters, the event of the counter i on the cpu c is at the index i * NUM_CPUS + c
+BPF_PERF_ARRAY(counters, NUM_CPUS * NUM_COUNTERS);
 
 // tracking counters
-BPF_ARRAY(prev_cpu_cycles, u64, NUM_CPUS);
-BPF_ARRAY(prev_cpu_instr, u64, NUM_CPUS);
-BPF_ARRAY(prev_cache_miss, u64, NUM_CPUS);
+BPF_ARRAY(prev_counters, u64, NUM_CPUS * NUM_COUNTERS);
+
+static inline u64 get_cgroup_id()
+{
+#ifdef SET_GROUP_ID
+    return bpf_get_current_cgroup_id();
+#else
+    return 0;
+#endif
+}
+
+static inline u64 is_kernel_thread()
+{
+    struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+    return (task->flags & PF_KTHREAD) != 0;
+}
+
+// take_irq_time returns the interrupt time since the last context switch and resets it
+static inline u64 take_irq_time()
+{
+    u32 key = 0;
+    u64 *irq_delta = irq_since_switch.lookup(&key);
+    if (irq_delta == 0)
+    {
+        return 0;
+    }
+    u64 value = *irq_delta;
+    *irq_delta = 0;
+    return value;
+}
+
+// add_irq_time adds the interrupt time to the CPU and to the time since the last context switch
+static inline void add_irq_time(u32 index, u64 delta)
+{
+    u64 *total = irq_time.lookup(&index);
+    if (total != 0)
+    {
+        *total += delta;
+    }
+    u32 key = 0;
+    u64 *irq_delta = irq_since_switch.lookup(&key);
+    if (irq_delta != 0)
+    {
+        *irq_delta += delta;
+    }
+}
+
+// get_process returns the entry of the process, it is created if it does not exist yet
+static inline process_time_t *get_process(u64 pid)
+{
+    process_time_t *process_time = processes.lookup(&pid);
+    if (process_time != 0)
+    {
+        return process_time;
+    }
+    process_time_t new_process = {};
+    new_process.pid = pid;
+    new_process.cgroup_id = get_cgroup_id();
+    new_process.kernel_thread = is_kernel_thread();
+    u64 *parent_pid = parent_pids.lookup(&pid);
+    if (parent_pid != 0)
+    {
+        new_process.parent_pid = *parent_pid;
+    }
+    bpf_get_current_comm(&new_process.comm, sizeof(new_process.comm));
+    processes.update(&pid, &new_process);
+    return processes.lookup(&pid);
+}
 
-static void safe_array_add(u32 idx, u16 *array, u16 value)
+// get_sibling_busy_time returns the time that the sibling hyperthread of the CPU was busy until now, 0 if the CPU has no sibling
+static inline u64 get_sibling_busy_time(u32 cpu_id, u64 time)
 {
+    u32 *sibling = cpu_siblings.lookup(&cpu_id);
+    if (sibling == 0 || *sibling == 0)
+    {
+        return 0;
+    }
+    u32 sibling_id = *sibling - 1;
+    cpu_busy_t *sibling_busy = cpu_busy.lookup(&sibling_id);
+    if (sibling_busy == 0)
+    {
+        return 0;
+    }
+    u64 busy_time = sibling_busy->busy_time;
+    if (sibling_busy->busy && time > sibling_busy->last_switch)
+    {
+        busy_time += time - sibling_busy->last_switch;
+    }
+    return busy_time;
+}
+
+// take_shared_time returns the time that the sibling hyperthread was busy since the current task was scheduled or last accounted,
+// the CPU was busy all this time so it is the time that the task shared the physical core. The CPU becomes busy if it switches to a task.
+static inline u64 take_shared_time(u64 time, int switched, int next_busy)
+{
+    u32 cpu_id = bpf_get_smp_processor_id();
+    cpu_busy_t *own = cpu_busy.lookup(&cpu_id);
+    if (own == 0)
+    {
+        return 0;
+    }
+    u64 sibling_busy_time = get_sibling_busy_time(cpu_id, time);
+    u64 shared = 0;
+    if (own->busy && sibling_busy_time > own->sibling_start)
+    {
+        shared = sibling_busy_time - own->sibling_start;
+    }
+    own->sibling_start = sibling_busy_time;
+    if (switched)
+    {
+        if (own->busy && time > own->last_switch)
+        {
+            own->busy_time += time - own->last_switch;
+        }
+        own->last_switch = time;
+        own->busy = next_busy;
+    }
+    return shared;
+}
+
+// account_process adds the time and the counters since the task was scheduled to the process
+static inline void account_process(process_time_t *process_time, u64 pid, u64 delta, u64 shared)
+{
+    process_time->process_run_time += delta;
+    // the interrupts are not in delta, they can be in the shared time
+    process_time->shared_run_time += shared < delta ? shared : delta;
+    // the per-CPU time is always recorded, it is not only used for the average frequency
+    u64 *process_cpu_time = cpu_time.lookup(&pid);
+    if (process_cpu_time != 0)
+    {
+        *process_cpu_time += delta;
+    }
+    else
+    {
+        cpu_time.update(&pid, &delta);
+    }
+
+    u32 cpu_id = bpf_get_smp_processor_id();
+    if (cpu_id >= NUM_CPUS)
+    {
+        return;
+    }
+    u64 *prev;
 #pragma clang loop unroll(full)
-    for (int array_index = 0; array_index < CPU_VECTOR_SIZE-1; array_index++)
+    for (int i = 0; i < NUM_COUNTERS; i++)
     {
-        if (array_index == idx)
+        u32 idx = i * NUM_CPUS + cpu_id;
+        u64 val = counters.perf_read(idx);
+        if (((s64)val > 0) || ((s64)val < -256))
         {
-            array[array_index] += value;
-            break;
+            prev = prev_counters.lookup(&idx);
+            if (prev)
+            {
+                process_time->counters[i] += val - *prev;
+            }
+            prev_counters.update(&idx, &val);
         }
     }
 }
@@ -89,23 +307,19 @@ static void safe_array_add(u32 idx, u16 *array, u16 value)
 int sched_switch(switch_args *ctx)
 {
     u64 pid = bpf_get_current_pid_tgid() >> 32;
-#ifdef SET_GROUP_ID
-    u64 cgroup_id = bpf_get_current_cgroup_id();
-#else
-    u64 cgroup_id = 0;
-#endif
-
     u64 time = bpf_ktime_get_ns();
     u64 delta = 0;
-    u32 cpu_id = bpf_get_smp_processor_id();
     pid_time_t new_pid, old_pid;
+    u64 irq_delta = take_irq_time();
+    // the idle task does not keep the CPU busy
+    u64 shared = take_shared_time(time, 1, ctx->next_pid != 0);
 
     // get pid time
     old_pid.pid = ctx->prev_pid;
     u64 *last_time = pid_time.lookup(&old_pid);
     if (last_time != 0)
     {
-        delta = (time - *last_time) / 1000000; /*milisecond*/
+        delta = time - *last_time; /*nanosecond*/
         // return if the process did not use any cpu time yet
         if (delta == 0)
         {
@@ -113,76 +327,156 @@ int sched_switch(switch_args *ctx)
         }
         pid_time.delete(&old_pid);
     }
+    // the interrupts served during the time slice are accounted separately
+    delta = delta > irq_delta ? delta - irq_delta : 0;
 
     new_pid.pid = ctx->next_pid;
     pid_time.lookup_or_try_init(&new_pid, &time);
 
-    u64 cpu_cycles_delta = 0;
-    u64 cpu_instr_delta = 0;
-    u64 cache_miss_delta = 0;
-    u64 *prev;
-
-    u64 val = cpu_cycles.perf_read(CUR_CPU_IDENTIFIER);
-    if (((s64)val > 0) || ((s64)val < -256))
+    // init process time
+    process_time_t *process_time = get_process(pid);
+    if (process_time == 0)
     {
-        prev = prev_cpu_cycles.lookup(&cpu_id);
-        if (prev)
-        {
-            cpu_cycles_delta = val - *prev;
-        }
-        prev_cpu_cycles.update(&cpu_id, &val);
+        return 0;
     }
-    val = cpu_instr.perf_read(CUR_CPU_IDENTIFIER);
-    if (((s64)val > 0) || ((s64)val < -256))
+
+    // update process time
+    account_process(process_time, pid, delta, shared);
+
+    return 0;
+}
+
+int sched_process_fork(fork_args *ctx)
+{
+    // the current task is the parent
+    u64 parent_pid = bpf_get_current_pid_tgid() >> 32;
+    u64 child_pid = ctx->child_pid;
+    parent_pids.update(&child_pid, &parent_pid);
+    return 0;
+}
+
+int sched_process_exec(exec_args *ctx)
+{
+    // the command changes at exec
+    u64 pid = bpf_get_current_pid_tgid() >> 32;
+    process_time_t *process_time = processes.lookup(&pid);
+    if (process_time != 0)
     {
-        prev = prev_cpu_instr.lookup(&cpu_id);
-        if (prev)
-        {
-            cpu_instr_delta = val - *prev;
-        }
-        prev_cpu_instr.update(&cpu_id, &val);
+        bpf_get_current_comm(&process_time->comm, sizeof(process_time->comm));
     }
-    val = cache_miss.perf_read(CUR_CPU_IDENTIFIER);
-    if (((s64)val > 0) || ((s64)val < -256))
+    return 0;
+}
+
+int sched_process_exit(exit_args *ctx)
+{
+    u64 pid_tgid = bpf_get_current_pid_tgid();
+    u64 pid = pid_tgid >> 32;
+    u64 tid = (u32)pid_tgid;
+    u64 time = bpf_ktime_get_ns();
+    u64 delta = 0;
+    pid_time_t old_pid;
+    u64 irq_delta = take_irq_time();
+    u64 shared = take_shared_time(time, 0, 0);
+
+    // the task will not be scheduled again, account the time since it was scheduled and purge its entries
+    old_pid.pid = tid;
+    u64 *last_time = pid_time.lookup(&old_pid);
+    if (last_time != 0)
     {
-        prev = prev_cache_miss.lookup(&cpu_id);
-        if (prev)
-        {
-            cache_miss_delta = val - *prev;
-        }
-        prev_cache_miss.update(&cpu_id, &val);
+        delta = time - *last_time;
+        pid_time.delete(&old_pid);
     }
+    // the interrupts served during the time slice are accounted separately
+    delta = delta > irq_delta ? delta - irq_delta : 0;
+    parent_pids.delete(&tid);
 
-    // init process time
-    struct process_time_t *process_time;
-    process_time = processes.lookup(&pid);
+    process_time_t *process_time = get_process(pid);
     if (process_time == 0)
     {
-        process_time_t new_process = {};
-        new_process.pid = pid;
-        new_process.cgroup_id = cgroup_id;
-        new_process.cpu_cycles = cpu_cycles_delta;
-        new_process.cpu_instr = cpu_instr_delta;
-        new_process.cache_misses = cache_miss_delta;
-        new_process.process_run_time += delta;
-#ifdef CPU_FREQ
-        //FIXME: for certain reason, hyper-v seems to always get a cpu_id that is same as NUM_CPUS and cause stack overrun
-        safe_array_add(cpu_id, new_process.cpu_time, delta);
-#endif        
-        bpf_get_current_comm(&new_process.comm, sizeof(new_process.comm));
-        processes.update(&pid, &new_process);
+        return 0;
     }
-    else
+    account_process(process_time, pid, delta, shared);
+
+    // the thread group leader exits, record the cgroup of the process since /proc/<pid>/cgroup will not exist anymore
+    // and purge its per-CPU time, the time of the process is still in process_run_time
+    if (tid == pid)
+    {
+        process_time->exited = 1;
+        process_time->cgroup_id = get_cgroup_id();
+        cpu_time.delete(&pid);
+    }
+    return 0;
+}
+
+// mark_irq_start records the start time of the interrupt of the given kind, 0 for hard IRQs and 1 for softirqs
+static inline void mark_irq_start(u32 kind)
+{
+    u64 *start = irq_start.lookup(&kind);
+    if (start != 0)
     {
-        // update process time
-        process_time->cpu_cycles += cpu_cycles_delta;
-        process_time->cpu_instr += cpu_instr_delta;
-        process_time->cache_misses += cache_miss_delta;
-        process_time->process_run_time += delta;
-#ifdef CPU_FREQ
-        safe_array_add(cpu_id, process_time->cpu_time, delta);
-#endif        
+        *start = bpf_ktime_get_ns();
     }
+}
+
+// take_irq_duration returns the duration of the interrupt of the given kind, or 0 if its start was missed
+static inline u64 take_irq_duration(u32 kind)
+{
+    u64 *start = irq_start.lookup(&kind);
+    if (start == 0 || *start == 0)
+    {
+        return 0;
+    }
+    u64 delta = bpf_ktime_get_ns() - *start;
+    *start = 0;
+    return delta;
+}
+
+int irq_handler_entry(void *ctx)
+{
+    mark_irq_start(0);
+    return 0;
+}
 
+int irq_handler_exit(void *ctx)
+{
+    u64 delta = take_irq_duration(0);
+    if (delta == 0)
+    {
+        return 0;
+    }
+    add_irq_time(IRQ_TIME_HARDIRQ, delta);
+    // a hard IRQ can interrupt a softirq, its time is not counted twice
+    u32 kind = 1;
+    u64 *softirq_start = irq_start.lookup(&kind);
+    if (softirq_start != 0 && *softirq_start != 0)
+    {
+        *softirq_start += delta;
+    }
+    return 0;
+}
+
+int softirq_entry(softirq_args *ctx)
+{
+    mark_irq_start(1);
+    return 0;
+}
+
+int softirq_exit(softirq_args *ctx)
+{
+    u64 delta = take_irq_duration(1);
+    if (delta == 0)
+    {
+        return 0;
+    }
+    add_irq_time(IRQ_TIME_SOFTIRQ, delta);
+    if (ctx->vec == NET_TX_SOFTIRQ || ctx->vec == NET_RX_SOFTIRQ)
+    {
+        u32 index = IRQ_TIME_NET_SOFTIRQ;
+        u64 *total = irq_time.lookup(&index);
+        if (total != 0)
+        {
+            *total += delta;
+        }
+    }
     return 0;
 }
@@ -0,0 +1,582 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// CO-RE version of bpfassets/perf_event/perf_event.c, it is compiled ahead of time with
+// `make bpf-core-object` and loaded without BCC. The tables must keep the same layout, TestBPFSourcesInSync in
+// pkg/bpfassets/attacher checks that the structs, the maps and the map operations of both programs match.
+
+#include <linux/types.h>
+#include <linux/bpf.h>
+#include <bpf/bpf_helpers.h>
+#include <bpf/bpf_core_read.h>
+
+typedef __u64 u64;
+typedef __s64 s64;
+typedef __u32 u32;
+typedef __u16 u16;
+
+// MAX_COUNTERS must be in sync with attacher.MaxCounters
+#define MAX_COUNTERS 8
+
+// the indexes of irq_time, the network softirqs are also counted in IRQ_TIME_SOFTIRQ
+// the indexes must be in sync with the collector
+#define IRQ_TIME_HARDIRQ 0
+#define IRQ_TIME_SOFTIRQ 1
+#define IRQ_TIME_NET_SOFTIRQ 2
+#define IRQ_TIME_SIZE 3
+
+#define NET_TX_SOFTIRQ 2
+#define NET_RX_SOFTIRQ 3
+
+#define PF_KTHREAD 0x00200000
+
+// only the fields read by the program, they are relocated with the BTF of the running kernel
+struct task_struct
+{
+    unsigned int flags;
+} __attribute__((preserve_access_index));
+
+// set by the loader, replace the SET_GROUP_ID, NUM_CPUS and NUM_COUNTERS defines of the BCC program
+const volatile int set_cgroup_id = 0;
+const volatile u32 num_cpus = 1;
+const volatile u32 num_counters = 0;
+
+typedef struct switch_args
+{
+    u64 pad;
+    char prev_comm[16];
+    int prev_pid;
+    int prev_prio;
+    long long prev_state;
+    char next_comm[16];
+    int next_pid;
+    int next_prio;
+} switch_args;
+
+typedef struct fork_args
+{
+    u64 pad;
+    char parent_comm[16];
+    int parent_pid;
+    char child_comm[16];
+    int child_pid;
+} fork_args;
+
+typedef struct exec_args
+{
+    u64 pad;
+    int filename_loc;
+    int pid;
+    int old_pid;
+} exec_args;
+
+typedef struct exit_args
+{
+    u64 pad;
+    char comm[16];
+    int pid;
+    int prio;
+} exit_args;
+
+typedef struct softirq_args
+{
+    u64 pad;
+    unsigned int vec;
+} softirq_args;
+
+typedef struct process_time_t
+{
+    u64 cgroup_id;
+    u64 pid;
+    // the process that forked this process, its container is the fallback when the process exited before it was resolved
+    u64 parent_pid;
+    u64 process_run_time;
+    u64 counters[MAX_COUNTERS];
+    char comm[16];
+    // set when the process exited, the cgroup ID is the one at exit
+    u64 exited;
+    // set when the process is a kernel thread, e.g. kworker, ksoftirqd or the idle task
+    u64 kernel_thread;
+    // the part of process_run_time when the sibling hyperthread of the CPU was busy, the physical core was shared
+    u64 shared_run_time;
+} process_time_t;
+
+typedef struct pid_time_t
+{
+    int pid;
+} pid_time_t;
+
+// the busy state of each CPU, the CPUs read the entry of their sibling hyperthread
+typedef struct cpu_busy_t
+{
+    // set when the CPU runs a task other than the idle task
+    u64 busy;
+    // the time of the last context switch
+    u64 last_switch;
+    // the time that the CPU was busy until the last context switch
+    u64 busy_time;
+    // the busy time of the sibling hyperthread when the current task was scheduled or last accounted
+    u64 sibling_start;
+} cpu_busy_t;
+
+// processes and pid time
+struct
+{
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __type(key, u64);
+    __type(value, process_time_t);
+    __uint(max_entries, 10240);
+} processes SEC(".maps");
+
+struct
+{
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __type(key, pid_time_t);
+    __type(value, u64);
+    __uint(max_entries, 10240);
+} pid_time SEC(".maps");
+
+// the time in nanoseconds that each process ran on each CPU
+struct
+{
+    __uint(type, BPF_MAP_TYPE_PERCPU_HASH);
+    __type(key, u64);
+    __type(value, u64);
+    __uint(max_entries, 10240);
+} cpu_time SEC(".maps");
+
+// the parent process of the forked tasks, the entries are removed when the task exits
+struct
+{
+    __uint(type, BPF_MAP_TYPE_LRU_HASH);
+    __type(key, u64);
+    __type(value, u64);
+    __uint(max_entries, 10240);
+} parent_pids SEC(".maps");
+
+// the sibling hyperthread of each CPU plus one, 0 if the CPU has no sibling, set by the loader
+// the cpu_siblings and cpu_busy arrays are resized to num_cpus by the loader
+struct
+{
+    __uint(type, BPF_MAP_TYPE_ARRAY);
+    __type(key, u32);
+    __type(value, u32);
+    __uint(max_entries, 1);
+} cpu_siblings SEC(".maps");
+
+// the busy state of each CPU
+struct
+{
+    __uint(type, BPF_MAP_TYPE_ARRAY);
+    __type(key, u32);
+    __type(value, cpu_busy_t);
+    __uint(max_entries, 1);
+} cpu_busy SEC(".maps");
+
+// the time in nanoseconds that each CPU spent in interrupts since it started, indexed by IRQ_TIME_*
+struct
+{
+    __uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+    __type(key, u32);
+    __type(value, u64);
+    __uint(max_entries, IRQ_TIME_SIZE);
+} irq_time SEC(".maps");
+
+// the start time of the hard IRQ (0) and of the softirq (1) that the CPU is serving
+struct
+{
+    __uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+    __type(key, u32);
+    __type(value, u64);
+    __uint(max_entries, 2);
+} irq_start SEC(".maps");
+
+// the interrupt time since the last context switch, it is not charged to the process that was interrupted
+struct
+{
+    __uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+    __type(key, u32);
+    __type(value, u64);
+    __uint(max_entries, 1);
+} irq_since_switch SEC(".maps");
+
+// perf counters, the event of the counter i on the cpu c is at the index i * num_cpus + c
+// the perf and tracking arrays are resized to num_cpus * num_counters by the loader
+struct
+{
+    __uint(type, BPF_MAP_TYPE_PERF_EVENT_ARRAY);
+    __type(key, int);
+    __type(value, u32);
+    __uint(max_entries, 1);
+} counters SEC(".maps");
+
+// tracking counters
+struct
+{
+    __uint(type, BPF_MAP_TYPE_ARRAY);
+    __type(key, u32);
+    __type(value, u64);
+    __uint(max_entries, 1);
+} prev_counters SEC(".maps");
+
+static __always_inline u64 get_cgroup_id()
+{
+    if (set_cgroup_id)
+    {
+        return bpf_get_current_cgroup_id();
+    }
+    return 0;
+}
+
+static __always_inline u64 is_kernel_thread()
+{
+    struct task_struct *task = (struct task_struct *)bpf_get_current_task();
+    return (BPF_CORE_READ(task, flags) & PF_KTHREAD) != 0;
+}
+
+// take_irq_time returns the interrupt time since the last context switch and resets it
+static __always_inline u64 take_irq_time()
+{
+    u32 key = 0;
+    u64 *irq_delta = bpf_map_lookup_elem(&irq_since_switch, &key);
+    if (irq_delta == 0)
+    {
+        return 0;
+    }
+    u64 value = *irq_delta;
+    *irq_delta = 0;
+    return value;
+}
+
+// add_irq_time adds the interrupt time to the CPU and to the time since the last context switch
+static __always_inline void add_irq_time(u32 index, u64 delta)
+{
+    u64 *total = bpf_map_lookup_elem(&irq_time, &index);
+    if (total != 0)
+    {
+        *total += delta;
+    }
+    u32 key = 0;
+    u64 *irq_delta = bpf_map_lookup_elem(&irq_since_switch, &key);
+    if (irq_delta != 0)
+    {
+        *irq_delta += delta;
+    }
+}
+
+// get_process returns the entry of the process, it is created if it does not exist yet
+static __always_inline process_time_t *get_process(u64 pid)
+{
+    process_time_t *process_time = bpf_map_lookup_elem(&processes, &pid);
+    if (process_time != 0)
+    {
+        return process_time;
+    }
+    process_time_t new_process = {};
+    new_process.pid = pid;
+    new_process.cgroup_id = get_cgroup_id();
+    new_process.kernel_thread = is_kernel_thread();
+    u64 *parent_pid = bpf_map_lookup_elem(&parent_pids, &pid);
+    if (parent_pid != 0)
+    {
+        new_process.parent_pid = *parent_pid;
+    }
+    bpf_get_current_comm(&new_process.comm, sizeof(new_process.comm));
+    bpf_map_update_elem(&processes, &pid, &new_process, BPF_NOEXIST);
+    return bpf_map_lookup_elem(&processes, &pid);
+}
+
+// get_sibling_busy_time returns the time that the sibling hyperthread of the CPU was busy until now, 0 if the CPU has no sibling
+static __always_inline u64 get_sibling_busy_time(u32 cpu_id, u64 time)
+{
+    u32 *sibling = bpf_map_lookup_elem(&cpu_siblings, &cpu_id);
+    if (sibling == 0 || *sibling == 0)
+    {
+        return 0;
+    }
+    u32 sibling_id = *sibling - 1;
+    cpu_busy_t *sibling_busy = bpf_map_lookup_elem(&cpu_busy, &sibling_id);
+    if (sibling_busy == 0)
+    {
+        return 0;
+    }
+    u64 busy_time = sibling_busy->busy_time;
+    if (sibling_busy->busy && time > sibling_busy->last_switch)
+    {
+        busy_time += time - sibling_busy->last_switch;
+    }
+    return busy_time;
+}
+
+// take_shared_time returns the time that the sibling hyperthread was busy since the current task was scheduled or last accounted,
+// the CPU was busy all this time so it is the time that the task shared the physical core. The CPU becomes busy if it switches to a task.
+static __always_inline u64 take_shared_time(u64 time, int switched, int next_busy)
+{
+    u32 cpu_id = bpf_get_smp_processor_id();
+    cpu_busy_t *own = bpf_map_lookup_elem(&cpu_busy, &cpu_id);
+    if (own == 0)
+    {
+        return 0;
+    }
+    u64 sibling_busy_time = get_sibling_busy_time(cpu_id, time);
+    u64 shared = 0;
+    if (own->busy && sibling_busy_time > own->sibling_start)
+    {
+        shared = sibling_busy_time - own->sibling_start;
+    }
+    own->sibling_start = sibling_busy_time;
+    if (switched)
+    {
+        if (own->busy && time > own->last_switch)
+        {
+            own->busy_time += time - own->last_switch;
+        }
+        own->last_switch = time;
+        own->busy = next_busy;
+    }
+    return shared;
+}
+
+// account_process adds the time and the counters since the task was scheduled to the process
+static __always_inline void account_process(process_time_t *process_time, u64 pid, u64 delta, u64 shared)
+{
+    process_time->process_run_time += delta;
+    // the interrupts are not in delta, they can be in the shared time
+    process_time->shared_run_time += shared < delta ? shared : delta;
+    // the per-CPU time is always recorded, it is not only used for the average frequency
+    u64 *process_cpu_time = bpf_map_lookup_elem(&cpu_time, &pid);
+    if (process_cpu_time != 0)
+    {
+        *process_cpu_time += delta;
+    }
+    else
+    {
+        bpf_map_update_elem(&cpu_time, &pid, &delta, BPF_NOEXIST);
+    }
+
+    u32 cpu_id = bpf_get_smp_processor_id();
+    if (cpu_id >= num_cpus)
+    {
+        return;
+    }
+    u64 *prev;
+#pragma clang loop unroll(full)
+    for (int i = 0; i < MAX_COUNTERS; i++)
+    {
+        if (i >= num_counters)
+        {
+            break;
+        }
+        u32 idx = i * num_cpus + cpu_id;
+        u64 val = bpf_perf_event_read(&counters, idx);
+        if (((s64)val > 0) || ((s64)val < -256))
+        {
+            prev = bpf_map_lookup_elem(&prev_counters, &idx);
+            if (prev)
+            {
+                process_time->counters[i] += val - *prev;
+            }
+            bpf_map_update_elem(&prev_counters, &idx, &val, BPF_ANY);
+        }
+    }
+}
+
+SEC("tracepoint/sched/sched_switch")
+int sched_switch(switch_args *ctx)
+{
+    u64 pid = bpf_get_current_pid_tgid() >> 32;
+    u64 time = bpf_ktime_get_ns();
+    u64 delta = 0;
+    pid_time_t new_pid = {}, old_pid = {};
+    u64 irq_delta = take_irq_time();
+    // the idle task does not keep the CPU busy
+    u64 shared = take_shared_time(time, 1, ctx->next_pid != 0);
+
+    // get pid time
+    old_pid.pid = ctx->prev_pid;
+    u64 *last_time = bpf_map_lookup_elem(&pid_time, &old_pid);
+    if (last_time != 0)
+    {
+        delta = time - *last_time; /*nanosecond*/
+        // return if the process did not use any cpu time yet
+        if (delta == 0)
+        {
+            return 0;
+        }
+        bpf_map_delete_elem(&pid_time, &old_pid);
+    }
+    // the interrupts served during the time slice are accounted separately
+    delta = delta > irq_delta ? delta - irq_delta : 0;
+
+    new_pid.pid = ctx->next_pid;
+    bpf_map_update_elem(&pid_time, &new_pid, &time, BPF_NOEXIST);
+
+    // init process time
+    process_time_t *process_time = get_process(pid);
+    if (process_time == 0)
+    {
+        return 0;
+    }
+
+    // update process time
+    account_process(process_time, pid, delta, shared);
+
+    return 0;
+}
+
+SEC("tracepoint/sched/sched_process_fork")
+int sched_process_fork(fork_args *ctx)
+{
+    // the current task is the parent
+    u64 parent_pid = bpf_get_current_pid_tgid() >> 32;
+    u64 child_pid = ctx->child_pid;
+    bpf_map_update_elem(&parent_pids, &child_pid, &parent_pid, BPF_ANY);
+    return 0;
+}
+
+SEC("tracepoint/sched/sched_process_exec")
+int sched_process_exec(exec_args *ctx)
+{
+    // the command changes at exec
+    u64 pid = bpf_get_current_pid_tgid() >> 32;
+    process_time_t *process_time = bpf_map_lookup_elem(&processes, &pid);
+    if (process_time != 0)
+    {
+        bpf_get_current_comm(&process_time->comm, sizeof(process_time->comm));
+    }
+    return 0;
+}
+
+SEC("tracepoint/sched/sched_process_exit")
+int sched_process_exit(exit_args *ctx)
+{
+    u64 pid_tgid = bpf_get_current_pid_tgid();
+    u64 pid = pid_tgid >> 32;
+    u64 tid = (u32)pid_tgid;
+    u64 time = bpf_ktime_get_ns();
+    u64 delta = 0;
+    pid_time_t old_pid = {};
+    u64 irq_delta = take_irq_time();
+    u64 shared = take_shared_time(time, 0, 0);
+
+    // the task will not be scheduled again, account the time since it was scheduled and purge its entries
+    old_pid.pid = tid;
+    u64 *last_time = bpf_map_lookup_elem(&pid_time, &old_pid);
+    if (last_time != 0)
+    {
+        delta = time - *last_time;
+        bpf_map_delete_elem(&pid_time, &old_pid);
+    }
+    // the interrupts served during the time slice are accounted separately
+    delta = delta > irq_delta ? delta - irq_delta : 0;
+    bpf_map_delete_elem(&parent_pids, &tid);
+
+    process_time_t *process_time = get_process(pid);
+    if (process_time == 0)
+    {
+        return 0;
+    }
+    account_process(process_time, pid, delta, shared);
+
+    // the thread group leader exits, record the cgroup of the process since /proc/<pid>/cgroup will not exist anymore
+    // and purge its per-CPU time, the time of the process is still in process_run_time
+    if (tid == pid)
+    {
+        process_time->exited = 1;
+        process_time->cgroup_id = get_cgroup_id();
+        bpf_map_delete_elem(&cpu_time, &pid);
+    }
+    return 0;
+}
+
+// mark_irq_start records the start time of the interrupt of the given kind, 0 for hard IRQs and 1 for softirqs
+static __always_inline void mark_irq_start(u32 kind)
+{
+    u64 *start = bpf_map_lookup_elem(&irq_start, &kind);
+    if (start != 0)
+    {
+        *start = bpf_ktime_get_ns();
+    }
+}
+
+// take_irq_duration returns the duration of the interrupt of the given kind, or 0 if its start was missed
+static __always_inline u64 take_irq_duration(u32 kind)
+{
+    u64 *start = bpf_map_lookup_elem(&irq_start, &kind);
+    if (start == 0 || *start == 0)
+    {
+        return 0;
+    }
+    u64 delta = bpf_ktime_get_ns() - *start;
+    *start = 0;
+    return delta;
+}
+
+SEC("tracepoint/irq/irq_handler_entry")
+int irq_handler_entry(void *ctx)
+{
+    mark_irq_start(0);
+    return 0;
+}
+
+SEC("tracepoint/irq/irq_handler_exit")
+int irq_handler_exit(void *ctx)
+{
+    u64 delta = take_irq_duration(0);
+    if (delta == 0)
+    {
+        return 0;
+    }
+    add_irq_time(IRQ_TIME_HARDIRQ, delta);
+    // a hard IRQ can interrupt a softirq, its time is not counted twice
+    u32 kind = 1;
+    u64 *softirq_start = bpf_map_lookup_elem(&irq_start, &kind);
+    if (softirq_start != 0 && *softirq_start != 0)
+    {
+        *softirq_start += delta;
+    }
+    return 0;
+}
+
+SEC("tracepoint/irq/softirq_entry")
+int softirq_entry(softirq_args *ctx)
+{
+    mark_irq_start(1);
+    return 0;
+}
+
+SEC("tracepoint/irq/softirq_exit")
+int softirq_exit(softirq_args *ctx)
+{
+    u64 delta = take_irq_duration(1);
+    if (delta == 0)
+    {
+        return 0;
+    }
+    add_irq_time(IRQ_TIME_SOFTIRQ, delta);
+    if (ctx->vec == NET_TX_SOFTIRQ || ctx->vec == NET_RX_SOFTIRQ)
+    {
+        u32 index = IRQ_TIME_NET_SOFTIRQ;
+        u64 *total = bpf_map_lookup_elem(&irq_time, &index);
+        if (total != 0)
+        {
+            *total += delta;
+        }
+    }
+    return 0;
+}
+
+char _license[] SEC("license") = "GPL";
@@ -17,6 +17,7 @@ limitations under the License.
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"net/http"
@@ -26,6 +27,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/sustainable-computing-io/kepler/pkg/bpfassets/attacher"
 	"github.com/sustainable-computing-io/kepler/pkg/cgroup"
 	collector_metric "github.com/sustainable-computing-io/kepler/pkg/collector/metric"
 	"github.com/sustainable-computing-io/kepler/pkg/config"
@@ -33,6 +35,8 @@ import (
 	"github.com/sustainable-computing-io/kepler/pkg/model"
 	"github.com/sustainable-computing-io/kepler/pkg/power/accelerator"
 	"github.com/sustainable-computing-io/kepler/pkg/power/components"
+	"github.com/sustainable-computing-io/kepler/pkg/power/network"
+	"github.com/sustainable-computing-io/kepler/pkg/training"
 	kversion "github.com/sustainable-computing-io/kepler/pkg/version"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -55,6 +59,21 @@ var (
 	modelServerEndpoint          = flag.String("model-server-endpoint", "", "model server endpoint")
 	enabledEBPFCgroupID          = flag.Bool("enable-cgroup-id", true, "whether enable eBPF to collect cgroup id (must have kernel version >= 4.18 and cGroup v2)")
 	exposeHardwareCounterMetrics = flag.Bool("expose-hardware-counter-metrics", true, "whether expose hardware counter as prometheus metrics")
+	hardwareCounters             = flag.String("hardware-counters", "", "comma-separated hardware events collected per process, e.g. cpu_cycles,cpu_instr,llc_load_misses,branch_misses or raw PMU events as r<hex config> (default cpu_cycles,cpu_instr,cache_miss)")
+	excludedBlockDevices         = flag.String("excluded-block-devices", "", "comma-separated prefixes of the block devices not accounted in the IO stats, an empty value disables the filtering (default loop,dm,nbd,zram)")
+	enableNetworkMetrics         = flag.Bool("enable-network-metrics", true, "whether collect the container network traffic from /proc/<pid>/net/dev")
+	nicEnergyModel               = flag.String("nic-energy-model", "", "per-interface network energy model, e.g. eth=6:1200,default=5:1000 (<interface-prefix>=<nJ per byte>:<nJ per packet>)")
+	bpfBackend                   = flag.String("bpf-backend", "", "how the eBPF program is loaded: core, bcc or auto (default auto, the precompiled CO-RE object with a fallback to bcc)")
+	bpfObjectPath                = flag.String("bpf-object-path", "", "path of the precompiled CO-RE eBPF object (default /var/lib/kepler/bpfassets/perf_event.bpf.o)")
+	idlePowerPolicy              = flag.String("idle-power-policy", "", "how the node idle energy is attributed to the containers: none, evenly, requests (CPU and memory requests) or usage (default usage)")
+	attributionPolicies          = flag.String("attribution-policies", "", "attribution policy of the component energy written as <component>=<policy> separated by semicolons, the components are core, uncore, dram, gpu and other, the policy is evenly, usage, requests or a weighted combination, e.g. uncore=usage;other=usage:0.5,requests:0.5 (default core, dram and gpu by usage, uncore and other evenly)")
+	smtAwareAttribution          = flag.Bool("smt-aware-attribution", false, "whether attribute the core energy by the core time, where the time that sibling hyperthreads shared a physical core is split between them")
+	estimatorType                = flag.String("estimator-type", "", "local estimator of the trained power models: LinearRegressor, TreeEnsemble (XGBoost or LightGBM JSON dump), Polynomial or PiecewiseLinear (default LinearRegressor)")
+	modelRefreshInterval         = flag.Duration("model-refresh-interval", 0, "how often the power models are reloaded from the model server or the initial model location, e.g. 1h (default 0, no refresh)")
+	onlineCalibration            = flag.Bool("enable-online-calibration", false, "whether fit the node component power model on the measured energy (e.g. RAPL) and serve the weights on /calibrated-model for the nodes without measurement")
+	energyReconciliation         = flag.Bool("enable-energy-reconciliation", true, "whether scale the container energy of each component so that the container sum equals the node energy, the rest is exported as the node unattributed energy")
+	exposeEnergyStatMetrics      = flag.Bool("expose-energy-stat-metrics", false, "whether expose the deprecated kepler_node_energy_stat and kepler_pod_energy_stat metrics, replaced by the training data sink")
+	trainingDataSink             = flag.String("training-data-sink", "", "comma-separated sinks of the training data: file (rotating JSON lines or CSV files) and http (JSON lines streamed on /training-data)")
 	cpuProfile                   = flag.String("cpuprofile", "", "dump cpu profile to a file")
 )
 
@@ -66,12 +85,45 @@ func healthProbe(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// modelStatus lists the status of each power model estimator: the loaded model, its missing features and the last load error
+func modelStatus(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(model.GetModelStatuses()); err != nil {
+		klog.Errorf("failed to write the model status: %v", err)
+	}
+}
+
+// calibratedModel serves the weights of the node component model fitted online, in the format of the initial models
+func calibratedModel(w http.ResponseWriter, req *http.Request) {
+	weights, samples := model.GetCalibratedNodeComponentWeights()
+	if samples == 0 {
+		http.Error(w, "the node component model is not calibrated, enable the online calibration on a node with measured energy", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Calibration-Samples", fmt.Sprintf("%d", samples))
+	if err := json.NewEncoder(w).Encode(weights); err != nil {
+		klog.Errorf("failed to write the calibrated model: %v", err)
+	}
+}
+
 func finalizing() {
 	exitCode := 10
 	klog.Infoln(finishingMsg)
 	klog.FlushAndExit(klog.ExitFlushTimeout, exitCode)
 }
 
+// isFlagSet returns if the flag was given on the command line, even with an empty value
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
 func main() {
 	start := time.Now()
 	defer finalizing()
@@ -79,19 +131,15 @@ func main() {
 	flag.Parse()
 
 	klog.Infof("Kepler running on version: %s", kversion.Version)
+	// main returns on these signals to run the deferred shutdown, e.g. flush the training data sinks
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 	if *cpuProfile != "" {
 		f, err := os.Create(*cpuProfile)
 		if err == nil {
 			profErr := pprof.StartCPUProfile(f)
 			if profErr == nil {
-				sigs := make(chan os.Signal, 1)
-				signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
-				go func() {
-					<-sigs
-					fmt.Println("exiting...")
-					pprof.StopCPUProfile()
-					os.Exit(0)
-				}()
+				defer pprof.StopCPUProfile()
 			}
 		}
 	}
@@ -99,16 +147,69 @@ func main() {
 	config.SetEnabledEBPFCgroupID(*enabledEBPFCgroupID)
 	config.SetEnabledHardwareCounterMetrics(*exposeHardwareCounterMetrics)
 	config.SetEnabledGPU(*enableGPU)
+	if *hardwareCounters != "" {
+		config.SetHardwareCounters(*hardwareCounters)
+	}
+	if err := attacher.InitCounters(config.HardwareCounters); err != nil {
+		klog.Fatalf("failed to init the hardware counters: %v", err)
+	}
+	if isFlagSet("excluded-block-devices") {
+		config.SetExcludedBlockDevices(*excludedBlockDevices)
+	}
+	config.SetEnabledNetworkMetrics(*enableNetworkMetrics)
+	config.SetSMTAwareAttribution(*smtAwareAttribution)
+	config.SetOnlineCalibration(*onlineCalibration)
+	config.SetEnergyReconciliation(*energyReconciliation)
+	config.SetExposeEnergyStatMetrics(*exposeEnergyStatMetrics)
+	if *trainingDataSink != "" {
+		config.SetTrainingDataSinks(*trainingDataSink)
+	}
+	if err := training.Init(); err != nil {
+		klog.Fatalf("failed to init the training data sinks: %v", err)
+	}
+	defer training.Close()
+	if *nicEnergyModel != "" {
+		config.SetNICEnergyModel(*nicEnergyModel)
+	}
+	if err := network.InitNICEnergyModel(config.NICEnergyModel); err != nil {
+		klog.Fatalf("failed to parse the NIC energy model: %v", err)
+	}
+
+	if *bpfBackend != "" {
+		config.SetBPFBackend(*bpfBackend)
+	}
+	if *bpfObjectPath != "" {
+		config.SetBPFObjectPath(*bpfObjectPath)
+	}
+	if *estimatorType != "" {
+		config.SetEstimatorType(*estimatorType)
+	}
+	if *idlePowerPolicy != "" {
+		config.SetIdlePowerPolicy(*idlePowerPolicy)
+	}
+	if err := config.SetAttributionPolicies(*attributionPolicies); err != nil {
+		klog.Fatalf("failed to parse the attribution policies: %v", err)
+	}
 
 	cgroup.SetSliceHandler()
 
+	// the models are validated against the collected metrics
+	collector_metric.InitAvailableParamAndMetrics()
+
 	if modelServerEndpoint != nil {
 		klog.Infof("Initializing the Model Server")
 		config.SetModelServerEndpoint(*modelServerEndpoint)
 		model.InitEstimateFunctions(collector_metric.ContainerMetricNames, collector_metric.NodeMetadataNames, collector_metric.NodeMetadataValues)
+		if *modelRefreshInterval > 0 {
+			config.SetModelRefreshInterval(*modelRefreshInterval)
+		}
+		model.StartModelRefresh(config.ModelRefreshInterval, collector_metric.ContainerMetricNames, collector_metric.NodeMetadataNames, collector_metric.NodeMetadataValues)
 	}
-
-	collector_metric.InitAvailableParamAndMetrics()
+	if config.OnlineCalibration {
+		model.InitNodeComponentCalibration(collector_metric.ContainerMetricNames)
+	}
+	// the nodes without power measurement estimate the power from the CPU utilization while no trained power model of the node is loaded
+	components.InitPowerEstimate()
 
 	if *enableGPU {
 		klog.Infof("Initializing the GPU collector")
@@ -131,6 +232,9 @@ func main() {
 
 	http.Handle(*metricsPath, promhttp.Handler())
 	http.HandleFunc("/healthz", healthProbe)
+	http.HandleFunc("/models", modelStatus)
+	http.HandleFunc("/calibrated-model", calibratedModel)
+	http.HandleFunc("/training-data", training.Handler)
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		_, err := w.Write([]byte(`<html>
                         <head><title>Energy Stats Exporter</title></head>
@@ -151,6 +255,12 @@ func main() {
 
 	klog.Infof(startedMsg, time.Since(start))
 	klog.Flush() // force flush to parse the start msg in the e2e test
-	err := <-ch
-	klog.Fatalf("%s", fmt.Sprintf("failed to bind on %s: %v", *address, err))
+	select {
+	case err := <-ch:
+		// klog.Fatalf exits without running the deferred functions
+		training.Close()
+		klog.Fatalf("%s", fmt.Sprintf("failed to bind on %s: %v", *address, err))
+	case sig := <-sigs:
+		klog.Infof("received %v, exiting...", sig)
+	}
 }
@@ -4,6 +4,7 @@ go 1.18
 
 require (
 	github.com/NVIDIA/go-nvml v0.11.6-0
+	github.com/cilium/ebpf v0.9.1
 	github.com/iovisor/gobpf v0.2.0
 	github.com/jszwec/csvutil v1.7.1
 	github.com/onsi/ginkgo/v2 v2.4.0
@@ -0,0 +1,172 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attacher
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/power/acpi"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	CPUCycleLable       = config.CPUCycle
+	CPUInstructionLabel = config.CPUInstruction
+	CacheMissLabel      = config.CacheMiss
+
+	// CoreBackend loads the precompiled CO-RE object with a pure-Go loader
+	CoreBackend = "core"
+	// BCCBackend compiles the program at runtime with BCC
+	BCCBackend = "bcc"
+	// AutoBackend tries the CO-RE backend first and falls back to BCC
+	AutoBackend = "auto"
+)
+
+// Table is a BPF hash table, all backends expose the tables with the same key and leaf layout
+type Table interface {
+	Iter() TableIterator
+	DeleteAll()
+}
+
+// TableIterator iterates over the entries of a Table
+type TableIterator interface {
+	Next() bool
+	Key() []byte
+	Leaf() []byte
+}
+
+type BpfModuleTables struct {
+	// Backend is the backend that loaded the module
+	Backend   string
+	Table     Table
+	TimeTable Table
+	// CPUTimeTable is a per-CPU table, the leaf holds an u64 value per possible CPU
+	CPUTimeTable Table
+	// IRQTimeTable is a per-CPU array with the time spent in interrupts since the program was loaded
+	IRQTimeTable Table
+	close        func()
+}
+
+var (
+	EnableCPUFreq = true
+
+	// optionalTracepoints are attached as <group>:<program>, the usage is still collected without them.
+	// The sched tracepoints track the parent, the command and the exit of the processes, without them the processes
+	// that exit before they are resolved are misattributed. The irq tracepoints account the interrupt time of the CPUs.
+	optionalTracepoints = []string{
+		"sched:sched_process_fork", "sched:sched_process_exec", "sched:sched_process_exit",
+		"irq:irq_handler_entry", "irq:irq_handler_exit", "irq:softirq_entry", "irq:softirq_exit",
+	}
+
+	backendAttachers = map[string]func() (*BpfModuleTables, error){
+		CoreBackend: attachCoreAssets,
+		BCCBackend:  attachBCCAssets,
+	}
+)
+
+// AttachBPFAssets loads the BPF program with the configured backend, in auto mode the BCC backend is the fallback of the CO-RE backend
+func AttachBPFAssets() (*BpfModuleTables, error) {
+	backends := []string{config.BPFBackend}
+	if config.BPFBackend == AutoBackend {
+		backends = []string{CoreBackend, BCCBackend}
+	}
+	var errs []error
+	for _, backend := range backends {
+		attach, exists := backendAttachers[backend]
+		if !exists {
+			return nil, fmt.Errorf("unknown bpf backend %q", backend)
+		}
+		m, err := attach()
+		if err == nil {
+			m.Backend = backend
+			klog.Infof("Successfully load eBPF module with the %s backend", backend)
+			return m, nil
+		}
+		klog.Infof("failed to load eBPF module with the %s backend: %v", backend, err)
+		errs = append(errs, fmt.Errorf("%s: %v", backend, err))
+	}
+	return nil, fmt.Errorf("failed to load eBPF module: %v", errs)
+}
+
+// splitTracepoint returns the group and the name of a tracepoint written as <group>:<name>
+func splitTracepoint(tracepoint string) (group, name string) {
+	if i := strings.IndexByte(tracepoint, ':'); i >= 0 {
+		return tracepoint[:i], tracepoint[i+1:]
+	}
+	return "", tracepoint
+}
+
+// getCPUSiblings maps each CPU to the other hardware thread of its physical core, the CPUs without a sibling are not in the map.
+// The program tracks a single sibling, on cores with more than two threads the first other thread is used.
+func getCPUSiblings() map[uint32]uint32 {
+	siblings := map[uint32]uint32{}
+	topology := acpi.ReadCPUTopology(acpi.CPUPathDir, acpi.NodePathDir)
+	for cpu, threads := range topology.ThreadSiblings {
+		for _, thread := range threads {
+			if thread != cpu {
+				siblings[uint32(cpu)] = uint32(thread)
+				break
+			}
+		}
+	}
+	return siblings
+}
+
+// setCPUSiblings stores the sibling of each CPU plus one in the cpu_siblings array with put, 0 is left for the CPUs without sibling
+func setCPUSiblings(siblings map[uint32]uint32, numCPUs int, put func(cpu, sibling uint32) error) error {
+	for cpu, sibling := range siblings {
+		if int(cpu) >= numCPUs || int(sibling) >= numCPUs {
+			continue
+		}
+		if err := put(cpu, sibling+1); err != nil {
+			return fmt.Errorf("failed to set the sibling of cpu %d: %v", cpu, err)
+		}
+	}
+	return nil
+}
+
+func DetachBPFModules(bpfModules *BpfModuleTables) {
+	if bpfModules.close != nil {
+		bpfModules.close()
+	}
+}
+
+// disableCounter marks the counter as not collected, e.g. some hypervisors don't expose perf counters
+func disableCounter(name string) {
+	counter := Counters[name]
+	counter.enabled = false
+	Counters[name] = counter
+}
+
+func GetEnabledCounters() []string {
+	var metrics []string
+	klog.V(5).Infof("hardeware counter metr %t", config.ExposeHardwareCounterMetrics)
+	if !config.ExposeHardwareCounterMetrics {
+		klog.V(5).Info("hardeware counter metrics not enabled")
+		return metrics
+	}
+
+	for _, metric := range CounterNames {
+		if Counters[metric].enabled {
+			metrics = append(metrics, metric)
+		}
+	}
+	return metrics
+}
@@ -21,10 +21,8 @@ package attacher
 
 import (
 	"fmt"
-	"runtime"
 	"strconv"
-
-	"golang.org/x/sys/unix"
+	"unsafe"
 
 	assets "github.com/sustainable-computing-io/kepler/pkg/bpfassets"
 	"github.com/sustainable-computing-io/kepler/pkg/config"
@@ -34,122 +32,118 @@ import (
 	"k8s.io/klog/v2"
 )
 
-type perfCounter struct {
-	evType   int
-	evConfig int
-	enabled  bool
+// bccTable adapts the BCC table to the Table interface
+type bccTable struct {
+	*bpf.Table
 }
 
-type BpfModuleTables struct {
-	Module    *bpf.Module
-	Table     *bpf.Table
-	TimeTable *bpf.Table
+func (t bccTable) Iter() TableIterator {
+	return t.Table.Iter()
 }
 
-const (
-	CPUCycleLable       = config.CPUCycle
-	CPUInstructionLabel = config.CPUInstruction
-	CacheMissLabel      = config.CacheMiss
-)
-
-var (
-	Counters = map[string]perfCounter{
-		CPUCycleLable:       {unix.PERF_TYPE_HARDWARE, unix.PERF_COUNT_HW_CPU_CYCLES, true},
-		CPUInstructionLabel: {unix.PERF_TYPE_HARDWARE, unix.PERF_COUNT_HW_INSTRUCTIONS, true},
-		CacheMissLabel:      {unix.PERF_TYPE_HARDWARE, unix.PERF_COUNT_HW_CACHE_MISSES, true},
+func (t bccTable) DeleteAll() {
+	if err := t.Table.DeleteAll(); err != nil {
+		klog.V(5).Infof("failed to delete the table entries: %v", err)
 	}
-	EnableCPUFreq = true
-)
+}
 
-func loadModule(objProg []byte, options []string) (m *bpf.Module, err error) {
+func loadModule(objProg []byte, options []string, numCPUs int) (m *bpf.Module, err error) {
+	module := bpf.NewModule(string(objProg), options)
+	if module == nil {
+		return nil, fmt.Errorf("failed to compile the bpf program")
+	}
+	// the module is closed on every failure, the caller can fall back to CO-RE
 	defer func() {
 		if r := recover(); r != nil {
-			err = fmt.Errorf("failed to attach the bpf program: %v", err)
+			err = fmt.Errorf("failed to attach the bpf program: %v", r)
 			klog.Infoln(err)
 		}
+		if err != nil {
+			module.Close()
+			m = nil
+		}
 	}()
-	m = bpf.NewModule(string(objProg), options)
 	// TODO make all entrypoints yaml-declarable
-	sched_switch, err := m.LoadTracepoint("sched_switch")
+	sched_switch, err := module.LoadTracepoint("sched_switch")
 	if err != nil {
 		return nil, fmt.Errorf("failed to load sched_switch: %s", err)
 	}
-	err = m.AttachTracepoint("sched:sched_switch", sched_switch)
+	err = module.AttachTracepoint("sched:sched_switch", sched_switch)
 	if err != nil {
 		return nil, fmt.Errorf("failed to attach sched_switch: %s", err)
 	}
-
-	for arrayName, counter := range Counters {
-		t := bpf.NewTable(m.TableId(arrayName), m)
-		if t == nil {
-			return nil, fmt.Errorf("failed to find perf array: %s", arrayName)
+	for _, tracepoint := range optionalTracepoints {
+		_, name := splitTracepoint(tracepoint)
+		fd, tpErr := module.LoadTracepoint(name)
+		if tpErr == nil {
+			tpErr = module.AttachTracepoint(tracepoint, fd)
 		}
-		perfErr := openPerfEvent(t, counter.evType, counter.evConfig)
+		if tpErr != nil {
+			klog.Infof("failed to attach %s: %v\n", tracepoint, tpErr)
+		}
+	}
+
+	t := bpf.NewTable(module.TableId("counters"), module)
+	if t == nil {
+		return nil, fmt.Errorf("failed to find perf array: counters")
+	}
+	for i, name := range CounterNames {
+		counter := Counters[name]
+		perfErr := openPerfEvent(t, i*numCPUs, counter.evType, counter.evConfig)
 		if perfErr != nil {
 			// some hypervisors don't expose perf counters
-			klog.Infof("failed to attach perf event %s: %v\n", arrayName, perfErr)
-			counter.enabled = false
+			klog.Infof("failed to attach perf event %s: %v\n", name, perfErr)
+			disableCounter(name)
 		}
 	}
-	return m, err
+	return module, nil
 }
 
-func AttachBPFAssets() (*BpfModuleTables, error) {
-	bpfModules := &BpfModuleTables{}
+func attachBCCAssets() (*BpfModuleTables, error) {
 	program := assets.Program
 	objProg, err := assets.Asset(program)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get program %q: %v", program, err)
 	}
+	numCPUs, err := getNumCPUs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the number of cpus: %v", err)
+	}
 	options := []string{
-		"-DNUM_CPUS=" + strconv.Itoa(runtime.NumCPU()),
-		"-DCPU_FREQ",
+		"-DNUM_CPUS=" + strconv.Itoa(numCPUs),
+		"-DNUM_COUNTERS=" + strconv.Itoa(len(CounterNames)),
 	}
 	if config.EnabledEBPFCgroupID {
 		options = append(options, "-DSET_GROUP_ID")
 	}
-	m, err := loadModule(objProg, options)
+	m, err := loadModule(objProg, options, numCPUs)
 	if err != nil {
-		klog.Warningf("failed to attach perf module with options %v: %v, Hardware counter related metrics does not exist\n", options, err)
-		options = []string{"-DNUM_CPUS=" + strconv.Itoa(runtime.NumCPU())}
-		EnableCPUFreq = false
-		m, err = loadModule(objProg, options)
-		if err != nil {
-			klog.Infof("failed to attach perf module with options %v: %v, not able to load eBPF modules\n", options, err)
-			// at this time, there is not much we can do with the eBPF module
-			return nil, err
-		}
+		klog.Infof("failed to attach perf module with options %v: %v, not able to load eBPF modules\n", options, err)
+		// at this time, there is not much we can do with the eBPF module
+		return nil, err
 	}
 
-	table := bpf.NewTable(m.TableId("processes"), m)
-	timeTable := bpf.NewTable(m.TableId("pid_time"), m)
+	siblingTable := bpf.NewTable(m.TableId("cpu_siblings"), m)
+	err = setCPUSiblings(getCPUSiblings(), numCPUs, func(cpu, sibling uint32) error {
+		return siblingTable.SetP(unsafe.Pointer(&cpu), unsafe.Pointer(&sibling))
+	})
+	if err != nil {
+		// without the siblings no time is accounted as shared
+		klog.Infof("failed to set the cpu siblings: %v\n", err)
+	}
 
-	bpfModules.Module = m
-	bpfModules.Table = table
-	bpfModules.TimeTable = timeTable
+	bpfModules := &BpfModuleTables{
+		Table:        bccTable{bpf.NewTable(m.TableId("processes"), m)},
+		TimeTable:    bccTable{bpf.NewTable(m.TableId("pid_time"), m)},
+		CPUTimeTable: bccTable{bpf.NewTable(m.TableId("cpu_time"), m)},
+		IRQTimeTable: bccTable{bpf.NewTable(m.TableId("irq_time"), m)},
+		close: func() {
+			closePerfEvent()
+			m.Close()
+		},
+	}
 
 	klog.Infof("Successfully load eBPF module with option: %s", options)
 
 	return bpfModules, nil
 }
-
-func DetachBPFModules(bpfModules *BpfModuleTables) {
-	closePerfEvent()
-	bpfModules.Module.Close()
-}
-
-func GetEnabledCounters() []string {
-	var metrics []string
-	klog.V(5).Infof("hardeware counter metr %t", config.ExposeHardwareCounterMetrics)
-	if !config.ExposeHardwareCounterMetrics {
-		klog.V(5).Info("hardeware counter metrics not enabled")
-		return metrics
-	}
-
-	for metric, counter := range Counters {
-		if counter.enabled {
-			metrics = append(metrics, metric)
-		}
-	}
-	return metrics
-}
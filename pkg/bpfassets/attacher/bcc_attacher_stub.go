@@ -23,55 +23,6 @@ import (
 	"fmt"
 )
 
-const (
-	CPUCycleLable       = "cpu_cycles"
-	CPUInstructionLabel = "cpu_instr"
-	CacheMissLabel      = "cache_miss"
-)
-
-type perfCounter struct{}
-
-type ModuleStub struct{}
-
-type Table struct {
-}
-type TableIterator struct {
-	leaf []byte
-}
-
-func (table *Table) Iter() *TableIterator {
-	return &TableIterator{}
-}
-
-func (it *TableIterator) Next() bool {
-	return false
-}
-
-func (it *TableIterator) Leaf() []byte {
-	return it.leaf
-}
-
-func (table *Table) DeleteAll() {
-}
-
-type BpfModuleTables struct {
-	Module    ModuleStub
-	Table     *Table
-	TimeTable *Table
-}
-
-var (
-	Counters      = map[string]perfCounter{}
-	EnableCPUFreq = false
-)
-
-func AttachBPFAssets() (*BpfModuleTables, error) {
+func attachBCCAssets() (*BpfModuleTables, error) {
 	return nil, fmt.Errorf("no bcc build tag")
 }
-
-func DetachBPFModules(bpfModules *BpfModuleTables) {
-}
-
-func GetEnabledCounters() []string {
-	return []string{}
-}
@@ -50,8 +50,9 @@ func init() {
 	byteOrder = bpf.GetHostByteOrder()
 }
 
-func openPerfEvent(table *bpf.Table, typ, config int) error {
-	perfKey := fmt.Sprintf("%d:%d", typ, config)
+// openPerfEvent opens the event on each online cpu, the event of the cpu c is stored at the index base + c of the table
+func openPerfEvent(table *bpf.Table, base, typ, config int) error {
+	perfKey := fmt.Sprintf("%d:%d:%d", base, typ, config)
 	if _, ok := perfEvents[perfKey]; ok {
 		return nil
 	}
@@ -76,7 +77,7 @@ func openPerfEvent(table *bpf.Table, typ, config int) error {
 		}
 		key := make([]byte, keySize)
 		leaf := make([]byte, leafSize)
-		byteOrder.PutUint32(key, uint32(i))
+		byteOrder.PutUint32(key, uint32(base+int(i)))
 		byteOrder.PutUint32(leaf, uint32(fd))
 		keyP := unsafe.Pointer(&key[0])
 		leafP := unsafe.Pointer(&leaf[0])
@@ -0,0 +1,117 @@
+package attacher
+
+import (
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/sustainable-computing-io/kepler/pkg/bpfassets"
+)
+
+// the BCC program is compiled at runtime and the CO-RE program ahead of time, the CO-RE program is a port of the BCC
+// program and the checks below catch the changes made to only one of them
+const (
+	bccSource  = "../../../bpfassets/perf_event/perf_event.c"
+	coreSource = "../../../bpfassets/perf_event_core/perf_event.bpf.c"
+)
+
+var (
+	defineRegex   = regexp.MustCompile(`(?m)^#define (\w+) (.+)$`)
+	typedefRegex  = regexp.MustCompile(`(?ms)^typedef struct (\w+)\n\{\n.*?^\}\s*(\w+);`)
+	functionRegex = regexp.MustCompile(`(?m)^(?:static (?:__always_)?inline )?[\w ]+?\*?(\w+)\([^;\n]*\)\n\{\n`)
+	bccMapRegex   = regexp.MustCompile(`(?m)^BPF_(?:HASH|PERCPU_HASH|PERCPU_ARRAY|PERF_ARRAY|ARRAY)\((\w+)|^BPF_TABLE\("\w+", \w+, \w+, (\w+)`)
+	coreMapRegex  = regexp.MustCompile(`(?m)^\} (\w+) SEC\("\.maps"\);`)
+	bccOpRegex    = regexp.MustCompile(`(\w+)\.(lookup|update|delete|lookup_or_try_init|perf_read)\(`)
+	coreOpRegex   = regexp.MustCompile(`bpf_(?:map_(lookup|update|delete)_elem|(perf_event_read))\(&(\w+)`)
+	spaceRegex    = regexp.MustCompile(`\s+`)
+)
+
+func readSource(t *testing.T, path string) string {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", path, err)
+	}
+	return string(content)
+}
+
+// defines returns the value of the macros, the values set by the BCC loader are not defined in the CO-RE program
+func defines(source string) map[string]string {
+	values := map[string]string{}
+	for _, match := range defineRegex.FindAllStringSubmatch(source, -1) {
+		if match[1] == "NUM_CPUS" || match[1] == "NUM_COUNTERS" {
+			continue
+		}
+		values[match[1]] = match[2]
+	}
+	return values
+}
+
+func typedefs(source string) map[string]string {
+	types := map[string]string{}
+	for _, match := range typedefRegex.FindAllStringSubmatch(source, -1) {
+		types[match[2]] = spaceRegex.ReplaceAllString(match[0], " ")
+	}
+	return types
+}
+
+// mapOperations returns the sorted map operations of each function, an update that only inserts is an update
+func mapOperations(source string, bcc bool) map[string][]string {
+	operations := map[string][]string{}
+	locs := functionRegex.FindAllStringSubmatchIndex(source, -1)
+	for _, loc := range locs {
+		name := source[loc[2]:loc[3]]
+		body := source[loc[1]:]
+		body = body[:strings.Index(body, "\n}\n")]
+		ops := []string{}
+		if bcc {
+			for _, match := range bccOpRegex.FindAllStringSubmatch(body, -1) {
+				op := match[2]
+				if op == "lookup_or_try_init" {
+					op = "update"
+				}
+				ops = append(ops, match[1]+"."+op)
+			}
+		} else {
+			for _, match := range coreOpRegex.FindAllStringSubmatch(body, -1) {
+				ops = append(ops, match[3]+"."+strings.Replace(match[1]+match[2], "perf_event_read", "perf_read", 1))
+			}
+		}
+		sort.Strings(ops)
+		operations[name] = ops
+	}
+	return operations
+}
+
+func TestBPFSourcesInSync(t *testing.T) {
+	g := NewWithT(t)
+	bcc := readSource(t, bccSource)
+	core := readSource(t, coreSource)
+
+	coreDefines := defines(core)
+	for name, value := range defines(bcc) {
+		g.Expect(coreDefines).To(HaveKeyWithValue(name, value), "#define %s", name)
+	}
+	g.Expect(typedefs(core)).To(Equal(typedefs(bcc)))
+
+	var bccMaps, coreMaps []string
+	for _, match := range bccMapRegex.FindAllStringSubmatch(bcc, -1) {
+		bccMaps = append(bccMaps, match[1]+match[2])
+	}
+	for _, match := range coreMapRegex.FindAllStringSubmatch(core, -1) {
+		coreMaps = append(coreMaps, match[1])
+	}
+	g.Expect(coreMaps).To(ConsistOf(bccMaps))
+
+	bccOps := mapOperations(bcc, true)
+	g.Expect(bccOps).To(HaveKey("sched_switch"))
+	g.Expect(mapOperations(core, false)).To(Equal(bccOps))
+
+	// the BCC program is embedded with go-bindata, run `make genbpfassets` after changing it
+	asset, err := bpfassets.Asset(bpfassets.Program)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(asset)).To(Equal(bcc), "the BCC program is not in sync with its bindata")
+}
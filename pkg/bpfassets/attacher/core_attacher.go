@@ -0,0 +1,267 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attacher
+
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	"github.com/iovisor/gobpf/pkg/cpuonline"
+	"golang.org/x/sys/unix"
+
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	coreProgramName = "sched_switch"
+)
+
+// coreMap is the part of *ebpf.Map used by coreTable
+type coreMap interface {
+	NextKeyBytes(key interface{}) ([]byte, error)
+	LookupBytes(key interface{}) ([]byte, error)
+	Delete(key interface{}) error
+}
+
+// coreTable adapts the map of the CO-RE object to the Table interface
+type coreTable struct {
+	m coreMap
+}
+
+// coreTableIterator looks up the raw leaf of each key, the leaf of a per-CPU map holds the value of each possible CPU
+type coreTableIterator struct {
+	m    coreMap
+	key  []byte
+	leaf []byte
+}
+
+func (t coreTable) Iter() TableIterator {
+	return &coreTableIterator{m: t.m}
+}
+
+func (it *coreTableIterator) Next() bool {
+	for {
+		var prevKey interface{}
+		if it.key != nil {
+			prevKey = it.key
+		}
+		key, err := it.m.NextKeyBytes(prevKey)
+		if err != nil || key == nil {
+			return false
+		}
+		it.key = key
+		leaf, err := it.m.LookupBytes(key)
+		if err != nil {
+			return false
+		}
+		// the entry was deleted in the meantime
+		if leaf == nil {
+			continue
+		}
+		it.leaf = leaf
+		return true
+	}
+}
+
+func (it *coreTableIterator) Key() []byte {
+	return it.key
+}
+
+func (it *coreTableIterator) Leaf() []byte {
+	return it.leaf
+}
+
+// DeleteAll collects the keys before deleting them, deleting while iterating restarts the iteration
+func (t coreTable) DeleteAll() {
+	var keys [][]byte
+	for it := t.Iter(); it.Next(); {
+		keys = append(keys, it.Key())
+	}
+	for _, key := range keys {
+		if err := t.m.Delete(key); err != nil {
+			klog.V(5).Infof("failed to delete the table entry: %v", err)
+		}
+	}
+}
+
+// loadCoreCollection loads the CO-RE object
+func loadCoreCollection(spec *ebpf.CollectionSpec, numCPUs int) (*ebpf.Collection, error) {
+	spec, err := prepareCoreSpec(spec, numCPUs)
+	if err != nil {
+		return nil, err
+	}
+	return ebpf.NewCollection(spec)
+}
+
+// prepareCoreSpec returns a copy of the spec whose counter arrays are resized to a slot per counter and possible CPU,
+// whose per-CPU arrays are resized to a slot per possible CPU and whose loader constants are set
+func prepareCoreSpec(spec *ebpf.CollectionSpec, numCPUs int) (*ebpf.CollectionSpec, error) {
+	spec = spec.Copy()
+	for _, mapName := range []string{"counters", "prev_counters"} {
+		if m, exists := spec.Maps[mapName]; exists {
+			m.MaxEntries = uint32(numCPUs * len(CounterNames))
+		}
+	}
+	for _, mapName := range []string{"cpu_siblings", "cpu_busy"} {
+		if m, exists := spec.Maps[mapName]; exists {
+			m.MaxEntries = uint32(numCPUs)
+		}
+	}
+	consts := map[string]interface{}{
+		"set_cgroup_id": boolToInt32(config.EnabledEBPFCgroupID),
+		"num_cpus":      uint32(numCPUs),
+		"num_counters":  uint32(len(CounterNames)),
+	}
+	if err := spec.RewriteConstants(consts); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+func attachCoreAssets() (*BpfModuleTables, error) {
+	spec, err := ebpf.LoadCollectionSpec(config.BPFObjectPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the CO-RE object %q: %v", config.BPFObjectPath, err)
+	}
+	numCPUs, err := getNumCPUs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the number of cpus: %v", err)
+	}
+
+	coll, err := loadCoreCollection(spec, numCPUs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the CO-RE object: %v", err)
+	}
+
+	if siblingArray := coll.Maps["cpu_siblings"]; siblingArray != nil {
+		err = setCPUSiblings(getCPUSiblings(), numCPUs, func(cpu, sibling uint32) error {
+			return siblingArray.Put(cpu, sibling)
+		})
+		if err != nil {
+			// without the siblings no time is accounted as shared
+			klog.Infof("failed to set the cpu siblings: %v\n", err)
+		}
+	}
+
+	prog := coll.Programs[coreProgramName]
+	if prog == nil {
+		coll.Close()
+		return nil, fmt.Errorf("failed to find program %s", coreProgramName)
+	}
+	tp, err := link.Tracepoint("sched", "sched_switch", prog, nil)
+	if err != nil {
+		coll.Close()
+		return nil, fmt.Errorf("failed to attach sched_switch: %v", err)
+	}
+	links := []link.Link{tp}
+	for _, tracepoint := range optionalTracepoints {
+		group, name := splitTracepoint(tracepoint)
+		optionalProg := coll.Programs[name]
+		if optionalProg == nil {
+			klog.Infof("failed to find program %s\n", name)
+			continue
+		}
+		l, tpErr := link.Tracepoint(group, name, optionalProg, nil)
+		if tpErr != nil {
+			klog.Infof("failed to attach %s: %v\n", tracepoint, tpErr)
+			continue
+		}
+		links = append(links, l)
+	}
+	closeLinks := func() {
+		for _, l := range links {
+			l.Close()
+		}
+	}
+
+	perfArray := coll.Maps["counters"]
+	if perfArray == nil {
+		closeLinks()
+		coll.Close()
+		return nil, fmt.Errorf("failed to find perf array: counters")
+	}
+	var perfFds []int
+	for i, name := range CounterNames {
+		counter := Counters[name]
+		fds, perfErr := openCorePerfEvent(perfArray, i*numCPUs, counter.evType, counter.evConfig)
+		perfFds = append(perfFds, fds...)
+		if perfErr != nil {
+			// some hypervisors don't expose perf counters
+			klog.Infof("failed to attach perf event %s: %v\n", name, perfErr)
+			disableCounter(name)
+		}
+	}
+	bpfModules := &BpfModuleTables{
+		Table:        coreTable{coll.Maps["processes"]},
+		TimeTable:    coreTable{coll.Maps["pid_time"]},
+		CPUTimeTable: coreTable{coll.Maps["cpu_time"]},
+		IRQTimeTable: coreTable{coll.Maps["irq_time"]},
+		close: func() {
+			closeLinks()
+			closePerfFds(perfFds)
+			coll.Close()
+		},
+	}
+
+	klog.Infof("Successfully load CO-RE eBPF object %s", config.BPFObjectPath)
+
+	return bpfModules, nil
+}
+
+// openCorePerfEvent opens the counter on each online CPU, the file descriptor of the cpu c is stored at the index base + c of the perf array
+func openCorePerfEvent(perfArray *ebpf.Map, base, evType, evConfig int) ([]int, error) {
+	cpus, err := cpuonline.Get()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the online cpus: %v", err)
+	}
+	attr := unix.PerfEventAttr{
+		Type:   uint32(evType),
+		Size:   uint32(unsafe.Sizeof(unix.PerfEventAttr{})),
+		Config: uint64(evConfig),
+	}
+	var fds []int
+	for _, cpu := range cpus {
+		fd, err := unix.PerfEventOpen(&attr, -1, int(cpu), -1, unix.PERF_FLAG_FD_CLOEXEC)
+		if err != nil {
+			closePerfFds(fds)
+			return nil, fmt.Errorf("failed to open perf event on cpu %d: %v", cpu, err)
+		}
+		fds = append(fds, fd)
+		if err := perfArray.Put(uint32(base+int(cpu)), uint32(fd)); err != nil {
+			closePerfFds(fds)
+			return nil, fmt.Errorf("failed to store perf event of cpu %d: %v", cpu, err)
+		}
+	}
+	return fds, nil
+}
+
+func closePerfFds(fds []int) {
+	for _, fd := range fds {
+		unix.Close(fd)
+	}
+}
+
+func boolToInt32(value bool) int32 {
+	if value {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,177 @@
+package attacher
+
+import (
+	"errors"
+	"sort"
+	"testing"
+	"unsafe"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/btf"
+	. "github.com/onsi/gomega"
+
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+)
+
+// fakeCoreMap behaves like a BPF hash map, the next key of a missing key is the first key
+type fakeCoreMap struct {
+	entries map[string][]byte
+	// onLookup is called before each lookup, e.g. to delete an entry during the iteration
+	onLookup func(key string)
+	nextErr  error
+}
+
+func (m *fakeCoreMap) keys() []string {
+	var keys []string
+	for key := range m.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (m *fakeCoreMap) NextKeyBytes(key interface{}) ([]byte, error) {
+	if m.nextErr != nil {
+		return nil, m.nextErr
+	}
+	keys := m.keys()
+	next := 0
+	if key != nil {
+		prev := string(key.([]byte))
+		if _, exists := m.entries[prev]; exists {
+			next = sort.SearchStrings(keys, prev) + 1
+		}
+	}
+	if next >= len(keys) {
+		return nil, nil
+	}
+	return []byte(keys[next]), nil
+}
+
+func (m *fakeCoreMap) LookupBytes(key interface{}) ([]byte, error) {
+	if m.onLookup != nil {
+		m.onLookup(string(key.([]byte)))
+	}
+	return m.entries[string(key.([]byte))], nil
+}
+
+func (m *fakeCoreMap) Delete(key interface{}) error {
+	delete(m.entries, string(key.([]byte)))
+	return nil
+}
+
+func collectTable(table Table) map[string]string {
+	entries := map[string]string{}
+	for it := table.Iter(); it.Next(); {
+		entries[string(it.Key())] = string(it.Leaf())
+	}
+	return entries
+}
+
+func TestCoreTable(t *testing.T) {
+	g := NewWithT(t)
+
+	m := &fakeCoreMap{entries: map[string][]byte{"a": []byte("1"), "b": []byte("2"), "c": []byte("3")}}
+	table := coreTable{m}
+	g.Expect(collectTable(table)).To(Equal(map[string]string{"a": "1", "b": "2", "c": "3"}))
+
+	// an entry deleted between the key and the leaf lookups is skipped
+	m.onLookup = func(key string) {
+		if key == "b" {
+			delete(m.entries, "b")
+		}
+	}
+	g.Expect(collectTable(table)).To(Equal(map[string]string{"a": "1", "c": "3"}))
+	m.onLookup = nil
+
+	m.nextErr = errors.New("failed")
+	g.Expect(collectTable(table)).To(BeEmpty())
+	m.nextErr = nil
+
+	table.DeleteAll()
+	g.Expect(m.entries).To(BeEmpty())
+	g.Expect(collectTable(table)).To(BeEmpty())
+	// deleting an empty table is a no-op
+	table.DeleteAll()
+}
+
+func TestPrepareCoreSpec(t *testing.T) {
+	g := NewWithT(t)
+
+	defer func(enabled bool) { config.EnabledEBPFCgroupID = enabled }(config.EnabledEBPFCgroupID)
+	config.EnabledEBPFCgroupID = true
+
+	rodataVar := func(name string, offset uint32) btf.VarSecinfo {
+		return btf.VarSecinfo{Type: &btf.Var{Name: name}, Offset: offset, Size: 4}
+	}
+	spec := &ebpf.CollectionSpec{
+		Maps: map[string]*ebpf.MapSpec{
+			"counters":      {Name: "counters", Type: ebpf.PerfEventArray, MaxEntries: 1},
+			"prev_counters": {Name: "prev_counters", Type: ebpf.Array, MaxEntries: 1},
+			"processes":     {Name: "processes", Type: ebpf.Hash, MaxEntries: 10240},
+			"cpu_siblings":  {Name: "cpu_siblings", Type: ebpf.Array, MaxEntries: 1},
+			"cpu_busy":      {Name: "cpu_busy", Type: ebpf.Array, MaxEntries: 1},
+			".rodata": {
+				Name:       ".rodata",
+				Type:       ebpf.Array,
+				KeySize:    4,
+				ValueSize:  12,
+				MaxEntries: 1,
+				Value: &btf.Datasec{Name: ".rodata", Size: 12, Vars: []btf.VarSecinfo{
+					rodataVar("set_cgroup_id", 0), rodataVar("num_cpus", 4), rodataVar("num_counters", 8),
+				}},
+				Contents: []ebpf.MapKV{{Key: uint32(0), Value: make([]byte, 12)}},
+			},
+		},
+	}
+
+	prepared, err := prepareCoreSpec(spec, 6)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(prepared.Maps["counters"].MaxEntries).To(Equal(uint32(6 * len(CounterNames))))
+	g.Expect(prepared.Maps["prev_counters"].MaxEntries).To(Equal(uint32(6 * len(CounterNames))))
+	g.Expect(prepared.Maps["processes"].MaxEntries).To(Equal(uint32(10240)))
+	g.Expect(prepared.Maps["cpu_siblings"].MaxEntries).To(Equal(uint32(6)))
+	g.Expect(prepared.Maps["cpu_busy"].MaxEntries).To(Equal(uint32(6)))
+	rodata := prepared.Maps[".rodata"].Contents[0].Value.([]byte)
+	g.Expect(nativeUint32(rodata[0:])).To(Equal(uint32(1)))
+	g.Expect(nativeUint32(rodata[4:])).To(Equal(uint32(6)))
+	g.Expect(nativeUint32(rodata[8:])).To(Equal(uint32(len(CounterNames))))
+
+	// the spec loaded from the object is not modified
+	g.Expect(spec.Maps["counters"].MaxEntries).To(Equal(uint32(1)))
+	g.Expect(spec.Maps[".rodata"].Contents[0].Value).To(Equal(make([]byte, 12)))
+
+	config.EnabledEBPFCgroupID = false
+	prepared, err = prepareCoreSpec(spec, 2)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(prepared.Maps["counters"].MaxEntries).To(Equal(uint32(2 * len(CounterNames))))
+	g.Expect(nativeUint32(prepared.Maps[".rodata"].Contents[0].Value.([]byte)[0:])).To(Equal(uint32(0)))
+
+	// an object without the loader constants is rejected
+	delete(spec.Maps, ".rodata")
+	_, err = prepareCoreSpec(spec, 2)
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestSetCPUSiblings(t *testing.T) {
+	g := NewWithT(t)
+
+	stored := map[uint32]uint32{}
+	put := func(cpu, sibling uint32) error {
+		stored[cpu] = sibling
+		return nil
+	}
+	// the siblings of the CPUs beyond the arrays are skipped
+	err := setCPUSiblings(map[uint32]uint32{0: 2, 2: 0, 1: 3, 3: 1, 4: 5, 5: 4}, 4, put)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(stored).To(Equal(map[uint32]uint32{0: 3, 2: 1, 1: 4, 3: 2}))
+
+	err = setCPUSiblings(map[uint32]uint32{0: 1}, 2, func(cpu, sibling uint32) error {
+		return errors.New("full")
+	})
+	g.Expect(err).To(HaveOccurred())
+}
+
+func nativeUint32(b []byte) uint32 {
+	return *(*uint32)(unsafe.Pointer(&b[0]))
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attacher
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/iovisor/gobpf/pkg/cpupossible"
+	"golang.org/x/sys/unix"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	// MaxCounters is the number of counter slots in the processes table of the eBPF program, see MAX_COUNTERS
+	MaxCounters = 8
+
+	CPURefCycleLabel    = "cpu_ref_cycles"
+	CacheReferenceLabel = "cache_references"
+	BranchInstrLabel    = "branch_instr"
+	BranchMissLabel     = "branch_misses"
+	LLCLoadLabel        = "llc_loads"
+	LLCLoadMissLabel    = "llc_load_misses"
+	DTLBLoadMissLabel   = "dtlb_load_misses"
+)
+
+type perfCounter struct {
+	evType   int
+	evConfig int
+	enabled  bool
+}
+
+var (
+	// knownEvents are the events that can be configured by name, raw PMU events are configured as r<hex config>, e.g. r01c2
+	knownEvents = map[string]perfCounter{
+		CPUCycleLable:       {unix.PERF_TYPE_HARDWARE, unix.PERF_COUNT_HW_CPU_CYCLES, true},
+		CPUInstructionLabel: {unix.PERF_TYPE_HARDWARE, unix.PERF_COUNT_HW_INSTRUCTIONS, true},
+		CacheMissLabel:      {unix.PERF_TYPE_HARDWARE, unix.PERF_COUNT_HW_CACHE_MISSES, true},
+		CPURefCycleLabel:    {unix.PERF_TYPE_HARDWARE, unix.PERF_COUNT_HW_REF_CPU_CYCLES, true},
+		CacheReferenceLabel: {unix.PERF_TYPE_HARDWARE, unix.PERF_COUNT_HW_CACHE_REFERENCES, true},
+		BranchInstrLabel:    {unix.PERF_TYPE_HARDWARE, unix.PERF_COUNT_HW_BRANCH_INSTRUCTIONS, true},
+		BranchMissLabel:     {unix.PERF_TYPE_HARDWARE, unix.PERF_COUNT_HW_BRANCH_MISSES, true},
+		LLCLoadLabel:        {unix.PERF_TYPE_HW_CACHE, hwCacheConfig(unix.PERF_COUNT_HW_CACHE_LL, unix.PERF_COUNT_HW_CACHE_RESULT_ACCESS), true},
+		LLCLoadMissLabel:    {unix.PERF_TYPE_HW_CACHE, hwCacheConfig(unix.PERF_COUNT_HW_CACHE_LL, unix.PERF_COUNT_HW_CACHE_RESULT_MISS), true},
+		DTLBLoadMissLabel:   {unix.PERF_TYPE_HW_CACHE, hwCacheConfig(unix.PERF_COUNT_HW_CACHE_DTLB, unix.PERF_COUNT_HW_CACHE_RESULT_MISS), true},
+	}
+	rawEventRegex = regexp.MustCompile(`^r([0-9a-fA-F]+)$`)
+
+	// Counters holds the configured hardware counters
+	Counters = map[string]perfCounter{}
+	// CounterNames holds the configured hardware counters in the order of their slots in the eBPF program
+	CounterNames []string
+)
+
+func init() {
+	if err := InitCounters([]string{CPUCycleLable, CPUInstructionLabel, CacheMissLabel}); err != nil {
+		klog.Fatalf("failed to init the default hardware counters: %v", err)
+	}
+}
+
+// hwCacheConfig returns the config of a cache read event, see perf_event_open(2)
+func hwCacheConfig(cache, result int) int {
+	return cache | unix.PERF_COUNT_HW_CACHE_OP_READ<<8 | result<<16
+}
+
+// InitCounters sets the hardware counters collected by the eBPF program, the names are the known
+// event names (e.g. cpu_cycles, llc_load_misses) or raw PMU events in the r<hex config> format
+func InitCounters(names []string) error {
+	if len(names) == 0 {
+		return fmt.Errorf("no hardware counter configured, disable the hardware counter metrics instead")
+	}
+	if len(names) > MaxCounters {
+		return fmt.Errorf("at most %d hardware counters are supported, got %d", MaxCounters, len(names))
+	}
+	counters := map[string]perfCounter{}
+	var counterNames []string
+	for _, name := range names {
+		if _, exists := counters[name]; exists {
+			continue
+		}
+		counter, err := parseCounter(name)
+		if err != nil {
+			return err
+		}
+		counters[name] = counter
+		counterNames = append(counterNames, name)
+	}
+	Counters = counters
+	CounterNames = counterNames
+	return nil
+}
+
+func parseCounter(name string) (perfCounter, error) {
+	if counter, exists := knownEvents[name]; exists {
+		return counter, nil
+	}
+	if match := rawEventRegex.FindStringSubmatch(name); match != nil {
+		config, err := strconv.ParseUint(match[1], 16, 64)
+		if err != nil {
+			return perfCounter{}, fmt.Errorf("invalid raw event %q: %v", name, err)
+		}
+		return perfCounter{unix.PERF_TYPE_RAW, int(config), true}, nil
+	}
+	return perfCounter{}, fmt.Errorf("unknown hardware counter %q", name)
+}
+
+// getNumCPUs returns the number of possible CPUs, the CPU IDs are lower than this number
+func getNumCPUs() (int, error) {
+	cpus, err := cpupossible.Get()
+	if err != nil {
+		return 0, err
+	}
+	if len(cpus) == 0 {
+		return 0, fmt.Errorf("no possible cpus")
+	}
+	return int(cpus[len(cpus)-1]) + 1, nil
+}
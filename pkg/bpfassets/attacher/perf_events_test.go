@@ -0,0 +1,27 @@
+package attacher
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"golang.org/x/sys/unix"
+)
+
+func TestInitCounters(t *testing.T) {
+	g := NewWithT(t)
+
+	defaultCounters, defaultCounterNames := Counters, CounterNames
+	defer func() { Counters, CounterNames = defaultCounters, defaultCounterNames }()
+
+	err := InitCounters([]string{LLCLoadMissLabel, "r01c2", CPUCycleLable, LLCLoadMissLabel})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(CounterNames).To(Equal([]string{LLCLoadMissLabel, "r01c2", CPUCycleLable}))
+	g.Expect(Counters["r01c2"]).To(Equal(perfCounter{unix.PERF_TYPE_RAW, 0x01c2, true}))
+	g.Expect(Counters[LLCLoadMissLabel]).To(Equal(perfCounter{unix.PERF_TYPE_HW_CACHE, 0x10002, true}))
+
+	g.Expect(InitCounters([]string{"unknown"})).NotTo(Succeed())
+	g.Expect(InitCounters([]string{})).NotTo(Succeed())
+	g.Expect(InitCounters(make([]string, MaxCounters+1))).NotTo(Succeed())
+	// the previous configuration is kept on error
+	g.Expect(CounterNames).To(HaveLen(3))
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cgroup
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+)
+
+// DeviceIOStat holds the aggregated IO of a cgroup on a block device
+type DeviceIOStat struct {
+	Device     string
+	ReadBytes  uint64
+	WriteBytes uint64
+	ReadOps    uint64
+	WriteOps   uint64
+}
+
+var (
+	sysDevBlockPath = "/sys/dev/block"
+
+	// wellKnownMajors names the devices when sysfs is not available, these majors are statically allocated in the kernel,
+	// except device-mapper which is dynamic but almost always 253
+	wellKnownMajors = map[string]string{
+		"7":   "loop",
+		"43":  "nbd",
+		"253": "dm-",
+	}
+
+	deviceNameCache = map[string]string{}
+	deviceNameMutex sync.Mutex
+)
+
+// GetBlockDeviceName resolves the kernel name of the block device MAJ:MIN using /sys/dev/block/MAJ:MIN/uevent
+func GetBlockDeviceName(majMin string) string {
+	deviceNameMutex.Lock()
+	defer deviceNameMutex.Unlock()
+	if name, exists := deviceNameCache[majMin]; exists {
+		return name
+	}
+	name := readBlockDeviceName(majMin)
+	deviceNameCache[majMin] = name
+	return name
+}
+
+func readBlockDeviceName(majMin string) string {
+	devicePath := filepath.Join(sysDevBlockPath, majMin)
+	if file, err := os.Open(filepath.Join(devicePath, "uevent")); err == nil {
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if name := strings.TrimPrefix(scanner.Text(), "DEVNAME="); name != scanner.Text() {
+				return name
+			}
+		}
+	}
+	if link, err := os.Readlink(devicePath); err == nil {
+		return filepath.Base(link)
+	}
+	parts := strings.Split(majMin, ":")
+	if prefix, exists := wellKnownMajors[parts[0]]; exists && len(parts) == 2 {
+		return prefix + parts[1]
+	}
+	return majMin
+}
+
+// IsExcludedBlockDevice returns true if the device name matches one of the configured excluded prefixes
+func IsExcludedBlockDevice(name string) bool {
+	for _, prefix := range config.ExcludedBlockDevices {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isExcludedMajMin returns true if the device MAJ:MIN is excluded from the IO stats
+func isExcludedMajMin(majMin string) bool {
+	return IsExcludedBlockDevice(GetBlockDeviceName(majMin))
+}
@@ -0,0 +1,51 @@
+package cgroup
+
+import (
+	"os"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+)
+
+func TestMain(m *testing.M) {
+	// do not depend on the block devices of the host running the tests
+	sysDevBlockPath = "./test/sys/dev/block"
+	os.Exit(m.Run())
+}
+
+func TestGetBlockDeviceName(t *testing.T) {
+	g := NewWithT(t)
+
+	var testcases = []struct {
+		majMin   string
+		expected string
+	}{
+		{majMin: "8:0", expected: "sda"},
+		{majMin: "253:0", expected: "dm-0"},
+		{majMin: "253:3", expected: "dm-3"}, // not in sysfs, named by the well-known major
+		{majMin: "7:2", expected: "loop2"},
+		{majMin: "259:0", expected: "259:0"},
+	}
+	for _, testcase := range testcases {
+		g.Expect(GetBlockDeviceName(testcase.majMin)).To(Equal(testcase.expected))
+	}
+}
+
+func TestIsExcludedBlockDevice(t *testing.T) {
+	g := NewWithT(t)
+
+	defaultDevices := config.ExcludedBlockDevices
+	defer func() { config.ExcludedBlockDevices = defaultDevices }()
+
+	for _, device := range []string{"loop0", "dm-1", "nbd0", "zram0"} {
+		g.Expect(IsExcludedBlockDevice(device)).To(BeTrue())
+	}
+	g.Expect(IsExcludedBlockDevice("nvme0n1")).To(BeFalse())
+
+	config.SetExcludedBlockDevices("nvme, sd")
+	g.Expect(IsExcludedBlockDevice("nvme0n1")).To(BeTrue())
+	g.Expect(IsExcludedBlockDevice("sda")).To(BeTrue())
+	g.Expect(IsExcludedBlockDevice("dm-1")).To(BeFalse())
+}
@@ -21,7 +21,6 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strconv"
 	"strings"
 
@@ -29,12 +28,9 @@ import (
 )
 
 const (
-	ioStatFile = "io.stat"
-	reIOStat   = `(\d+):(\d+).rbytes=(\d+).wbytes=(\d+)` // 8:16 rbytes=58032128 wbytes=0 rios=120 wios=0 dbytes=0 dios=0
-)
-
-var (
-	reIO = regexp.MustCompile(reIOStat)
+	ioStatFile         = "io.stat"
+	blkioBytesStatFile = "blkio.throttle.io_service_bytes"
+	blkioOpsStatFile   = "blkio.throttle.io_serviced"
 )
 
 func ReadAllCgroupIOStat() (rBytes, wBytes uint64, disks int, err error) {
@@ -43,58 +39,206 @@ func ReadAllCgroupIOStat() (rBytes, wBytes uint64, disks int, err error) {
 }
 
 func ReadCgroupIOStat(cGroupID, pid uint64) (rBytes, wBytes uint64, disks int, err error) {
+	stats, err := ReadCgroupDeviceIOStat(cGroupID, pid)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	rBytes, wBytes, disks = sumDeviceIOStat(stats)
+	return rBytes, wBytes, disks, nil
+}
+
+// ReadCgroupDeviceIOStat returns the IO of the container per block device name, excluding the filtered devices
+func ReadCgroupDeviceIOStat(cGroupID, pid uint64) (map[string]*DeviceIOStat, error) {
 	var path string
+	var err error
 	if config.EnabledEBPFCgroupID {
 		path, err = getPathFromcGroupID(cGroupID)
 	} else {
-		path, err = getPathFromPID(procPath, pid)
+		path, err = getIOPathFromPID(procPath, pid)
 	}
 
 	if err != nil {
-		return 0, 0, 0, err
+		return nil, err
 	}
-	if strings.Contains(path, "crio") || strings.Contains(path, "docker") || strings.Contains(path, "containerd") {
-		p := filepath.Join(path, ioStatFile)
-		return readIOStat(p)
+	if isContainerPath(path) {
+		return readCgroupDeviceIOStat(path)
 	}
-	return 0, 0, 0, fmt.Errorf("no cgroup path found")
+	return nil, fmt.Errorf("no cgroup path found")
 }
 
-func readIOStat(path string) (rBytes, wBytes uint64, disks int, err error) {
-	rBytes = uint64(0)
-	wBytes = uint64(0)
-	disks = 0
+func isContainerPath(path string) bool {
+	// kubepods covers the cgroupfs driver, where the container folder is only named by its ID
+	for _, name := range []string{"crio", "docker", "containerd", kubePodsCgroupfsName} {
+		if strings.Contains(path, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// readCgroupDeviceIOStat reads io.stat in cgroup v2 and falls back to the blkio files in cgroup v1
+func readCgroupDeviceIOStat(path string) (map[string]*DeviceIOStat, error) {
+	stats, err := readDeviceIOStat(filepath.Join(path, ioStatFile))
+	if err == nil {
+		return stats, nil
+	}
+	return readBlkioDeviceIOStat(path)
+}
+
+// getIOPathFromPID returns the folder of the io controller of the process
+func getIOPathFromPID(searchPath string, pid uint64) (string, error) {
+	return getControllerPathFromPID(searchPath, pid, ioController)
+}
+
+// getControllerPathFromPID returns the folder of the controller of the process.
+// The lines of /proc/<pid>/cgroup are in the format "hierarchy-ID:controller-list:cgroup-path",
+// the v2 entry has an empty controller list and the v1 entry lists the v1 name of the controller, e.g. blkio.
+func getControllerPathFromPID(searchPath string, pid uint64, controller string) (string, error) {
+	hierarchy := getControllerHierarchy(controller)
+	if SliceHandlerInstance != nil {
+		hierarchy = SliceHandlerInstance.GetHierarchy(controller)
+	}
+	v1Name := v1ControllerNames[controller]
+
+	path := fmt.Sprintf(searchPath, pid)
 	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open cgroup description file for pid %d: %v", pid, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if hierarchy.Version == 2 && fields[1] == "" {
+			return filepath.Join(hierarchy.Root, fields[2]), nil
+		}
+		if hierarchy.Version == 1 {
+			for _, name := range strings.Split(fields[1], ",") {
+				if name == v1Name {
+					return filepath.Join(hierarchy.Root, fields[2]), nil
+				}
+			}
+		}
+	}
+	return "", fmt.Errorf("could not find %s cgroup entry for pid %d", controller, pid)
+}
+
+func readIOStat(path string) (rBytes, wBytes uint64, disks int, err error) {
+	stats, err := readDeviceIOStat(path)
 	if err != nil {
 		return 0, 0, 0, err
 	}
+	rBytes, wBytes, disks = sumDeviceIOStat(stats)
+	return rBytes, wBytes, disks, nil
+}
+
+func sumDeviceIOStat(stats map[string]*DeviceIOStat) (rBytes, wBytes uint64, disks int) {
+	for _, stat := range stats {
+		rBytes += stat.ReadBytes
+		wBytes += stat.WriteBytes
+	}
+	return rBytes, wBytes, len(stats)
+}
+
+// readDeviceIOStat reads io.stat, lines are in the format "8:16 rbytes=58032128 wbytes=0 rios=120 wios=0 dbytes=0 dios=0"
+func readDeviceIOStat(path string) (map[string]*DeviceIOStat, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
 	defer file.Close()
 
+	stats := make(map[string]*DeviceIOStat)
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
-		line := scanner.Text()
-		matches := reIO.FindStringSubmatch(line)
-		l := len(matches)
-		if l > 4 {
-			major := strings.TrimSpace(matches[l-4])
-			if isVirtualDisk(major) {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || isExcludedMajMin(fields[0]) {
+			continue
+		}
+		stat := getDeviceIOStat(stats, fields[0])
+		for _, field := range fields[1:] {
+			kv := strings.Split(field, "=")
+			if len(kv) != 2 {
 				continue
 			}
-			r := strings.TrimSpace(matches[l-2])
-			w := strings.TrimSpace(matches[l-1])
-			disks++
-			if val, e := strconv.ParseUint(r, 10, 64); e == nil {
-				rBytes += val
+			val, e := strconv.ParseUint(kv[1], 10, 64)
+			if e != nil {
+				continue
 			}
-			if val, e := strconv.ParseUint(w, 10, 64); e == nil {
-				wBytes += val
+			switch kv[0] {
+			case "rbytes":
+				stat.ReadBytes += val
+			case "wbytes":
+				stat.WriteBytes += val
+			case "rios":
+				stat.ReadOps += val
+			case "wios":
+				stat.WriteOps += val
 			}
 		}
 	}
-	return rBytes, wBytes, disks, err
+	return stats, scanner.Err()
 }
 
-func isVirtualDisk(major string) bool {
-	// TODO add other virtual device
-	return major == "253"
+// readBlkioDeviceIOStat reads the v1 blkio.throttle.io_service_bytes and blkio.throttle.io_serviced files in the cgroup folder,
+// lines are in the format "8:0 Read 4096"
+func readBlkioDeviceIOStat(path string) (map[string]*DeviceIOStat, error) {
+	stats := make(map[string]*DeviceIOStat)
+	err := readBlkioFile(filepath.Join(path, blkioBytesStatFile), func(stat *DeviceIOStat, op string, val uint64) {
+		switch op {
+		case "Read":
+			stat.ReadBytes += val
+		case "Write":
+			stat.WriteBytes += val
+		}
+	}, stats)
+	if err != nil {
+		return nil, err
+	}
+	// the number of operations is optional
+	_ = readBlkioFile(filepath.Join(path, blkioOpsStatFile), func(stat *DeviceIOStat, op string, val uint64) {
+		switch op {
+		case "Read":
+			stat.ReadOps += val
+		case "Write":
+			stat.WriteOps += val
+		}
+	}, stats)
+	return stats, nil
+}
+
+func readBlkioFile(path string, add func(stat *DeviceIOStat, op string, val uint64), stats map[string]*DeviceIOStat) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// the last line is the overall "Total N"
+		if len(fields) != 3 || isExcludedMajMin(fields[0]) {
+			continue
+		}
+		val, e := strconv.ParseUint(fields[2], 10, 64)
+		if e != nil {
+			continue
+		}
+		add(getDeviceIOStat(stats, fields[0]), fields[1], val)
+	}
+	return scanner.Err()
+}
+
+// getDeviceIOStat returns the stat of the device MAJ:MIN, the stats are keyed by device name
+func getDeviceIOStat(stats map[string]*DeviceIOStat, majMin string) *DeviceIOStat {
+	name := GetBlockDeviceName(majMin)
+	if _, exists := stats[name]; !exists {
+		stats[name] = &DeviceIOStat{Device: name}
+	}
+	return stats[name]
 }
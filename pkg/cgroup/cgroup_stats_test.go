@@ -2,6 +2,7 @@ package cgroup
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
 	. "github.com/onsi/gomega"
@@ -56,3 +57,91 @@ func TestReadIOStat(t *testing.T) {
 		})
 	}
 }
+
+const blkioContent = `8:0 Read 4096
+8:0 Write 8192
+8:0 Sync 12288
+8:0 Total 12288
+8:16 Read 1
+8:16 Write 0
+8:16 Total 1
+253:0 Read 4096
+253:0 Write 8192
+253:0 Total 12288
+Total 24577`
+
+const blkioOpsContent = `8:0 Read 1
+8:0 Write 2
+8:0 Total 3
+Total 3`
+
+func TestReadBlkioDeviceIOStat(t *testing.T) {
+	g := NewWithT(t)
+
+	dir, err := utils.CreateTempDir()
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	g.Expect(os.WriteFile(filepath.Join(dir, blkioBytesStatFile), []byte(blkioContent), 0644)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(dir, blkioOpsStatFile), []byte(blkioOpsContent), 0644)).To(Succeed())
+
+	stats, err := readBlkioDeviceIOStat(dir)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(stats).To(HaveLen(2))
+	g.Expect(*stats["sda"]).To(Equal(DeviceIOStat{Device: "sda", ReadBytes: 4096, WriteBytes: 8192, ReadOps: 1, WriteOps: 2}))
+	g.Expect(*stats["sdb"]).To(Equal(DeviceIOStat{Device: "sdb", ReadBytes: 1}))
+}
+
+func TestReadDeviceIOStat(t *testing.T) {
+	g := NewWithT(t)
+
+	file, err := utils.CreateTempFile(`8:0 rbytes=10 wbytes=20 rios=1 wios=2 dbytes=0 dios=0
+253:0 rbytes=10 wbytes=20 rios=1 wios=2 dbytes=0 dios=0
+7:1 rbytes=10 wbytes=20 rios=1 wios=2 dbytes=0 dios=0`)
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.Remove(file)
+
+	stats, err := readDeviceIOStat(file)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(stats).To(HaveLen(1))
+	g.Expect(*stats["sda"]).To(Equal(DeviceIOStat{Device: "sda", ReadBytes: 10, WriteBytes: 20, ReadOps: 1, WriteOps: 2}))
+}
+
+func TestGetIOPathFromPID(t *testing.T) {
+	g := NewWithT(t)
+
+	var testcases = []struct {
+		name      string
+		contents  string
+		hierarchy ControllerHierarchy
+		expected  string
+	}{
+		{
+			name: "test v1 blkio entry",
+			contents: `12:cpu,cpuacct:/kubepods.slice/kubepods-pod1.slice/docker-abc.scope
+8:blkio:/kubepods.slice/kubepods-pod1.slice/docker-abc.scope
+1:name=systemd:/kubepods.slice/kubepods-pod1.slice/docker-abc.scope`,
+			hierarchy: ControllerHierarchy{Root: "/sys/fs/cgroup/blkio", Version: 1},
+			expected:  "/sys/fs/cgroup/blkio/kubepods.slice/kubepods-pod1.slice/docker-abc.scope",
+		},
+		{
+			name:      "test v2 entry",
+			contents:  `0::/kubepods/burstable/pod1/abc`,
+			hierarchy: ControllerHierarchy{Root: "/sys/fs/cgroup", Version: 2},
+			expected:  "/sys/fs/cgroup/kubepods/burstable/pod1/abc",
+		},
+	}
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			file, err := utils.CreateTempFile(testcase.contents)
+			g.Expect(err).NotTo(HaveOccurred())
+			defer os.Remove(file)
+
+			SliceHandlerInstance = &SliceHandler{hierarchies: map[string]ControllerHierarchy{ioController: testcase.hierarchy}}
+			// the search path is a format string of the pid, so give the file name as is
+			path, err := getIOPathFromPID(file+"%.0d", 0)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(path).To(Equal(testcase.expected))
+			g.Expect(isContainerPath(path)).To(BeTrue())
+		})
+	}
+}
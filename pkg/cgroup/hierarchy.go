@@ -0,0 +1,110 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+
+This file detects where each cgroup controller is mounted.
+On a unified (v2) host every controller lives in /sys/fs/cgroup, on a v1 host each controller has its own mount,
+and on a hybrid host some controllers are mounted as v1 while the others are in /sys/fs/cgroup/unified.
+
+*/
+
+package cgroup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	cpuController    = "cpu"
+	memoryController = "memory"
+	ioController     = "io"
+
+	unifiedDirName      = "unified"
+	controllersFileName = "cgroup.controllers"
+
+	kubePodsSliceName    = "kubepods.slice" // systemd cgroup driver
+	kubePodsCgroupfsName = "kubepods"       // cgroupfs cgroup driver
+	systemSliceName      = "system.slice"
+)
+
+var (
+	// v1ControllerDirs lists, in order of preference, the directories where a controller can be mounted in cgroup v1
+	v1ControllerDirs = map[string][]string{
+		cpuController:    {"cpu", "cpu,cpuacct", "cpuacct"},
+		memoryController: {"memory"},
+		ioController:     {"blkio"},
+	}
+	// v1ControllerNames is the name of the controller in /proc/<pid>/cgroup in cgroup v1
+	v1ControllerNames = map[string]string{
+		cpuController:    "cpu",
+		memoryController: "memory",
+		ioController:     "blkio",
+	}
+	topSliceNames = []string{kubePodsSliceName, kubePodsCgroupfsName, systemSliceName}
+)
+
+// ControllerHierarchy describes the mount root and the cgroup version of a controller
+type ControllerHierarchy struct {
+	Root    string
+	Version int
+}
+
+// getControllerHierarchy returns where the controller is mounted.
+// The controller is in v2 if it is listed in cgroup.controllers of the base path or of the hybrid unified mount,
+// otherwise it is in v1 if its own mount exists.
+func getControllerHierarchy(controller string) ControllerHierarchy {
+	base := filepath.Clean(baseCGroupPath)
+	for _, root := range []string{base, filepath.Join(base, unifiedDirName)} {
+		if hasV2Controller(root, controller) {
+			return ControllerHierarchy{Root: root, Version: 2}
+		}
+	}
+	for _, dir := range v1ControllerDirs[controller] {
+		root := filepath.Join(base, dir)
+		if _, err := os.Stat(root); err == nil {
+			return ControllerHierarchy{Root: root, Version: 1}
+		}
+	}
+	// there is no information about the controller (e.g. cgroup.controllers is not visible), assume the unified hierarchy
+	return ControllerHierarchy{Root: base, Version: 2}
+}
+
+func hasV2Controller(root, controller string) bool {
+	content, err := os.ReadFile(filepath.Join(root, controllersFileName))
+	if err != nil {
+		return false
+	}
+	for _, c := range strings.Fields(string(content)) {
+		if c == controller {
+			return true
+		}
+	}
+	return false
+}
+
+// getTopPath returns the folder containing the containers within the controller root
+func getTopPath(root string) string {
+	for _, name := range topSliceNames {
+		path := filepath.Join(root, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return root
+}
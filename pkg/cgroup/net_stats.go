@@ -0,0 +1,97 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cgroup
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	loopbackInterface = "lo"
+)
+
+var (
+	procNetDevPath = "/proc/%d/net/dev"
+	procNetNSPath  = "/proc/%d/ns/net"
+	// the network namespace of the host, processes in this namespace (e.g. pods with hostNetwork) cannot be told apart
+	hostNetNSPID uint64 = 1
+)
+
+// NetDevStat holds the traffic of a network interface
+type NetDevStat struct {
+	Interface string
+	RxBytes   uint64
+	RxPackets uint64
+	TxBytes   uint64
+	TxPackets uint64
+}
+
+// ReadNetDevStat returns the network namespace of the process and the traffic per interface in this namespace.
+// The loopback traffic is ignored, and an error is returned if the process is in the host network namespace.
+func ReadNetDevStat(pid uint64) (netNS string, stats map[string]*NetDevStat, err error) {
+	netNS, err = os.Readlink(fmt.Sprintf(procNetNSPath, pid))
+	if err != nil {
+		return "", nil, err
+	}
+	if hostNetNS, e := os.Readlink(fmt.Sprintf(procNetNSPath, hostNetNSPID)); e == nil && hostNetNS == netNS {
+		return netNS, nil, fmt.Errorf("process %d is in the host network namespace", pid)
+	}
+	stats, err = readNetDev(fmt.Sprintf(procNetDevPath, pid))
+	return netNS, stats, err
+}
+
+// readNetDev reads /proc/<pid>/net/dev, after two header lines the lines are in the format
+// "eth0: rx-bytes rx-packets errs drop fifo frame compressed multicast tx-bytes tx-packets errs drop fifo colls carrier compressed"
+func readNetDev(path string) (map[string]*NetDevStat, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	stats := make(map[string]*NetDevStat)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		iface := strings.TrimSpace(parts[0])
+		fields := strings.Fields(parts[1])
+		if iface == loopbackInterface || len(fields) < 10 {
+			continue
+		}
+		var values [4]uint64
+		for i, index := range []int{0, 1, 8, 9} {
+			if values[i], err = strconv.ParseUint(fields[index], 10, 64); err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+			}
+		}
+		stats[iface] = &NetDevStat{
+			Interface: iface,
+			RxBytes:   values[0],
+			RxPackets: values[1],
+			TxBytes:   values[2],
+			TxPackets: values[3],
+		}
+	}
+	return stats, scanner.Err()
+}
@@ -0,0 +1,60 @@
+package cgroup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/sustainable-computing-io/kepler/pkg/utils"
+)
+
+const netDevContent = `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:    1000      10    0    0    0     0          0         0     1000      10    0    0    0     0       0          0
+  eth0: 2033626   13406    0    0    0     0          0         0  1240112    9876    0    0    0     0       0          0
+`
+
+func TestReadNetDev(t *testing.T) {
+	g := NewWithT(t)
+
+	file, err := utils.CreateTempFile(netDevContent)
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.Remove(file)
+
+	stats, err := readNetDev(file)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(stats).To(HaveLen(1))
+	g.Expect(*stats["eth0"]).To(Equal(NetDevStat{Interface: "eth0", RxBytes: 2033626, RxPackets: 13406, TxBytes: 1240112, TxPackets: 9876}))
+}
+
+func TestReadNetDevStat(t *testing.T) {
+	g := NewWithT(t)
+
+	dir, err := utils.CreateTempDir()
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	defaultNetDevPath, defaultNetNSPath := procNetDevPath, procNetNSPath
+	defer func() { procNetDevPath, procNetNSPath = defaultNetDevPath, defaultNetNSPath }()
+	procNetDevPath = filepath.Join(dir, "%d", "net", "dev")
+	procNetNSPath = filepath.Join(dir, "%d", "ns", "net")
+
+	// pid 1 is in the host namespace, pid 100 is in a pod namespace and pid 200 uses the host network
+	for pid, netNS := range map[int]string{1: "net:[1]", 100: "net:[2]", 200: "net:[1]"} {
+		g.Expect(os.MkdirAll(filepath.Join(dir, fmt.Sprint(pid), "ns"), 0755)).To(Succeed())
+		g.Expect(os.MkdirAll(filepath.Join(dir, fmt.Sprint(pid), "net"), 0755)).To(Succeed())
+		g.Expect(os.Symlink(netNS, fmt.Sprintf(procNetNSPath, pid))).To(Succeed())
+		g.Expect(os.WriteFile(fmt.Sprintf(procNetDevPath, pid), []byte(netDevContent), 0644)).To(Succeed())
+	}
+
+	netNS, stats, err := ReadNetDevStat(100)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(netNS).To(Equal("net:[2]"))
+	g.Expect(stats).To(HaveKey("eth0"))
+
+	_, _, err = ReadNetDevStat(200)
+	g.Expect(err).To(HaveOccurred())
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cgroup
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+)
+
+const (
+	numaStatFile = "memory.numa_stat"
+)
+
+var (
+	// numaStatV2Types are the memory types summed per NUMA node in cgroup v2, the shared memory is accounted as file
+	numaStatV2Types = []string{"anon", "file"}
+	// numaStatV1Totals are the totals of the pages per NUMA node in cgroup v1, in order of preference
+	numaStatV1Totals = []string{"hierarchical_total", "total"}
+)
+
+// ReadCgroupNUMAMemory returns the memory of the container on each NUMA node in bytes
+func ReadCgroupNUMAMemory(cGroupID, pid uint64) (map[int32]uint64, error) {
+	var path string
+	var err error
+	if config.EnabledEBPFCgroupID {
+		path, err = getPathFromcGroupID(cGroupID)
+	} else {
+		path, err = getControllerPathFromPID(procPath, pid, memoryController)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if isContainerPath(path) {
+		return readNUMAStat(filepath.Join(path, numaStatFile))
+	}
+	return nil, fmt.Errorf("no cgroup path found")
+}
+
+// readNUMAStat parses memory.numa_stat. The cgroup v2 file lists the bytes of each memory type per node, e.g. "anon N0=4096 N1=8192",
+// and the cgroup v1 file lists the pages per node, e.g. "hierarchical_total=3 N0=1 N1=2".
+func readNUMAStat(path string) (map[int32]uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	typeNodes := make(map[string]map[int32]uint64)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		// the v1 lines start with <type>=<total>
+		memoryType := strings.SplitN(fields[0], "=", 2)[0]
+		nodes := make(map[int32]uint64)
+		for _, field := range fields[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 || !strings.HasPrefix(kv[0], "N") {
+				continue
+			}
+			node, err := strconv.ParseInt(kv[0][1:], 10, 32)
+			if err != nil {
+				continue
+			}
+			if value, err := strconv.ParseUint(kv[1], 10, 64); err == nil {
+				nodes[int32(node)] = value
+			}
+		}
+		typeNodes[memoryType] = nodes
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, total := range numaStatV1Totals {
+		if pages, exists := typeNodes[total]; exists {
+			memory := make(map[int32]uint64, len(pages))
+			for node, value := range pages {
+				memory[node] = value * uint64(os.Getpagesize())
+			}
+			return memory, nil
+		}
+	}
+	memory := make(map[int32]uint64)
+	for _, memoryType := range numaStatV2Types {
+		for node, value := range typeNodes[memoryType] {
+			memory[node] += value
+		}
+	}
+	if len(memory) == 0 {
+		return nil, fmt.Errorf("no NUMA node memory in %s", path)
+	}
+	return memory, nil
+}
@@ -0,0 +1,29 @@
+package cgroup
+
+import (
+	"os"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/sustainable-computing-io/kepler/pkg/utils"
+)
+
+func TestReadNUMAStat(t *testing.T) {
+	g := NewWithT(t)
+
+	v2File, err := utils.CreateTempFile("anon N0=4096 N1=8192\nfile N0=1024 N1=0\nkernel_stack N0=512 N1=512\nshmem N0=0 N1=0\n")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.Remove(v2File)
+	memory, err := readNUMAStat(v2File)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(memory).To(Equal(map[int32]uint64{0: 5120, 1: 8192}))
+
+	v1File, err := utils.CreateTempFile("total=3 N0=1 N1=2\nfile=1 N0=1 N1=0\nhierarchical_total=5 N0=2 N1=3\n")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.Remove(v1File)
+	memory, err = readNUMAStat(v1File)
+	g.Expect(err).NotTo(HaveOccurred())
+	pageSize := uint64(os.Getpagesize())
+	g.Expect(memory).To(Equal(map[int32]uint64{0: 2 * pageSize, 1: 3 * pageSize}))
+}
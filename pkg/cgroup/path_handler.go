@@ -83,8 +83,7 @@ func ReadLineKEqualToV(fileName string) (map[string]interface{}, error) {
 	sc := bufio.NewScanner(f)
 	for sc.Scan() {
 		fields := strings.Fields(sc.Text())
-		if strings.Contains(fields[0], "253:") {
-			// device-mapper
+		if len(fields) == 0 || isExcludedMajMin(fields[0]) {
 			continue
 		}
 		for _, field := range fields {
@@ -103,3 +102,33 @@ func ReadLineKEqualToV(fileName string) (map[string]interface{}, error) {
 
 	return values, sc.Err()
 }
+
+// ReadBlkioStat reads the cgroup v1 blkio files with lines in the format "MAJ:MIN Operation Value"
+// and returns the sum of each lower-cased operation over all devices
+func ReadBlkioStat(fileName string) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	f, err := os.Open(fileName)
+	if err != nil {
+		return values, err
+	}
+
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		// the last line is the overall "Total N"
+		if len(fields) != 3 || isExcludedMajMin(fields[0]) {
+			continue
+		}
+		op := strings.ToLower(fields[1])
+		if _, exists := values[op]; !exists {
+			values[op] = uint64(0)
+		}
+		v, err := strconv.ParseUint(fields[2], 10, 64)
+		if err == nil {
+			values[op] = values[op].(uint64) + v
+		}
+	}
+
+	return values, sc.Err()
+}
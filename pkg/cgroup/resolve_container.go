@@ -38,6 +38,9 @@ type ContainerInfo struct {
 	ContainerName string
 	PodName       string
 	Namespace     string
+	// CPURequest (in cores) and MemoryRequest (in bytes) are the resource requests of the container, 0 when not set
+	CPURequest    float64
+	MemoryRequest float64
 }
 
 const (
@@ -90,6 +93,32 @@ func GetContainerID(cGroupID, pid uint64, withCGroupID bool) (string, error) {
 	return info.ContainerID, err
 }
 
+// GetContainerRequests returns the CPU (in cores) and memory (in bytes) requests of the container
+func GetContainerRequests(cGroupID, pid uint64, withCGroupID bool) (cpuRequest, memoryRequest float64, err error) {
+	info, err := getContainerInfo(cGroupID, pid, withCGroupID)
+	return info.CPURequest, info.MemoryRequest, err
+}
+
+// GetPodContainerRequests returns the CPU (in cores) and memory (in bytes) requests of the named container of the pod
+func GetPodContainerRequests(pod *corev1.Pod, containerName string) (cpuRequest, memoryRequest float64) {
+	for _, containers := range [][]corev1.Container{pod.Spec.Containers, pod.Spec.InitContainers} {
+		for i := 0; i < len(containers); i++ {
+			if containers[i].Name != containerName {
+				continue
+			}
+			requests := containers[i].Resources.Requests
+			if cpu, ok := requests[corev1.ResourceCPU]; ok {
+				cpuRequest = float64(cpu.MilliValue()) / 1000
+			}
+			if memory, ok := requests[corev1.ResourceMemory]; ok {
+				memoryRequest = float64(memory.Value())
+			}
+			return
+		}
+	}
+	return
+}
+
 func GetContainerMetrics() (containerCPU, containerMem map[string]float64, nodeCPU, nodeMem float64, retErr error) {
 	return podLister.ListMetrics()
 }
@@ -142,12 +171,7 @@ func updateListPodCache(targetContainerID string, stopWhenFound bool) (*[]corev1
 		containers := (*pods)[i].Status.ContainerStatuses
 		for j := 0; j < len(containers); j++ {
 			containerID := ParseContainerIDFromPodStatus(containers[j].ContainerID)
-			containerIDToContainerInfo[containerID] = &ContainerInfo{
-				ContainerID:   containerID,
-				ContainerName: containers[j].Name,
-				PodName:       (*pods)[i].Name,
-				Namespace:     (*pods)[i].Namespace,
-			}
+			containerIDToContainerInfo[containerID] = newContainerInfo(&(*pods)[i], containerID, containers[j].Name)
 			if stopWhenFound && containers[j].ContainerID == targetContainerID {
 				return pods, err
 			}
@@ -155,12 +179,7 @@ func updateListPodCache(targetContainerID string, stopWhenFound bool) (*[]corev1
 		containers = (*pods)[i].Status.InitContainerStatuses
 		for j := 0; j < len(containers); j++ {
 			containerID := ParseContainerIDFromPodStatus(containers[j].ContainerID)
-			containerIDToContainerInfo[containerID] = &ContainerInfo{
-				ContainerID:   containerID,
-				ContainerName: containers[j].Name,
-				PodName:       (*pods)[i].Name,
-				Namespace:     (*pods)[i].Namespace,
-			}
+			containerIDToContainerInfo[containerID] = newContainerInfo(&(*pods)[i], containerID, containers[j].Name)
 			if stopWhenFound && containers[j].ContainerID == targetContainerID {
 				return pods, err
 			}
@@ -168,12 +187,7 @@ func updateListPodCache(targetContainerID string, stopWhenFound bool) (*[]corev1
 		containers = (*pods)[i].Status.EphemeralContainerStatuses
 		for j := 0; j < len(containers); j++ {
 			containerID := ParseContainerIDFromPodStatus(containers[j].ContainerID)
-			containerIDToContainerInfo[containerID] = &ContainerInfo{
-				ContainerID:   containerID,
-				ContainerName: containers[j].Name,
-				PodName:       (*pods)[i].Name,
-				Namespace:     (*pods)[i].Namespace,
-			}
+			containerIDToContainerInfo[containerID] = newContainerInfo(&(*pods)[i], containerID, containers[j].Name)
 			if stopWhenFound && containers[j].ContainerID == targetContainerID {
 				return pods, err
 			}
@@ -182,6 +196,18 @@ func updateListPodCache(targetContainerID string, stopWhenFound bool) (*[]corev1
 	return pods, err
 }
 
+func newContainerInfo(pod *corev1.Pod, containerID, containerName string) *ContainerInfo {
+	cpuRequest, memoryRequest := GetPodContainerRequests(pod, containerName)
+	return &ContainerInfo{
+		ContainerID:   containerID,
+		ContainerName: containerName,
+		PodName:       pod.Name,
+		Namespace:     pod.Namespace,
+		CPURequest:    cpuRequest,
+		MemoryRequest: memoryRequest,
+	}
+}
+
 func ParseContainerIDFromPodStatus(containerID string) string {
 	return regexReplaceContainerIDPrefix.ReplaceAllString(containerID, "")
 }
@@ -202,6 +228,11 @@ func AddContainerIDToCache(pid uint64, containerID string) {
 	containerIDCache[pid] = containerID
 }
 
+// RemoveContainerIDFromCache removes the container id of the pid from cache, e.g. when the process exited
+func RemoveContainerIDFromCache(pid uint64) {
+	delete(containerIDCache, pid)
+}
+
 // GetContainerIDFromPID find the container ID using the process PID
 func GetContainerIDFromPID(pid uint64) (string, error) {
 	if p, ok := containerIDCache[pid]; ok {
@@ -40,9 +40,7 @@ const (
 )
 
 var (
-	baseCGroupPath    string = "/sys/fs/cgroup"
-	KubePodCGroupPath string = "/sys/fs/cgroup/kubepods.slice"
-	SystemCGroupPath  string = "/sys/fs/cgroup/system.slice"
+	baseCGroupPath string = "/sys/fs/cgroup"
 )
 
 type SliceHandler struct {
@@ -50,6 +48,8 @@ type SliceHandler struct {
 	CPUTopPath    string
 	MemoryTopPath string
 	IOTopPath     string
+	// hierarchies keeps the mount root and cgroup version of each controller
+	hierarchies map[string]ControllerHierarchy
 }
 
 var SliceHandlerInstance *SliceHandler
@@ -82,6 +82,13 @@ func (s *SliceHandler) GetIOTopPath() string {
 	return s.IOTopPath
 }
 
+func (s *SliceHandler) GetHierarchy(controller string) ControllerHierarchy {
+	if hierarchy, exists := s.hierarchies[controller]; exists {
+		return hierarchy
+	}
+	return getControllerHierarchy(controller)
+}
+
 func (s *SliceHandler) GetStats(containerID string) map[string]interface{} {
 	if readers, exists := s.statReaders[containerID]; exists {
 		values := make(map[string]interface{})
@@ -97,25 +104,15 @@ func (s *SliceHandler) GetStats(containerID string) map[string]interface{} {
 }
 
 func InitSliceHandler() *SliceHandler {
-	var handler *SliceHandler
-	if _, err := os.Stat(KubePodCGroupPath); err == nil {
-		handler = &SliceHandler{
-			CPUTopPath:    KubePodCGroupPath,
-			MemoryTopPath: KubePodCGroupPath,
-			IOTopPath:     KubePodCGroupPath,
-		}
-	} else if _, err := os.Stat(SystemCGroupPath); err == nil {
-		handler = &SliceHandler{
-			CPUTopPath:    SystemCGroupPath,
-			MemoryTopPath: SystemCGroupPath,
-			IOTopPath:     SystemCGroupPath,
-		}
-	} else {
-		handler = &SliceHandler{
-			CPUTopPath:    filepath.Join(baseCGroupPath, "cpu"),
-			MemoryTopPath: filepath.Join(baseCGroupPath, "memory"),
-			IOTopPath:     filepath.Join(baseCGroupPath, "blkio"),
-		}
+	hierarchies := make(map[string]ControllerHierarchy)
+	for _, controller := range []string{cpuController, memoryController, ioController} {
+		hierarchies[controller] = getControllerHierarchy(controller)
+	}
+	handler := &SliceHandler{
+		CPUTopPath:    getTopPath(hierarchies[cpuController].Root),
+		MemoryTopPath: getTopPath(hierarchies[memoryController].Root),
+		IOTopPath:     getTopPath(hierarchies[ioController].Root),
+		hierarchies:   hierarchies,
 	}
 	handler.Init()
 	klog.V(3).Infof("InitSliceHandler: %v", handler)
@@ -126,11 +123,15 @@ func TryInitStatReaders(containerID string) {
 	statReaders := SliceHandlerInstance.GetStatReaders()
 	if _, exists := statReaders[containerID]; !exists {
 		cpuTopPath := SliceHandlerInstance.GetCPUTopPath()
-		memoryTopPath := SliceHandlerInstance.GetMemoryTopPath()
-		ioTopPath := SliceHandlerInstance.GetIOTopPath()
 		containerCPUPath := SearchByContainerID(cpuTopPath, containerID)
-		containerMemoryPath := strings.Replace(containerCPUPath, cpuTopPath, memoryTopPath, 1)
-		containerIOPath := strings.Replace(containerCPUPath, cpuTopPath, ioTopPath, 1)
+		var containerMemoryPath, containerIOPath string
+		if containerCPUPath != "" {
+			// in v1 and hybrid hierarchies, each controller has its own root but the same relative container path
+			cpuRoot := SliceHandlerInstance.GetHierarchy(cpuController).Root
+			relativePath := strings.TrimPrefix(containerCPUPath, cpuRoot)
+			containerMemoryPath = filepath.Join(SliceHandlerInstance.GetHierarchy(memoryController).Root, relativePath)
+			containerIOPath = filepath.Join(SliceHandlerInstance.GetHierarchy(ioController).Root, relativePath)
+		}
 		statReaders[containerID] = []StatReader{
 			CPUStatReader{Path: containerCPUPath},
 			MemoryStatReader{Path: containerMemoryPath},
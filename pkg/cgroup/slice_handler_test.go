@@ -17,8 +17,8 @@ limitations under the License.
 package cgroup
 
 import (
-	"fmt"
 	"os"
+	"path/filepath"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -31,15 +31,13 @@ var testPaths []string = []string{
 }
 
 var expectedStandardStats map[string]int = map[string]int{
-	testPaths[0]: 6,
+	testPaths[0]: 8,
 	testPaths[1]: 6,
 	testPaths[2]: 6,
 }
 
 func initSliceHandler(basePath string) *SliceHandler {
 	baseCGroupPath = basePath
-	KubePodCGroupPath = fmt.Sprintf("%s/kubepods.slice", basePath)
-	SystemCGroupPath = fmt.Sprintf("%s/system.slice", basePath)
 	sliceHandler := InitSliceHandler()
 	return sliceHandler
 }
@@ -86,6 +84,47 @@ var _ = Describe("Test Read Stat", func() {
 	})
 })
 
+var _ = Describe("Test cgroup hierarchy", func() {
+	It("Properly detect v1 hierarchy", func() {
+		SliceHandlerInstance = initSliceHandler(testPaths[0])
+		Expect(SliceHandlerInstance.GetHierarchy(cpuController).Version).To(Equal(1))
+		Expect(SliceHandlerInstance.GetHierarchy(ioController).Root).To(Equal(filepath.Join(testPaths[0], "blkio")))
+		Expect(SliceHandlerInstance.GetIOTopPath()).To(Equal(filepath.Join(testPaths[0], "blkio", kubePodsSliceName)))
+	})
+
+	It("Properly detect hybrid hierarchy per controller", func() {
+		dir, err := utils.CreateTempDir()
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		// memory is in the unified mount, cpu and blkio are v1 mounts
+		Expect(os.MkdirAll(filepath.Join(dir, unifiedDirName), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, unifiedDirName, controllersFileName), []byte("memory pids\n"), 0644)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(dir, "cpu,cpuacct"), 0755)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(dir, "blkio"), 0755)).To(Succeed())
+
+		SliceHandlerInstance = initSliceHandler(dir)
+		Expect(SliceHandlerInstance.GetHierarchy(memoryController)).To(Equal(ControllerHierarchy{Root: filepath.Join(dir, unifiedDirName), Version: 2}))
+		Expect(SliceHandlerInstance.GetHierarchy(cpuController)).To(Equal(ControllerHierarchy{Root: filepath.Join(dir, "cpu,cpuacct"), Version: 1}))
+		Expect(SliceHandlerInstance.GetHierarchy(ioController)).To(Equal(ControllerHierarchy{Root: filepath.Join(dir, "blkio"), Version: 1}))
+	})
+
+	It("Properly detect unified hierarchy", func() {
+		dir, err := utils.CreateTempDir()
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		Expect(os.WriteFile(filepath.Join(dir, controllersFileName), []byte("cpuset cpu io memory pids\n"), 0644)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(dir, kubePodsSliceName), 0755)).To(Succeed())
+
+		SliceHandlerInstance = initSliceHandler(dir)
+		for _, controller := range []string{cpuController, memoryController, ioController} {
+			Expect(SliceHandlerInstance.GetHierarchy(controller)).To(Equal(ControllerHierarchy{Root: dir, Version: 2}))
+		}
+		Expect(SliceHandlerInstance.GetCPUTopPath()).To(Equal(filepath.Join(dir, kubePodsSliceName)))
+	})
+})
+
 var _ = Describe("Test Read Scope file", func() {
 	It("Properly find scope file", func() {
 		dir, err := utils.CreateTempDir()
@@ -33,13 +33,19 @@ var cpuUsageFiles = []string{
 	"cpuacct.usage",      // hierarchy: system + kernel
 	"cpuacct.usage_sys",  // hierarchy: kernel
 	"cpuacct.usage_user", // hierarchy: tcp buff
+	"cpuacct.stat",       // hierarchy: user and system in USER_HZ
 	"cpu.stat",           // toppath cpu stat
 }
 
 var ioUsageFiles = []string{
-	"io.stat",
+	"io.stat",                         // toppath io stat
+	"blkio.throttle.io_service_bytes", // hierarchy: read and write bytes
+	"blkio.throttle.io_serviced",      // hierarchy: read and write ops
 }
 
+// userHZ is the unit of cpuacct.stat, the kernel always exports it as 100 ticks per second
+const userHZ = 100
+
 var standardMetricName = map[string][]CgroupFSReadMetric{
 	config.CgroupfsMemory: {
 		{Name: "memory.current", Converter: DefaultConverter},
@@ -58,10 +64,12 @@ var standardMetricName = map[string][]CgroupFSReadMetric{
 	config.CgroupfsSystemCPU: {
 		{Name: "cpuacct.usage_sys", Converter: NanoToMicroConverter},
 		{Name: "system_usec", Converter: DefaultConverter},
+		{Name: "cpuacct.stat.system", Converter: TicksToMicroConverter},
 	},
 	config.CgroupfsUserCPU: {
 		{Name: "cpuacct.usage_user", Converter: NanoToMicroConverter},
 		{Name: "user_usec", Converter: DefaultConverter},
+		{Name: "cpuacct.stat.user", Converter: TicksToMicroConverter},
 	},
 	config.CgroupfsReadIO: {
 		{Name: "rbytes", Converter: DefaultConverter},
@@ -98,15 +106,24 @@ type CPUStatReader struct {
 func (s CPUStatReader) Read() map[string]interface{} {
 	values := make(map[string]interface{})
 	for _, usageFile := range cpuUsageFiles {
+		fileName := filepath.Join(s.Path, usageFile)
 		switch usageFile {
 		case "cpu.stat":
-			fileName := filepath.Join(s.Path, usageFile)
+			// cpu.stat also exists in cgroup v1 (throttling stats only), so merge it instead of replacing the values
 			kv, err := ReadKV(fileName)
 			if err == nil {
-				return kv
+				for k, v := range kv {
+					values[k] = v
+				}
+			}
+		case "cpuacct.stat":
+			kv, err := ReadKV(fileName)
+			if err == nil {
+				for k, v := range kv {
+					values[usageFile+"."+k] = v
+				}
 			}
 		default:
-			fileName := filepath.Join(s.Path, usageFile)
 			value, err := ReadUInt64(fileName)
 			if err == nil {
 				values[usageFile] = value
@@ -120,15 +137,31 @@ type IOStatReader struct {
 	Path string
 }
 
+// blkioStatKeys maps the operations of the v1 blkio files to the io.stat keys
+var blkioStatKeys = map[string]map[string]string{
+	"blkio.throttle.io_service_bytes": {"read": "rbytes", "write": "wbytes"},
+	"blkio.throttle.io_serviced":      {"read": "rios", "write": "wios"},
+}
+
 func (s IOStatReader) Read() map[string]interface{} {
 	values := make(map[string]interface{})
 	for _, usageFile := range ioUsageFiles {
+		fileName := filepath.Join(s.Path, usageFile)
 		if usageFile == "io.stat" {
-			fileName := filepath.Join(s.Path, usageFile)
 			kv, err := ReadLineKEqualToV(fileName)
 			if err == nil {
 				return kv
 			}
+			continue
+		}
+		kv, err := ReadBlkioStat(fileName)
+		if err != nil {
+			continue
+		}
+		for op, key := range blkioStatKeys[usageFile] {
+			if v, exists := kv[op]; exists {
+				values[key] = v
+			}
 		}
 	}
 	return values
@@ -147,6 +180,10 @@ func NanoToMicroConverter(stats map[string]interface{}, key string) interface{}
 	return stats[key].(uint64) / 1000
 }
 
+func TicksToMicroConverter(stats map[string]interface{}, key string) interface{} {
+	return stats[key].(uint64) * (1000000 / userHZ)
+}
+
 func convertToStandard(stats map[string]interface{}) map[string]interface{} {
 	values := make(map[string]interface{})
 	for key, readMetrics := range standardMetricName {
@@ -113,6 +113,15 @@ var _ = Describe("Test Read Stat Converter", func() {
 		Expect(ok).To(Equal(true))
 		Expect(v).To(Equal(100))
 	})
+	It("Test converter cgroupfs_user_cpu_usage_us with cpuacct.stat", func() {
+		imap := make(map[string]interface{})
+		imap["cpuacct.stat.user"] = uint64(100)
+		imap["cpuacct.stat.system"] = uint64(2)
+		out := convertToStandard(imap)
+		Expect(len(out)).To(Equal(2))
+		Expect(out["cgroupfs_user_cpu_usage_us"]).To(Equal(uint64(1000000)))
+		Expect(out["cgroupfs_system_cpu_usage_us"]).To(Equal(uint64(20000)))
+	})
 	It("Test converter cgroupfs_ioread_bytes", func() {
 		imap := make(map[string]interface{})
 		imap["rbytes"] = 100
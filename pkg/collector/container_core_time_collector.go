@@ -0,0 +1,40 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"k8s.io/klog/v2"
+)
+
+// updateCoreTimeMetrics sets the core time of the containers, the CPU time where the time that sibling hyperthreads shared a physical core
+// is split between them instead of being counted once per thread. The eBPF program measures the time that each process ran while the
+// sibling of its CPU was busy, half of it is charged to the process. Without eBPF the shared time is unknown and the core time is the CPU time.
+func (c *Collector) updateCoreTimeMetrics() {
+	for _, container := range c.ContainersMetrics {
+		// the core time is in milliseconds like the CPU time
+		sharedTime := container.CurrSharedCPUTime / 2 / 1000
+		coreTime := container.CPUTime.Curr
+		if sharedTime < coreTime {
+			coreTime -= sharedTime
+		} else {
+			coreTime = 0
+		}
+		if err := container.CoreTime.AddNewCurr(coreTime); err != nil {
+			klog.V(5).Infoln(err)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package collector
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	collector_metric "github.com/sustainable-computing-io/kepler/pkg/collector/metric"
+)
+
+var _ = Describe("Test Core Time Collector", func() {
+	It("should split the time that sibling hyperthreads shared a core", func() {
+		containersMetrics := map[string]*collector_metric.ContainerMetrics{}
+		containersMetrics["containerA"] = collector_metric.NewContainerMetrics("containerA", "podA", "test")
+		containersMetrics["containerB"] = collector_metric.NewContainerMetrics("containerB", "podB", "test")
+		// containerA shared the core the whole time, containerB a quarter of its time
+		Expect(containersMetrics["containerA"].CPUTime.AddNewCurr(1000)).To(Succeed())
+		containersMetrics["containerA"].CurrSharedCPUTime = 1000000
+		Expect(containersMetrics["containerB"].CPUTime.AddNewCurr(1000)).To(Succeed())
+		containersMetrics["containerB"].CurrSharedCPUTime = 250000
+		c := &Collector{ContainersMetrics: containersMetrics}
+		c.updateCoreTimeMetrics()
+		Expect(containersMetrics["containerA"].CoreTime.Curr).To(Equal(uint64(500)))
+		Expect(containersMetrics["containerB"].CoreTime.Curr).To(Equal(uint64(875)))
+	})
+
+	It("should charge all the time that was not shared", func() {
+		containersMetrics := map[string]*collector_metric.ContainerMetrics{}
+		containersMetrics["containerA"] = collector_metric.NewContainerMetrics("containerA", "podA", "test")
+		Expect(containersMetrics["containerA"].CPUTime.AddNewCurr(400)).To(Succeed())
+		c := &Collector{ContainersMetrics: containersMetrics}
+		c.updateCoreTimeMetrics()
+		Expect(containersMetrics["containerA"].CoreTime.Curr).To(Equal(uint64(400)))
+	})
+})
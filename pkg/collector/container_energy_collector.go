@@ -17,10 +17,153 @@ limitations under the License.
 package collector
 
 import (
+	"math"
+	"sort"
+
+	collector_metric "github.com/sustainable-computing-io/kepler/pkg/collector/metric"
+	"github.com/sustainable-computing-io/kepler/pkg/config"
 	"github.com/sustainable-computing-io/kepler/pkg/model"
+	"github.com/sustainable-computing-io/kepler/pkg/power/components"
 )
 
 // updateContainerEnergy matches the container resource usage with the node energy consumption
 func (c *Collector) updateContainerEnergy() {
 	model.UpdateContainerEnergy(c.ContainersMetrics, c.NodeMetrics)
 }
+
+// reconciledComponents are the energy components of the containers reconciled with the node energy
+var reconciledComponents = []string{"pkg", "core", "uncore", "dram", "gpu", "other"}
+
+// reconcileContainerEnergy scales the container energy of each component so that the container sum equals the node energy that is attributed
+// to the containers. The attribution rounds up the container energy and the trained power models estimate each container independently,
+// so the sum can drift from the node energy. The idle energy is not attributed when the idle power policy is none or when the container
+// energy is estimated by the trained power model of the dynamic power. The core and uncore energy of a container are then clamped to its
+// package energy. The attributable energy that is left, e.g. when no container has energy of a component, is recorded as the unattributed
+// energy of the node.
+func (c *Collector) reconcileContainerEnergy() {
+	idleAttributed := components.IsSystemCollectionSupported() && config.IdlePowerPolicy != config.IdlePowerPolicyNone
+	derivedEnergy := make(map[string]uint64, len(c.ContainersMetrics))
+	for containerID, container := range c.ContainersMetrics {
+		derivedEnergy[containerID] = getDynIdleComponentsEnergy(container)
+	}
+	unattributed := make(map[string]uint64, len(reconciledComponents))
+	for _, component := range reconciledComponents {
+		nodeEnergy := c.NodeMetrics.GetPrometheusEnergyValue(component)
+		// the component is not measured or estimated on the node, there is nothing to reconcile with
+		if nodeEnergy == 0 {
+			continue
+		}
+		attributable := nodeEnergy
+		if !idleAttributed {
+			if idleEnergy := c.NodeMetrics.GetNodeIdleEnergy(component); idleEnergy < nodeEnergy {
+				attributable -= idleEnergy
+			} else {
+				attributable = 0
+			}
+		}
+		containerEnergy := make(map[string]uint64, len(c.ContainersMetrics))
+		var sum uint64
+		for containerID, container := range c.ContainersMetrics {
+			energy := container.GetEnergyStat(component).Curr
+			containerEnergy[containerID] = energy
+			sum += energy
+		}
+		if sum > 0 && sum != attributable {
+			for containerID, energy := range scaleEnergy(containerEnergy, sum, attributable) {
+				c.ContainersMetrics[containerID].GetEnergyStat(component).SetNewCurr(energy)
+			}
+			sum = attributable
+		}
+		unattributed[component] = attributable - sum
+	}
+	// the core and uncore are parts of the package, the energy above the package energy of a container is unattributed
+	if _, reconciled := unattributed["pkg"]; reconciled {
+		for _, container := range c.ContainersMetrics {
+			coreEnergy, uncoreEnergy := clampToPackageEnergy(container)
+			unattributed["core"] += coreEnergy
+			unattributed["uncore"] += uncoreEnergy
+		}
+	}
+	for _, component := range reconciledComponents {
+		if energy, reconciled := unattributed[component]; reconciled {
+			c.NodeMetrics.EnergyUnattributed.AddCurrStat(component, energy)
+		}
+	}
+	for containerID, container := range c.ContainersMetrics {
+		rescaleDynIdleEnergy(container, derivedEnergy[containerID], getDynIdleComponentsEnergy(container))
+	}
+}
+
+// clampToPackageEnergy scales down the core and uncore energy of the container to its package energy and returns the energy taken off
+func clampToPackageEnergy(container *collector_metric.ContainerMetrics) (coreEnergy, uncoreEnergy uint64) {
+	pkgEnergy := container.EnergyInPkg.Curr
+	core, uncore := container.EnergyInCore.Curr, container.EnergyInUncore.Curr
+	if core+uncore <= pkgEnergy {
+		return 0, 0
+	}
+	ratio := float64(pkgEnergy) / float64(core+uncore)
+	clampedCore := uint64(math.Floor(float64(core) * ratio))
+	clampedUncore := uint64(math.Floor(float64(uncore) * ratio))
+	container.EnergyInCore.SetNewCurr(clampedCore)
+	container.EnergyInUncore.SetNewCurr(clampedUncore)
+	return core - clampedCore, uncore - clampedUncore
+}
+
+// getDynIdleComponentsEnergy returns the energy of the components that the dynamic and idle energy of the container add up to
+func getDynIdleComponentsEnergy(container *collector_metric.ContainerMetrics) uint64 {
+	return container.EnergyInPkg.Curr + container.EnergyInDRAM.Curr + container.EnergyInGPU.Curr + container.EnergyInOther.Curr
+}
+
+// rescaleDynIdleEnergy scales the dynamic and idle energy of the container from the derived energy of its components to the reconciled one,
+// the idle energy keeps its share and the dynamic energy is the rest
+func rescaleDynIdleEnergy(container *collector_metric.ContainerMetrics, derived, reconciled uint64) {
+	if derived == reconciled {
+		return
+	}
+	var idleEnergy uint64
+	if derived > 0 {
+		idleEnergy = uint64(math.Round(float64(container.IdleEnergy.Curr) * float64(reconciled) / float64(derived)))
+	}
+	if idleEnergy > reconciled {
+		idleEnergy = reconciled
+	}
+	container.IdleEnergy.SetNewCurr(idleEnergy)
+	container.DynEnergy.SetNewCurr(reconciled - idleEnergy)
+}
+
+// scaleEnergy scales the energy of each container by target/sum, the rounded down values are completed by the largest remainders
+// so that the scaled energy adds up to the target
+func scaleEnergy(energy map[string]uint64, sum, target uint64) map[string]uint64 {
+	type remainder struct {
+		key      string
+		fraction float64
+	}
+	scaled := make(map[string]uint64, len(energy))
+	remainders := make([]remainder, 0, len(energy))
+	var total uint64
+	ratio := float64(target) / float64(sum)
+	for key, value := range energy {
+		exact := float64(value) * ratio
+		scaled[key] = uint64(math.Floor(exact))
+		total += scaled[key]
+		remainders = append(remainders, remainder{key: key, fraction: exact - math.Floor(exact)})
+	}
+	sort.Slice(remainders, func(i, j int) bool {
+		if remainders[i].fraction != remainders[j].fraction {
+			return remainders[i].fraction > remainders[j].fraction
+		}
+		return remainders[i].key < remainders[j].key
+	})
+	// the float rounding can leave more than one unit per container, the loop also removes the excess of a rounded up ratio
+	for i := 0; total < target && len(remainders) > 0; i = (i + 1) % len(remainders) {
+		scaled[remainders[i].key]++
+		total++
+	}
+	for i := len(remainders) - 1; total > target && len(remainders) > 0; i = (i + len(remainders) - 1) % len(remainders) {
+		if scaled[remainders[i].key] > 0 {
+			scaled[remainders[i].key]--
+			total--
+		}
+	}
+	return scaled
+}
@@ -0,0 +1,126 @@
+package collector
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	collector_metric "github.com/sustainable-computing-io/kepler/pkg/collector/metric"
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+)
+
+func newReconcileCollector(pkgEnergy uint64, containerEnergy map[string]uint64) *Collector {
+	nodeMetrics := *collector_metric.NewNodeMetrics()
+	nodeMetrics.EnergyInPkg.AddCurrStat("0", pkgEnergy)
+	containersMetrics := map[string]*collector_metric.ContainerMetrics{}
+	for containerID, energy := range containerEnergy {
+		containersMetrics[containerID] = collector_metric.NewContainerMetrics(containerID, "pod"+containerID, "test")
+		Expect(containersMetrics[containerID].EnergyInPkg.AddNewCurr(energy)).To(Succeed())
+	}
+	return &Collector{ContainersMetrics: containersMetrics, NodeMetrics: nodeMetrics}
+}
+
+func getContainerPkgEnergy(c *Collector) (energy map[string]uint64, sum uint64) {
+	energy = map[string]uint64{}
+	for containerID, container := range c.ContainersMetrics {
+		energy[containerID] = container.EnergyInPkg.Curr
+		sum += container.EnergyInPkg.Curr
+	}
+	return
+}
+
+var _ = Describe("Test Container Energy Reconciliation", func() {
+	policy := config.IdlePowerPolicy
+	AfterEach(func() {
+		config.IdlePowerPolicy = policy
+	})
+
+	It("should scale the rounded up container energy to the node energy", func() {
+		c := newReconcileCollector(1000, map[string]uint64{"A": 334, "B": 334, "C": 334})
+		c.reconcileContainerEnergy()
+		energy, sum := getContainerPkgEnergy(c)
+		Expect(sum).To(Equal(uint64(1000)))
+		Expect(energy).To(Equal(map[string]uint64{"A": 334, "B": 333, "C": 333}))
+		// the aggregated value is corrected too
+		Expect(c.ContainersMetrics["C"].EnergyInPkg.Aggr).To(Equal(uint64(333)))
+		Expect(c.NodeMetrics.EnergyUnattributed.Stat["pkg"].Curr).To(Equal(uint64(0)))
+	})
+
+	It("should scale the container energy up to the node energy", func() {
+		c := newReconcileCollector(1000, map[string]uint64{"A": 100, "B": 300})
+		c.reconcileContainerEnergy()
+		energy, _ := getContainerPkgEnergy(c)
+		Expect(energy).To(Equal(map[string]uint64{"A": 250, "B": 750}))
+	})
+
+	It("should not attribute the idle energy when the idle power policy is none", func() {
+		config.IdlePowerPolicy = config.IdlePowerPolicyNone
+		c := newReconcileCollector(1000, map[string]uint64{"A": 500, "B": 500})
+		c.NodeMetrics.EnergyIdle.AddCurrStat("pkg", 200)
+		c.reconcileContainerEnergy()
+		_, sum := getContainerPkgEnergy(c)
+		Expect(sum).To(Equal(uint64(800)))
+		// the idle energy is exported as the node idle energy, it is not unattributed
+		Expect(c.NodeMetrics.EnergyUnattributed.Stat["pkg"].Curr).To(Equal(uint64(0)))
+	})
+
+	It("should reconcile the core and uncore energy to the node energy", func() {
+		c := newReconcileCollector(1000, map[string]uint64{"A": 1000, "B": 1000})
+		c.NodeMetrics.EnergyInCore.AddCurrStat("0", 700)
+		c.NodeMetrics.EnergyInUncore.AddCurrStat("0", 200)
+		for containerID, energy := range map[string][]uint64{"A": {450, 60}, "B": {450, 40}} {
+			Expect(c.ContainersMetrics[containerID].EnergyInCore.AddNewCurr(energy[0])).To(Succeed())
+			Expect(c.ContainersMetrics[containerID].EnergyInUncore.AddNewCurr(energy[1])).To(Succeed())
+		}
+		c.reconcileContainerEnergy()
+		for component, nodeEnergy := range map[string]uint64{"core": 700, "uncore": 200} {
+			var sum uint64
+			for _, container := range c.ContainersMetrics {
+				sum += container.GetEnergyStat(component).Curr
+			}
+			Expect(sum).To(Equal(nodeEnergy), component)
+			Expect(c.NodeMetrics.EnergyUnattributed.Stat[component].Curr).To(Equal(uint64(0)), component)
+		}
+		for _, container := range c.ContainersMetrics {
+			Expect(container.EnergyInPkg.Curr).To(BeNumerically(">=", container.EnergyInCore.Curr+container.EnergyInUncore.Curr))
+		}
+	})
+
+	It("should clamp the core and uncore energy of a container to its package energy", func() {
+		c := newReconcileCollector(1000, map[string]uint64{"A": 100, "B": 900})
+		c.NodeMetrics.EnergyInCore.AddCurrStat("0", 600)
+		c.NodeMetrics.EnergyInUncore.AddCurrStat("0", 200)
+		// the container A has more core energy than package energy
+		for containerID, energy := range map[string][]uint64{"A": {300, 100}, "B": {300, 100}} {
+			Expect(c.ContainersMetrics[containerID].EnergyInCore.AddNewCurr(energy[0])).To(Succeed())
+			Expect(c.ContainersMetrics[containerID].EnergyInUncore.AddNewCurr(energy[1])).To(Succeed())
+		}
+		c.reconcileContainerEnergy()
+		Expect(c.ContainersMetrics["A"].EnergyInCore.Curr).To(Equal(uint64(75)))
+		Expect(c.ContainersMetrics["A"].EnergyInUncore.Curr).To(Equal(uint64(25)))
+		// the energy taken off is unattributed
+		Expect(c.NodeMetrics.EnergyUnattributed.Stat["core"].Curr).To(Equal(uint64(225)))
+		Expect(c.NodeMetrics.EnergyUnattributed.Stat["uncore"].Curr).To(Equal(uint64(75)))
+	})
+
+	It("should rescale the dynamic and idle energy of the containers", func() {
+		c := newReconcileCollector(1000, map[string]uint64{"A": 600, "B": 600})
+		Expect(c.ContainersMetrics["A"].DynEnergy.AddNewCurr(400)).To(Succeed())
+		Expect(c.ContainersMetrics["A"].IdleEnergy.AddNewCurr(200)).To(Succeed())
+		Expect(c.ContainersMetrics["B"].DynEnergy.AddNewCurr(600)).To(Succeed())
+		c.reconcileContainerEnergy()
+		for _, container := range c.ContainersMetrics {
+			Expect(container.DynEnergy.Curr + container.IdleEnergy.Curr).To(Equal(container.EnergyInPkg.Curr))
+		}
+		Expect(c.ContainersMetrics["A"].IdleEnergy.Curr).To(Equal(uint64(167)))
+		Expect(c.ContainersMetrics["A"].DynEnergy.Aggr).To(Equal(uint64(333)))
+		Expect(c.ContainersMetrics["B"].IdleEnergy.Curr).To(Equal(uint64(0)))
+	})
+
+	It("should export the node energy as unattributed when no container has energy", func() {
+		c := newReconcileCollector(1000, map[string]uint64{"A": 0})
+		c.reconcileContainerEnergy()
+		Expect(c.ContainersMetrics["A"].EnergyInPkg.Curr).To(Equal(uint64(0)))
+		Expect(c.NodeMetrics.EnergyUnattributed.Stat["pkg"].Curr).To(Equal(uint64(1000)))
+		// the components without node energy are not reconciled
+		Expect(c.NodeMetrics.EnergyUnattributed.Stat).NotTo(HaveKey("dram"))
+	})
+})
@@ -18,133 +18,163 @@ package collector
 
 import (
 	"bytes"
-	"encoding/binary"
-
-	"unsafe"
 
 	"github.com/sustainable-computing-io/kepler/pkg/bpfassets/attacher"
 	"github.com/sustainable-computing-io/kepler/pkg/cgroup"
-	collector_metric "github.com/sustainable-computing-io/kepler/pkg/collector/metric"
 	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/utils"
 
 	"k8s.io/klog/v2"
 )
 
-// #define CPU_VECTOR_SIZE 128
-import "C"
+const (
+	nsToMs = 1000000
+	nsToUs = 1000
+)
 
-// TODO in sync with bpf program
+// ProcessBPFMetrics holds the usage of a process since the previous read, the times are in nanoseconds
 type ProcessBPFMetrics struct {
-	CGroupID       uint64
-	PID            uint64
+	CGroupID uint64
+	PID      uint64
+	// ParentPID is the process that forked the process, it is 0 if unknown
+	ParentPID      uint64
 	ProcessRunTime uint64
-	CPUCycles      uint64
-	CPUInstr       uint64
-	CacheMisses    uint64
-	Command        [16]byte
-	CPUTime        [C.CPU_VECTOR_SIZE]uint16
+	// Counters holds the hardware counters in the order of attacher.CounterNames
+	Counters [attacher.MaxCounters]uint64
+	Command  [16]byte
+	// CPUTime holds the time the process ran on each CPU
+	CPUTime map[int32]uint64
+	// Exited is set when the process exited during the period, its /proc entry does not exist anymore
+	Exited bool
+	// KernelThread is set for the kernel threads, they are accounted in the kernel bucket
+	KernelThread bool
+	// SharedRunTime is the part of ProcessRunTime when the sibling hyperthread was busy, it is 0 with procfs
+	SharedRunTime uint64
 }
 
-// resetBPFTables reset BPF module's tables
-func (c *Collector) resetBPFTables() {
-	c.bpfHCMeter.Table.DeleteAll()
-	c.bpfHCMeter.TimeTable.DeleteAll()
+// GetCommand returns the command of the process, it is NUL terminated unless it has the maximum length
+func (ct *ProcessBPFMetrics) GetCommand() string {
+	if end := bytes.IndexByte(ct.Command[:], 0); end >= 0 {
+		return string(ct.Command[:end])
+	}
+	return string(ct.Command[:])
 }
 
-// updateBPFMetrics reads the BPF tables with process/pid/cgroupid metrics (CPU time, available HW counters)
+// updateBPFMetrics reads the process/pid/cgroupid metrics (CPU time, available HW counters) from the process meter
 func (c *Collector) updateBPFMetrics() {
-	if c.bpfHCMeter == nil {
+	if c.processMeter == nil {
 		return
 	}
 	foundContainer := make(map[string]bool)
-	var ct ProcessBPFMetrics
-	for it := c.bpfHCMeter.Table.Iter(); it.Next(); {
-		data := it.Leaf()
-		err := binary.Read(bytes.NewBuffer(data), binary.LittleEndian, &ct)
-		if err != nil {
-			klog.V(5).Infof("failed to decode received data: %v", err)
-			continue
-		}
-		comm := (*C.char)(unsafe.Pointer(&ct.Command))
-
-		containerID, _ := cgroup.GetContainerID(ct.CGroupID, ct.PID, config.EnabledEBPFCgroupID)
-		if err != nil {
-			klog.V(5).Infof("failed to resolve container for cGroup ID %v: %v, set containerID=%s", ct.CGroupID, err, c.systemProcessName)
+	// the IO stats are per cgroup, so they are read once per container
+	readIOContainer := make(map[string]bool)
+	// the memory per NUMA node is only needed to attribute the DRAM energy of several NUMA nodes
+	readNUMAContainer := make(map[string]bool)
+	readNUMAMemory := len(c.NodeMetrics.NUMANodePackages) > 1
+	// the CPU time is accumulated in nanoseconds and converted once per container to not truncate each process time
+	containerCPUTime := make(map[string]uint64)
+	processes := c.processMeter.ReadProcesses()
+	for i := range processes {
+		ct := &processes[i]
+		// the procfs meter does not know the cgroup ID, then the container is resolved with the pid
+		withCGroupID := config.EnabledEBPFCgroupID && ct.CGroupID != 0
+
+		pid := ct.PID
+		var containerID string
+		if ct.KernelThread {
+			// the kernel threads are accounted in the kernel bucket
+			containerID = utils.KernelProcessName
+			c.createKernelMetricsIfNotExist()
+		} else {
+			var err error
+			containerID, err = cgroup.GetContainerID(ct.CGroupID, pid, withCGroupID)
+			if err != nil && !withCGroupID && ct.Exited && ct.ParentPID != 0 {
+				// the process exited before it was resolved, it was forked in the container of its parent
+				pid = ct.ParentPID
+				containerID, err = cgroup.GetContainerID(ct.CGroupID, pid, withCGroupID)
+			}
+			if err != nil {
+				klog.V(5).Infof("failed to resolve container for cGroup ID %v: %v, set containerID=%s", ct.CGroupID, err, c.systemProcessName)
+			}
+			c.createContainersMetricsIfNotExist(containerID, ct.CGroupID, pid, withCGroupID)
 		}
 		// TODO: improve the removal of deleted containers from ContainersMetrics. Currently we verify the maxInactiveContainers using the foundContainer map
 		foundContainer[containerID] = true
 
-		c.createContainersMetricsIfNotExist(containerID, ct.CGroupID, ct.PID, config.EnabledEBPFCgroupID)
-
 		// System process is the aggregation of all background process running outside kubernetes
 		// this means that the list of process might be very large, so we will not add this information to the cache
-		if containerID != c.systemProcessName {
-			c.ContainersMetrics[containerID].SetLatestProcess(ct.CGroupID, ct.PID, C.GoString(comm))
+		if containerID != c.systemProcessName && containerID != utils.KernelProcessName {
+			c.ContainersMetrics[containerID].SetLatestProcess(ct.CGroupID, ct.PID, ct.GetCommand())
 		}
 
 		var activeCPUs []int32
 		var avgFreq float64
 		var totalCPUTime uint64
 		if attacher.EnableCPUFreq {
-			avgFreq, totalCPUTime, activeCPUs = getAVGCPUFreqAndTotalCPUTime(c.NodeCPUFrequency, &ct.CPUTime)
+			avgFreq, totalCPUTime, activeCPUs = getAVGCPUFreqAndTotalCPUTime(c.NodeCPUFrequency, ct.CPUTime)
 			c.ContainersMetrics[containerID].AvgCPUFreq = avgFreq
+			// the per-CPU time of a process is purged when it exits, its run time is still accounted
+			if totalCPUTime == 0 {
+				totalCPUTime = ct.ProcessRunTime
+			}
 		} else {
 			totalCPUTime = ct.ProcessRunTime
-			activeCPUs = getActiveCPUs(&ct.CPUTime)
+			activeCPUs = getActiveCPUs(ct.CPUTime)
 		}
 
 		for _, cpu := range activeCPUs {
-			c.ContainersMetrics[containerID].CurrCPUTimePerCPU[uint32(cpu)] += uint64(ct.CPUTime[cpu])
+			c.ContainersMetrics[containerID].CurrCPUTimePerCPU[uint32(cpu)] += ct.CPUTime[cpu] / nsToUs
 		}
+		containerCPUTime[containerID] += totalCPUTime
+		c.ContainersMetrics[containerID].CurrSharedCPUTime += ct.SharedRunTime / nsToUs
 
-		if err = c.ContainersMetrics[containerID].CPUTime.AddNewCurr(totalCPUTime); err != nil {
-			klog.V(5).Infoln(err)
-		}
-
-		for _, counterKey := range collector_metric.AvailableCounters {
-			var val uint64
-			switch counterKey {
-			case attacher.CPUCycleLable:
-				val = ct.CPUCycles
-			case attacher.CPUInstructionLabel:
-				val = ct.CPUInstr
-			case attacher.CacheMissLabel:
-				val = ct.CacheMisses
-			default:
-				val = 0
+		for i, counterKey := range attacher.CounterNames {
+			// the counters that failed to be opened are not available
+			counterStat, exists := c.ContainersMetrics[containerID].CounterStats[counterKey]
+			if !exists {
+				continue
 			}
-			if err = c.ContainersMetrics[containerID].CounterStats[counterKey].AddNewCurr(val); err != nil {
+			if err := counterStat.AddNewCurr(ct.Counters[i]); err != nil {
 				klog.V(5).Infoln(err)
 			}
 		}
 
 		c.ContainersMetrics[containerID].CurrProcesses++
 		// system process should not include container event
-		if containerID != c.systemProcessName {
-			// TODO: move to container-level section
-			rBytes, wBytes, disks, err := cgroup.ReadCgroupIOStat(ct.CGroupID, ct.PID)
+		if containerID != c.systemProcessName && containerID != utils.KernelProcessName && !readIOContainer[containerID] {
+			deviceStats, err := cgroup.ReadCgroupDeviceIOStat(ct.CGroupID, pid)
+			if err == nil {
+				readIOContainer[containerID] = true
+				c.ContainersMetrics[containerID].SetBlockDeviceStats(deviceStats)
+			}
+		}
+		if readNUMAMemory && containerID != c.systemProcessName && containerID != utils.KernelProcessName && !readNUMAContainer[containerID] {
+			numaMemory, err := cgroup.ReadCgroupNUMAMemory(ct.CGroupID, pid)
 			if err == nil {
-				if disks > c.ContainersMetrics[containerID].Disks {
-					c.ContainersMetrics[containerID].Disks = disks
-				}
-				c.ContainersMetrics[containerID].BytesRead.AddAggrStat(containerID, rBytes)
-				c.ContainersMetrics[containerID].BytesWrite.AddAggrStat(containerID, wBytes)
+				readNUMAContainer[containerID] = true
+				c.ContainersMetrics[containerID].NUMAMemory = numaMemory
 			}
 		}
+		if ct.Exited && !withCGroupID {
+			// the pid can be reused by another process
+			cgroup.RemoveContainerIDFromCache(ct.PID)
+		}
+	}
+	for containerID, cpuTime := range containerCPUTime {
+		// the CPU time feature is in milliseconds
+		if err := c.ContainersMetrics[containerID].CPUTime.AddNewCurr(cpuTime / nsToMs); err != nil {
+			klog.V(5).Infoln(err)
+		}
 	}
-	c.resetBPFTables()
 	c.handleInactiveContainers(foundContainer)
 }
 
 // getAVGCPUFreqAndTotalCPUTime calculates the weighted cpu frequency average
-func getAVGCPUFreqAndTotalCPUTime(cpuFrequency map[int32]uint64, cpuTime *[C.CPU_VECTOR_SIZE]uint16) (avgFreq float64, totalCPUTime uint64, activeCPUs []int32) {
+func getAVGCPUFreqAndTotalCPUTime(cpuFrequency map[int32]uint64, cpuTime map[int32]uint64) (avgFreq float64, totalCPUTime uint64, activeCPUs []int32) {
 	totalFreq := float64(0)
 	totalFreqWithoutWeight := float64(0)
 	for cpu, freq := range cpuFrequency {
-		if int(cpu) > len((*cpuTime))-1 {
-			break
-		}
-		totalCPUTime += uint64(cpuTime[cpu])
+		totalCPUTime += cpuTime[cpu]
 		totalFreqWithoutWeight += float64(freq)
 	}
 	if totalCPUTime == 0 {
@@ -154,9 +184,6 @@ func getAVGCPUFreqAndTotalCPUTime(cpuFrequency map[int32]uint64, cpuTime *[C.CPU
 		avgFreq = totalFreqWithoutWeight / float64(len(cpuFrequency))
 	} else {
 		for cpu, freq := range cpuFrequency {
-			if int(cpu) > len((*cpuTime))-1 {
-				break
-			}
 			if cpuTime[cpu] != 0 {
 				totalFreq += float64(freq) * (float64(cpuTime[cpu]) / float64(totalCPUTime))
 				activeCPUs = append(activeCPUs, cpu)
@@ -168,10 +195,10 @@ func getAVGCPUFreqAndTotalCPUTime(cpuFrequency map[int32]uint64, cpuTime *[C.CPU
 }
 
 // getActiveCPUs returns active cpu(vcpu) (in case that frequency is not active)
-func getActiveCPUs(cpuTime *[C.CPU_VECTOR_SIZE]uint16) (activeCPUs []int32) {
-	for cpu := range cpuTime {
-		if cpuTime[cpu] != 0 {
-			activeCPUs = append(activeCPUs, int32(cpu))
+func getActiveCPUs(cpuTime map[int32]uint64) (activeCPUs []int32) {
+	for cpu, time := range cpuTime {
+		if time != 0 {
+			activeCPUs = append(activeCPUs, cpu)
 		}
 	}
 	return
@@ -187,7 +214,7 @@ func (c *Collector) handleInactiveContainers(foundContainer map[string]bool) {
 			return
 		}
 		for containerID := range c.ContainersMetrics {
-			if containerID == c.systemProcessName {
+			if containerID == c.systemProcessName || containerID == utils.KernelProcessName {
 				continue
 			}
 			if _, found := aliveContainers[containerID]; !found {
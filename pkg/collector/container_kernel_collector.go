@@ -0,0 +1,97 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	collector_metric "github.com/sustainable-computing-io/kepler/pkg/collector/metric"
+	"github.com/sustainable-computing-io/kepler/pkg/utils"
+
+	"k8s.io/klog/v2"
+)
+
+// createKernelMetricsIfNotExist creates the kernel bucket, it holds the kernel threads and the time the CPUs spent in interrupts
+func (c *Collector) createKernelMetricsIfNotExist() {
+	if _, exists := c.ContainersMetrics[utils.KernelProcessName]; !exists {
+		c.ContainersMetrics[utils.KernelProcessName] = collector_metric.NewContainerMetrics(utils.KernelProcessName, utils.KernelProcessName, c.systemProcessNamespace)
+	}
+}
+
+// updateKernelMetrics adds the interrupt time of the CPUs to the kernel bucket, the interrupts are not charged to the processes they interrupted.
+// The time of the network softirqs is attributed to the containers by their share of the network traffic when it is known.
+func (c *Collector) updateKernelMetrics() {
+	if c.processMeter == nil {
+		return
+	}
+	kernelTime := c.processMeter.ReadKernelTime()
+	if len(kernelTime.IRQ) == 0 {
+		return
+	}
+	c.createKernelMetricsIfNotExist()
+	kernel := c.ContainersMetrics[utils.KernelProcessName]
+	shares := c.getNetworkTrafficShares()
+
+	// the CPU time is accumulated in nanoseconds and converted once per container
+	cpuTime := make(map[*collector_metric.ContainerMetrics]float64)
+	for cpu, irqTime := range kernelTime.IRQ {
+		netTime := uint64(0)
+		if len(shares) > 0 {
+			netTime = kernelTime.NetSoftIRQ[cpu]
+			if netTime > irqTime {
+				netTime = irqTime
+			}
+		}
+		kernel.CurrCPUTimePerCPU[uint32(cpu)] += (irqTime - netTime) / nsToUs
+		cpuTime[kernel] += float64(irqTime - netTime)
+		for container, share := range shares {
+			time := float64(netTime) * share
+			container.CurrCPUTimePerCPU[uint32(cpu)] += uint64(time / nsToUs)
+			cpuTime[container] += time
+		}
+	}
+	for container, time := range cpuTime {
+		// the CPU time feature is in milliseconds
+		if err := container.CPUTime.AddNewCurr(uint64(time / nsToMs)); err != nil {
+			klog.V(5).Infoln(err)
+		}
+	}
+}
+
+// getNetworkTrafficShares returns the share of each container in the network traffic of the period,
+// the traffic of a network namespace is evenly divided between its containers. It is empty if there was no traffic.
+func (c *Collector) getNetworkTrafficShares() map[*collector_metric.ContainerMetrics]float64 {
+	shares := make(map[*collector_metric.ContainerMetrics]float64)
+	totalBytes := float64(0)
+	for _, containers := range c.getNetNSContainers() {
+		// all containers in the namespace read the same counters
+		container := containers[0]
+		bytes := uint64(0)
+		for iface, rxBytes := range container.NetRxBytes.Stat {
+			bytes += rxBytes.Curr + getCurr(container.NetTxBytes, iface)
+		}
+		if bytes == 0 {
+			continue
+		}
+		totalBytes += float64(bytes)
+		for _, container := range containers {
+			shares[container] = float64(bytes) / float64(len(containers))
+		}
+	}
+	for container := range shares {
+		shares[container] /= totalBytes
+	}
+	return shares
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"github.com/sustainable-computing-io/kepler/pkg/cgroup"
+	collector_metric "github.com/sustainable-computing-io/kepler/pkg/collector/metric"
+	"github.com/sustainable-computing-io/kepler/pkg/power/network"
+
+	"k8s.io/klog/v2"
+)
+
+// updateNetworkMetrics adds the traffic of the network namespace of each container
+func (c *Collector) updateNetworkMetrics() {
+	for containerID, container := range c.ContainersMetrics {
+		if containerID == c.systemProcessName {
+			continue
+		}
+		// start from the latest process since the older ones are more likely to be finished
+		for i := len(container.PIDS) - 1; i >= 0; i-- {
+			netNS, stats, err := cgroup.ReadNetDevStat(container.PIDS[i])
+			if err != nil {
+				klog.V(5).Infof("failed to read network stats of container %s: %v", containerID, err)
+				continue
+			}
+			container.SetNetworkStats(netNS, stats)
+			break
+		}
+	}
+}
+
+// updateContainerNetworkEnergy estimates the energy of the traffic of each network namespace using the NIC energy model,
+// the energy is evenly divided between the containers sharing the namespace (i.e., the containers of a pod)
+func (c *Collector) updateContainerNetworkEnergy() {
+	if !network.IsNICEnergyModelEnabled() {
+		return
+	}
+	for _, containers := range c.getNetNSContainers() {
+		// all containers in the namespace read the same counters
+		container := containers[0]
+		energy := float64(0)
+		for iface, rxBytes := range container.NetRxBytes.Stat {
+			bytes := rxBytes.Curr + getCurr(container.NetTxBytes, iface)
+			packets := getCurr(container.NetRxPackets, iface) + getCurr(container.NetTxPackets, iface)
+			energy += network.GetEnergy(iface, bytes, packets)
+		}
+		share := energy / float64(len(containers))
+		for _, container := range containers {
+			container.AddNetworkEnergy(share)
+		}
+	}
+}
+
+// getNetNSContainers groups the containers by network namespace
+func (c *Collector) getNetNSContainers() map[string][]*collector_metric.ContainerMetrics {
+	netNSContainers := make(map[string][]*collector_metric.ContainerMetrics)
+	for _, container := range c.ContainersMetrics {
+		if container.NetNS != "" {
+			netNSContainers[container.NetNS] = append(netNSContainers[container.NetNS], container)
+		}
+	}
+	return netNSContainers
+}
+
+func getCurr(stats *collector_metric.UInt64StatCollection, key string) uint64 {
+	if stat, exists := stats.Stat[key]; exists {
+		return stat.Curr
+	}
+	return 0
+}
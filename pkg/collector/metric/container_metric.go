@@ -21,6 +21,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/sustainable-computing-io/kepler/pkg/cgroup"
 	"github.com/sustainable-computing-io/kepler/pkg/config"
 	"github.com/sustainable-computing-io/kepler/pkg/power/accelerator"
 	"k8s.io/klog/v2"
@@ -48,21 +49,44 @@ type ContainerMetrics struct {
 	// TODO: we should consider deprecate the command information
 	Command string
 
+	// CPURequest (in cores) and MemoryRequest (in bytes) are the resource requests of the container, 0 when not set
+	CPURequest    float64
+	MemoryRequest float64
+
 	AvgCPUFreq    float64
 	CurrProcesses int
 	Disks         int
 
+	// CPUTime is in milliseconds
 	CPUTime *UInt64Stat
+	// CoreTime is the CPU time in milliseconds where the time shared with a sibling hyperthread is split between the siblings,
+	// it is only collected with the SMT-aware attribution
+	CoreTime *UInt64Stat
 
 	CounterStats  map[string]*UInt64Stat
 	CgroupFSStats map[string]*UInt64StatCollection
 	KubeletStats  map[string]*UInt64Stat
 	GPUStats      map[string]*UInt64Stat
 
+	// block device IO keyed by device name
 	BytesRead  *UInt64StatCollection
 	BytesWrite *UInt64StatCollection
+	ReadOps    *UInt64StatCollection
+	WriteOps   *UInt64StatCollection
+
+	// network traffic keyed by interface name, it is the traffic of the network namespace shared by the containers of the pod
+	NetNS        string
+	NetRxBytes   *UInt64StatCollection
+	NetTxBytes   *UInt64StatCollection
+	NetRxPackets *UInt64StatCollection
+	NetTxPackets *UInt64StatCollection
 
+	// CurrCPUTimePerCPU is in microseconds
 	CurrCPUTimePerCPU map[uint32]uint64
+	// CurrSharedCPUTime is the CPU time in microseconds when the sibling hyperthread was busy, it is only measured by eBPF
+	CurrSharedCPUTime uint64
+	// NUMAMemory is the memory of the container on each NUMA node in bytes
+	NUMAMemory map[int32]uint64
 
 	EnergyInCore   *UInt64Stat
 	EnergyInDRAM   *UInt64Stat
@@ -70,8 +94,15 @@ type ContainerMetrics struct {
 	EnergyInPkg    *UInt64Stat
 	EnergyInGPU    *UInt64Stat
 	EnergyInOther  *UInt64Stat
+	// EnergyInNetwork is estimated from the traffic with the NIC energy model
+	EnergyInNetwork *UInt64Stat
+
+	// DynEnergy is the energy of the container resource usage, IdleEnergy is its share of the node idle energy
+	DynEnergy  *UInt64Stat
+	IdleEnergy *UInt64Stat
 
-	DynEnergy *UInt64Stat
+	// networkEnergyFraction keeps the mJ fraction not yet added to EnergyInNetwork
+	networkEnergyFraction float64
 }
 
 // NewContainerMetrics creates a new ContainerMetrics instance
@@ -81,6 +112,7 @@ func NewContainerMetrics(containerName, podName, podNamespace string) *Container
 		ContainerName: containerName,
 		Namespace:     podNamespace,
 		CPUTime:       &UInt64Stat{},
+		CoreTime:      &UInt64Stat{},
 		CounterStats:  make(map[string]*UInt64Stat),
 		CgroupFSStats: make(map[string]*UInt64StatCollection),
 		KubeletStats:  make(map[string]*UInt64Stat),
@@ -90,14 +122,35 @@ func NewContainerMetrics(containerName, podName, podNamespace string) *Container
 		BytesWrite: &UInt64StatCollection{
 			Stat: make(map[string]*UInt64Stat),
 		},
+		ReadOps: &UInt64StatCollection{
+			Stat: make(map[string]*UInt64Stat),
+		},
+		WriteOps: &UInt64StatCollection{
+			Stat: make(map[string]*UInt64Stat),
+		},
+		NetRxBytes: &UInt64StatCollection{
+			Stat: make(map[string]*UInt64Stat),
+		},
+		NetTxBytes: &UInt64StatCollection{
+			Stat: make(map[string]*UInt64Stat),
+		},
+		NetRxPackets: &UInt64StatCollection{
+			Stat: make(map[string]*UInt64Stat),
+		},
+		NetTxPackets: &UInt64StatCollection{
+			Stat: make(map[string]*UInt64Stat),
+		},
 		CurrCPUTimePerCPU: make(map[uint32]uint64),
+		NUMAMemory:        make(map[int32]uint64),
 		EnergyInCore:      &UInt64Stat{},
 		EnergyInDRAM:      &UInt64Stat{},
 		EnergyInUncore:    &UInt64Stat{},
 		EnergyInPkg:       &UInt64Stat{},
 		EnergyInOther:     &UInt64Stat{},
 		EnergyInGPU:       &UInt64Stat{},
+		EnergyInNetwork:   &UInt64Stat{},
 		DynEnergy:         &UInt64Stat{},
+		IdleEnergy:        &UInt64Stat{},
 	}
 	for _, metricName := range AvailableCounters {
 		c.CounterStats[metricName] = &UInt64Stat{}
@@ -122,6 +175,7 @@ func NewContainerMetrics(containerName, podName, podNamespace string) *Container
 func (c *ContainerMetrics) ResetCurr() {
 	c.CurrProcesses = 0
 	c.CPUTime.ResetCurr()
+	c.CoreTime.ResetCurr()
 	for counterKey := range c.CounterStats {
 		c.CounterStats[counterKey].ResetCurr()
 	}
@@ -130,17 +184,27 @@ func (c *ContainerMetrics) ResetCurr() {
 	}
 	c.BytesRead.ResetCurr()
 	c.BytesWrite.ResetCurr()
+	c.ReadOps.ResetCurr()
+	c.WriteOps.ResetCurr()
+	c.NetRxBytes.ResetCurr()
+	c.NetTxBytes.ResetCurr()
+	c.NetRxPackets.ResetCurr()
+	c.NetTxPackets.ResetCurr()
 	for kubeletKey := range c.KubeletStats {
 		c.KubeletStats[kubeletKey].ResetCurr()
 	}
 	c.CurrCPUTimePerCPU = make(map[uint32]uint64)
+	c.CurrSharedCPUTime = 0
+	c.NUMAMemory = make(map[int32]uint64)
 	c.EnergyInCore.ResetCurr()
 	c.EnergyInDRAM.ResetCurr()
 	c.EnergyInUncore.ResetCurr()
 	c.EnergyInPkg.ResetCurr()
 	c.EnergyInOther.ResetCurr()
 	c.EnergyInGPU.ResetCurr()
+	c.EnergyInNetwork.ResetCurr()
 	c.DynEnergy.ResetCurr()
+	c.IdleEnergy.ResetCurr()
 }
 
 // SetLatestProcess set cgroupPID, PID, and command to the latest captured process
@@ -162,6 +226,71 @@ func (c *ContainerMetrics) SetLatestProcess(cgroupPID, pid uint64, comm string)
 	c.Command = comm
 }
 
+// SetBlockDeviceStats sets the aggregated IO per block device read from the container cgroup
+func (c *ContainerMetrics) SetBlockDeviceStats(stats map[string]*cgroup.DeviceIOStat) {
+	for device, stat := range stats {
+		c.BytesRead.AddAggrStat(device, stat.ReadBytes)
+		c.BytesWrite.AddAggrStat(device, stat.WriteBytes)
+		c.ReadOps.AddAggrStat(device, stat.ReadOps)
+		c.WriteOps.AddAggrStat(device, stat.WriteOps)
+	}
+	c.Disks = len(stats)
+}
+
+// SetNetworkStats sets the aggregated traffic per interface read from the network namespace of the container
+func (c *ContainerMetrics) SetNetworkStats(netNS string, stats map[string]*cgroup.NetDevStat) {
+	if netNS != c.NetNS {
+		// the container was recreated in another network namespace, the counters restart from zero
+		c.NetNS = netNS
+		c.NetRxBytes.Stat = make(map[string]*UInt64Stat)
+		c.NetTxBytes.Stat = make(map[string]*UInt64Stat)
+		c.NetRxPackets.Stat = make(map[string]*UInt64Stat)
+		c.NetTxPackets.Stat = make(map[string]*UInt64Stat)
+	}
+	for iface, stat := range stats {
+		c.NetRxBytes.AddAggrStat(iface, stat.RxBytes)
+		c.NetTxBytes.AddAggrStat(iface, stat.TxBytes)
+		c.NetRxPackets.AddAggrStat(iface, stat.RxPackets)
+		c.NetTxPackets.AddAggrStat(iface, stat.TxPackets)
+	}
+}
+
+// AddNetworkEnergy adds the network energy in mJ, keeping the fraction for the next update
+func (c *ContainerMetrics) AddNetworkEnergy(energy float64) {
+	energy += c.networkEnergyFraction
+	intEnergy := uint64(energy)
+	c.networkEnergyFraction = energy - float64(intEnergy)
+	if err := c.EnergyInNetwork.AddNewCurr(intEnergy); err != nil {
+		klog.V(5).Infoln(err)
+	}
+}
+
+// GetResUsage returns the resource usage of the container in the period, 0 if the metric is not collected
+func (c *ContainerMetrics) GetResUsage(metric string) float64 {
+	if metric == "" {
+		return 0
+	}
+	curr, _, err := c.extractUIntCurrAggr(metric)
+	if err != nil {
+		return 0
+	}
+	return float64(curr)
+}
+
+// HasResUsage returns whether the metric is collected for the container
+func (c *ContainerMetrics) HasResUsage(metric string) bool {
+	if metric == "" {
+		return false
+	}
+	_, _, err := c.extractUIntCurrAggr(metric)
+	return err == nil
+}
+
+// IsActive returns whether the container ran in the period
+func (c *ContainerMetrics) IsActive() bool {
+	return c.CurrProcesses > 0 || c.CPUTime.Curr > 0
+}
+
 // extractFloatCurrAggr return curr, aggr float64 values of specific uint metric
 func (c *ContainerMetrics) extractFloatCurrAggr(metric string) (curr, aggr float64, err error) {
 	// TO-ADD
@@ -183,12 +312,28 @@ func (c *ContainerMetrics) extractUIntCurrAggr(metric string) (curr, aggr uint64
 	switch metric {
 	case CPUTimeLabel:
 		return c.CPUTime.Curr, c.CPUTime.Aggr, nil
+	case CoreTimeLabel:
+		if config.SMTAwareAttribution {
+			return c.CoreTime.Curr, c.CoreTime.Aggr, nil
+		}
 	// hardcode cgroup metrics
 	// TO-DO: merge to cgroup stat
 	case ByteReadLabel:
 		return c.BytesRead.Curr(), c.BytesRead.Aggr(), nil
 	case ByteWriteLabel:
 		return c.BytesWrite.Curr(), c.BytesWrite.Aggr(), nil
+	case ReadOpsLabel:
+		return c.ReadOps.Curr(), c.ReadOps.Aggr(), nil
+	case WriteOpsLabel:
+		return c.WriteOps.Curr(), c.WriteOps.Aggr(), nil
+	case NetRxBytesLabel:
+		return c.NetRxBytes.Curr(), c.NetRxBytes.Aggr(), nil
+	case NetTxBytesLabel:
+		return c.NetTxBytes.Curr(), c.NetTxBytes.Aggr(), nil
+	case NetRxPacketsLabel:
+		return c.NetRxPackets.Curr(), c.NetRxPackets.Aggr(), nil
+	case NetTxPacketsLabel:
+		return c.NetTxPackets.Curr(), c.NetTxPackets.Aggr(), nil
 	}
 
 	klog.V(4).Infof("cannot extract: %s", metric)
@@ -250,8 +395,8 @@ func (c *ContainerMetrics) ToPrometheusValue(metric string) string {
 	return ""
 }
 
-func (c *ContainerMetrics) GetPrometheusEnergyValue(ekey string, curr bool) float64 {
-	var val *UInt64Stat
+// GetEnergyStat returns the energy of the component (core, dram, uncore, pkg, gpu, other or network) or the dynamic or idle energy
+func (c *ContainerMetrics) GetEnergyStat(ekey string) (val *UInt64Stat) {
 	switch ekey {
 	case "core":
 		val = c.EnergyInCore
@@ -265,7 +410,18 @@ func (c *ContainerMetrics) GetPrometheusEnergyValue(ekey string, curr bool) floa
 		val = c.EnergyInGPU
 	case "other":
 		val = c.EnergyInOther
+	case "network":
+		val = c.EnergyInNetwork
+	case "dynamic":
+		val = c.DynEnergy
+	case "idle":
+		val = c.IdleEnergy
 	}
+	return
+}
+
+func (c *ContainerMetrics) GetPrometheusEnergyValue(ekey string, curr bool) float64 {
+	val := c.GetEnergyStat(ekey)
 	if curr {
 		return float64(val.Curr)
 	}
@@ -284,7 +440,7 @@ func (c *ContainerMetrics) String() string {
 	return fmt.Sprintf("energy from pod (%d processes): name: %s namespace: %s \n"+
 		"\tcgrouppid: %d pid: %d comm: %s\n"+
 		"\tePkg (mJ): %s (eCore: %s eDram: %s eUncore: %s) eGPU (mJ): %s eOther (mJ): %s \n"+
-		"\teDyn (mJ): %s \n"+
+		"\teDyn (mJ): %s eIdle (mJ): %s \n"+
 		"\tavgFreq: %.2f\n"+
 		"\tCPUTime:  %d (%d)\n"+
 		"\tcounters: %v\n"+
@@ -293,7 +449,7 @@ func (c *ContainerMetrics) String() string {
 		c.CurrProcesses, c.PodName, c.Namespace,
 		c.CGroupPID, c.PIDS, c.Command,
 		c.EnergyInPkg, c.EnergyInCore, c.EnergyInDRAM, c.EnergyInUncore, c.EnergyInOther, c.EnergyInGPU,
-		c.DynEnergy,
+		c.DynEnergy, c.IdleEnergy,
 		c.AvgCPUFreq/1000, /*MHZ*/
 		c.CPUTime.Curr, c.CPUTime.Aggr,
 		c.CounterStats,
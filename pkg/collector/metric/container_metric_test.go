@@ -17,8 +17,12 @@ limitations under the License.
 package metric
 
 import (
+	"math"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+
+	"github.com/sustainable-computing-io/kepler/pkg/cgroup"
 )
 
 var _ = Describe("Test Container Metric", func() {
@@ -73,6 +77,22 @@ var _ = Describe("Test Container Metric", func() {
 		Expect(c.GetPrometheusEnergyValue("other", true)).To(Equal(float64(11)))
 	})
 
+	It("Test SetNewCurr", func() {
+		stat := &UInt64Stat{}
+		Expect(stat.AddNewCurr(100)).To(Succeed())
+		Expect(stat.AddNewCurr(20)).To(Succeed())
+		stat.SetNewCurr(50)
+		Expect(*stat).To(Equal(UInt64Stat{Curr: 50, Aggr: 50}))
+		stat.ResetCurr()
+		Expect(stat.AddNewCurr(10)).To(Succeed())
+		stat.SetNewCurr(30)
+		Expect(stat.Aggr).To(Equal(uint64(80)))
+
+		// the aggregated value restarts instead of overflowing
+		stat = &UInt64Stat{Curr: 10, Aggr: math.MaxUint64 - 5}
+		stat.SetNewCurr(20)
+		Expect(*stat).To(Equal(UInt64Stat{Curr: 20, Aggr: 20}))
+	})
 	It("Test extractUIntCurrAggr", func() {
 		curr, aggr, err := c.extractUIntCurrAggr("core")
 		Expect(err).NotTo(HaveOccurred())
@@ -99,4 +119,20 @@ var _ = Describe("Test Container Metric", func() {
 		Expect(curr).To(Equal(uint64(23)))
 		Expect(aggr).To(Equal(uint64(24)))
 	})
+
+	It("Test SetBlockDeviceStats", func() {
+		cm := NewContainerMetrics("container", "pod", "namespace")
+		cm.SetBlockDeviceStats(map[string]*cgroup.DeviceIOStat{
+			"sda":     {Device: "sda", ReadBytes: 10, WriteBytes: 20, ReadOps: 1, WriteOps: 2},
+			"nvme0n1": {Device: "nvme0n1", ReadBytes: 30, WriteBytes: 40, ReadOps: 3, WriteOps: 4},
+		})
+		Expect(cm.Disks).To(Equal(2))
+		_, aggr, err := cm.extractUIntCurrAggr(ByteReadLabel)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(aggr).To(Equal(uint64(40)))
+		_, aggr, err = cm.extractUIntCurrAggr(WriteOpsLabel)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(aggr).To(Equal(uint64(6)))
+		Expect(cm.BytesWrite.Stat["nvme0n1"].Aggr).To(Equal(uint64(40)))
+	})
 })
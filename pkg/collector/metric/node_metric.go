@@ -17,24 +17,19 @@ limitations under the License.
 package metric
 
 import (
-	"encoding/csv"
 	"fmt"
-	"io"
 	"math"
 	"os"
-	"os/exec"
 	"strconv"
-	"strings"
+	"time"
 
-	"github.com/jszwec/csvutil"
 	"k8s.io/klog/v2"
 
+	"github.com/sustainable-computing-io/kepler/pkg/config"
 	"github.com/sustainable-computing-io/kepler/pkg/power/components/source"
 )
 
 var (
-	CPUModelDataPath = "/var/lib/kepler/data/normalized_cpu_arch.csv"
-
 	NodeName            = getNodeName()
 	NodeCPUArchitecture = getCPUArch()
 
@@ -45,11 +40,6 @@ var (
 	NodeMetadataValues []string = []string{NodeCPUArchitecture}
 )
 
-type CPUModelData struct {
-	Name         string `csv:"Name"`
-	Architecture string `csv:"Architecture"`
-}
-
 func getNodeName() string {
 	nodeName, err := os.Hostname()
 	if err != nil {
@@ -59,48 +49,22 @@ func getNodeName() string {
 }
 
 func getCPUArch() string {
-	arch, err := getCPUArchitecture()
+	arch, err := source.GetCPUArchitecture()
 	if err == nil {
 		return arch
 	}
 	return "unknown"
 }
 
-func getCPUArchitecture() (string, error) {
-	// check if there is a CPU architecture override
-	cpuArchOverride := os.Getenv("CPU_ARCH_OVERRIDE")
-	if len(cpuArchOverride) > 0 {
-		klog.V(2).Infof("cpu arch override: %v\n", cpuArchOverride)
-		return cpuArchOverride, nil
-	}
-	output, err := exec.Command("archspec", "cpu").Output()
-	if err != nil {
-		return "", err
-	}
-	myCPUModel := strings.TrimSuffix(string(output), "\n")
-	file, err := os.Open(CPUModelDataPath)
-	if err != nil {
-		return "", err
-	}
-	reader := csv.NewReader(file)
-
-	dec, err := csvutil.NewDecoder(reader)
-	if err != nil {
-		return "", err
-	}
-
-	for {
-		var p CPUModelData
-		if err := dec.Decode(&p); err == io.EOF {
-			break
-		}
-		if strings.HasPrefix(myCPUModel, p.Name) {
-			return p.Architecture, nil
-		}
-	}
-
-	return "", fmt.Errorf("no CPU power model found for architecture %s", myCPUModel)
-}
+const (
+	// the sources of the node energy of the components, exported by kepler_node_energy_source
+	EnergySourceRAPL = "rapl"
+	EnergySourceACPI = "acpi"
+	// EnergySourceEstimated is the energy estimated from the CPU utilization on the nodes without power measurement
+	EnergySourceEstimated = "estimated"
+	// EnergySourceModel is the energy estimated by the trained power models of the node
+	EnergySourceModel = "trained_power_model"
+)
 
 type NodeMetrics struct {
 	ResourceUsage    map[string]float64
@@ -111,6 +75,37 @@ type NodeMetrics struct {
 	EnergyInGPU      *UInt64StatCollection
 	EnergyInOther    *UInt64StatCollection
 	EnergyInPlatform *UInt64StatCollection
+	// EnergyInPkgIdle and EnergyInPkgActive split the package energy by the idle state residency of its CPUs
+	EnergyInPkgIdle   *UInt64StatCollection
+	EnergyInPkgActive *UInt64StatCollection
+	// CPUIdleResidency holds the ratio of the period that each CPU spent in each idle state (C-state)
+	CPUIdleResidency map[int32]map[string]float64
+	// EnergyIdle holds the idle energy of the period per component (core, uncore, pkg, dram, gpu and other)
+	EnergyIdle *UInt64StatCollection
+	// EnergyUnattributed holds the energy of the period per component that is attributable to the containers but not attributed to any container,
+	// the idle energy that is not attributed is only in EnergyIdle
+	EnergyUnattributed *UInt64StatCollection
+	// CPUPackages and NUMANodePackages map the CPUs and the NUMA nodes to their package (socket), the energy of each package is attributed
+	// to the containers by their CPU time on the CPUs of the package and the DRAM energy by their memory on the NUMA nodes of the package
+	CPUPackages      map[int32]int
+	NUMANodePackages map[int32]int
+	// UsageMetrics holds the usage metric chosen for each component (core, uncore, dram, gpu and other), empty if none is collected
+	UsageMetrics map[string]string
+	// ComponentsEnergySource and PlatformEnergySource are where the energy of the components and of the platform comes from, e.g. EnergySourceRAPL,
+	// empty if the energy is neither measured nor estimated
+	ComponentsEnergySource string
+	PlatformEnergySource   string
+	// minPower holds the power samples of each component that can still be the minimum of the idle window, in increasing order
+	// of time and power, the idle baseline is the first sample
+	minPower map[string][]powerSample
+	// idleClock is the sum of the periods, the time of the power samples
+	idleClock time.Duration
+}
+
+// powerSample is the average power (mJ/s) of a component in the period that ended at the given time of the idle clock
+type powerSample struct {
+	at    time.Duration
+	power float64
 }
 
 func NewNodeMetrics() *NodeMetrics {
@@ -136,6 +131,23 @@ func NewNodeMetrics() *NodeMetrics {
 		EnergyInPlatform: &UInt64StatCollection{
 			Stat: make(map[string]*UInt64Stat),
 		},
+		EnergyInPkgIdle: &UInt64StatCollection{
+			Stat: make(map[string]*UInt64Stat),
+		},
+		EnergyInPkgActive: &UInt64StatCollection{
+			Stat: make(map[string]*UInt64Stat),
+		},
+		CPUIdleResidency: make(map[int32]map[string]float64),
+		EnergyIdle: &UInt64StatCollection{
+			Stat: make(map[string]*UInt64Stat),
+		},
+		EnergyUnattributed: &UInt64StatCollection{
+			Stat: make(map[string]*UInt64Stat),
+		},
+		CPUPackages:      make(map[int32]int),
+		NUMANodePackages: make(map[int32]int),
+		UsageMetrics:     make(map[string]string),
+		minPower:         make(map[string][]powerSample),
 	}
 }
 
@@ -148,6 +160,11 @@ func (ne *NodeMetrics) ResetCurr() {
 	ne.EnergyInGPU.ResetCurr()
 	ne.EnergyInOther.ResetCurr()
 	ne.EnergyInPlatform.ResetCurr()
+	ne.EnergyInPkgIdle.ResetCurr()
+	ne.EnergyInPkgActive.ResetCurr()
+	ne.CPUIdleResidency = make(map[int32]map[string]float64)
+	ne.EnergyIdle.ResetCurr()
+	ne.EnergyUnattributed.ResetCurr()
 }
 
 // AddNodeResResourceUsageFromContainerResResourceUsage adds the sum of all container resource usage as the node resource usage
@@ -164,6 +181,39 @@ func (ne *NodeMetrics) AddNodeResUsageFromContainerResUsage(containersMetrics ma
 	ne.ResourceUsage = nodeResourceUsage
 }
 
+// SelectUsageMetrics chooses the usage metric of each component, the first metric of its preference list that is collected for the containers
+func (ne *NodeMetrics) SelectUsageMetrics(containersMetrics map[string]*ContainerMetrics) {
+	preferences := map[string][]string{
+		"core":   config.CoreUsageMetrics,
+		"uncore": config.UncoreUsageMetrics,
+		"dram":   config.DRAMUsageMetrics,
+		"gpu":    config.GpuUsageMetrics,
+		"other":  config.GeneralUsageMetrics,
+	}
+	for component, metrics := range preferences {
+		selected := ""
+		for _, metric := range metrics {
+			if isUsageMetricCollected(metric, containersMetrics) {
+				selected = metric
+				break
+			}
+		}
+		if previous, exists := ne.UsageMetrics[component]; !exists || previous != selected {
+			klog.Infof("the %s energy is attributed by the usage metric %q from %v", component, selected, metrics)
+		}
+		ne.UsageMetrics[component] = selected
+	}
+}
+
+func isUsageMetricCollected(metric string, containersMetrics map[string]*ContainerMetrics) bool {
+	for _, container := range containersMetrics {
+		if container.HasResUsage(metric) {
+			return true
+		}
+	}
+	return false
+}
+
 // AddLastestPlatformEnergy adds the lastest energy consumption from the node sensor
 func (ne *NodeMetrics) AddLastestPlatformEnergy(platformEnergy map[string]float64) {
 	for sensorID, energy := range platformEnergy {
@@ -182,6 +232,107 @@ func (ne *NodeMetrics) AddNodeComponentsEnergy(componentsEnergy map[int]source.N
 	}
 }
 
+// SetCPUIdleResidency adds the idle state residency of the period (in microseconds per CPU and state) as node features
+// and splits the package energy into its idle and active portions, proportionally to the time that the CPUs of each package were idle.
+// It must be called after the node resource usage and the package energy are updated.
+func (ne *NodeMetrics) SetCPUIdleResidency(residency map[int32]map[string]uint64, elapsed time.Duration, cpuPackages map[int32]int) {
+	periodUs := float64(elapsed.Microseconds())
+	if len(residency) == 0 || periodUs <= 0 {
+		return
+	}
+	stateRatios := make(map[string]float64)
+	nodeIdle := float64(0)
+	packageIdle := make(map[string]float64)
+	packageCPUs := make(map[string]int)
+	for cpu, states := range residency {
+		ne.CPUIdleResidency[cpu] = make(map[string]float64)
+		cpuIdle := float64(0)
+		for state, time := range states {
+			ratio := math.Min(float64(time)/periodUs, 1)
+			ne.CPUIdleResidency[cpu][state] = ratio
+			stateRatios[state] += ratio / float64(len(residency))
+			cpuIdle += ratio
+		}
+		cpuIdle = math.Min(cpuIdle, 1)
+		nodeIdle += cpuIdle / float64(len(residency))
+		if pkgID, exists := cpuPackages[cpu]; exists {
+			key := strconv.Itoa(pkgID)
+			packageIdle[key] += cpuIdle
+			packageCPUs[key]++
+		}
+	}
+
+	if ne.ResourceUsage == nil {
+		ne.ResourceUsage = make(map[string]float64)
+	}
+	ne.ResourceUsage[config.CPUIdleRatio] = nodeIdle
+	for state, ratio := range stateRatios {
+		ne.ResourceUsage[config.CPUIdleRatio+"_"+state] = ratio
+	}
+
+	for pkgID, pkgEnergy := range ne.EnergyInPkg.Stat {
+		idleRatio := nodeIdle
+		// the package IDs of the estimated energy might not match the CPU topology
+		if cpus := packageCPUs[pkgID]; cpus > 0 {
+			idleRatio = packageIdle[pkgID] / float64(cpus)
+		}
+		idleEnergy := uint64(float64(pkgEnergy.Curr) * idleRatio)
+		ne.EnergyInPkgIdle.AddCurrStat(pkgID, idleEnergy)
+		ne.EnergyInPkgActive.AddCurrStat(pkgID, pkgEnergy.Curr-idleEnergy)
+	}
+}
+
+// UpdateIdleEnergy learns the idle baseline of each component from the minimum power observed in the last config.IdlePowerWindow and sets
+// the baseline power over the period as the idle energy of the period. It must be called after the node energy is updated.
+func (ne *NodeMetrics) UpdateIdleEnergy(period time.Duration) {
+	if period <= 0 {
+		return
+	}
+	ne.idleClock += period
+	componentsEnergy := ne.GetNodeTotalEnergyPerComponent()
+	energyPerComponent := map[string]uint64{
+		"core":   componentsEnergy.Core,
+		"uncore": componentsEnergy.Uncore,
+		"pkg":    componentsEnergy.Pkg,
+		"dram":   componentsEnergy.DRAM,
+		"gpu":    ne.GetNodeTotalGPUEnergy(),
+		"other":  ne.GetNodeTotalOtherComponentsEnergy(),
+	}
+	for component, energy := range energyPerComponent {
+		// the component is not available or the energy was not updated in this period
+		if energy == 0 {
+			continue
+		}
+		power := float64(energy) / period.Seconds()
+		// the samples with a higher power than the new one can no longer be the minimum of the window
+		samples := ne.minPower[component]
+		for len(samples) > 0 && samples[len(samples)-1].power >= power {
+			samples = samples[:len(samples)-1]
+		}
+		samples = append(samples, powerSample{at: ne.idleClock, power: power})
+		if config.IdlePowerWindow > 0 {
+			for samples[0].at <= ne.idleClock-config.IdlePowerWindow {
+				samples = samples[1:]
+			}
+		}
+		ne.minPower[component] = samples
+
+		idleEnergy := uint64(samples[0].power * period.Seconds())
+		if idleEnergy > energy {
+			idleEnergy = energy
+		}
+		ne.EnergyIdle.AddCurrStat(component, idleEnergy)
+	}
+}
+
+// GetNodeIdleEnergy returns the idle energy of the component in the period
+func (ne *NodeMetrics) GetNodeIdleEnergy(component string) uint64 {
+	if stat, exists := ne.EnergyIdle.Stat[component]; exists {
+		return stat.Curr
+	}
+	return 0
+}
+
 // AddNodeGPUEnergy adds the lastest energy consumption of each GPU power consumption.
 // Right now we don't support other types of accelerators than GPU, but we will in the future.
 func (ne *NodeMetrics) AddNodeGPUEnergy(gpuEnergy []uint32) {
@@ -224,7 +375,13 @@ func (ne *NodeMetrics) GetNodeTotalEnergyPerComponent() source.NodeComponentsEne
 		pkgValue = ne.EnergyInOther.Curr()
 	}
 	if coreValue == 0 {
-		coreValue = pkgValue - uncoreValue
+		// the core energy of each package is derived like the energy attributed per package
+		for pkgID := range ne.EnergyInPkg.Stat {
+			coreValue += ne.GetPackageCoreEnergy(pkgID)
+		}
+		if coreValue == 0 {
+			coreValue = getCoreEnergy(0, uncoreValue, pkgValue)
+		}
 	}
 	return source.NodeComponentsEnergy{
 		Core:   coreValue,
@@ -234,6 +391,29 @@ func (ne *NodeMetrics) GetNodeTotalEnergyPerComponent() source.NodeComponentsEne
 	}
 }
 
+// GetPackageCoreEnergy returns the core energy of the package, the package energy without the uncore if the core is not reported
+func (ne *NodeMetrics) GetPackageCoreEnergy(pkgID string) uint64 {
+	var coreValue, uncoreValue, pkgValue uint64
+	if stat, exists := ne.EnergyInCore.Stat[pkgID]; exists {
+		coreValue = stat.Curr
+	}
+	if stat, exists := ne.EnergyInUncore.Stat[pkgID]; exists {
+		uncoreValue = stat.Curr
+	}
+	if stat, exists := ne.EnergyInPkg.Stat[pkgID]; exists {
+		pkgValue = stat.Curr
+	}
+	return getCoreEnergy(coreValue, uncoreValue, pkgValue)
+}
+
+// getCoreEnergy returns the core energy or the package energy without the uncore if the core is not reported
+func getCoreEnergy(coreValue, uncoreValue, pkgValue uint64) uint64 {
+	if coreValue == 0 && pkgValue > uncoreValue {
+		return pkgValue - uncoreValue
+	}
+	return coreValue
+}
+
 func (ne *NodeMetrics) GetNodeTotalGPUEnergy() uint64 {
 	return ne.EnergyInGPU.Curr()
 }
@@ -17,6 +17,8 @@ limitations under the License.
 package metric
 
 import (
+	"time"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/sustainable-computing-io/kepler/pkg/config"
@@ -103,4 +105,56 @@ var _ = Describe("Test Node Metric", func() {
 		out := nodeMetrics.GetPrometheusEnergyValue("core")
 		Expect(out).To(Equal(uint64(5)))
 	})
+
+	It("Split the package energy by the idle state residency", func() {
+		// cpu0 is idle 75% of the period and cpu1 25%, both are in the package 0
+		residency := map[int32]map[string]uint64{
+			0: {"C1": 500000, "C6": 250000},
+			1: {"C1": 0, "C6": 250000},
+		}
+		nodeMetrics.SetCPUIdleResidency(residency, time.Second, map[int32]int{0: 0, 1: 0})
+		Expect(nodeMetrics.CPUIdleResidency[0]["C1"]).To(Equal(0.5))
+		Expect(nodeMetrics.ResourceUsage[config.CPUIdleRatio]).To(Equal(0.5))
+		Expect(nodeMetrics.ResourceUsage[config.CPUIdleRatio+"_C6"]).To(Equal(0.25))
+		// the package energy of the period is 8 mJ
+		Expect(nodeMetrics.EnergyInPkgIdle.Curr()).To(Equal(uint64(4)))
+		Expect(nodeMetrics.EnergyInPkgActive.Curr()).To(Equal(uint64(4)))
+	})
+
+	It("Learn the idle baseline from the minimum power in the window", func() {
+		defer func(window time.Duration) { config.IdlePowerWindow = window }(config.IdlePowerWindow)
+		config.IdlePowerWindow = 10 * time.Second
+		idle := NewNodeMetrics()
+		update := func(pkgEnergy uint64, period time.Duration) uint64 {
+			idle.ResetCurr()
+			idle.EnergyInPkg.AddCurrStat("0", pkgEnergy)
+			idle.UpdateIdleEnergy(period)
+			return idle.GetNodeIdleEnergy("pkg")
+		}
+		// 20 mJ in 2s is the minimum power, 10 mJ/s
+		Expect(update(60, 3*time.Second)).To(Equal(uint64(60)))
+		Expect(update(20, 2*time.Second)).To(Equal(uint64(20)))
+		// the baseline power is scaled to the duration of the period
+		Expect(update(90, 3*time.Second)).To(Equal(uint64(30)))
+		Expect(update(80, 4*time.Second)).To(Equal(uint64(40)))
+		// the period without energy does not change the baseline
+		Expect(update(0, time.Second)).To(Equal(uint64(0)))
+		// the minimum is older than the window, the baseline recovers to the minimum of the window, 20 mJ/s
+		Expect(update(60, 3*time.Second)).To(Equal(uint64(60)))
+		// no period, e.g. the first read of the energy counters
+		Expect(update(60, 0)).To(Equal(uint64(0)))
+	})
+
+	It("Select the first collected usage metric of each component", func() {
+		defer func(metrics []string) { config.CoreUsageMetrics = metrics }(config.CoreUsageMetrics)
+		// the hardware counters and the cgroup CPU usage are not collected
+		config.CoreUsageMetrics = []string{config.CPUInstruction, config.CgroupfsCPU, config.CgroupfsMemory, config.CPUTime}
+		nodeMetrics.SelectUsageMetrics(containerMetrics)
+		Expect(nodeMetrics.UsageMetrics["core"]).To(Equal(config.CgroupfsMemory))
+		Expect(nodeMetrics.UsageMetrics["uncore"]).To(BeEmpty())
+
+		config.CoreUsageMetrics = []string{config.CPUInstruction}
+		nodeMetrics.SelectUsageMetrics(containerMetrics)
+		Expect(nodeMetrics.UsageMetrics["core"]).To(BeEmpty())
+	})
 })
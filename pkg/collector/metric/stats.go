@@ -17,9 +17,17 @@ const (
 	// TO-DO: merge to cgroup stat
 	ByteReadLabel    = config.BytesReadIO
 	ByteWriteLabel   = config.BytesWriteIO
+	ReadOpsLabel     = config.ReadOpsIO
+	WriteOpsLabel    = config.WriteOpsIO
 	blockDeviceLabel = config.BlockDevicesIO
 
-	CPUTimeLabel = config.CPUTime
+	NetRxBytesLabel   = config.NetRxBytes
+	NetTxBytesLabel   = config.NetTxBytes
+	NetRxPacketsLabel = config.NetRxPackets
+	NetTxPacketsLabel = config.NetTxPackets
+
+	CPUTimeLabel  = config.CPUTime
+	CoreTimeLabel = config.CoreTime
 
 	CurrPrefix = "curr_"
 	AggrPrefix = "total_"
@@ -75,6 +83,21 @@ func (s *UInt64Stat) AddNewCurr(newCurr uint64) error {
 	return nil
 }
 
+// SetNewCurr replaces the value added in the current period (e.g., a reconciled energy) and corrects the aggregated value
+func (s *UInt64Stat) SetNewCurr(newCurr uint64) {
+	prevAggr := uint64(0)
+	// the aggregated value can be below the current value after an overflow of SetNewAggr
+	if s.Aggr >= s.Curr {
+		prevAggr = s.Aggr - s.Curr
+	}
+	if math.MaxUint64-newCurr < prevAggr {
+		// overflow: the aggregated value restarts like in AddNewCurr
+		prevAggr = 0
+	}
+	s.Aggr = prevAggr + newCurr
+	s.Curr = newCurr
+}
+
 // SetNewAggr set new read aggregated value (e.g., from cgroup, energy files)
 func (s *UInt64Stat) SetNewAggr(newAggr uint64) error {
 	oldAggr := s.Aggr
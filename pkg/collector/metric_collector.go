@@ -17,7 +17,6 @@ limitations under the License.
 package collector
 
 import (
-	"fmt"
 	"time"
 
 	"github.com/sustainable-computing-io/kepler/pkg/bpfassets/attacher"
@@ -25,6 +24,7 @@ import (
 	"github.com/sustainable-computing-io/kepler/pkg/config"
 	"github.com/sustainable-computing-io/kepler/pkg/power/accelerator"
 	"github.com/sustainable-computing-io/kepler/pkg/power/acpi"
+	"github.com/sustainable-computing-io/kepler/pkg/training"
 	"github.com/sustainable-computing-io/kepler/pkg/utils"
 
 	collector_metric "github.com/sustainable-computing-io/kepler/pkg/collector/metric"
@@ -35,13 +35,20 @@ import (
 
 const (
 	maxInactiveContainers = 10
+
+	procfsPath = "/proc"
 )
 
 type Collector struct {
-	// instance that collects the bpf metrics
-	bpfHCMeter *attacher.BpfModuleTables
+	// instance that collects the process metrics, from eBPF or from procfs if eBPF is not available
+	processMeter ProcessMeter
 	// instance that collects the node energy consumption
 	acpiPowerMeter *acpi.ACPI
+	// instance that collects the idle state residency of the CPUs
+	cpuIdleReader *acpi.CPUIdleReader
+
+	// lastUpdate is the time of the previous update
+	lastUpdate time.Time
 
 	// TODO: fix me: these metrics should be in NodeMetrics structure
 	NodeCPUFrequency map[int32]uint64
@@ -60,21 +67,30 @@ type Collector struct {
 func NewCollector() *Collector {
 	c := &Collector{
 		acpiPowerMeter:         acpi.NewACPIPowerMeter(),
+		cpuIdleReader:          acpi.NewCPUIdleReader(acpi.CPUPathDir),
 		NodeCPUFrequency:       map[int32]uint64{},
 		NodeMetrics:            *collector_metric.NewNodeMetrics(),
 		ContainersMetrics:      map[string]*collector_metric.ContainerMetrics{},
 		systemProcessName:      utils.SystemProcessName,
 		systemProcessNamespace: utils.SystemProcessNamespace,
 	}
+	topology := acpi.ReadCPUTopology(acpi.CPUPathDir, acpi.NodePathDir)
+	c.NodeMetrics.CPUPackages = topology.CPUPackages
+	c.NodeMetrics.NUMANodePackages = topology.NUMANodePackages
 	return c
 }
 
 func (c *Collector) Initialize() error {
-	m, err := attacher.AttachBPFAssets()
-	if err != nil {
-		return fmt.Errorf("failed to attach bpf assets: %v", err)
+	if m, err := attacher.AttachBPFAssets(); err != nil {
+		klog.Warningf("failed to attach bpf assets: %v, falling back to procfs, hardware counter metrics are not available", err)
+		c.processMeter = newProcfsProcessMeter(procfsPath)
+	} else if bpfMeter, err := newBPFProcessMeter(m); err != nil {
+		klog.Warningf("failed to read the bpf assets: %v, falling back to procfs, hardware counter metrics are not available", err)
+		attacher.DetachBPFModules(m)
+		c.processMeter = newProcfsProcessMeter(procfsPath)
+	} else {
+		c.processMeter = bpfMeter
 	}
-	c.bpfHCMeter = m
 
 	pods, err := cgroup.Init()
 	if err != nil {
@@ -83,22 +99,26 @@ func (c *Collector) Initialize() error {
 	}
 
 	c.prePopulateContainerMetrics(pods)
-	c.updateNodeEnergyMetrics()
+	// the first read initializes the energy counters, there is no period yet
+	c.updateNodeEnergyMetrics(0)
 	c.acpiPowerMeter.Run()
-	c.resetBPFTables()
+	c.processMeter.Reset()
+	c.lastUpdate = time.Now()
 
 	return nil
 }
 
 func (c *Collector) Destroy() {
-	if c.bpfHCMeter != nil {
-		attacher.DetachBPFModules(c.bpfHCMeter)
+	if c.processMeter != nil {
+		c.processMeter.Close()
 	}
 }
 
 // Update updates the node and container energy and resource usage metrics
 func (c *Collector) Update() {
 	start := time.Now()
+	period := start.Sub(c.lastUpdate)
+	c.lastUpdate = start
 
 	// reset the previous collected value because not all containers will have new data
 	// that is, a container that was inactive will not have any update but we need to set its metrics to 0
@@ -106,14 +126,20 @@ func (c *Collector) Update() {
 
 	// update container metrics regarding the resource utilization to be used to calculate the energy consumption
 	// we first updates the bpf which is resposible to include new containers in the ContainersMetrics collection
-	// the bpf collects metrics per processes and then map the process ids to container ids
-	// TODO: when bpf is not running, the ContainersMetrics will not be updated with new containers.
-	// The ContainersMetrics will only have the containers that were identified during the initialization (initContainersMetrics)
+	// the bpf (or procfs when bpf is not available) collects metrics per processes and then map the process ids to container ids
 	c.updateBPFMetrics() // collect new hardware counter metrics if possible
 
 	// TODO: collect cgroup metrics only from cgroup to avoid unnecessary overhead to kubelet
 	c.updateCgroupMetrics()  // collect new cgroup metrics from cgroup
 	c.updateKubeletMetrics() // collect new cgroup metrics from kubelet
+	if config.EnabledNetworkMetrics {
+		c.updateNetworkMetrics() // collect new network metrics from the container network namespace
+	}
+	// the network softirqs are attributed by the network traffic of the containers
+	c.updateKernelMetrics() // collect the interrupt time of the CPUs
+	if config.SMTAwareAttribution {
+		c.updateCoreTimeMetrics() // split the time that sibling hyperthreads shared a core
+	}
 
 	if config.EnabledGPU && accelerator.IsGPUCollectionSupported() {
 		c.updateAcceleratorMetrics()
@@ -121,10 +147,20 @@ func (c *Collector) Update() {
 
 	// use the container's resource usage metrics to update the node metrics
 	c.updateNodeResourceUsage()
-	c.updateNodeEnergyMetrics()
+	c.updateNodeEnergyMetrics(period)
+	c.updateNodeCPUIdleMetrics()
 
 	// calculate the container energy consumption using its resource utilization and the node components energy consumption
 	c.updateContainerEnergy()
+	if config.EnergyReconciliation {
+		c.reconcileContainerEnergy() // match the container energy sum with the node energy
+	}
+	c.updateContainerNetworkEnergy()
+
+	// write the features and the measured energy of the period for the power model training
+	if training.IsEnabled() {
+		c.updateTrainingData(period)
+	}
 
 	// check the log verbosity level before iterating in all container
 	if klog.V(3).Enabled() {
@@ -154,16 +190,19 @@ func (c *Collector) prePopulateContainerMetrics(pods *[]corev1.Pod) {
 			container := pod.Status.InitContainerStatuses[j]
 			containerID := cgroup.ParseContainerIDFromPodStatus(container.ContainerID)
 			c.ContainersMetrics[containerID] = collector_metric.NewContainerMetrics(container.Name, pod.Name, pod.Namespace)
+			c.ContainersMetrics[containerID].CPURequest, c.ContainersMetrics[containerID].MemoryRequest = cgroup.GetPodContainerRequests(&pod, container.Name)
 		}
 		for j := 0; j < len(pod.Status.ContainerStatuses); j++ {
 			container := pod.Status.ContainerStatuses[j]
 			containerID := cgroup.ParseContainerIDFromPodStatus(container.ContainerID)
 			c.ContainersMetrics[containerID] = collector_metric.NewContainerMetrics(container.Name, pod.Name, pod.Namespace)
+			c.ContainersMetrics[containerID].CPURequest, c.ContainersMetrics[containerID].MemoryRequest = cgroup.GetPodContainerRequests(&pod, container.Name)
 		}
 		for j := 0; j < len(pod.Status.EphemeralContainerStatuses); j++ {
 			container := pod.Status.EphemeralContainerStatuses[j]
 			containerID := cgroup.ParseContainerIDFromPodStatus(container.ContainerID)
 			c.ContainersMetrics[containerID] = collector_metric.NewContainerMetrics(container.Name, pod.Name, pod.Namespace)
+			c.ContainersMetrics[containerID].CPURequest, c.ContainersMetrics[containerID].MemoryRequest = cgroup.GetPodContainerRequests(&pod, container.Name)
 		}
 	}
 }
@@ -1,14 +1,19 @@
 package collector
 
 import (
+	"time"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	collector_metric "github.com/sustainable-computing-io/kepler/pkg/collector/metric"
 
+	"github.com/sustainable-computing-io/kepler/pkg/bpfassets/attacher"
 	"github.com/sustainable-computing-io/kepler/pkg/cgroup"
 	"github.com/sustainable-computing-io/kepler/pkg/config"
 	"github.com/sustainable-computing-io/kepler/pkg/power/accelerator"
 	"github.com/sustainable-computing-io/kepler/pkg/power/components/source"
+	"github.com/sustainable-computing-io/kepler/pkg/power/network"
+	"github.com/sustainable-computing-io/kepler/pkg/utils"
 )
 
 // we need to add all metric to a container, otherwise it will not create the right usageMetric with all elements. The usageMetric is used in the Prediction Power Models
@@ -121,6 +126,26 @@ func createMockNodeMetrics(containersMetrics map[string]*collector_metric.Contai
 	return nodeMetrics
 }
 
+// fakeProcessMeter returns the same processes at every read
+type fakeProcessMeter struct {
+	processes  []ProcessBPFMetrics
+	kernelTime KernelTime
+}
+
+func (m *fakeProcessMeter) ReadProcesses() []ProcessBPFMetrics {
+	return m.processes
+}
+
+func (m *fakeProcessMeter) ReadKernelTime() KernelTime {
+	return m.kernelTime
+}
+
+func (m *fakeProcessMeter) Reset() {
+}
+
+func (m *fakeProcessMeter) Close() {
+}
+
 func newMockCollector() *Collector {
 	metricCollector := NewCollector()
 	metricCollector.ContainersMetrics = createMockContainersMetrics()
@@ -150,10 +175,88 @@ var _ = Describe("Test Collector Unit", func() {
 		// update container and node metrics
 		metricCollector.updateAcceleratorMetrics()
 		metricCollector.updateNodeResourceUsage()
-		metricCollector.updateNodeEnergyMetrics()
+		metricCollector.updateNodeEnergyMetrics(3 * time.Second)
 		// TODO CONTINUE -- it is missing the node energy
 		metricCollector.updateContainerEnergy()
 		Expect(metricCollector.ContainersMetrics["containerA"].EnergyInPkg.Curr).ShouldNot(BeNil())
 	})
 
+	It("Update the container metrics from the process meter", func() {
+		// the pid is not in any container, its usage is added to the system processes
+		// the counters are in the order of attacher.CounterNames: cpu_cycles, cpu_instr, cache_miss
+		ct := ProcessBPFMetrics{PID: 1 << 40, ProcessRunTime: 30, Counters: [attacher.MaxCounters]uint64{100, 50, 5}}
+		// 10.5ms and 20ms, the sub-millisecond times of the processes are summed
+		ct.CPUTime = map[int32]uint64{0: 10500000, 1: 20000000}
+		metricCollector.processMeter = &fakeProcessMeter{processes: []ProcessBPFMetrics{ct, ct}}
+		metricCollector.NodeCPUFrequency = map[int32]uint64{0: 2000000, 1: 2000000}
+
+		metricCollector.updateBPFMetrics()
+		systemProcesses := metricCollector.ContainersMetrics[utils.SystemProcessName]
+		Expect(systemProcesses).NotTo(BeNil())
+		Expect(systemProcesses.CurrProcesses).To(Equal(2))
+		Expect(systemProcesses.CPUTime.Curr).To(Equal(uint64(61)))
+		Expect(systemProcesses.CounterStats[config.CPUInstruction].Curr).To(Equal(uint64(100)))
+		Expect(systemProcesses.CurrCPUTimePerCPU[0]).To(Equal(uint64(21000)))
+
+		// the per-CPU time of the exited processes is purged, the run time is used instead
+		exited := ProcessBPFMetrics{PID: 1 << 40, ProcessRunTime: 5000000, Exited: true}
+		metricCollector.processMeter = &fakeProcessMeter{processes: []ProcessBPFMetrics{exited}}
+		cpuTime := systemProcesses.CPUTime.Curr
+		metricCollector.updateBPFMetrics()
+		Expect(systemProcesses.CPUTime.Curr - cpuTime).To(Equal(uint64(5)))
+	})
+
+	It("Account the kernel threads and the interrupts in the kernel bucket", func() {
+		netStats := func(rx, tx uint64) map[string]*cgroup.NetDevStat {
+			return map[string]*cgroup.NetDevStat{"eth0": {Interface: "eth0", RxBytes: rx, TxBytes: tx}}
+		}
+		containerA := metricCollector.ContainersMetrics["containerA"]
+		containerA.SetNetworkStats("net:[1]", netStats(1000, 1000))
+		containerA.SetNetworkStats("net:[1]", netStats(2000, 3000))
+		cpuTimeA := containerA.CPUTime.Curr
+
+		kworker := ProcessBPFMetrics{PID: 1 << 40, ProcessRunTime: 4000000, KernelThread: true}
+		kworker.CPUTime = map[int32]uint64{0: 4000000}
+		metricCollector.processMeter = &fakeProcessMeter{
+			processes: []ProcessBPFMetrics{kworker},
+			// 5ms of interrupts on cpu 0, 2ms of them in the network softirqs
+			kernelTime: KernelTime{IRQ: map[int32]uint64{0: 5000000}, NetSoftIRQ: map[int32]uint64{0: 2000000}},
+		}
+		metricCollector.NodeCPUFrequency = map[int32]uint64{0: 2000000}
+
+		metricCollector.updateBPFMetrics()
+		metricCollector.updateKernelMetrics()
+		kernel := metricCollector.ContainersMetrics[utils.KernelProcessName]
+		Expect(kernel).NotTo(BeNil())
+		// the kworker time and the interrupts that are not caused by the network traffic
+		Expect(kernel.CPUTime.Curr).To(Equal(uint64(7)))
+		Expect(kernel.CurrCPUTimePerCPU[0]).To(Equal(uint64(7000)))
+		// containerA is the only container with network traffic
+		Expect(containerA.CPUTime.Curr - cpuTimeA).To(Equal(uint64(2)))
+		Expect(containerA.CurrCPUTimePerCPU[0]).To(Equal(uint64(2000)))
+	})
+
+	It("Split network energy between the containers of the network namespace", func() {
+		err := network.InitNICEnergyModel("eth=1000:0")
+		Expect(err).NotTo(HaveOccurred())
+		defer func() { _ = network.InitNICEnergyModel("") }()
+
+		netStats := func(rx, tx uint64) map[string]*cgroup.NetDevStat {
+			return map[string]*cgroup.NetDevStat{"eth0": {Interface: "eth0", RxBytes: rx, TxBytes: tx}}
+		}
+		containerA := metricCollector.ContainersMetrics["containerA"]
+		containerB := metricCollector.ContainersMetrics["containerB"]
+		// both containers are in the same pod, the counters of the namespace increase by 3000 bytes
+		for _, container := range []*collector_metric.ContainerMetrics{containerA, containerB} {
+			container.SetNetworkStats("net:[1]", netStats(1000, 1000))
+			container.SetNetworkStats("net:[1]", netStats(2000, 3000))
+		}
+		metricCollector.updateContainerNetworkEnergy()
+		// 3000 bytes * 1000 nJ = 3 mJ
+		Expect(containerA.EnergyInNetwork.Aggr).To(Equal(uint64(1)))
+		Expect(containerB.EnergyInNetwork.Aggr).To(Equal(uint64(1)))
+		metricCollector.updateContainerNetworkEnergy()
+		Expect(containerA.EnergyInNetwork.Aggr + containerB.EnergyInNetwork.Aggr).To(Equal(uint64(6)))
+	})
+
 })
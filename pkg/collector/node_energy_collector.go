@@ -17,6 +17,9 @@ limitations under the License.
 package collector
 
 import (
+	"time"
+
+	collector_metric "github.com/sustainable-computing-io/kepler/pkg/collector/metric"
 	"github.com/sustainable-computing-io/kepler/pkg/config"
 	"github.com/sustainable-computing-io/kepler/pkg/model"
 	"github.com/sustainable-computing-io/kepler/pkg/power/accelerator"
@@ -29,6 +32,7 @@ import (
 // TODO: verify if the cgroup metrics are also accounting for the OS, not only containers
 func (c *Collector) updateNodeResourceUsage() {
 	c.NodeMetrics.AddNodeResUsageFromContainerResUsage(c.ContainersMetrics)
+	c.NodeMetrics.SelectUsageMetrics(c.ContainersMetrics)
 }
 
 // updateMeasuredNodeEnergy updates the node platfomr power consumption, i.e, the node total power consumption
@@ -36,8 +40,10 @@ func (c *Collector) updatePlatformEnergy() {
 	nodePlatformEnergy := map[string]float64{}
 	if c.acpiPowerMeter.IsPowerSupported() {
 		nodePlatformEnergy, _ = c.acpiPowerMeter.GetEnergyFromHost()
+		c.NodeMetrics.PlatformEnergySource = collector_metric.EnergySourceACPI
 	} else if model.IsNodePlatformPowerModelEnabled() {
 		nodePlatformEnergy = model.GetEstimatedNodePlatformPower(c.NodeMetrics)
+		c.NodeMetrics.PlatformEnergySource = collector_metric.EnergySourceModel
 	}
 	c.NodeMetrics.AddLastestPlatformEnergy(nodePlatformEnergy)
 }
@@ -47,10 +53,19 @@ func (c *Collector) updateNodeComponentsEnergy() {
 	nodeComponentsEnergy := map[int]source.NodeComponentsEnergy{}
 	if components.IsSystemCollectionSupported() {
 		nodeComponentsEnergy = components.GetNodeComponentsEnergy()
+		c.NodeMetrics.ComponentsEnergySource = collector_metric.EnergySourceRAPL
+		if components.IsPowerEstimated() {
+			c.NodeMetrics.ComponentsEnergySource = collector_metric.EnergySourceEstimated
+		}
 	} else if model.IsNodeComponentPowerModelEnabled() {
 		nodeComponentsEnergy = model.GetNodeComponentPowers(c.NodeMetrics)
+		c.NodeMetrics.ComponentsEnergySource = collector_metric.EnergySourceModel
 	}
 	c.NodeMetrics.AddNodeComponentsEnergy(nodeComponentsEnergy)
+	if components.IsSystemCollectionSupported() && !components.IsPowerEstimated() {
+		// fit the node component model for the nodes without measurement
+		model.UpdateNodeComponentCalibration(c.NodeMetrics)
+	}
 }
 
 // updateNodeGPUEnergy updates each GPU power consumption. Right now we don't support other types of accelerators
@@ -66,10 +81,23 @@ func (c *Collector) updateNodeAvgCPUFrequency() {
 	c.NodeCPUFrequency = c.acpiPowerMeter.GetCPUCoreFrequency()
 }
 
-// updateNodeEnergyMetrics updates the node energy consumption of each component
-func (c *Collector) updateNodeEnergyMetrics() {
+// updateNodeCPUIdleMetrics updates the idle state residency of the CPUs and splits the package energy into its idle and active portions
+func (c *Collector) updateNodeCPUIdleMetrics() {
+	if c.cpuIdleReader == nil || !c.cpuIdleReader.IsSupported() {
+		return
+	}
+	residency, elapsed := c.cpuIdleReader.ReadResidency()
+	c.NodeMetrics.SetCPUIdleResidency(residency, elapsed, c.NodeMetrics.CPUPackages)
+}
+
+// updateNodeEnergyMetrics updates the node energy consumption of each component in the period
+func (c *Collector) updateNodeEnergyMetrics(period time.Duration) {
+	// the CPU utilization only estimates the power while no trained power model of the node is loaded
+	components.SetPowerEstimate(!model.IsNodeComponentPowerModelEnabled() && !model.IsNodePlatformPowerModelEnabled())
 	c.updatePlatformEnergy()
 	c.updateNodeComponentsEnergy()
 	c.updateNodeAvgCPUFrequency()
 	c.updateNodeGPUEnergy()
+	// the idle baseline is learned from the energy of all components
+	c.NodeMetrics.UpdateIdleEnergy(period)
 }
@@ -0,0 +1,195 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/iovisor/gobpf/pkg/cpupossible"
+
+	"github.com/sustainable-computing-io/kepler/pkg/bpfassets/attacher"
+
+	"k8s.io/klog/v2"
+)
+
+// ProcessMeter collects the resource usage of the processes, e.g. from the eBPF tables or from procfs
+type ProcessMeter interface {
+	// ReadProcesses returns the usage of the processes that ran since the previous call
+	ReadProcesses() []ProcessBPFMetrics
+	// ReadKernelTime returns the time the CPUs spent in interrupts since the previous call
+	ReadKernelTime() KernelTime
+	// Reset discards the usage collected so far
+	Reset()
+	Close()
+}
+
+// KernelTime holds the time in nanoseconds that each CPU spent serving interrupts
+type KernelTime struct {
+	// IRQ is the time in hard IRQs and softirqs, including NetSoftIRQ
+	IRQ map[int32]uint64
+	// NetSoftIRQ is the time in the network softirqs, it is unknown (empty) with procfs
+	NetSoftIRQ map[int32]uint64
+}
+
+// indexes of the irq_time table, they must be in sync with the IRQ_TIME_* defines of the bpf program
+const (
+	irqTimeHardIRQ = iota
+	irqTimeSoftIRQ
+	irqTimeNetSoftIRQ
+)
+
+// processTime is the leaf of the processes table, it must be in sync with process_time_t in the bpf program
+type processTime struct {
+	CGroupID       uint64
+	PID            uint64
+	ParentPID      uint64
+	ProcessRunTime uint64
+	Counters       [attacher.MaxCounters]uint64
+	Command        [16]byte
+	Exited         uint64
+	KernelThread   uint64
+	SharedRunTime  uint64
+}
+
+// bpfProcessMeter reads the processes table filled by the eBPF program
+type bpfProcessMeter struct {
+	modules *attacher.BpfModuleTables
+	// possibleCPUs are the CPU IDs of the values in the leaf of the per-CPU tables
+	possibleCPUs []uint
+	// prevIRQTime holds the previous value of the irq_time table per index and CPU, the table is never reset
+	prevIRQTime map[uint32]map[int32]uint64
+}
+
+func newBPFProcessMeter(modules *attacher.BpfModuleTables) (*bpfProcessMeter, error) {
+	possibleCPUs, err := cpupossible.Get()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the possible cpus: %v", err)
+	}
+	return &bpfProcessMeter{modules: modules, possibleCPUs: possibleCPUs, prevIRQTime: map[uint32]map[int32]uint64{}}, nil
+}
+
+func (m *bpfProcessMeter) ReadProcesses() []ProcessBPFMetrics {
+	cpuTime := m.readCPUTime()
+	var processes []ProcessBPFMetrics
+	for it := m.modules.Table.Iter(); it.Next(); {
+		var pt processTime
+		data := it.Leaf()
+		err := binary.Read(bytes.NewBuffer(data), binary.LittleEndian, &pt)
+		if err != nil {
+			klog.V(5).Infof("failed to decode received data: %v", err)
+			continue
+		}
+		processes = append(processes, ProcessBPFMetrics{
+			CGroupID:       pt.CGroupID,
+			PID:            pt.PID,
+			ParentPID:      pt.ParentPID,
+			ProcessRunTime: pt.ProcessRunTime,
+			Counters:       pt.Counters,
+			Command:        pt.Command,
+			CPUTime:        cpuTime[pt.PID],
+			Exited:         pt.Exited != 0,
+			KernelThread:   pt.KernelThread != 0,
+			SharedRunTime:  pt.SharedRunTime,
+		})
+	}
+	// the pid_time table holds the running tasks, the eBPF program removes the entries of the tasks that exit
+	m.modules.Table.DeleteAll()
+	m.modules.CPUTimeTable.DeleteAll()
+	return processes
+}
+
+// readCPUTime reads the per-CPU time of the processes, the leaf holds an u64 per possible CPU
+func (m *bpfProcessMeter) readCPUTime() map[uint64]map[int32]uint64 {
+	cpuTime := make(map[uint64]map[int32]uint64)
+	for it := m.modules.CPUTimeTable.Iter(); it.Next(); {
+		key, leaf := it.Key(), it.Leaf()
+		if len(key) != 8 || len(leaf) < 8*len(m.possibleCPUs) {
+			klog.V(5).Infof("failed to decode the cpu time of %v: %d bytes", key, len(leaf))
+			continue
+		}
+		processCPUTime := make(map[int32]uint64)
+		for i, cpu := range m.possibleCPUs {
+			if time := binary.LittleEndian.Uint64(leaf[i*8:]); time != 0 {
+				processCPUTime[int32(cpu)] = time
+			}
+		}
+		cpuTime[binary.LittleEndian.Uint64(key)] = processCPUTime
+	}
+	return cpuTime
+}
+
+func (m *bpfProcessMeter) ReadKernelTime() KernelTime {
+	kernelTime := KernelTime{IRQ: map[int32]uint64{}, NetSoftIRQ: map[int32]uint64{}}
+	if m.modules.IRQTimeTable == nil {
+		return kernelTime
+	}
+	for index, delta := range m.readIRQTime() {
+		switch index {
+		case irqTimeHardIRQ, irqTimeSoftIRQ:
+			for cpu, time := range delta {
+				kernelTime.IRQ[cpu] += time
+			}
+		case irqTimeNetSoftIRQ:
+			kernelTime.NetSoftIRQ = delta
+		}
+	}
+	return kernelTime
+}
+
+// readIRQTime returns the increase of the irq_time table since the previous read per index and CPU
+func (m *bpfProcessMeter) readIRQTime() map[uint32]map[int32]uint64 {
+	deltas := make(map[uint32]map[int32]uint64)
+	for it := m.modules.IRQTimeTable.Iter(); it.Next(); {
+		key, leaf := it.Key(), it.Leaf()
+		if len(key) != 4 || len(leaf) < 8*len(m.possibleCPUs) {
+			klog.V(5).Infof("failed to decode the irq time of %v: %d bytes", key, len(leaf))
+			continue
+		}
+		index := binary.LittleEndian.Uint32(key)
+		prev, exists := m.prevIRQTime[index]
+		if !exists {
+			prev = make(map[int32]uint64)
+			m.prevIRQTime[index] = prev
+		}
+		delta := make(map[int32]uint64)
+		for i, cpu := range m.possibleCPUs {
+			time := binary.LittleEndian.Uint64(leaf[i*8:])
+			if time > prev[int32(cpu)] {
+				delta[int32(cpu)] = time - prev[int32(cpu)]
+			}
+			prev[int32(cpu)] = time
+		}
+		deltas[index] = delta
+	}
+	return deltas
+}
+
+// Reset resets BPF module's tables
+func (m *bpfProcessMeter) Reset() {
+	m.modules.Table.DeleteAll()
+	m.modules.TimeTable.DeleteAll()
+	m.modules.CPUTimeTable.DeleteAll()
+	if m.modules.IRQTimeTable != nil {
+		m.readIRQTime()
+	}
+}
+
+func (m *bpfProcessMeter) Close() {
+	attacher.DetachBPFModules(m.modules)
+}
@@ -0,0 +1,246 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	// userHZ is the unit of the times in /proc/<pid>/stat, it is 100 in all the supported architectures
+	userHZ      = 100
+	nsPerSecond = 1000000000
+
+	// indexes of the /proc/<pid>/stat fields after the command, i.e. field number - 3
+	statFlagsIndex     = 6
+	statUTimeIndex     = 11
+	statSTimeIndex     = 12
+	statStartTimeIndex = 19
+	statProcessorIndex = 36
+
+	// pfKThread is the flag of the kernel threads in /proc/<pid>/stat
+	pfKThread = 0x00200000
+
+	// indexes of the irq and softirq times of the cpu<N> lines of /proc/stat after the CPU
+	cpuStatIRQIndex     = 5
+	cpuStatSoftIRQIndex = 6
+)
+
+// procStat holds the fields of /proc/<pid>/stat used by the procfs meter, the times are in clock ticks
+type procStat struct {
+	comm      string
+	cpuTicks  uint64
+	startTime uint64
+	processor int
+	// kernelThread is set for the kernel threads
+	kernelThread bool
+}
+
+// procfsProcessMeter derives the process CPU time from /proc/<pid>/stat when the eBPF program cannot be loaded.
+// It is less precise than eBPF: the time is sampled every period, the CPU is the last one the process ran on,
+// short-lived processes are missed and the hardware counters are not available.
+type procfsProcessMeter struct {
+	procPath string
+	// prevStats holds the stats of the previous scan to calculate the deltas
+	prevStats map[uint64]procStat
+	// prevUptime is the time of the previous scan in clock ticks since boot
+	prevUptime uint64
+	// prevIRQTicks holds the interrupt time of each CPU of the previous read in clock ticks
+	prevIRQTicks map[int32]uint64
+}
+
+func newProcfsProcessMeter(procPath string) *procfsProcessMeter {
+	m := &procfsProcessMeter{procPath: procPath}
+	m.Reset()
+	return m
+}
+
+func (m *procfsProcessMeter) ReadProcesses() []ProcessBPFMetrics {
+	stats, uptime := m.scan()
+	var processes []ProcessBPFMetrics
+	for pid, stat := range stats {
+		prevCPUTicks := uint64(0)
+		if prev, exists := m.prevStats[pid]; exists && prev.startTime == stat.startTime {
+			prevCPUTicks = prev.cpuTicks
+		} else if stat.startTime < m.prevUptime {
+			// the process was running in the previous scan but could not be read, its usage is unknown
+			continue
+		}
+		if stat.cpuTicks <= prevCPUTicks {
+			continue
+		}
+		processes = append(processes, stat.toProcessMetrics(pid, stat.cpuTicks-prevCPUTicks))
+	}
+	m.prevStats = stats
+	m.prevUptime = uptime
+	return processes
+}
+
+// ReadKernelTime reads the interrupt time of each CPU from /proc/stat, the network softirqs are not distinguished
+func (m *procfsProcessMeter) ReadKernelTime() KernelTime {
+	kernelTime := KernelTime{IRQ: map[int32]uint64{}, NetSoftIRQ: map[int32]uint64{}}
+	irqTicks, err := readCPUIRQTicks(filepath.Join(m.procPath, "stat"))
+	if err != nil {
+		klog.V(5).Infof("failed to read the interrupt time: %v", err)
+		return kernelTime
+	}
+	for cpu, ticks := range irqTicks {
+		if prev, exists := m.prevIRQTicks[cpu]; exists && ticks > prev {
+			kernelTime.IRQ[cpu] = (ticks - prev) * (nsPerSecond / userHZ)
+		}
+	}
+	m.prevIRQTicks = irqTicks
+	return kernelTime
+}
+
+// Reset takes the current process and interrupt times as the baseline of the next read
+func (m *procfsProcessMeter) Reset() {
+	m.prevStats, m.prevUptime = m.scan()
+	var err error
+	if m.prevIRQTicks, err = readCPUIRQTicks(filepath.Join(m.procPath, "stat")); err != nil {
+		klog.V(5).Infof("failed to read the interrupt time: %v", err)
+	}
+}
+
+func (m *procfsProcessMeter) Close() {
+}
+
+// scan reads the stats of all processes and the uptime in clock ticks
+func (m *procfsProcessMeter) scan() (map[uint64]procStat, uint64) {
+	stats := make(map[uint64]procStat)
+	uptime, err := readUptimeTicks(filepath.Join(m.procPath, "uptime"))
+	if err != nil {
+		klog.V(5).Infof("failed to read uptime: %v", err)
+	}
+	entries, err := os.ReadDir(m.procPath)
+	if err != nil {
+		klog.V(5).Infof("failed to list the processes: %v", err)
+		return stats, uptime
+	}
+	for _, entry := range entries {
+		pid, err := strconv.ParseUint(entry.Name(), 10, 64)
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		// the process might have exited in the meantime
+		if stat, err := readProcStat(filepath.Join(m.procPath, entry.Name(), "stat")); err == nil {
+			stats[pid] = stat
+		}
+	}
+	return stats, uptime
+}
+
+func (stat procStat) toProcessMetrics(pid, cpuTicks uint64) ProcessBPFMetrics {
+	ct := ProcessBPFMetrics{
+		PID:            pid,
+		ProcessRunTime: cpuTicks * (nsPerSecond / userHZ),
+		CPUTime:        map[int32]uint64{},
+		KernelThread:   stat.kernelThread,
+	}
+	copy(ct.Command[:len(ct.Command)-1], stat.comm)
+	ct.CPUTime[int32(stat.processor)] = ct.ProcessRunTime
+	return ct
+}
+
+// readProcStat parses /proc/<pid>/stat, the command is in parentheses and might contain spaces and parentheses
+func readProcStat(path string) (procStat, error) {
+	var stat procStat
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return stat, err
+	}
+	content := string(data)
+	start, end := strings.IndexByte(content, '('), strings.LastIndexByte(content, ')')
+	if start < 0 || end < start {
+		return stat, fmt.Errorf("failed to parse %s", path)
+	}
+	stat.comm = content[start+1 : end]
+	fields := strings.Fields(content[end+1:])
+	if len(fields) <= statProcessorIndex {
+		return stat, fmt.Errorf("failed to parse %s: %d fields", path, len(fields))
+	}
+	var values [3]uint64
+	for i, index := range []int{statUTimeIndex, statSTimeIndex, statStartTimeIndex} {
+		if values[i], err = strconv.ParseUint(fields[index], 10, 64); err != nil {
+			return stat, fmt.Errorf("failed to parse %s: %v", path, err)
+		}
+	}
+	stat.cpuTicks = values[0] + values[1]
+	stat.startTime = values[2]
+	flags, err := strconv.ParseUint(fields[statFlagsIndex], 10, 64)
+	if err != nil {
+		return stat, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	stat.kernelThread = flags&pfKThread != 0
+	if stat.processor, err = strconv.Atoi(fields[statProcessorIndex]); err != nil {
+		return stat, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return stat, nil
+}
+
+// readUptimeTicks returns the time since boot in clock ticks, the first field of /proc/uptime is in seconds
+func readUptimeTicks(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("failed to parse %s", path)
+	}
+	seconds, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(seconds * userHZ), nil
+}
+
+// readCPUIRQTicks returns the irq and softirq time of each CPU in clock ticks from the cpu<N> lines of /proc/stat
+func readCPUIRQTicks(path string) (map[int32]uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	irqTicks := make(map[int32]uint64)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		// the aggregated "cpu" line is skipped
+		if len(fields) <= cpuStatSoftIRQIndex+1 || !strings.HasPrefix(fields[0], "cpu") || fields[0] == "cpu" {
+			continue
+		}
+		cpu, err := strconv.ParseInt(strings.TrimPrefix(fields[0], "cpu"), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+		}
+		var ticks uint64
+		for _, index := range []int{cpuStatIRQIndex, cpuStatSoftIRQIndex} {
+			value, err := strconv.ParseUint(fields[index+1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+			}
+			ticks += value
+		}
+		irqTicks[int32(cpu)] = ticks
+	}
+	return irqTicks, nil
+}
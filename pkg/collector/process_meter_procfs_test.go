@@ -0,0 +1,125 @@
+package collector
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/sustainable-computing-io/kepler/pkg/utils"
+)
+
+// writeProcStat writes a /proc/<pid>/stat file with the given times in clock ticks
+func writeProcStat(g *WithT, dir string, pid int, comm string, utime, stime, startTime uint64, processor int) {
+	fields := make([]string, statProcessorIndex+1)
+	for i := range fields {
+		fields[i] = "0"
+	}
+	fields[0] = "S"
+	fields[statUTimeIndex] = fmt.Sprint(utime)
+	fields[statSTimeIndex] = fmt.Sprint(stime)
+	fields[statStartTimeIndex] = fmt.Sprint(startTime)
+	fields[statProcessorIndex] = fmt.Sprint(processor)
+	content := fmt.Sprintf("%d (%s) %s 0 0 0\n", pid, comm, strings.Join(fields, " "))
+	g.Expect(os.MkdirAll(filepath.Join(dir, fmt.Sprint(pid)), 0755)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(dir, fmt.Sprint(pid), "stat"), []byte(content), 0644)).To(Succeed())
+}
+
+func writeUptime(g *WithT, dir string, seconds float64) {
+	g.Expect(os.WriteFile(filepath.Join(dir, "uptime"), []byte(fmt.Sprintf("%.2f 1000.00\n", seconds)), 0644)).To(Succeed())
+}
+
+func TestReadProcStat(t *testing.T) {
+	g := NewWithT(t)
+
+	dir, err := utils.CreateTempDir()
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	writeProcStat(g, dir, 10, "my (app)", 30, 20, 500, 3)
+	stat, err := readProcStat(filepath.Join(dir, "10", "stat"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(stat).To(Equal(procStat{comm: "my (app)", cpuTicks: 50, startTime: 500, processor: 3}))
+
+	// kthreadd has the PF_KTHREAD flag
+	writeProcStat(g, dir, 2, "kthreadd", 0, 10, 0, 1)
+	path := filepath.Join(dir, "2", "stat")
+	data, err := os.ReadFile(path)
+	g.Expect(err).NotTo(HaveOccurred())
+	fields := strings.Fields(string(data))
+	fields[statFlagsIndex+2] = fmt.Sprint(0x00208040)
+	g.Expect(os.WriteFile(path, []byte(strings.Join(fields, " ")), 0644)).To(Succeed())
+	stat, err = readProcStat(path)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(stat.kernelThread).To(BeTrue())
+}
+
+func TestProcfsProcessMeter(t *testing.T) {
+	g := NewWithT(t)
+
+	dir, err := utils.CreateTempDir()
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	// pid 10 was running before the meter started
+	writeUptime(g, dir, 10)
+	writeProcStat(g, dir, 10, "app", 100, 50, 200, 1)
+	meter := newProcfsProcessMeter(dir)
+
+	// pid 10 runs 20 ticks, pid 20 started after the previous scan and runs 5 ticks, pid 30 is idle
+	writeUptime(g, dir, 13)
+	writeProcStat(g, dir, 10, "app", 110, 60, 200, 2)
+	writeProcStat(g, dir, 20, "worker", 5, 0, 1100, 0)
+	writeProcStat(g, dir, 30, "idle", 0, 0, 1150, 0)
+	processes := meter.ReadProcesses()
+	g.Expect(processes).To(HaveLen(2))
+	for _, process := range processes {
+		switch process.PID {
+		case 10:
+			g.Expect(process.ProcessRunTime).To(Equal(uint64(200000000)))
+			g.Expect(process.CPUTime).To(Equal(map[int32]uint64{2: 200000000}))
+			g.Expect(process.GetCommand()).To(Equal("app"))
+		case 20:
+			g.Expect(process.ProcessRunTime).To(Equal(uint64(50000000)))
+			g.Expect(process.CPUTime).To(Equal(map[int32]uint64{0: 50000000}))
+		default:
+			t.Errorf("unexpected process %d", process.PID)
+		}
+	}
+
+	// pid 10 is reused by a new process, its time is not subtracted from the previous one
+	writeUptime(g, dir, 16)
+	writeProcStat(g, dir, 10, "new", 3, 0, 1400, 0)
+	processes = meter.ReadProcesses()
+	g.Expect(processes).To(HaveLen(1))
+	g.Expect(processes[0].ProcessRunTime).To(Equal(uint64(30000000)))
+}
+
+func writeCPUStat(g *WithT, dir string, irq0, softirq0, irq1, softirq1 uint64) {
+	content := fmt.Sprintf("cpu  100 0 100 1000 0 %d %d 0 0 0\n", irq0+irq1, softirq0+softirq1) +
+		fmt.Sprintf("cpu0 50 0 50 500 0 %d %d 0 0 0\n", irq0, softirq0) +
+		fmt.Sprintf("cpu1 50 0 50 500 0 %d %d 0 0 0\n", irq1, softirq1) +
+		"intr 12345 0 0\nctxt 6789\n"
+	g.Expect(os.WriteFile(filepath.Join(dir, "stat"), []byte(content), 0644)).To(Succeed())
+}
+
+func TestProcfsKernelTime(t *testing.T) {
+	g := NewWithT(t)
+
+	dir, err := utils.CreateTempDir()
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	writeUptime(g, dir, 10)
+	writeCPUStat(g, dir, 10, 20, 5, 5)
+	meter := newProcfsProcessMeter(dir)
+
+	// cpu0 serves 1 tick of hard IRQs and 2 ticks of softirqs, cpu1 is not interrupted
+	writeCPUStat(g, dir, 11, 22, 5, 5)
+	kernelTime := meter.ReadKernelTime()
+	g.Expect(kernelTime.IRQ).To(Equal(map[int32]uint64{0: 30000000}))
+	g.Expect(kernelTime.NetSoftIRQ).To(BeEmpty())
+}
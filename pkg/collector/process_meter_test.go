@@ -0,0 +1,116 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/sustainable-computing-io/kepler/pkg/bpfassets/attacher"
+)
+
+type fakeTableEntry struct {
+	key, leaf []byte
+}
+
+// fakeTable is an in-memory attacher.Table
+type fakeTable struct {
+	entries []fakeTableEntry
+}
+
+type fakeTableIterator struct {
+	table *fakeTable
+	index int
+}
+
+func (t *fakeTable) Iter() attacher.TableIterator {
+	return &fakeTableIterator{table: t, index: -1}
+}
+
+func (t *fakeTable) DeleteAll() {
+	t.entries = nil
+}
+
+func (it *fakeTableIterator) Next() bool {
+	it.index++
+	return it.index < len(it.table.entries)
+}
+
+func (it *fakeTableIterator) Key() []byte {
+	return it.table.entries[it.index].key
+}
+
+func (it *fakeTableIterator) Leaf() []byte {
+	return it.table.entries[it.index].leaf
+}
+
+func encodeUint64s(values ...uint64) []byte {
+	buf := new(bytes.Buffer)
+	_ = binary.Write(buf, binary.LittleEndian, values)
+	return buf.Bytes()
+}
+
+func TestBPFProcessMeter(t *testing.T) {
+	g := NewWithT(t)
+
+	buf := new(bytes.Buffer)
+	pt := processTime{PID: 42, ParentPID: 7, ProcessRunTime: 3000, Exited: 1}
+	pt.Counters[0] = 100
+	copy(pt.Command[:], "short-lived")
+	g.Expect(binary.Write(buf, binary.LittleEndian, pt)).To(Succeed())
+
+	processes := &fakeTable{entries: []fakeTableEntry{{key: encodeUint64s(42), leaf: buf.Bytes()}}}
+	pidTime := &fakeTable{entries: []fakeTableEntry{{key: encodeUint64s(43), leaf: encodeUint64s(1)}}}
+	cpuTime := &fakeTable{entries: []fakeTableEntry{{key: encodeUint64s(42), leaf: encodeUint64s(1000, 0, 2000)}}}
+	meter := &bpfProcessMeter{
+		modules:      &attacher.BpfModuleTables{Table: processes, TimeTable: pidTime, CPUTimeTable: cpuTime},
+		possibleCPUs: []uint{0, 1, 2},
+	}
+
+	metrics := meter.ReadProcesses()
+	g.Expect(metrics).To(HaveLen(1))
+	g.Expect(metrics[0].PID).To(Equal(uint64(42)))
+	g.Expect(metrics[0].ParentPID).To(Equal(uint64(7)))
+	g.Expect(metrics[0].Exited).To(BeTrue())
+	g.Expect(metrics[0].ProcessRunTime).To(Equal(uint64(3000)))
+	g.Expect(metrics[0].Counters[0]).To(Equal(uint64(100)))
+	g.Expect(metrics[0].GetCommand()).To(Equal("short-lived"))
+	g.Expect(metrics[0].CPUTime).To(Equal(map[int32]uint64{0: 1000, 2: 2000}))
+
+	// the usage is read once, the running tasks are kept to account their current time slice
+	g.Expect(processes.entries).To(BeEmpty())
+	g.Expect(cpuTime.entries).To(BeEmpty())
+	g.Expect(pidTime.entries).To(HaveLen(1))
+}
+
+func TestBPFKernelTime(t *testing.T) {
+	g := NewWithT(t)
+
+	irqKey := func(index uint32) []byte {
+		key := make([]byte, 4)
+		binary.LittleEndian.PutUint32(key, index)
+		return key
+	}
+	irqTime := &fakeTable{}
+	setIRQTime := func(hardIRQ, softIRQ, netSoftIRQ []byte) {
+		irqTime.entries = []fakeTableEntry{
+			{key: irqKey(irqTimeHardIRQ), leaf: hardIRQ},
+			{key: irqKey(irqTimeSoftIRQ), leaf: softIRQ},
+			{key: irqKey(irqTimeNetSoftIRQ), leaf: netSoftIRQ},
+		}
+	}
+	meter := &bpfProcessMeter{
+		modules:      &attacher.BpfModuleTables{Table: &fakeTable{}, TimeTable: &fakeTable{}, CPUTimeTable: &fakeTable{}, IRQTimeTable: irqTime},
+		possibleCPUs: []uint{0, 1},
+		prevIRQTime:  map[uint32]map[int32]uint64{},
+	}
+
+	// the table holds the time since the program was loaded, the reset takes it as the baseline
+	setIRQTime(encodeUint64s(100, 100), encodeUint64s(200, 200), encodeUint64s(50, 50))
+	meter.Reset()
+	setIRQTime(encodeUint64s(110, 100), encodeUint64s(230, 200), encodeUint64s(70, 50))
+	kernelTime := meter.ReadKernelTime()
+	g.Expect(kernelTime.IRQ).To(Equal(map[int32]uint64{0: 40}))
+	g.Expect(kernelTime.NetSoftIRQ).To(Equal(map[int32]uint64{0: 20}))
+}
@@ -19,6 +19,7 @@ package collector
 import (
 	"fmt"
 	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -26,6 +27,8 @@ import (
 	"github.com/sustainable-computing-io/kepler/pkg/bpfassets/attacher"
 	collector_metric "github.com/sustainable-computing-io/kepler/pkg/collector/metric"
 	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/model"
+	"github.com/sustainable-computing-io/kepler/pkg/power/network"
 )
 
 const (
@@ -91,10 +94,19 @@ type NodeDesc struct {
 	nodePlatformJoulesTotal        *prometheus.Desc
 	nodeOtherComponentsJoulesTotal *prometheus.Desc
 	nodeGPUJoulesTotal             *prometheus.Desc
+	nodePackageIdleJoulesTotal     *prometheus.Desc
+	nodePackageActiveJoulesTotal   *prometheus.Desc
+	nodeIdleJoulesTotal            *prometheus.Desc
+	nodeUnattributedJoulesTotal    *prometheus.Desc
 
 	// Additional metrics (gauge)
 	// TODO: review if we really need to expose this metric.
-	NodeCPUFrequency *prometheus.Desc
+	NodeCPUFrequency     *prometheus.Desc
+	nodeCPUIdleResidency *prometheus.Desc
+	nodeUsageMetric      *prometheus.Desc
+	nodeEnergySource     *prometheus.Desc
+	modelInfo            *prometheus.Desc
+	powerRejected        *prometheus.Desc
 
 	// Old metric
 	// TODO: remove these metrics in the next release. The dependent components must stop to use this.
@@ -112,11 +124,24 @@ type ContainerDesc struct {
 	containerOtherComponentsJoulesTotal *prometheus.Desc
 	containerGPUJoulesTotal             *prometheus.Desc
 	containerJoulesTotal                *prometheus.Desc
+	containerNetworkJoulesTotal         *prometheus.Desc
+	containerDynamicJoulesTotal         *prometheus.Desc
+	containerIdleJoulesTotal            *prometheus.Desc
 
 	// Hardware Counters (counter)
 	containerCPUCyclesTotal *prometheus.Desc
 	containerCPUInstrTotal  *prometheus.Desc
 	containerCacheMissTotal *prometheus.Desc
+	// all the configured hardware events, labeled by event
+	containerHardwareEventsTotal *prometheus.Desc
+
+	// Block device IO (counter)
+	containerBlockDeviceBytesTotal *prometheus.Desc
+	containerBlockDeviceOpsTotal   *prometheus.Desc
+
+	// Network (counter)
+	containerNetworkBytesTotal   *prometheus.Desc
+	containerNetworkPacketsTotal *prometheus.Desc
 
 	// Additional metrics (gauge)
 	// TODO: review if we really need to expose this metric. cgroup also has some sortof cpuTime metric
@@ -184,12 +209,24 @@ func (p *PrometheusCollector) Describe(ch chan<- *prometheus.Desc) {
 		ch <- p.nodeDesc.nodeGPUJoulesTotal
 	}
 
+	ch <- p.nodeDesc.nodePackageIdleJoulesTotal
+	ch <- p.nodeDesc.nodePackageActiveJoulesTotal
+	ch <- p.nodeDesc.nodeIdleJoulesTotal
+	ch <- p.nodeDesc.nodeUnattributedJoulesTotal
+
 	// Additional Node metrics (gauge)
 	ch <- p.nodeDesc.NodeCPUFrequency
+	ch <- p.nodeDesc.nodeCPUIdleResidency
+	ch <- p.nodeDesc.nodeUsageMetric
+	ch <- p.nodeDesc.nodeEnergySource
+	ch <- p.nodeDesc.modelInfo
+	ch <- p.nodeDesc.powerRejected
 
 	// Old Node metric
 	ch <- p.nodeDesc.nodePackageMiliJoulesTotal
-	ch <- p.nodeDesc.NodeMetricsStat
+	if config.ExposeEnergyStatMetrics {
+		ch <- p.nodeDesc.NodeMetricsStat
+	}
 
 	// Container Energy (counter)
 	ch <- p.containerDesc.containerCoreJoulesTotal
@@ -201,6 +238,8 @@ func (p *PrometheusCollector) Describe(ch chan<- *prometheus.Desc) {
 		ch <- p.containerDesc.containerGPUJoulesTotal
 	}
 	ch <- p.containerDesc.containerJoulesTotal
+	ch <- p.containerDesc.containerDynamicJoulesTotal
+	ch <- p.containerDesc.containerIdleJoulesTotal
 
 	// container Hardware Counters (counter)
 	if collector_metric.CPUHardwareCounterEnabled {
@@ -208,10 +247,28 @@ func (p *PrometheusCollector) Describe(ch chan<- *prometheus.Desc) {
 		ch <- p.containerDesc.containerCPUInstrTotal
 		ch <- p.containerDesc.containerCacheMissTotal
 	}
+	if len(collector_metric.AvailableCounters) > 0 {
+		ch <- p.containerDesc.containerHardwareEventsTotal
+	}
+
+	// Container block device IO (counter)
+	ch <- p.containerDesc.containerBlockDeviceBytesTotal
+	ch <- p.containerDesc.containerBlockDeviceOpsTotal
+
+	// Container network (counter)
+	if config.EnabledNetworkMetrics {
+		ch <- p.containerDesc.containerNetworkBytesTotal
+		ch <- p.containerDesc.containerNetworkPacketsTotal
+		if network.IsNICEnergyModelEnabled() {
+			ch <- p.containerDesc.containerNetworkJoulesTotal
+		}
+	}
 
 	// Old Node metric
 	ch <- p.containerDesc.containerCPUTime
-	ch <- p.podDesc.podEnergyStat
+	if config.ExposeEnergyStatMetrics {
+		ch <- p.podDesc.podEnergyStat
+	}
 }
 
 func (p *PrometheusCollector) newNodeMetrics() {
@@ -258,12 +315,58 @@ func (p *PrometheusCollector) newNodeMetrics() {
 		[]string{"index", "instance", "source"}, nil,
 	)
 
+	nodePackageIdleJoulesTotal := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "node", "package_idle_joules_total"),
+		"Aggregated package (socket) energy in joules while the CPUs of the package were in idle states",
+		[]string{"package", "instance"}, nil,
+	)
+	nodePackageActiveJoulesTotal := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "node", "package_active_joules_total"),
+		"Aggregated package (socket) energy in joules while the CPUs of the package were active",
+		[]string{"package", "instance"}, nil,
+	)
+	nodeIdleJoulesTotal := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "node", "idle_joules_total"),
+		"Aggregated idle energy in joules per component, the idle baseline is the minimum energy observed in a period",
+		[]string{"component", "instance"}, nil,
+	)
+	nodeUnattributedJoulesTotal := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "node", "unattributed_joules_total"),
+		"Aggregated energy in joules per component that is attributable to the containers but not attributed to any container, it does not include the idle energy",
+		[]string{"component", "instance"}, nil,
+	)
+
 	// Additional metrics (gauge)
 	NodeCPUFrequency := prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "node", "cpu_scaling_frequency_hertz"),
 		"Current average cpu frequency in hertz",
 		[]string{"cpu", "instance"}, nil,
 	)
+	nodeCPUIdleResidency := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "node", "cpu_idle_state_residency_ratio"),
+		"Ratio of the last period that the cpu spent in the idle state (C-state)",
+		[]string{"cpu", "state", "instance"}, nil,
+	)
+	nodeEnergySource := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "node", "energy_source"),
+		"Source of the node energy of the component: rapl or acpi (measured), estimated (from the CPU utilization) or trained_power_model",
+		[]string{"component", "source", "instance"}, nil,
+	)
+	nodeUsageMetric := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "node", "usage_metric_info"),
+		"Usage metric chosen to attribute the energy of the component to the containers, the first collected metric of its preference list",
+		[]string{"component", "metric", "instance"}, nil,
+	)
+	modelInfo := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "model_info"),
+		"Model loaded by the power model estimator of each power output type, with the model file checksum (sha256) and the comma-separated features of the model that are not collected",
+		[]string{"output_type", "estimator", "model_name", "model_version", "source", "checksum", "missing_features", "instance"}, nil,
+	)
+	powerRejected := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "estimated_power_rejected_total"),
+		"Estimates of the power models clamped or rejected by reason: negative (clamped to zero), invalid, implausible (above the maximum node power) and inconsistent (total below the components)",
+		[]string{"output_type", "reason", "instance"}, nil,
+	)
 
 	// Old metrics
 	nodePackageMiliJoulesTotal := prometheus.NewDesc(
@@ -286,7 +389,16 @@ func (p *PrometheusCollector) newNodeMetrics() {
 		nodePlatformJoulesTotal:        nodePlatformJoulesTotal,
 		nodeOtherComponentsJoulesTotal: nodeOtherComponentsJoulesTotal,
 		nodeGPUJoulesTotal:             nodeGPUJoulesTotal,
+		nodePackageIdleJoulesTotal:     nodePackageIdleJoulesTotal,
+		nodePackageActiveJoulesTotal:   nodePackageActiveJoulesTotal,
+		nodeIdleJoulesTotal:            nodeIdleJoulesTotal,
+		nodeUnattributedJoulesTotal:    nodeUnattributedJoulesTotal,
 		NodeCPUFrequency:               NodeCPUFrequency,
+		nodeCPUIdleResidency:           nodeCPUIdleResidency,
+		nodeUsageMetric:                nodeUsageMetric,
+		nodeEnergySource:               nodeEnergySource,
+		modelInfo:                      modelInfo,
+		powerRejected:                  powerRejected,
 		nodePackageMiliJoulesTotal:     nodePackageMiliJoulesTotal, // deprecated
 		NodeMetricsStat:                NodeMetricsStat,
 	}
@@ -329,6 +441,21 @@ func (p *PrometheusCollector) newContainerMetrics() {
 		"Aggregated RAPL Package + Uncore + DRAM + GPU + other host components (platform - package - dram) in joules",
 		[]string{"pod_name", "container_name", "container_namespace", "command"}, nil,
 	)
+	containerNetworkJoulesTotal := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "container", "network_joules_total"),
+		"Aggregated network energy estimated from the traffic with the NIC energy model in joules, shared by the containers of the pod",
+		[]string{"pod_name", "container_name", "container_namespace", "command"}, nil,
+	)
+	containerDynamicJoulesTotal := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "container", "dynamic_joules_total"),
+		"Aggregated energy in joules of the container resource usage, above the node idle baseline",
+		[]string{"pod_name", "container_name", "container_namespace", "command"}, nil,
+	)
+	containerIdleJoulesTotal := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "container", "idle_joules_total"),
+		"Aggregated share of the node idle energy in joules attributed to the container with the idle power policy",
+		[]string{"pod_name", "container_name", "container_namespace", "command"}, nil,
+	)
 
 	// Hardware Counters (counter)
 	containerCPUCyclesTotal := prometheus.NewDesc(
@@ -346,6 +473,35 @@ func (p *PrometheusCollector) newContainerMetrics() {
 		"Aggregated cache miss value",
 		[]string{"pod_name", "container_name", "container_namespace", "command"}, nil,
 	)
+	containerHardwareEventsTotal := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "container", "hardware_events_total"),
+		"Aggregated value of the configured hardware performance events",
+		[]string{"pod_name", "container_name", "container_namespace", "command", "event"}, nil,
+	)
+
+	// Block device IO (counter)
+	containerBlockDeviceBytesTotal := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "container", "block_device_bytes_total"),
+		"Aggregated bytes read and written per block device",
+		[]string{"pod_name", "container_name", "container_namespace", "device", "operation"}, nil,
+	)
+	containerBlockDeviceOpsTotal := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "container", "block_device_ops_total"),
+		"Aggregated read and write operations per block device",
+		[]string{"pod_name", "container_name", "container_namespace", "device", "operation"}, nil,
+	)
+
+	// Network (counter)
+	containerNetworkBytesTotal := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "container", "network_bytes_total"),
+		"Aggregated bytes received and transmitted per interface of the pod network namespace",
+		[]string{"pod_name", "container_name", "container_namespace", "interface", "direction"}, nil,
+	)
+	containerNetworkPacketsTotal := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "container", "network_packets_total"),
+		"Aggregated packets received and transmitted per interface of the pod network namespace",
+		[]string{"pod_name", "container_name", "container_namespace", "interface", "direction"}, nil,
+	)
 
 	// Additional metrics (gauge)
 	containerCPUTime := prometheus.NewDesc(
@@ -362,9 +518,17 @@ func (p *PrometheusCollector) newContainerMetrics() {
 		containerOtherComponentsJoulesTotal: containerOtherComponentsJoulesTotal,
 		containerGPUJoulesTotal:             containerGPUJoulesTotal,
 		containerJoulesTotal:                containerJoulesTotal,
+		containerNetworkJoulesTotal:         containerNetworkJoulesTotal,
+		containerDynamicJoulesTotal:         containerDynamicJoulesTotal,
+		containerIdleJoulesTotal:            containerIdleJoulesTotal,
 		containerCPUCyclesTotal:             containerCPUCyclesTotal,
 		containerCPUInstrTotal:              containerCPUInstrTotal,
 		containerCacheMissTotal:             containerCacheMissTotal,
+		containerHardwareEventsTotal:        containerHardwareEventsTotal,
+		containerBlockDeviceBytesTotal:      containerBlockDeviceBytesTotal,
+		containerBlockDeviceOpsTotal:        containerBlockDeviceOpsTotal,
+		containerNetworkBytesTotal:          containerNetworkBytesTotal,
+		containerNetworkPacketsTotal:        containerNetworkPacketsTotal,
 		containerCPUTime:                    containerCPUTime,
 	}
 }
@@ -413,6 +577,65 @@ func (p *PrometheusCollector) UpdateNodeMetrics(wg *sync.WaitGroup, ch chan<- pr
 				fmt.Sprintf("%d", cpuID), collector_metric.NodeName,
 			)
 		}
+		for cpuID, states := range p.NodeMetrics.CPUIdleResidency {
+			for state, ratio := range states {
+				ch <- prometheus.MustNewConstMetric(
+					p.nodeDesc.nodeCPUIdleResidency,
+					prometheus.GaugeValue,
+					ratio,
+					fmt.Sprintf("%d", cpuID), state, collector_metric.NodeName,
+				)
+			}
+		}
+		for component, metric := range p.NodeMetrics.UsageMetrics {
+			// the energy of the component is divided evenly
+			if metric == "" {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(
+				p.nodeDesc.nodeUsageMetric,
+				prometheus.GaugeValue,
+				1,
+				component, metric, collector_metric.NodeName,
+			)
+		}
+		for component, source := range map[string]string{
+			"pkg":      p.NodeMetrics.ComponentsEnergySource,
+			"core":     p.NodeMetrics.ComponentsEnergySource,
+			"uncore":   p.NodeMetrics.ComponentsEnergySource,
+			"dram":     p.NodeMetrics.ComponentsEnergySource,
+			"platform": p.NodeMetrics.PlatformEnergySource,
+		} {
+			if source == "" {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(
+				p.nodeDesc.nodeEnergySource,
+				prometheus.GaugeValue,
+				1,
+				component, source, collector_metric.NodeName,
+			)
+		}
+		for _, status := range model.GetModelStatuses() {
+			if !status.Valid {
+				continue
+			}
+			info := status.Model
+			ch <- prometheus.MustNewConstMetric(
+				p.nodeDesc.modelInfo,
+				prometheus.GaugeValue,
+				1,
+				status.OutputType, info.EstimatorType, info.Name, info.Version, info.Source, info.Checksum, strings.Join(status.MissingFeatures, ","), collector_metric.NodeName,
+			)
+		}
+		for _, rejection := range model.GetPowerRejections() {
+			ch <- prometheus.MustNewConstMetric(
+				p.nodeDesc.powerRejected,
+				prometheus.CounterValue,
+				float64(rejection.Count),
+				rejection.OutputType, rejection.Reason, collector_metric.NodeName,
+			)
+		}
 		for pkgID, val := range p.NodeMetrics.EnergyInPkg.Stat {
 			coreEnergy := strconv.FormatUint(p.NodeMetrics.EnergyInCore.Stat[pkgID].Curr, 10)
 			dramEnergy := strconv.FormatUint(p.NodeMetrics.EnergyInDRAM.Stat[pkgID].Curr, 10)
@@ -425,18 +648,20 @@ func (p *PrometheusCollector) UpdateNodeMetrics(wg *sync.WaitGroup, ch chan<- pr
 			) // deprecated metric
 		}
 
-		NodeMetricsStatusLabelValues := []string{collector_metric.NodeName, collector_metric.NodeCPUArchitecture}
-		for _, label := range NodeMetricsStatLabels[2:] {
-			val := uint64(p.NodeMetrics.ResourceUsage[label])
-			valStr := strconv.FormatUint(val, 10)
-			NodeMetricsStatusLabelValues = append(NodeMetricsStatusLabelValues, valStr)
+		if config.ExposeEnergyStatMetrics {
+			NodeMetricsStatusLabelValues := []string{collector_metric.NodeName, collector_metric.NodeCPUArchitecture}
+			for _, label := range NodeMetricsStatLabels[2:] {
+				val := uint64(p.NodeMetrics.ResourceUsage[label])
+				valStr := strconv.FormatUint(val, 10)
+				NodeMetricsStatusLabelValues = append(NodeMetricsStatusLabelValues, valStr)
+			}
+			ch <- prometheus.MustNewConstMetric(
+				p.nodeDesc.NodeMetricsStat,
+				prometheus.CounterValue,
+				(float64(p.NodeMetrics.EnergyInPlatform.Curr())/miliJouleToJoule)/p.SamplePeriodSec,
+				NodeMetricsStatusLabelValues...,
+			)
 		}
-		ch <- prometheus.MustNewConstMetric(
-			p.nodeDesc.NodeMetricsStat,
-			prometheus.CounterValue,
-			(float64(p.NodeMetrics.EnergyInPlatform.Curr())/miliJouleToJoule)/p.SamplePeriodSec,
-			NodeMetricsStatusLabelValues...,
-		)
 		ch <- prometheus.MustNewConstMetric(
 			p.nodeDesc.nodeInfo,
 			prometheus.CounterValue,
@@ -476,6 +701,38 @@ func (p *PrometheusCollector) UpdateNodeMetrics(wg *sync.WaitGroup, ch chan<- pr
 				pkgID, collector_metric.NodeName, "rapl",
 			)
 		}
+		for pkgID, val := range p.NodeMetrics.EnergyInPkgIdle.Stat {
+			ch <- prometheus.MustNewConstMetric(
+				p.nodeDesc.nodePackageIdleJoulesTotal,
+				prometheus.CounterValue,
+				float64(val.Aggr)/miliJouleToJoule,
+				pkgID, collector_metric.NodeName,
+			)
+		}
+		for pkgID, val := range p.NodeMetrics.EnergyInPkgActive.Stat {
+			ch <- prometheus.MustNewConstMetric(
+				p.nodeDesc.nodePackageActiveJoulesTotal,
+				prometheus.CounterValue,
+				float64(val.Aggr)/miliJouleToJoule,
+				pkgID, collector_metric.NodeName,
+			)
+		}
+		for component, val := range p.NodeMetrics.EnergyIdle.Stat {
+			ch <- prometheus.MustNewConstMetric(
+				p.nodeDesc.nodeIdleJoulesTotal,
+				prometheus.CounterValue,
+				float64(val.Aggr)/miliJouleToJoule,
+				component, collector_metric.NodeName,
+			)
+		}
+		for component, val := range p.NodeMetrics.EnergyUnattributed.Stat {
+			ch <- prometheus.MustNewConstMetric(
+				p.nodeDesc.nodeUnattributedJoulesTotal,
+				prometheus.CounterValue,
+				float64(val.Aggr)/miliJouleToJoule,
+				component, collector_metric.NodeName,
+			)
+		}
 		ch <- prometheus.MustNewConstMetric(
 			p.nodeDesc.nodePlatformJoulesTotal,
 			prometheus.CounterValue,
@@ -513,17 +770,19 @@ func (p *PrometheusCollector) UpdatePodMetrics(wg *sync.WaitGroup, ch chan<- pro
 				containerCommand = container.Command[:commandLenLimit]
 			}
 			// TODO: After removing this metric in the next release, we need to refactor and remove the ToPrometheusValues function
-			podEnergyStatusLabelValues := []string{container.PodName, container.ContainerName, container.Namespace, containerCommand}
-			for _, label := range podEnergyStatLabels[4:] {
-				val := container.ToPrometheusValue(label)
-				podEnergyStatusLabelValues = append(podEnergyStatusLabelValues, val)
+			if config.ExposeEnergyStatMetrics {
+				podEnergyStatusLabelValues := []string{container.PodName, container.ContainerName, container.Namespace, containerCommand}
+				for _, label := range podEnergyStatLabels[4:] {
+					val := container.ToPrometheusValue(label)
+					podEnergyStatusLabelValues = append(podEnergyStatusLabelValues, val)
+				}
+				ch <- prometheus.MustNewConstMetric(
+					p.podDesc.podEnergyStat,
+					prometheus.GaugeValue,
+					float64(container.Curr()),
+					podEnergyStatusLabelValues...,
+				)
 			}
-			ch <- prometheus.MustNewConstMetric(
-				p.podDesc.podEnergyStat,
-				prometheus.GaugeValue,
-				float64(container.Curr()),
-				podEnergyStatusLabelValues...,
-			)
 			for cpu, cpuTime := range container.CurrCPUTimePerCPU {
 				ch <- prometheus.MustNewConstMetric(
 					p.containerDesc.containerCPUTime,
@@ -532,6 +791,10 @@ func (p *PrometheusCollector) UpdatePodMetrics(wg *sync.WaitGroup, ch chan<- pro
 					container.PodName, container.ContainerName, container.Namespace, strconv.Itoa(int(cpu)),
 				)
 			}
+			p.updateContainerBlockDeviceMetrics(container, ch)
+			if config.EnabledNetworkMetrics {
+				p.updateContainerNetworkMetrics(container, containerCommand, ch)
+			}
 			ch <- prometheus.MustNewConstMetric(
 				p.containerDesc.containerCoreJoulesTotal,
 				prometheus.CounterValue,
@@ -580,6 +843,18 @@ func (p *PrometheusCollector) UpdatePodMetrics(wg *sync.WaitGroup, ch chan<- pro
 					float64(container.EnergyInOther.Aggr)/miliJouleToJoule),
 				container.PodName, container.ContainerName, container.Namespace, containerCommand,
 			)
+			ch <- prometheus.MustNewConstMetric(
+				p.containerDesc.containerDynamicJoulesTotal,
+				prometheus.CounterValue,
+				float64(container.DynEnergy.Aggr)/miliJouleToJoule,
+				container.PodName, container.ContainerName, container.Namespace, containerCommand,
+			)
+			ch <- prometheus.MustNewConstMetric(
+				p.containerDesc.containerIdleJoulesTotal,
+				prometheus.CounterValue,
+				float64(container.IdleEnergy.Aggr)/miliJouleToJoule,
+				container.PodName, container.ContainerName, container.Namespace, containerCommand,
+			)
 			if collector_metric.CPUHardwareCounterEnabled {
 				if container.CounterStats[attacher.CPUCycleLable] != nil {
 					ch <- prometheus.MustNewConstMetric(
@@ -606,6 +881,72 @@ func (p *PrometheusCollector) UpdatePodMetrics(wg *sync.WaitGroup, ch chan<- pro
 					)
 				}
 			}
+			for _, counterKey := range collector_metric.AvailableCounters {
+				if container.CounterStats[counterKey] != nil {
+					ch <- prometheus.MustNewConstMetric(
+						p.containerDesc.containerHardwareEventsTotal,
+						prometheus.CounterValue,
+						float64(container.CounterStats[counterKey].Aggr),
+						container.PodName, container.ContainerName, container.Namespace, containerCommand, counterKey,
+					)
+				}
+			}
 		}(container)
 	}
 }
+
+// updateContainerBlockDeviceMetrics send the container IO per block device to prometheus
+func (p *PrometheusCollector) updateContainerBlockDeviceMetrics(container *collector_metric.ContainerMetrics, ch chan<- prometheus.Metric) {
+	ioStats := []struct {
+		desc      *prometheus.Desc
+		operation string
+		stats     *collector_metric.UInt64StatCollection
+	}{
+		{p.containerDesc.containerBlockDeviceBytesTotal, "read", container.BytesRead},
+		{p.containerDesc.containerBlockDeviceBytesTotal, "write", container.BytesWrite},
+		{p.containerDesc.containerBlockDeviceOpsTotal, "read", container.ReadOps},
+		{p.containerDesc.containerBlockDeviceOpsTotal, "write", container.WriteOps},
+	}
+	for _, ioStat := range ioStats {
+		for device, val := range ioStat.stats.Stat {
+			ch <- prometheus.MustNewConstMetric(
+				ioStat.desc,
+				prometheus.CounterValue,
+				float64(val.Aggr),
+				container.PodName, container.ContainerName, container.Namespace, device, ioStat.operation,
+			)
+		}
+	}
+}
+
+// updateContainerNetworkMetrics send the container network traffic per interface and its estimated energy to prometheus
+func (p *PrometheusCollector) updateContainerNetworkMetrics(container *collector_metric.ContainerMetrics, containerCommand string, ch chan<- prometheus.Metric) {
+	netStats := []struct {
+		desc      *prometheus.Desc
+		direction string
+		stats     *collector_metric.UInt64StatCollection
+	}{
+		{p.containerDesc.containerNetworkBytesTotal, "rx", container.NetRxBytes},
+		{p.containerDesc.containerNetworkBytesTotal, "tx", container.NetTxBytes},
+		{p.containerDesc.containerNetworkPacketsTotal, "rx", container.NetRxPackets},
+		{p.containerDesc.containerNetworkPacketsTotal, "tx", container.NetTxPackets},
+	}
+	for _, netStat := range netStats {
+		for iface, val := range netStat.stats.Stat {
+			ch <- prometheus.MustNewConstMetric(
+				netStat.desc,
+				prometheus.CounterValue,
+				float64(val.Aggr),
+				container.PodName, container.ContainerName, container.Namespace, iface, netStat.direction,
+			)
+		}
+	}
+	if network.IsNICEnergyModelEnabled() {
+		ch <- prometheus.MustNewConstMetric(
+			p.containerDesc.containerNetworkJoulesTotal,
+			prometheus.CounterValue,
+			float64(container.EnergyInNetwork.Aggr)/miliJouleToJoule,
+			container.PodName, container.ContainerName, container.Namespace, containerCommand,
+		)
+	}
+}
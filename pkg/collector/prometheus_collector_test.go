@@ -97,6 +97,8 @@ var _ = Describe("Test Prometheus Collector Unit", func() {
 		nodePlatformEnergy := map[string]float64{}
 		nodePlatformEnergy["sensor0"] = sampleNodeEnergy
 		exporter.NodeMetrics.AddLastestPlatformEnergy(nodePlatformEnergy) // must be higher than components energy
+		exporter.NodeMetrics.ComponentsEnergySource = collector_metric.EnergySourceEstimated
+		exporter.NodeMetrics.PlatformEnergySource = collector_metric.EnergySourceACPI
 
 		// get metrics from prometheus
 		res = httptest.NewRecorder()
@@ -115,6 +117,10 @@ var _ = Describe("Test Prometheus Collector Unit", func() {
 		val, err = convertPromToValue(body, nodePackageEnergyMetric)
 		Expect(err).NotTo(HaveOccurred())
 		Expect(val).Should(BeEquivalentTo(int(samplePkgEnergy / 1000))) // J
+		// the energy source marks the estimated energy, the energy metrics keep their labels
+		Expect(convertPromMetricToMap(body, nodePackageEnergyMetric)).To(HaveKeyWithValue("source", "rapl"))
+		Expect(string(body)).To(ContainSubstring(`kepler_node_energy_source{component="pkg",instance="%s",source="%s"} 1`, collector_metric.NodeName, collector_metric.EnergySourceEstimated))
+		Expect(string(body)).To(ContainSubstring(`kepler_node_energy_source{component="platform",instance="%s",source="%s"} 1`, collector_metric.NodeName, collector_metric.EnergySourceACPI))
 
 		// check sample pod
 		val, err = convertPromToValue(body, containerCPUCoreEnergyMetric)
@@ -0,0 +1,63 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package collector
+
+import (
+	"time"
+
+	collector_metric "github.com/sustainable-computing-io/kepler/pkg/collector/metric"
+	"github.com/sustainable-computing-io/kepler/pkg/training"
+)
+
+// trainingDataComponents are the energy components of the training records, in the order of the energy values
+var trainingDataComponents = []string{"pkg", "core", "uncore", "dram", "gpu", "other", "platform"}
+
+// updateTrainingData writes the feature vectors of the node and of the containers with the node energy of the period to the training data sinks
+func (c *Collector) updateTrainingData(period time.Duration) {
+	schema := training.NewSchema(collector_metric.NodeMetadataNames, collector_metric.ContainerMetricNames, trainingDataComponents)
+	record := &training.Record{
+		Timestamp: c.lastUpdate,
+		PeriodSec: period.Seconds(),
+		Node: training.NodeRecord{
+			Name:         collector_metric.NodeName,
+			SystemValues: collector_metric.NodeMetadataValues,
+			Features:     make([]float64, len(schema.Features)),
+			Energy: []float64{
+				float64(c.NodeMetrics.EnergyInPkg.Curr()),
+				float64(c.NodeMetrics.EnergyInCore.Curr()),
+				float64(c.NodeMetrics.EnergyInUncore.Curr()),
+				float64(c.NodeMetrics.EnergyInDRAM.Curr()),
+				float64(c.NodeMetrics.EnergyInGPU.Curr()),
+				float64(c.NodeMetrics.EnergyInOther.Curr()),
+				float64(c.NodeMetrics.EnergyInPlatform.Curr()),
+			},
+		},
+		Containers: make([]training.ContainerRecord, 0, len(c.ContainersMetrics)),
+	}
+	for i, feature := range schema.Features {
+		record.Node.Features[i] = c.NodeMetrics.ResourceUsage[feature]
+	}
+	for _, container := range c.ContainersMetrics {
+		record.Containers = append(record.Containers, training.ContainerRecord{
+			PodName:       container.PodName,
+			ContainerName: container.ContainerName,
+			Namespace:     container.Namespace,
+			Features:      container.ToEstimatorValues(),
+		})
+	}
+	training.Write(schema, record)
+}
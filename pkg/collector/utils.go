@@ -44,5 +44,6 @@ func (c *Collector) createContainersMetricsIfNotExist(containerID string, cGroup
 		}
 
 		c.ContainersMetrics[containerID] = collector_metric.NewContainerMetrics(containerName, podName, namespace)
+		c.ContainersMetrics[containerID].CPURequest, c.ContainersMetrics[containerID].MemoryRequest, _ = cgroup.GetContainerRequests(cGroupID, pid, withCGroupID)
 	}
 }
@@ -19,10 +19,13 @@ package config
 import (
 	"bytes"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strconv"
+	"strings"
+	"time"
 
 	"golang.org/x/sys/unix"
 	"k8s.io/klog/v2"
@@ -47,20 +50,133 @@ var c config
 
 const (
 	defaultMetricValue = ""
+
+	// IdlePowerPolicyNone does not attribute the node idle energy, the containers only get their dynamic energy
+	IdlePowerPolicyNone = "none"
+	// IdlePowerPolicyEvenly divides the node idle energy evenly across the containers
+	IdlePowerPolicyEvenly = "evenly"
+	// IdlePowerPolicyRequests divides the node idle energy by the CPU requests of the containers, the DRAM idle energy by their memory requests
+	IdlePowerPolicyRequests = "requests"
+	// IdlePowerPolicyUsage divides the node idle energy with the attribution policy of the component, like the dynamic energy
+	IdlePowerPolicyUsage = "usage"
+
+	// PowerEstimatorAuto estimates the node power from the CPU utilization when the node has no power measurement and no trained power model
+	// of the node is loaded
+	PowerEstimatorAuto = "auto"
+	// PowerEstimatorNone disables the estimation of the node power from the CPU utilization
+	PowerEstimatorNone = "none"
+
+	// AttributionPolicyEvenly divides the component energy evenly across the containers that ran in the period
+	AttributionPolicyEvenly = "evenly"
+	// AttributionPolicyUsage divides the component energy by the usage metric of the component
+	AttributionPolicyUsage = "usage"
+	// AttributionPolicyRequests divides the component energy by the CPU requests of the containers, the DRAM energy by their memory requests
+	AttributionPolicyRequests = "requests"
 )
 
 var (
 	EnabledEBPFCgroupID          = false
 	ExposeHardwareCounterMetrics = true
 	EnabledGPU                   = false
+	EnabledNetworkMetrics        = true
+	SMTAwareAttribution          = false
+	OnlineCalibration            = false
+	ExposeEnergyStatMetrics      = false
+	EnergyReconciliation         = true
 
 	EstimatorModel        = getConfig("ESTIMATOR_MODEL", defaultMetricValue)         // auto-select
 	EstimatorSelectFilter = getConfig("ESTIMATOR_SELECT_FILTER", defaultMetricValue) // no filter
-	CoreUsageMetric       = getConfig("CORE_USAGE_METRIC", CPUInstruction)
-	DRAMUsageMetric       = getConfig("DRAM_USAGE_METRIC", CacheMiss)
-	UncoreUsageMetric     = getConfig("UNCORE_USAGE_METRIC", defaultMetricValue) // no metric (evenly divided)
-	GpuUsageMetric        = getConfig("GPU_USAGE_METRIC", GPUSMUtilization)      // no metric (evenly divided)
-	GeneralUsageMetric    = getConfig("GENERAL_USAGE_METRIC", CPUInstruction)    // for uncategorized energy; pkg - core - uncore
+	// EstimatorType selects the local estimator of the trained power models: LinearRegressor, TreeEnsemble, Polynomial or PiecewiseLinear
+	EstimatorType = getConfig("ESTIMATOR_TYPE", "LinearRegressor")
+
+	// the initial models of the power model estimators: an http(s) URL, a file:// URL or a local path, e.g. a mounted ConfigMap,
+	// optionally followed by #sha256=<checksum> of the model file. The built-in initial model is used if empty.
+	NodeTotalInitModel           = getConfig("NODE_TOTAL_INIT_MODEL", defaultMetricValue)
+	NodeComponentsInitModel      = getConfig("NODE_COMPONENTS_INIT_MODEL", defaultMetricValue)
+	ContainerTotalInitModel      = getConfig("CONTAINER_TOTAL_INIT_MODEL", defaultMetricValue)
+	ContainerComponentsInitModel = getConfig("CONTAINER_COMPONENTS_INIT_MODEL", defaultMetricValue)
+
+	// ModelRefreshInterval is how often the power models are reloaded in the background, a model is kept until a valid one is loaded (0 disables the refresh)
+	ModelRefreshInterval = parseDuration(getConfig("MODEL_REFRESH_INTERVAL", "0"), 0)
+	// ModelServerTimeout bounds each request to the model server or to the initial model URL
+	ModelServerTimeout = parseDuration(getConfig("MODEL_SERVER_TIMEOUT", "10s"), 10*time.Second)
+	// MaxNodePower is the maximum plausible power of the node in watts, an estimated power above it is rejected (0 disables the bound)
+	MaxNodePower = parseFloat(getConfig("MAX_NODE_POWER", "5000"), 5000)
+	// MinNodePower is the minimum plausible power of the node in watts, an estimated power below it is rejected (0 disables the bound)
+	MinNodePower = parseFloat(getConfig("MIN_NODE_POWER", "0"), 0)
+	// NodePowerBounds overrides MinNodePower and MaxNodePower by node name, written as <node>=<min>:<max> separated by commas,
+	// e.g. node-a=50:400,node-b=:800 where an empty bound keeps the global one. The node name is NODE_NAME or the hostname.
+	NodePowerBounds = parseNodePowerBounds(getConfig("NODE_POWER_BOUNDS", defaultMetricValue))
+	// EstimatorSidecarTimeout bounds each request to the estimator sidecar, a request that times out is sent again on a new connection
+	EstimatorSidecarTimeout = parseDuration(getConfig("ESTIMATOR_SIDECAR_TIMEOUT", "5s"), 5*time.Second)
+	// ModelServerRetries is how many times a failed model request is retried with exponential backoff, the requests at start are not retried
+	// to not block the start, the models that failed to load are reloaded in the background
+	ModelServerRetries = parseInt(getConfig("MODEL_SERVER_RETRIES", "3"), 3)
+	// the TLS and the bearer token authentication to the model server: the CA of the server, the client certificate and key for mTLS, and the token file
+	ModelServerCAFile    = getConfig("MODEL_SERVER_CA_FILE", defaultMetricValue)
+	ModelServerCertFile  = getConfig("MODEL_SERVER_CERT_FILE", defaultMetricValue)
+	ModelServerKeyFile   = getConfig("MODEL_SERVER_KEY_FILE", defaultMetricValue)
+	ModelServerTokenFile = getConfig("MODEL_SERVER_TOKEN_FILE", defaultMetricValue)
+
+	// MinModelFeatureCoverage is the minimum ratio of the features of a model that the node must collect, a model below it is rejected.
+	// The default 0 does not reject any model, the missing features are only reported in /models and kepler_model_info.
+	MinModelFeatureCoverage = parseFloat(getConfig("MIN_MODEL_FEATURE_COVERAGE", "0"), 0)
+	// CalibrationForgettingFactor discounts the older samples of the online calibration of the node component model, 1 weighs all samples equally
+	CalibrationForgettingFactor = parseFloat(getConfig("CALIBRATION_FORGETTING_FACTOR", "0.999"), 0.999)
+
+	// the usage metrics of the components are comma-separated preference lists, the first metric collected on the node is used
+	CoreUsageMetrics    = parseList(getConfig("CORE_USAGE_METRIC", CPUInstruction+","+CPUTime+","+CgroupfsCPU))
+	DRAMUsageMetrics    = parseList(getConfig("DRAM_USAGE_METRIC", CacheMiss+","+CPUTime))
+	UncoreUsageMetrics  = parseList(getConfig("UNCORE_USAGE_METRIC", defaultMetricValue))                          // no metric (evenly divided)
+	GpuUsageMetrics     = parseList(getConfig("GPU_USAGE_METRIC", GPUSMUtilization))                               // no metric (evenly divided)
+	GeneralUsageMetrics = parseList(getConfig("GENERAL_USAGE_METRIC", CPUInstruction+","+CPUTime+","+CgroupfsCPU)) // for uncategorized energy; pkg - core - uncore
+
+	// AttributionPolicies selects how the energy of each component (core, uncore, dram, gpu and other) is attributed to the containers,
+	// the policy is evenly, usage, requests or a weighted combination of them, e.g. usage:0.8,requests:0.2. The package energy follows the core policy.
+	AttributionPolicies = map[string]string{
+		"core":   getConfig("CORE_ATTRIBUTION_POLICY", AttributionPolicyUsage),
+		"uncore": getConfig("UNCORE_ATTRIBUTION_POLICY", AttributionPolicyEvenly),
+		"dram":   getConfig("DRAM_ATTRIBUTION_POLICY", AttributionPolicyUsage),
+		"gpu":    getConfig("GPU_ATTRIBUTION_POLICY", AttributionPolicyUsage),
+		"other":  getConfig("OTHER_ATTRIBUTION_POLICY", AttributionPolicyEvenly),
+	}
+
+	// IdlePowerPolicy selects how the node idle energy is attributed to the containers: none, evenly, requests or usage
+	IdlePowerPolicy = getConfig("IDLE_POWER_POLICY", IdlePowerPolicyUsage)
+	// IdlePowerWindow is how long the minimum power of a component is kept as its idle baseline, the baseline recovers from a
+	// minimum that is not observed anymore after the window (0 keeps the minimum forever)
+	IdlePowerWindow = parseDuration(getConfig("IDLE_POWER_WINDOW", "24h"), 24*time.Hour)
+
+	// ExcludedBlockDevices holds the prefixes of the block device names whose IO is not accounted, e.g. virtual devices stacked on the physical disks.
+	// An empty EXCLUDED_BLOCK_DEVICES (set but empty) disables the filtering, the default list is only used when it is unset.
+	ExcludedBlockDevices = parseList(getConfig("EXCLUDED_BLOCK_DEVICES", "loop,dm,nbd,zram"))
+
+	// HardwareCounters holds the hardware performance events collected by the eBPF program, see attacher.InitCounters for the names
+	HardwareCounters = parseList(getConfig("HARDWARE_COUNTERS", CPUCycle+","+CPUInstruction+","+CacheMiss))
+
+	// NICEnergyModel holds the per-interface energy model of the network traffic, see network.InitNICEnergyModel for the format
+	NICEnergyModel = getConfig("NIC_ENERGY_MODEL", defaultMetricValue) // no model (no network energy)
+
+	// TrainingDataSinks selects where the training data is written: file (rotating files at TrainingDataPath) and http (streamed on /training-data)
+	TrainingDataSinks = parseList(getConfig("TRAINING_DATA_SINK", defaultMetricValue))
+	// TrainingDataPath is the file of the training data, the rotated files are suffixed by .1 to .<TrainingDataMaxFiles> (at least 1)
+	TrainingDataPath      = getConfig("TRAINING_DATA_PATH", "/var/lib/kepler/training/training-data")
+	TrainingDataFormat    = getConfig("TRAINING_DATA_FORMAT", "json") // json (JSON lines) or csv
+	TrainingDataMaxSizeMB = parseInt(getConfig("TRAINING_DATA_MAX_SIZE_MB", "100"), 100)
+	TrainingDataMaxFiles  = parseInt(getConfig("TRAINING_DATA_MAX_FILES", "5"), 5)
+
+	// PowerEstimator selects the estimation of the node power from the CPU utilization: auto (used when neither RAPL nor hwmon is available
+	// and no trained power model of the node is loaded) or none
+	PowerEstimator = getConfig("POWER_ESTIMATOR", PowerEstimatorAuto)
+	// PowerCurve is the CPU power of the node in watts by utilization in percent, e.g. 0:50,50:100,100:150, which replaces the power data of the CPU architecture
+	PowerCurve = getConfig("POWER_CURVE", defaultMetricValue)
+	// MemoryPowerPerGB is the estimated DRAM power in watts per GB of memory, 0.392 is the memory coefficient of Cloud Carbon Footprint
+	MemoryPowerPerGB = parseFloat(getConfig("MEMORY_POWER_PER_GB", "0.392"), 0.392)
+
+	// BPFBackend selects how the eBPF program is loaded: core (precompiled CO-RE object), bcc or auto (core, then bcc)
+	BPFBackend = getConfig("BPF_BACKEND", "auto")
+	// BPFObjectPath is the precompiled CO-RE object loaded by the core backend
+	BPFObjectPath = getConfig("BPF_OBJECT_PATH", "/var/lib/kepler/bpfassets/perf_event.bpf.o")
 
 	versionRegex = regexp.MustCompile(`^(\d+)\.(\d+).`)
 
@@ -103,6 +219,112 @@ func SetEnabledGPU(enabled bool) {
 	EnabledGPU = true
 }
 
+// SetEnabledNetworkMetrics enables the collection of the container network traffic
+func SetEnabledNetworkMetrics(enabled bool) {
+	EnabledNetworkMetrics = enabled
+}
+
+// SetSMTAwareAttribution enables the attribution of the core energy by the core time, which splits the time that sibling hyperthreads shared a core.
+// The ratio model uses the core time instead of the configured core usage metrics.
+func SetSMTAwareAttribution(enabled bool) {
+	SMTAwareAttribution = enabled
+}
+
+// SetOnlineCalibration enables the online fitting of the node component model on the measured energy
+func SetOnlineCalibration(enabled bool) {
+	OnlineCalibration = enabled
+}
+
+// SetEnergyReconciliation enables the scaling of the container energy of each component to the node energy
+func SetEnergyReconciliation(enabled bool) {
+	EnergyReconciliation = enabled
+}
+
+// SetExposeEnergyStatMetrics enables the deprecated energy_stat metrics that encode the training data in labels
+func SetExposeEnergyStatMetrics(enabled bool) {
+	ExposeEnergyStatMetrics = enabled
+	if enabled {
+		klog.Warning("the kepler_node_energy_stat and kepler_pod_energy_stat metrics are deprecated and will be removed, use the training data sink instead")
+	}
+}
+
+// SetTrainingDataSinks sets the comma-separated training data sinks
+func SetTrainingDataSinks(sinks string) {
+	TrainingDataSinks = parseList(sinks)
+}
+
+// SetNICEnergyModel sets the per-interface energy model of the network traffic
+func SetNICEnergyModel(model string) {
+	NICEnergyModel = model
+}
+
+// SetBPFBackend sets the backend loading the eBPF program
+func SetBPFBackend(backend string) {
+	BPFBackend = backend
+}
+
+// SetBPFObjectPath sets the path of the precompiled CO-RE object
+func SetBPFObjectPath(path string) {
+	BPFObjectPath = path
+}
+
+// SetIdlePowerPolicy sets how the node idle energy is attributed to the containers
+func SetIdlePowerPolicy(policy string) {
+	IdlePowerPolicy = policy
+}
+
+// SetAttributionPolicies sets the attribution policy of the components written as <component>=<policy> separated by semicolons,
+// e.g. uncore=usage;other=usage:0.5,requests:0.5
+func SetAttributionPolicies(policies string) error {
+	for _, item := range strings.Split(policies, ";") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		component, policy, found := strings.Cut(item, "=")
+		if !found {
+			return fmt.Errorf("invalid attribution policy %q, expected <component>=<policy>", item)
+		}
+		component = strings.TrimSpace(component)
+		if _, exists := AttributionPolicies[component]; !exists {
+			return fmt.Errorf("unknown component %q in attribution policy %q", component, item)
+		}
+		if _, err := ParseAttributionPolicy(policy); err != nil {
+			return err
+		}
+		AttributionPolicies[component] = strings.TrimSpace(policy)
+	}
+	return nil
+}
+
+// ParseAttributionPolicy returns the normalized weight of each attribution policy of a policy written as <policy>[:<weight>] separated by commas
+func ParseAttributionPolicy(policy string) (map[string]float64, error) {
+	weights := make(map[string]float64)
+	totalWeight := float64(0)
+	for _, item := range parseList(policy) {
+		name, weightStr, hasWeight := strings.Cut(item, ":")
+		name = strings.TrimSpace(name)
+		if name != AttributionPolicyEvenly && name != AttributionPolicyUsage && name != AttributionPolicyRequests {
+			return nil, fmt.Errorf("unknown attribution policy %q in %q", name, policy)
+		}
+		weight := float64(1)
+		if hasWeight {
+			var err error
+			if weight, err = strconv.ParseFloat(strings.TrimSpace(weightStr), 64); err != nil || weight < 0 {
+				return nil, fmt.Errorf("invalid weight %q in attribution policy %q", weightStr, policy)
+			}
+		}
+		weights[name] += weight
+		totalWeight += weight
+	}
+	if totalWeight <= 0 {
+		return nil, fmt.Errorf("attribution policy %q has no weight", policy)
+	}
+	for name := range weights {
+		weights[name] /= totalWeight
+	}
+	return weights, nil
+}
+
 func (c config) getUnixName() (unix.Utsname, error) {
 	var utsname unix.Utsname
 	err := unix.Uname(&utsname)
@@ -167,6 +389,138 @@ func SetEstimatorConfig(modelName, selectFilter string) {
 	EstimatorSelectFilter = selectFilter
 }
 
+// SetEstimatorType sets the local estimator of the trained power models
+func SetEstimatorType(estimatorType string) {
+	EstimatorType = estimatorType
+}
+
+// SetExcludedBlockDevices sets the comma-separated prefixes of the block devices to ignore in the IO stats
+func SetExcludedBlockDevices(devices string) {
+	ExcludedBlockDevices = parseList(devices)
+}
+
+// SetHardwareCounters sets the comma-separated hardware performance events collected by the eBPF program
+func SetHardwareCounters(counters string) {
+	HardwareCounters = parseList(counters)
+}
+
+// PowerBounds is the minimum and maximum plausible power of a node in watts, a negative bound is not set
+type PowerBounds struct {
+	Min float64
+	Max float64
+}
+
+// GetNodePowerBounds returns the minimum and maximum plausible power of this node in watts, 0 disables a bound
+func GetNodePowerBounds() (minPower, maxPower float64) {
+	minPower, maxPower = MinNodePower, MaxNodePower
+	if bounds, ok := NodePowerBounds[getNodeName()]; ok {
+		if bounds.Min >= 0 {
+			minPower = bounds.Min
+		}
+		if bounds.Max >= 0 {
+			maxPower = bounds.Max
+		}
+	}
+	return
+}
+
+func getNodeName() string {
+	if nodeName := os.Getenv("NODE_NAME"); nodeName != "" {
+		return nodeName
+	}
+	nodeName, _ := os.Hostname()
+	return nodeName
+}
+
+// parseNodePowerBounds returns the power bounds by node name written as <node>=<min>:<max>, an invalid entry is ignored
+func parseNodePowerBounds(value string) map[string]PowerBounds {
+	result := map[string]PowerBounds{}
+	for _, item := range parseList(value) {
+		node, bounds, err := parsePowerBounds(item)
+		if err != nil {
+			klog.Warningf("ignoring the node power bounds %q: %v", item, err)
+			continue
+		}
+		result[node] = bounds
+	}
+	return result
+}
+
+func parsePowerBounds(item string) (node string, bounds PowerBounds, err error) {
+	node, value, found := strings.Cut(item, "=")
+	if node = strings.TrimSpace(node); !found || node == "" {
+		return node, bounds, fmt.Errorf("expected <node>=<min>:<max>")
+	}
+	minValue, maxValue, found := strings.Cut(value, ":")
+	if !found {
+		return node, bounds, fmt.Errorf("expected <min>:<max>")
+	}
+	if bounds.Min, err = parseBound(minValue); err != nil {
+		return node, bounds, err
+	}
+	if bounds.Max, err = parseBound(maxValue); err != nil {
+		return node, bounds, err
+	}
+	if bounds.Min > 0 && bounds.Max > 0 && bounds.Min > bounds.Max {
+		return node, bounds, fmt.Errorf("the minimum power %v is above the maximum power %v", bounds.Min, bounds.Max)
+	}
+	return node, bounds, nil
+}
+
+// parseBound returns the non-negative power of the value or -1 if it is empty
+func parseBound(value string) (float64, error) {
+	if value = strings.TrimSpace(value); value == "" {
+		return -1, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < 0 || math.IsInf(f, 0) || math.IsNaN(f) {
+		return 0, fmt.Errorf("invalid power %q", value)
+	}
+	return f, nil
+}
+
+// parseDuration returns the duration of the value, e.g. 5m, or the default value if it is invalid
+func parseDuration(value string, defaultValue time.Duration) time.Duration {
+	duration, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil || duration < 0 {
+		return defaultValue
+	}
+	return duration
+}
+
+// parseInt returns the non-negative integer of the value or the default value if it is invalid
+func parseInt(value string, defaultValue int) int {
+	i, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || i < 0 {
+		return defaultValue
+	}
+	return i
+}
+
+// parseFloat returns the non-negative float of the value or the default value if it is invalid
+func parseFloat(value string, defaultValue float64) float64 {
+	f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || f < 0 {
+		return defaultValue
+	}
+	return f
+}
+
+func parseList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func SetModelServerEndpoint(serverEndpoint string) {
 	ModelServerEndpoint = serverEndpoint
 }
+
+// SetModelRefreshInterval sets how often the power models are reloaded, 0 disables the refresh
+func SetModelRefreshInterval(interval time.Duration) {
+	ModelRefreshInterval = interval
+}
@@ -113,4 +113,53 @@ var _ = Describe("Test Configuration", func() {
 			// no test
 		}
 	})
+	It("Test attribution policies", func() {
+		weights, err := ParseAttributionPolicy("usage:3, requests:1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(weights).To(Equal(map[string]float64{AttributionPolicyUsage: 0.75, AttributionPolicyRequests: 0.25}))
+		weights, err = ParseAttributionPolicy("evenly")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(weights).To(Equal(map[string]float64{AttributionPolicyEvenly: 1}))
+		_, err = ParseAttributionPolicy("usage:-1")
+		Expect(err).To(HaveOccurred())
+		_, err = ParseAttributionPolicy("power")
+		Expect(err).To(HaveOccurred())
+
+		defer func(uncorePolicy string) { AttributionPolicies["uncore"] = uncorePolicy }(AttributionPolicies["uncore"])
+		Expect(SetAttributionPolicies("uncore=usage:0.5,evenly:0.5")).To(Succeed())
+		Expect(AttributionPolicies["uncore"]).To(Equal("usage:0.5,evenly:0.5"))
+		Expect(SetAttributionPolicies("disk=usage")).NotTo(Succeed())
+	})
+	It("Test node power bounds", func() {
+		Expect(parseNodePowerBounds("node-a=50:400, node-b=:800, node-c=500:100, node-d=50, node-e=x:1")).To(Equal(map[string]PowerBounds{
+			"node-a": {Min: 50, Max: 400},
+			"node-b": {Min: -1, Max: 800},
+		}))
+
+		defer func(bounds map[string]PowerBounds) { NodePowerBounds = bounds }(NodePowerBounds)
+		NodePowerBounds = parseNodePowerBounds("node-b=:800")
+		os.Setenv("NODE_NAME", "node-b")
+		defer os.Unsetenv("NODE_NAME")
+		minPower, maxPower := GetNodePowerBounds()
+		Expect(minPower).To(Equal(MinNodePower))
+		Expect(maxPower).To(Equal(float64(800)))
+		os.Setenv("NODE_NAME", "node-z")
+		minPower, maxPower = GetNodePowerBounds()
+		Expect(minPower).To(Equal(MinNodePower))
+		Expect(maxPower).To(Equal(MaxNodePower))
+	})
+	It("Test excluded block devices", func() {
+		defer func(devices []string) { ExcludedBlockDevices = devices }(ExcludedBlockDevices)
+		SetExcludedBlockDevices("nvme, sd")
+		Expect(ExcludedBlockDevices).To(Equal([]string{"nvme", "sd"}))
+		// an empty list disables the filtering
+		SetExcludedBlockDevices("")
+		Expect(ExcludedBlockDevices).To(BeEmpty())
+
+		os.Setenv("EXCLUDED_BLOCK_DEVICES", "")
+		defer os.Unsetenv("EXCLUDED_BLOCK_DEVICES")
+		Expect(parseList(getConfig("EXCLUDED_BLOCK_DEVICES", "loop,dm"))).To(BeEmpty())
+		os.Unsetenv("EXCLUDED_BLOCK_DEVICES")
+		Expect(parseList(getConfig("EXCLUDED_BLOCK_DEVICES", "loop,dm"))).To(Equal([]string{"loop", "dm"}))
+	})
 })
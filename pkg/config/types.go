@@ -24,6 +24,8 @@ const (
 
 	// bpf - attacher package
 	CPUTime = "cpu_time"
+	// CoreTime is the CPU time where the time that sibling hyperthreads shared a physical core is split between them
+	CoreTime = "core_time"
 
 	// cgroup - cgroup package
 	CgroupfsMemory       = "cgroupfs_memory_usage_bytes"
@@ -36,7 +38,14 @@ const (
 	CgroupfsWriteIO      = "cgroupfs_iowrite_bytes"
 	BytesReadIO          = "bytes_read"
 	BytesWriteIO         = "bytes_writes"
+	ReadOpsIO            = "read_ops"
+	WriteOpsIO           = "write_ops"
 	BlockDevicesIO       = "block_devices_used"
+	// network - cgroup package
+	NetRxBytes   = "net_rx_bytes"
+	NetTxBytes   = "net_tx_bytes"
+	NetRxPackets = "net_rx_packets"
+	NetTxPackets = "net_tx_packets"
 	// kubelet - package
 	KubeletContainerCPU    = "container_cpu_usage_seconds_total"
 	KubeletContainerMemory = "container_memory_working_set_bytes"
@@ -45,6 +54,8 @@ const (
 
 	// system
 	CPUFrequency = "avg_cpu_frequency"
+	// CPUIdleRatio is the node ratio of time in idle states, the ratio of each state is CPUIdleRatio + "_" + <state name>
+	CPUIdleRatio = "cpu_idle_ratio"
 
 	// GPU
 	GPUSMUtilization  = "gpu_sm_util"
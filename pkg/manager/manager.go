@@ -20,6 +20,7 @@ import (
 	"time"
 
 	"github.com/sustainable-computing-io/kepler/pkg/collector"
+	"github.com/sustainable-computing-io/kepler/pkg/model"
 )
 
 const (
@@ -45,6 +46,7 @@ func New() *CollectorManager {
 	manager.PrometheusCollector.NodeMetrics = &manager.MetricCollector.NodeMetrics
 	manager.PrometheusCollector.ContainersMetrics = &manager.MetricCollector.ContainersMetrics
 	manager.PrometheusCollector.SamplePeriodSec = SamplePeriodSec
+	model.SamplePeriodSec = SamplePeriodSec
 	return manager
 }
 
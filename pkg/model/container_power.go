@@ -18,6 +18,7 @@ package model
 
 import (
 	collector_metric "github.com/sustainable-computing-io/kepler/pkg/collector/metric"
+	"github.com/sustainable-computing-io/kepler/pkg/config"
 	"github.com/sustainable-computing-io/kepler/pkg/model/estimator/local"
 	"github.com/sustainable-computing-io/kepler/pkg/model/types"
 	"github.com/sustainable-computing-io/kepler/pkg/power/components"
@@ -27,8 +28,8 @@ import (
 
 var (
 	ContainerTotalPowerModelValid, ContainerComponentPowerModelValid bool
-	ContainerTotalPowerModelFunc                                     func([][]float64, []string) ([]float64, error)
-	ContainerComponentPowerModelFunc                                 func([][]float64, []string) (map[string][]float64, error)
+	ContainerTotalPowerModelFunc                                     func([]string, [][]float64, []string) ([]float64, error)
+	ContainerComponentPowerModelFunc                                 func([]string, [][]float64, []string) (map[string][]float64, error)
 
 	// TODO: be configured by config package
 	// cgroupOnly
@@ -37,30 +38,30 @@ var (
 	ContainerComponentPowerModelConfig types.ModelConfig = types.ModelConfig{UseEstimatorSidecar: false, InitModelURL: dynCompURL}
 )
 
-func InitContainerPowerEstimator(usageMetrics, systemFeatures, systemValues []string) {
-	var estimateFunc interface{}
+func InitContainerPowerEstimator(usageMetrics, systemFeatures, systemValues []string, retries int) {
+	if config.ContainerTotalInitModel != "" {
+		ContainerTotalPowerModelConfig.InitModelURL = config.ContainerTotalInitModel
+	}
 	// init func for ContainerTotalPower
-	ContainerTotalPowerModelValid, estimateFunc = initEstimateFunction(ContainerTotalPowerModelConfig, types.DynPower, types.DynModelWeight, usageMetrics, systemFeatures, systemValues, true)
-	if ContainerTotalPowerModelValid {
-		ContainerTotalPowerModelFunc = estimateFunc.(func([][]float64, []string) ([]float64, error))
+	valid, estimateFunc := initEstimateFunction(ContainerTotalPowerModelConfig, types.DynPower, types.DynModelWeight, usageMetrics, systemFeatures, systemValues, true, retries)
+	// the estimator is kept until a valid one is loaded
+	if valid {
+		estimatorLock.Lock()
+		ContainerTotalPowerModelValid = true
+		ContainerTotalPowerModelFunc = estimateFunc.(func([]string, [][]float64, []string) ([]float64, error))
+		estimatorLock.Unlock()
 	}
-	// init func for ContainerComponentPower
-	ContainerComponentPowerModelValid, estimateFunc = initEstimateFunction(ContainerComponentPowerModelConfig, types.DynComponentPower, types.DynComponentModelWeight, usageMetrics, systemFeatures, systemValues, false)
-	if ContainerComponentPowerModelValid {
-		ContainerComponentPowerModelFunc = estimateFunc.(func([][]float64, []string) (map[string][]float64, error))
+	if config.ContainerComponentsInitModel != "" {
+		ContainerComponentPowerModelConfig.InitModelURL = config.ContainerComponentsInitModel
 	}
-}
-
-// The current implementation from the model server returns a list of the container energy.
-// The list follows the order of the container containerMetricValuesOnly for the container id...
-// TODO: make model server return a list of elemets that also contains the containerID to enforce consistency
-func getContainerMetricsList(containersMetrics map[string]*collector_metric.ContainerMetrics) (containerMetricValuesOnly [][]float64) {
-	// convert to pod metrics to array
-	for _, c := range containersMetrics {
-		values := c.ToEstimatorValues()
-		containerMetricValuesOnly = append(containerMetricValuesOnly, values)
+	// init func for ContainerComponentPower
+	valid, estimateFunc = initEstimateFunction(ContainerComponentPowerModelConfig, types.DynComponentPower, types.DynComponentModelWeight, usageMetrics, systemFeatures, systemValues, false, retries)
+	if valid {
+		estimatorLock.Lock()
+		ContainerComponentPowerModelValid = true
+		ContainerComponentPowerModelFunc = estimateFunc.(func([]string, [][]float64, []string) (map[string][]float64, error))
+		estimatorLock.Unlock()
 	}
-	return
 }
 
 // UpdateContainerEnergy returns container energy consumption for each node component
@@ -70,28 +71,37 @@ func UpdateContainerEnergy(containersMetrics map[string]*collector_metric.Contai
 	if components.IsSystemCollectionSupported() {
 		local.UpdateContainerEnergyByRatioPowerModel(containersMetrics, nodeMetrics)
 	} else {
-		updateContainerEnergyByTrainedPowerModel(containersMetrics)
+		updateContainerEnergyByTrainedPowerModel(containersMetrics, nodeMetrics)
 	}
 }
 
-func updateContainerEnergyByTrainedPowerModel(containersMetrics map[string]*collector_metric.ContainerMetrics) {
-	var enabled bool
-	// convert the container metrics map to an array since the model server does not receive structured data
-	// TODO: send data to model server via protobuf instead of no structured data
+func updateContainerEnergyByTrainedPowerModel(containersMetrics map[string]*collector_metric.ContainerMetrics, nodeMetrics collector_metric.NodeMetrics) {
+	// convert the container metrics map to an array, the estimated powers are in the order of the container id list
+	// and the estimator sidecar keys the records by the container ids
 	containerMetricValuesOnly, containerIDList := containerMetricsToArray(containersMetrics)
 
-	totalPowerValid, totalContainerPowers := getContainerTotalPower(containerMetricValuesOnly)
+	totalPowerValid, totalContainerPowers, totalRejected := getContainerTotalPower(containerIDList, containerMetricValuesOnly)
 
-	enabled, containerComponentPowers := getContainerComponentPowers(containerMetricValuesOnly)
+	enabled, containerComponentPowers, componentRejected := getContainerComponentPowers(containerIDList, containerMetricValuesOnly)
 	if !enabled {
 		klog.V(5).Infoln("No ContainerComponentPower Model")
 		return
 	}
+	if totalRejected || componentRejected {
+		// the model estimated an invalid or implausible power, divide the node energy by the container usage instead
+		klog.V(3).Infoln("Rejected container power estimates, fall back to the ratio power model")
+		local.UpdateContainerEnergyByRatioPowerModel(containersMetrics, nodeMetrics)
+		return
+	}
 	containerOtherPowers := make([]uint64, len(containerComponentPowers))
 	if totalPowerValid {
 		for index, componentPower := range containerComponentPowers {
 			// TODO: include GPU into consideration
-			containerOtherPowers[index] = uint64(totalContainerPowers[index]) - componentPower.Pkg - componentPower.DRAM
+			if totalContainerPowers[index] < componentPower.Pkg+componentPower.DRAM {
+				countRejection(types.DynPower, RejectionInconsistent)
+				continue
+			}
+			containerOtherPowers[index] = totalContainerPowers[index] - componentPower.Pkg - componentPower.DRAM
 		}
 	}
 
@@ -113,41 +123,57 @@ func updateContainerEnergyByTrainedPowerModel(containersMetrics map[string]*coll
 		if err := containersMetrics[containerID].EnergyInOther.AddNewCurr(containerOtherPowers[i]); err != nil {
 			klog.V(5).Infoln(err)
 		}
+		// the power models estimate the dynamic power, the other energy is the dynamic power of the total model left by the components
+		if err := containersMetrics[containerID].DynEnergy.AddNewCurr(containerComponentPowers[i].Pkg + containerComponentPowers[i].DRAM + containerOtherPowers[i]); err != nil {
+			klog.V(5).Infoln(err)
+		}
 	}
 }
 
-// getContainerTotalPower returns estimated pods' total power
-func getContainerTotalPower(containerMetricValuesOnly [][]float64) (valid bool, results []float64) {
+// getContainerTotalPower returns estimated pods' total power, rejected is set if any estimate is invalid or implausible
+func getContainerTotalPower(containerIDList []string, containerMetricValuesOnly [][]float64) (valid bool, results []uint64, rejected bool) {
 	valid = false
-	if ContainerTotalPowerModelValid {
-		powers, err := ContainerTotalPowerModelFunc(containerMetricValuesOnly, collector_metric.NodeMetadataValues)
-		if err != nil || len(powers) == 0 {
+	estimatorLock.RLock()
+	modelValid, estimateFunc := ContainerTotalPowerModelValid, ContainerTotalPowerModelFunc
+	estimatorLock.RUnlock()
+	if modelValid {
+		powers, err := estimateFunc(containerIDList, containerMetricValuesOnly, collector_metric.NodeMetadataValues)
+		if err != nil || len(powers) < len(containerMetricValuesOnly) {
 			return
 		}
-		results = powers
+		guard := newPowerGuard(types.DynPower)
+		results = make([]uint64, len(containerMetricValuesOnly))
+		for index := range results {
+			results[index] = guard.check(powers[index])
+		}
 		valid = true
+		rejected = guard.rejected
 		return
 	}
 	return
 }
 
-// getContainerTotalPower returns estimated pods' RAPL power
-func getContainerComponentPowers(containerMetricValuesOnly [][]float64) (bool, []source.NodeComponentsEnergy) {
+// getContainerComponentPowers returns estimated pods' RAPL power, the last value is set if any estimate is invalid or implausible
+func getContainerComponentPowers(containerIDList []string, containerMetricValuesOnly [][]float64) (bool, []source.NodeComponentsEnergy, bool) {
 	podNumber := len(containerMetricValuesOnly)
-	if ContainerComponentPowerModelValid {
-		powers, err := ContainerComponentPowerModelFunc(containerMetricValuesOnly, collector_metric.NodeMetadataValues)
+	estimatorLock.RLock()
+	modelValid, estimateFunc := ContainerComponentPowerModelValid, ContainerComponentPowerModelFunc
+	estimatorLock.RUnlock()
+	if modelValid {
+		powers, err := estimateFunc(containerIDList, containerMetricValuesOnly, collector_metric.NodeMetadataValues)
 		if err != nil {
-			return false, make([]source.NodeComponentsEnergy, podNumber)
+			return false, make([]source.NodeComponentsEnergy, podNumber), false
 		}
+		guard := newPowerGuard(types.DynComponentPower)
 		raplPowers := make([]source.NodeComponentsEnergy, podNumber)
 		for index := 0; index < podNumber; index++ {
-			pkgPower := getComponentPower(powers, "pkg", index)
-			corePower := getComponentPower(powers, "core", index)
-			uncorePower := getComponentPower(powers, "uncore", index)
-			dramPower := getComponentPower(powers, "dram", index)
+			pkgPower := getComponentPower(guard, powers, "pkg", index)
+			corePower := getComponentPower(guard, powers, "core", index)
+			uncorePower := getComponentPower(guard, powers, "uncore", index)
+			dramPower := getComponentPower(guard, powers, "dram", index)
 			raplPowers[index] = fillRAPLPower(pkgPower, corePower, uncorePower, dramPower)
 		}
-		return true, raplPowers
+		return true, raplPowers, guard.rejected
 	}
-	return false, make([]source.NodeComponentsEnergy, podNumber)
+	return false, make([]source.NodeComponentsEnergy, podNumber), false
 }
@@ -0,0 +1,123 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+client.go
+request the models to Kepler Model Server or to the initial model URL with timeout, retries and optional mTLS or bearer token authentication.
+*/
+
+package local
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"k8s.io/klog/v2"
+)
+
+// retryBackoff is the wait before the first retry of a failed model request, it doubles on each retry
+var retryBackoff = time.Second
+
+// newModelClient returns an HTTP client with the configured timeout, the CA of the model server and the client certificate for mTLS
+func newModelClient() (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if config.ModelServerCAFile != "" || config.ModelServerCertFile != "" {
+		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+		if config.ModelServerCAFile != "" {
+			// the CA is added to the system ones to still reach the public initial model URLs
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				pool = x509.NewCertPool()
+			}
+			ca, err := os.ReadFile(config.ModelServerCAFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read the model server CA: %v", err)
+			}
+			if !pool.AppendCertsFromPEM(ca) {
+				return nil, fmt.Errorf("no certificate in the model server CA %s", config.ModelServerCAFile)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		if config.ModelServerCertFile != "" {
+			cert, err := tls.LoadX509KeyPair(config.ModelServerCertFile, config.ModelServerKeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load the model server client certificate: %v", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	return &http.Client{Timeout: config.ModelServerTimeout, Transport: transport}, nil
+}
+
+// doModelRequest sends the request created by newRequest and returns the response body, the request is retried up to retries times with
+// exponential backoff on connection errors and on server errors. The bearer token is only sent to the model server, withAuth.
+func doModelRequest(newRequest func() (*http.Request, error), withAuth bool, retries int) ([]byte, error) {
+	client, err := newModelClient()
+	if err != nil {
+		return nil, err
+	}
+	backoff := retryBackoff
+	for attempt := 0; ; attempt++ {
+		body, retry, err := tryModelRequest(client, newRequest, withAuth)
+		if err == nil {
+			return body, nil
+		}
+		if !retry || attempt >= retries {
+			return nil, err
+		}
+		klog.V(3).Infof("model request failed: %v, retry in %v", err, backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func tryModelRequest(client *http.Client, newRequest func() (*http.Request, error), withAuth bool) (body []byte, retry bool, err error) {
+	request, err := newRequest()
+	if err != nil {
+		return nil, false, err
+	}
+	if withAuth && config.ModelServerTokenFile != "" {
+		// the token is read on each request to follow its rotation
+		token, err := os.ReadFile(config.ModelServerTokenFile)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read the model server token: %v", err)
+		}
+		request.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, true, fmt.Errorf("connection error: %v (%v)", err, request.URL)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		retry = response.StatusCode >= http.StatusInternalServerError || response.StatusCode == http.StatusTooManyRequests
+		return nil, retry, fmt.Errorf("status not ok: %v (%v)", response.Status, request.URL)
+	}
+	body, err = io.ReadAll(response.Body)
+	if err != nil {
+		return nil, true, err
+	}
+	return body, false, nil
+}
@@ -0,0 +1,76 @@
+package local
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/utils"
+)
+
+func TestModelRequestRetries(t *testing.T) {
+	g := NewWithT(t)
+	defer func(backoff time.Duration, retries int, tokenFile string) {
+		retryBackoff, config.ModelServerRetries, config.ModelServerTokenFile = backoff, retries, tokenFile
+	}(retryBackoff, config.ModelServerRetries, config.ModelServerTokenFile)
+	retryBackoff = time.Millisecond
+	config.ModelServerRetries = 2
+	tokenFile, err := utils.CreateTempFile("secret\n")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.Remove(tokenFile)
+	config.ModelServerTokenFile = tokenFile
+
+	// the server fails the first requests
+	var requests int
+	var authorization string
+	failures := 2
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		authorization = r.Header.Get("Authorization")
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if requests <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"All_Weights": {"Bias_Weight": 1.0}}`))
+	}))
+	defer server.Close()
+
+	body, err := getModelFromServer(server.URL, ModelRequest{ModelName: "sample"}, config.ModelServerRetries)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(body)).To(Equal(`{"All_Weights": {"Bias_Weight": 1.0}}`))
+	g.Expect(requests).To(Equal(3))
+	g.Expect(authorization).To(Equal("Bearer secret"))
+
+	// the token is only sent to the model server
+	requests, failures = 0, 0
+	_, err = loadModelFromURL(server.URL, config.ModelServerRetries)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(authorization).To(BeEmpty())
+
+	// the retries are exhausted
+	requests, failures = 0, 5
+	_, err = getModelFromServer(server.URL, ModelRequest{ModelName: "sample"}, config.ModelServerRetries)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(requests).To(Equal(3))
+
+	// a client error is not retried
+	requests = 0
+	_, err = loadModelFromURL(server.URL+"/missing", config.ModelServerRetries)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(requests).To(Equal(1))
+
+	// the initial load does not retry
+	requests, failures = 0, 5
+	_, err = getModelFromServer(server.URL, ModelRequest{ModelName: "sample"}, 0)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(requests).To(Equal(1))
+}
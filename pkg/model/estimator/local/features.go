@@ -0,0 +1,73 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+features.go
+validate the features of the models against the usage metrics collected on the node.
+*/
+
+package local
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/model/types"
+)
+
+// getFeatureStatus compares the features of the model with the usage metrics collected on the node
+func getFeatureStatus(features, usageMetrics []string) types.FeatureStatus {
+	status := types.FeatureStatus{Features: features, Coverage: 1}
+	collected := make(map[string]bool, len(usageMetrics))
+	for _, metric := range usageMetrics {
+		collected[metric] = true
+	}
+	used := make(map[string]bool, len(features))
+	for _, feature := range features {
+		used[feature] = true
+		if !collected[feature] {
+			status.MissingFeatures = append(status.MissingFeatures, feature)
+		}
+	}
+	for _, metric := range usageMetrics {
+		if !used[metric] {
+			status.UnusedFeatures = append(status.UnusedFeatures, metric)
+		}
+	}
+	if len(features) > 0 {
+		status.Coverage = float64(len(features)-len(status.MissingFeatures)) / float64(len(features))
+	}
+	return status
+}
+
+// checkFeatureCoverage rejects the model if the node does not collect enough of its features, the missing features would be read as zero
+func checkFeatureCoverage(status types.FeatureStatus) error {
+	if status.Coverage < config.MinModelFeatureCoverage {
+		return fmt.Errorf("feature coverage %.2f is below %.2f, missing features %v", status.Coverage, config.MinModelFeatureCoverage, status.MissingFeatures)
+	}
+	return nil
+}
+
+// sortedKeys returns the sorted names of the features in the set
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,60 @@
+package local
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/model/types"
+)
+
+func TestFeatureValidation(t *testing.T) {
+	g := NewWithT(t)
+	defer func(coverage float64) { config.MinModelFeatureCoverage = coverage }(config.MinModelFeatureCoverage)
+	config.MinModelFeatureCoverage = 1
+
+	// the model is trained with a hardware counter that is not collected on a VM
+	weights := ComponentModelWeights{
+		"core": genWeights(map[string]NormalizedNumericalFeature{"cpu_cycles": {Weight: 1.0, Variance: 1}, "cpu_time": {Weight: 1.0, Variance: 1}}),
+		"dram": genWeights(map[string]NormalizedNumericalFeature{"cache_miss": {Weight: 0, Variance: 1}, "cpu_time": {Weight: 1.0, Variance: 1}}),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g.Expect(json.NewEncoder(w).Encode(weights)).To(Succeed())
+	}))
+	defer server.Close()
+
+	r := LinearRegressor{
+		UsageMetrics:   []string{"cpu_time", "cgroupfs_cpu_usage_us"},
+		OutputType:     types.DynComponentModelWeight,
+		SystemFeatures: systemFeatures,
+		InitModelURL:   server.URL,
+	}
+	g.Expect(r.Init()).To(BeFalse())
+	g.Expect(r.LoadError).To(HaveOccurred())
+	g.Expect(r.FeatureStatus).To(Equal(types.FeatureStatus{
+		Features:        []string{"cpu_cycles", "cpu_time"},
+		MissingFeatures: []string{"cpu_cycles"},
+		UnusedFeatures:  []string{"cgroupfs_cpu_usage_us"},
+		Coverage:        0.5,
+	}))
+
+	// the model is flagged but accepted with a lower coverage, by default the models are not rejected
+	for _, coverage := range []float64{0.5, 0} {
+		config.MinModelFeatureCoverage = coverage
+		g.Expect(r.Init()).To(BeTrue())
+		g.Expect(r.LoadError).NotTo(HaveOccurred())
+		g.Expect(r.FeatureStatus.MissingFeatures).To(Equal([]string{"cpu_cycles"}))
+	}
+}
+
+func TestTreeEnsembleFeatures(t *testing.T) {
+	g := NewWithT(t)
+	var weights NonLinearModelWeights
+	g.Expect(json.Unmarshal([]byte(sampleTreeEnsemble), &weights)).To(Succeed())
+	r := NonLinearRegressor{EstimatorType: types.TreeEnsembleEstimator}
+	g.Expect(r.getFeatures(weights)).To(Equal([]string{"cache_miss", "cpu_cycles"}))
+}
@@ -27,7 +27,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"math"
 	"net/http"
 
@@ -42,6 +41,8 @@ type ModelRequest struct {
 	MetricNames  []string `json:"metrics"`
 	SelectFilter string   `json:"filter"`
 	OutputType   string   `json:"output_type"`
+	// EstimatorType selects the non-linear model, it is empty for the linear regression
+	EstimatorType string `json:"estimator_type,omitempty"`
 }
 
 /*
@@ -108,6 +109,15 @@ func (weights ModelWeights) predict(usageMetrics []string, usageValues [][]float
 	return powers
 }
 
+// addFeatures adds the numerical features with a weight to the set
+func (weights ModelWeights) addFeatures(set map[string]bool) {
+	for name, coeff := range weights.AllWeights.NumericalVariables {
+		if coeff.Weight != 0 {
+			set[name] = true
+		}
+	}
+}
+
 /*
 ComponentModelWeights defines structure for multiple (power component's) weights
 {
@@ -142,8 +152,14 @@ type LinearRegressor struct {
 	ModelName      string
 	SelectFilter   string
 	InitModelURL   string
-	valid          bool
-	modelWeight    interface{}
+	// Retries is how many times a failed model request is retried
+	Retries int
+	// ModelInfo describes the loaded model, FeatureStatus compares its features with UsageMetrics and LoadError is the error of the load, set by Init
+	ModelInfo     types.ModelInfo
+	FeatureStatus types.FeatureStatus
+	LoadError     error
+	valid         bool
+	modelWeight   interface{}
 }
 
 // Init returns valid if model weight is obtainable
@@ -157,6 +173,13 @@ func (r *LinearRegressor) Init() bool {
 		// next try loading from URL by config
 		weight, err = r.loadWeightFromURL()
 	}
+	if weight != nil {
+		r.FeatureStatus = getFeatureStatus(r.getFeatures(weight), r.UsageMetrics)
+		if err = checkFeatureCoverage(r.FeatureStatus); err != nil {
+			weight = nil
+		}
+	}
+	r.LoadError = err
 	if weight != nil {
 		r.valid = true
 		r.modelWeight = weight
@@ -172,6 +195,20 @@ func (r *LinearRegressor) Init() bool {
 	return r.valid
 }
 
+// getFeatures returns the features of the model weight or of the weights of the components
+func (r *LinearRegressor) getFeatures(weight interface{}) []string {
+	set := make(map[string]bool)
+	switch w := weight.(type) {
+	case ModelWeights:
+		w.addFeatures(set)
+	case ComponentModelWeights:
+		for _, componentWeight := range w {
+			componentWeight.addFeatures(set)
+		}
+	}
+	return sortedKeys(set)
+}
+
 // getWeightFromServer tries getting weights for Kepler Model Server
 func (r *LinearRegressor) getWeightFromServer() (interface{}, error) {
 	modelRequest := ModelRequest{
@@ -180,80 +217,70 @@ func (r *LinearRegressor) getWeightFromServer() (interface{}, error) {
 		SelectFilter: r.SelectFilter,
 		OutputType:   r.OutputType.String(),
 	}
-	modelRequestJSON, err := json.Marshal(modelRequest)
+	body, err := getModelFromServer(r.Endpoint, modelRequest, r.Retries)
 	if err != nil {
-		return nil, fmt.Errorf("marshal error: %v (%v)", err, modelRequest)
-	}
-
-	request, err := http.NewRequestWithContext(context.Background(), http.MethodPost, r.Endpoint, bytes.NewBuffer(modelRequestJSON))
-	if err != nil {
-		return nil, fmt.Errorf("connection error: %s (%v)", r.Endpoint, err)
+		return nil, err
 	}
+	body, r.ModelInfo = getServerModelInfo(body, r.Endpoint, r.ModelName)
+	r.ModelInfo.EstimatorType = types.LinearRegressorEstimator
+	return r.unmarshalWeight(body)
+}
 
-	request.Header.Set("Content-Type", "application/json; charset=UTF-8")
-
-	client := &http.Client{}
-	response, err := client.Do(request)
+// loadWeightFromURL tries loading weights from initial model URL or local path
+func (r *LinearRegressor) loadWeightFromURL() (interface{}, error) {
+	body, info, err := loadModel(r.InitModelURL, r.Retries)
 	if err != nil {
-		return nil, fmt.Errorf("connection error: %v (%v)", err, r.Endpoint)
-	}
-	defer response.Body.Close()
-
-	if response.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("status not ok: %v (%v)", response.Status, modelRequest)
+		return nil, err
 	}
-	body, _ := io.ReadAll(response.Body)
+	r.ModelInfo = info
+	r.ModelInfo.EstimatorType = types.LinearRegressorEstimator
+	return r.unmarshalWeight(body)
+}
 
+// unmarshalWeight decodes the weights of a single model or of a model per component depending on the output type
+func (r *LinearRegressor) unmarshalWeight(body []byte) (interface{}, error) {
 	if types.IsComponentType(r.OutputType) {
-		var response ComponentModelWeights
-		err = json.Unmarshal(body, &response)
+		var content ComponentModelWeights
+		err := json.Unmarshal(body, &content)
 		if err != nil {
 			return nil, fmt.Errorf("model unmarshal error: %v (%s)", err, string(body))
 		}
-		return response, nil
+		return content, nil
 	} else {
-		var response ModelWeights
-		err = json.Unmarshal(body, &response)
+		var content ModelWeights
+		err := json.Unmarshal(body, &content)
 		if err != nil {
 			return nil, fmt.Errorf("model unmarshal error: %v (%s)", err, string(body))
 		}
-		return response, nil
+		return content, nil
 	}
 }
 
-// loadWeightFromURL tries loading weights from initial model URL
-func (r *LinearRegressor) loadWeightFromURL() (interface{}, error) {
-	request, err := http.NewRequestWithContext(context.Background(), http.MethodGet, r.InitModelURL, http.NoBody)
-	if err != nil {
-		return nil, fmt.Errorf("connection error: %s (%v)", r.InitModelURL, err)
-	}
-	client := &http.Client{}
-	response, err := client.Do(request)
-	if err != nil {
-		return nil, fmt.Errorf("connection error: %v (%v)", err, r.InitModelURL)
-	}
-
-	defer response.Body.Close()
-	body, err := io.ReadAll(response.Body)
+// getModelFromServer posts the model request to Kepler Model Server and returns the response body
+func getModelFromServer(endpoint string, modelRequest ModelRequest, retries int) ([]byte, error) {
+	modelRequestJSON, err := json.Marshal(modelRequest)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("marshal error: %v (%v)", err, modelRequest)
 	}
-
-	if types.IsComponentType(r.OutputType) {
-		var content ComponentModelWeights
-		err = json.Unmarshal(body, &content)
+	return doModelRequest(func() (*http.Request, error) {
+		request, err := http.NewRequestWithContext(context.Background(), http.MethodPost, endpoint, bytes.NewBuffer(modelRequestJSON))
 		if err != nil {
-			return nil, fmt.Errorf("model unmarshal error: %v (%s)", err, string(body))
+			return nil, fmt.Errorf("connection error: %s (%v)", endpoint, err)
 		}
-		return content, nil
-	} else {
-		var content ModelWeights
-		err = json.Unmarshal(body, &content)
+		request.Header.Set("Content-Type", "application/json; charset=UTF-8")
+		return request, nil
+	}, true, retries)
+}
+
+// loadModelFromURL gets the model from the URL and returns the response body
+func loadModelFromURL(url string, retries int) ([]byte, error) {
+	return doModelRequest(func() (*http.Request, error) {
+		request, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, http.NoBody)
 		if err != nil {
-			return nil, fmt.Errorf("model unmarshal error: %v (%s)", err, string(body))
+			return nil, fmt.Errorf("connection error: %s (%v)", url, err)
 		}
-		return content, nil
-	}
+		return request, nil
+	}, false, retries)
 }
 
 // GetTotalPower applies ModelWeight prediction and return a list of total powers
@@ -0,0 +1,125 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+model_file.go
+load the model weights from a URL or a local path, e.g. a mounted ConfigMap, and verify their checksum.
+*/
+
+package local
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sustainable-computing-io/kepler/pkg/model/types"
+	"k8s.io/klog/v2"
+)
+
+const (
+	checksumFragment = "#sha256="
+	checksumFileExt  = ".sha256"
+)
+
+/*
+VersionedModel defines the structure of a model file that records the model name and version with the weights
+{
+"Model_Name": "ScikitMixed",
+"Model_Version": "1.0",
+"Weights": {"All_Weights": {...}}
+}
+A model file without Weights holds the weights only.
+*/
+type VersionedModel struct {
+	ModelName    string          `json:"Model_Name"`
+	ModelVersion string          `json:"Model_Version"`
+	Weights      json.RawMessage `json:"Weights"`
+}
+
+// loadModel loads the model from the location and returns its weights with the model info.
+// The location is an http(s) URL, a file:// URL or a local path, optionally followed by #sha256=<checksum>.
+// Without checksum in the location, a local model is verified against the checksum file next to it (<path>.sha256) if any.
+// A failed request to a URL is retried up to retries times.
+func loadModel(location string, retries int) (weights []byte, info types.ModelInfo, err error) {
+	source, expected, _ := strings.Cut(location, checksumFragment)
+	var body []byte
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		body, err = loadModelFromURL(source, retries)
+	} else {
+		path := strings.TrimPrefix(source, "file://")
+		body, err = os.ReadFile(path)
+		if err == nil && expected == "" {
+			expected, err = readChecksumFile(path + checksumFileExt)
+		}
+	}
+	if err != nil {
+		return nil, info, err
+	}
+	weights, info = unwrapModel(body)
+	info.Source = source
+	if info.Name == "" {
+		info.Name = strings.TrimSuffix(filepath.Base(source), filepath.Ext(source))
+	}
+	if expected != "" && !strings.EqualFold(expected, info.Checksum) {
+		return nil, info, fmt.Errorf("checksum mismatch of %s: expected %s, got %s", source, expected, info.Checksum)
+	}
+	return weights, info, nil
+}
+
+// readChecksumFile returns the checksum in the sha256sum format (<checksum>  <file name>) or empty if the file does not exist
+func readChecksumFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		klog.V(5).Infof("no checksum file %s, the model is not verified", path)
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(string(content))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("empty checksum file %s", path)
+	}
+	return fields[0], nil
+}
+
+// unwrapModel returns the weights of the model file with the checksum of the file and the name and version recorded in the file if any
+func unwrapModel(body []byte) ([]byte, types.ModelInfo) {
+	sum := sha256.Sum256(body)
+	info := types.ModelInfo{Checksum: hex.EncodeToString(sum[:])}
+	var model VersionedModel
+	if err := json.Unmarshal(body, &model); err == nil && len(model.Weights) > 0 {
+		info.Name = model.ModelName
+		info.Version = model.ModelVersion
+		return model.Weights, info
+	}
+	return body, info
+}
+
+// getServerModelInfo returns the weights of the model returned by Kepler Model Server with its model info
+func getServerModelInfo(body []byte, endpoint, modelName string) ([]byte, types.ModelInfo) {
+	weights, info := unwrapModel(body)
+	info.Source = endpoint
+	if info.Name == "" {
+		info.Name = modelName
+	}
+	return weights, info
+}
@@ -0,0 +1,68 @@
+package local
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/sustainable-computing-io/kepler/pkg/model/types"
+	"github.com/sustainable-computing-io/kepler/pkg/utils"
+)
+
+const sampleVersionedModel = `{"Model_Name": "SampleLR", "Model_Version": "1.2", "Weights": {"All_Weights": {"Bias_Weight": 1.0,
+"Categorical_Variables": {"cpu_architecture": {"Sandy Bridge": {"weight": 1.0}}},
+"Numerical_Variables": {"cpu_cycles": {"mean": 0, "variance": 1.0, "weight": 1.0}}}}}`
+
+func TestLoadLocalModel(t *testing.T) {
+	g := NewWithT(t)
+	dir, err := utils.CreateTempDir()
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "model.json")
+	g.Expect(os.WriteFile(path, []byte(sampleVersionedModel), 0o600)).To(Succeed())
+	sum := sha256.Sum256([]byte(sampleVersionedModel))
+	checksum := hex.EncodeToString(sum[:])
+
+	r := LinearRegressor{
+		UsageMetrics:   []string{"cpu_cycles"},
+		OutputType:     types.AbsModelWeight,
+		SystemFeatures: systemFeatures,
+		InitModelURL:   "file://" + path,
+	}
+	g.Expect(r.Init()).To(BeTrue())
+	g.Expect(r.ModelInfo).To(Equal(types.ModelInfo{
+		EstimatorType: types.LinearRegressorEstimator,
+		Name:          "SampleLR",
+		Version:       "1.2",
+		Source:        "file://" + path,
+		Checksum:      checksum,
+	}))
+	powers, err := r.GetTotalPower([][]float64{{2}}, systemValues)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(powers).To(Equal([]float64{4}))
+
+	// the checksum is given in the location or in the checksum file
+	_, _, err = loadModel(path+"#sha256="+checksum, 0)
+	g.Expect(err).NotTo(HaveOccurred())
+	_, _, err = loadModel(path+"#sha256=0123", 0)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(os.WriteFile(path+".sha256", []byte(checksum+"  model.json\n"), 0o600)).To(Succeed())
+	_, _, err = loadModel(path, 0)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(os.WriteFile(path+".sha256", []byte("0123  model.json\n"), 0o600)).To(Succeed())
+	g.Expect(r.Init()).To(BeFalse())
+
+	// a model file without version holds the weights only and is named after the file
+	bareModel, err := utils.CreateTempFile(`{"All_Weights": {"Bias_Weight": 1.0}}`)
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.Remove(bareModel)
+	weights, info, err := loadModel(bareModel, 0)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(weights)).To(Equal(`{"All_Weights": {"Bias_Weight": 1.0}}`))
+	g.Expect(info.Name).To(Equal(filepath.Base(bareModel)))
+	g.Expect(info.Version).To(BeEmpty())
+}
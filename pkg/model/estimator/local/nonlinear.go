@@ -0,0 +1,346 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+nonlinear.go
+estimate (node/pod) component and total power by tree ensemble, polynomial or piecewise linear models without the estimator sidecar.
+The model weights can be obtained by Kepler Model Server or configured initial model URL.
+*/
+
+package local
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/model/types"
+	"k8s.io/klog/v2"
+)
+
+/*
+NonLinearModelWeights defines the structure of a non-linear model, only the section of the estimator type is used
+{
+"Categorical_Variables": {"cpu_architecture": {"Sky Lake": {"weight": 1.0}}},
+"Tree_Ensemble": {...},
+"Polynomial": {"Bias_Weight": 1.0, "Terms": [{"weight": 0.5, "powers": {"cpu_cycles": 2, "cache_miss": 1}}]},
+"Piecewise_Linear": {"Bias_Weight": 1.0, "Numerical_Variables": {"cpu_cycles": {"breakpoints": [0, 100, 200], "values": [0, 10, 15]}}}
+}
+The categorical weights are added to the prediction of the model like in the linear regression.
+*/
+type NonLinearModelWeights struct {
+	CategoricalVariables map[string]map[string]CategoricalFeature `json:"Categorical_Variables"`
+	TreeEnsemble         *TreeEnsemble                            `json:"Tree_Ensemble"`
+	Polynomial           *Polynomial                              `json:"Polynomial"`
+	PiecewiseLinear      *PiecewiseLinear                         `json:"Piecewise_Linear"`
+}
+
+// ComponentNonLinearModelWeights defines structure for multiple (power component's) non-linear models
+type ComponentNonLinearModelWeights map[string]NonLinearModelWeights
+
+// Polynomial is the sum of the terms, each term is its weight times the product of the features raised to their powers
+type Polynomial struct {
+	BiasWeight float64          `json:"Bias_Weight"`
+	Terms      []PolynomialTerm `json:"Terms"`
+}
+type PolynomialTerm struct {
+	Weight float64            `json:"weight"`
+	Powers map[string]float64 `json:"powers"`
+}
+
+// PiecewiseLinear is the sum of a piecewise linear function of each feature, the functions are constant beyond their first and last breakpoints
+type PiecewiseLinear struct {
+	BiasWeight         float64                           `json:"Bias_Weight"`
+	NumericalVariables map[string]PiecewiseLinearFeature `json:"Numerical_Variables"`
+}
+type PiecewiseLinearFeature struct {
+	Breakpoints []float64 `json:"breakpoints"`
+	Values      []float64 `json:"values"`
+}
+
+// nonLinearModel is the model of an estimator type evaluated on the features of one container or node
+type nonLinearModel interface {
+	validate() error
+	evaluate(values map[string]float64) float64
+	// addFeatures adds the features used by the model to the set
+	addFeatures(set map[string]bool)
+}
+
+func (p *Polynomial) validate() error {
+	if len(p.Terms) == 0 {
+		return fmt.Errorf("polynomial has no term")
+	}
+	return nil
+}
+
+func (p *Polynomial) evaluate(values map[string]float64) float64 {
+	prediction := p.BiasWeight
+	for _, term := range p.Terms {
+		product := term.Weight
+		for feature, power := range term.Powers {
+			product *= math.Pow(values[feature], power)
+		}
+		prediction += product
+	}
+	return prediction
+}
+
+func (p *Polynomial) addFeatures(set map[string]bool) {
+	for _, term := range p.Terms {
+		if term.Weight == 0 {
+			continue
+		}
+		for feature, power := range term.Powers {
+			if power != 0 {
+				set[feature] = true
+			}
+		}
+	}
+}
+
+func (p *PiecewiseLinear) validate() error {
+	if len(p.NumericalVariables) == 0 {
+		return fmt.Errorf("piecewise linear model has no feature")
+	}
+	for feature, f := range p.NumericalVariables {
+		if len(f.Breakpoints) == 0 || len(f.Breakpoints) != len(f.Values) {
+			return fmt.Errorf("feature %s has %d breakpoints and %d values", feature, len(f.Breakpoints), len(f.Values))
+		}
+		if !sort.Float64sAreSorted(f.Breakpoints) {
+			return fmt.Errorf("breakpoints of feature %s are not sorted", feature)
+		}
+	}
+	return nil
+}
+
+func (p *PiecewiseLinear) evaluate(values map[string]float64) float64 {
+	prediction := p.BiasWeight
+	for feature, f := range p.NumericalVariables {
+		prediction += f.interpolate(values[feature])
+	}
+	return prediction
+}
+
+func (p *PiecewiseLinear) addFeatures(set map[string]bool) {
+	for feature := range p.NumericalVariables {
+		set[feature] = true
+	}
+}
+
+// interpolate returns the value of the function at x, interpolated linearly between the surrounding breakpoints
+func (f PiecewiseLinearFeature) interpolate(x float64) float64 {
+	last := len(f.Breakpoints) - 1
+	if x <= f.Breakpoints[0] {
+		return f.Values[0]
+	}
+	if x >= f.Breakpoints[last] {
+		return f.Values[last]
+	}
+	// the first breakpoint greater than x, x is within (Breakpoints[i-1], Breakpoints[i])
+	i := sort.SearchFloat64s(f.Breakpoints, x)
+	if f.Breakpoints[i] == x {
+		return f.Values[i]
+	}
+	x0, x1 := f.Breakpoints[i-1], f.Breakpoints[i]
+	y0, y1 := f.Values[i-1], f.Values[i]
+	return y0 + (y1-y0)*(x-x0)/(x1-x0)
+}
+
+// getModel returns the model of the estimator type
+func (weights NonLinearModelWeights) getModel(estimatorType string) (nonLinearModel, error) {
+	var model nonLinearModel
+	switch estimatorType {
+	case types.TreeEnsembleEstimator:
+		if weights.TreeEnsemble != nil {
+			model = weights.TreeEnsemble
+		}
+	case types.PolynomialEstimator:
+		if weights.Polynomial != nil {
+			model = weights.Polynomial
+		}
+	case types.PiecewiseLinearEstimator:
+		if weights.PiecewiseLinear != nil {
+			model = weights.PiecewiseLinear
+		}
+	default:
+		return nil, fmt.Errorf("unknown estimator type: %s", estimatorType)
+	}
+	if model == nil {
+		return nil, fmt.Errorf("no %s model in the weights", estimatorType)
+	}
+	return model, model.validate()
+}
+
+// predict applies the model of the estimator type to usageValues and systemValues
+func (weights NonLinearModelWeights) predict(estimatorType string, usageMetrics []string, usageValues [][]float64, systemFeatures, systemValues []string) []float64 {
+	model, err := weights.getModel(estimatorType)
+	if err != nil {
+		// the weights are validated when loaded
+		return []float64{}
+	}
+	basePower := float64(0)
+	for index, feature := range systemFeatures {
+		basePower += weights.CategoricalVariables[feature][systemValues[index]].Weight
+	}
+	var powers []float64
+	for _, vals := range usageValues {
+		values := make(map[string]float64, len(usageMetrics))
+		for index, metric := range usageMetrics {
+			if index < len(vals) {
+				values[metric] = vals[index]
+			}
+		}
+		powers = append(powers, basePower+model.evaluate(values))
+	}
+	return powers
+}
+
+// NonLinearRegressor defines power estimator with tree ensemble, polynomial or piecewise linear models
+type NonLinearRegressor struct {
+	EstimatorType  string
+	Endpoint       string
+	UsageMetrics   []string
+	OutputType     types.ModelOutputType
+	SystemFeatures []string
+	ModelName      string
+	SelectFilter   string
+	InitModelURL   string
+	// Retries is how many times a failed model request is retried
+	Retries int
+	// ModelInfo describes the loaded model, FeatureStatus compares its features with UsageMetrics and LoadError is the error of the load, set by Init
+	ModelInfo     types.ModelInfo
+	FeatureStatus types.FeatureStatus
+	LoadError     error
+	valid         bool
+	modelWeight   interface{}
+}
+
+// Init returns valid if the model of the estimator type is obtainable
+func (r *NonLinearRegressor) Init() bool {
+	var err error
+	var body []byte
+	var info types.ModelInfo
+	var weight interface{}
+	// try getting weight from model server if it is enabled
+	if config.ModelServerEndpoint != "" {
+		body, err = getModelFromServer(r.Endpoint, ModelRequest{
+			ModelName:     r.ModelName,
+			MetricNames:   append(r.UsageMetrics, r.SystemFeatures...),
+			SelectFilter:  r.SelectFilter,
+			OutputType:    r.OutputType.String(),
+			EstimatorType: r.EstimatorType,
+		}, r.Retries)
+		if err == nil {
+			body, info = getServerModelInfo(body, r.Endpoint, r.ModelName)
+		}
+	} else if r.InitModelURL != "" {
+		// next try loading from URL or local path by config
+		body, info, err = loadModel(r.InitModelURL, r.Retries)
+	}
+	if err == nil && body != nil {
+		weight, err = r.unmarshalWeight(body)
+		r.ModelInfo = info
+		r.ModelInfo.EstimatorType = r.EstimatorType
+	}
+	if weight != nil {
+		r.FeatureStatus = getFeatureStatus(r.getFeatures(weight), r.UsageMetrics)
+		if err = checkFeatureCoverage(r.FeatureStatus); err != nil {
+			weight = nil
+		}
+	}
+	r.LoadError = err
+	if weight != nil {
+		r.valid = true
+		r.modelWeight = weight
+		klog.V(3).Infof("%s Model (%s) Weight: %v", r.EstimatorType, r.OutputType.String(), r.modelWeight)
+	} else {
+		if err == nil {
+			klog.V(3).Infof("%s Model (%s): no config", r.EstimatorType, r.OutputType.String())
+		} else {
+			klog.V(3).Infof("%s Model (%s): %v", r.EstimatorType, r.OutputType.String(), err)
+		}
+		r.valid = false
+	}
+	return r.valid
+}
+
+// unmarshalWeight decodes the model of a single model or of a model per component and checks that the estimator type can evaluate it
+func (r *NonLinearRegressor) unmarshalWeight(body []byte) (interface{}, error) {
+	if types.IsComponentType(r.OutputType) {
+		var content ComponentNonLinearModelWeights
+		if err := json.Unmarshal(body, &content); err != nil {
+			return nil, fmt.Errorf("model unmarshal error: %v (%s)", err, string(body))
+		}
+		for comp, weight := range content {
+			if _, err := weight.getModel(r.EstimatorType); err != nil {
+				return nil, fmt.Errorf("invalid %s model: %v", comp, err)
+			}
+		}
+		return content, nil
+	} else {
+		var content NonLinearModelWeights
+		if err := json.Unmarshal(body, &content); err != nil {
+			return nil, fmt.Errorf("model unmarshal error: %v (%s)", err, string(body))
+		}
+		if _, err := content.getModel(r.EstimatorType); err != nil {
+			return nil, fmt.Errorf("invalid model: %v", err)
+		}
+		return content, nil
+	}
+}
+
+// getFeatures returns the features of the model of the estimator type or of the models of the components, the weights are validated
+func (r *NonLinearRegressor) getFeatures(weight interface{}) []string {
+	set := make(map[string]bool)
+	switch w := weight.(type) {
+	case NonLinearModelWeights:
+		if model, err := w.getModel(r.EstimatorType); err == nil {
+			model.addFeatures(set)
+		}
+	case ComponentNonLinearModelWeights:
+		for _, componentWeight := range w {
+			if model, err := componentWeight.getModel(r.EstimatorType); err == nil {
+				model.addFeatures(set)
+			}
+		}
+	}
+	return sortedKeys(set)
+}
+
+// GetTotalPower applies the model prediction and return a list of total powers
+func (r *NonLinearRegressor) GetTotalPower(usageValues [][]float64, systemValues []string) ([]float64, error) {
+	if !r.valid {
+		return []float64{}, fmt.Errorf("invalid power model call: %s", r.OutputType.String())
+	}
+	if r.modelWeight != nil {
+		return r.modelWeight.(NonLinearModelWeights).predict(r.EstimatorType, r.UsageMetrics, usageValues, r.SystemFeatures, systemValues), nil
+	}
+	return []float64{}, fmt.Errorf("model Weight for model type %s is nil", r.OutputType.String())
+}
+
+// GetComponentPower applies each component's model prediction and return a map of component powers
+func (r *NonLinearRegressor) GetComponentPower(usageValues [][]float64, systemValues []string) (map[string][]float64, error) {
+	if !r.valid {
+		return map[string][]float64{}, fmt.Errorf("invalid power model call: %s", r.OutputType.String())
+	}
+	compPowers := make(map[string][]float64)
+	for comp, weight := range r.modelWeight.(ComponentNonLinearModelWeights) {
+		compPowers[comp] = weight.predict(r.EstimatorType, r.UsageMetrics, usageValues, r.SystemFeatures, systemValues)
+	}
+	return compPowers, nil
+}
@@ -0,0 +1,200 @@
+package local
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/model/types"
+)
+
+// the first tree is dumped by XGBoost and the second one by LightGBM
+const sampleTreeEnsemble = `{
+"Categorical_Variables": {"cpu_architecture": {"Sandy Bridge": {"weight": 1.0}}},
+"Tree_Ensemble": {
+	"Base_Score": 0.5,
+	"Feature_Names": ["cpu_cycles", "cache_miss"],
+	"Trees": [
+		{"nodeid": 0, "split": "f0", "split_condition": 100, "yes": 1, "no": 2, "missing": 2, "children": [
+			{"nodeid": 1, "leaf": 1.0},
+			{"nodeid": 2, "split": "cache_miss", "split_condition": 10, "yes": 3, "no": 4, "missing": 3, "children": [
+				{"nodeid": 3, "leaf": 2.0},
+				{"nodeid": 4, "leaf": 3.0}
+			]}
+		]},
+		{"split_feature": 1, "threshold": 10, "decision_type": "<=", "default_left": false,
+			"left_child": {"leaf_value": 0.25}, "right_child": {"leaf_value": 0.5}}
+	]
+}
+}`
+
+func TestTreeEnsemble(t *testing.T) {
+	g := NewWithT(t)
+	var weights NonLinearModelWeights
+	g.Expect(json.Unmarshal([]byte(sampleTreeEnsemble), &weights)).To(Succeed())
+
+	metrics := []string{"cpu_cycles", "cache_miss"}
+	values := [][]float64{{50, 0}, {150, 5}, {150, 20}, {100, 10}}
+	powers := weights.predict(types.TreeEnsembleEstimator, metrics, values, systemFeatures, systemValues)
+	g.Expect(powers).To(Equal([]float64{1 + 0.5 + 1 + 0.25, 1 + 0.5 + 2 + 0.25, 1 + 0.5 + 3 + 0.5, 1 + 0.5 + 3 + 0.25}))
+
+	// without cache_miss, the splits on it follow the missing and default directions
+	powers = weights.predict(types.TreeEnsembleEstimator, metrics[:1], [][]float64{{150}}, systemFeatures, systemValues)
+	g.Expect(powers).To(Equal([]float64{1 + 0.5 + 2 + 0.5}))
+
+	_, err := weights.getModel(types.PolynomialEstimator)
+	g.Expect(err).To(HaveOccurred())
+	weights.TreeEnsemble.Trees[0].Children = weights.TreeEnsemble.Trees[0].Children[:1]
+	_, err = weights.getModel(types.TreeEnsembleEstimator)
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestTreeEnsembleFeatureIndex(t *testing.T) {
+	g := NewWithT(t)
+	leaf := 1.0
+	lightGBMSplit := func(feature int) TreeNode {
+		return TreeNode{SplitFeature: &feature, LeftChild: &TreeNode{LeafValue: &leaf}, RightChild: &TreeNode{LeafValue: &leaf}}
+	}
+	xgboostSplit := func(feature string) TreeNode {
+		return TreeNode{Split: feature, Yes: 1, No: 2, Children: []TreeNode{{NodeID: 1, Leaf: &leaf}, {NodeID: 2, Leaf: &leaf}}}
+	}
+	featureNames := []string{"cpu_cycles", "cache_miss"}
+
+	valid := []TreeNode{lightGBMSplit(1), xgboostSplit("f1"), xgboostSplit("cpu_cycles")}
+	for _, tree := range valid {
+		ensemble := TreeEnsemble{FeatureNames: featureNames, Trees: []TreeNode{tree}}
+		g.Expect(ensemble.validate()).To(Succeed())
+	}
+	invalid := []TreeNode{lightGBMSplit(-1), lightGBMSplit(2), xgboostSplit("f-1")}
+	for _, tree := range invalid {
+		ensemble := TreeEnsemble{FeatureNames: featureNames, Trees: []TreeNode{tree}}
+		g.Expect(ensemble.validate()).NotTo(Succeed())
+	}
+	ensemble := TreeEnsemble{FeatureNames: featureNames}
+	g.Expect(ensemble.featureName("f-1")).To(Equal("f-1"))
+	g.Expect(ensemble.featureName("f1")).To(Equal("cache_miss"))
+}
+
+func TestTreeEnsembleDumps(t *testing.T) {
+	g := NewWithT(t)
+
+	// the list of XGBoost get_dump(dump_format="json"), the trees are the JSON strings or the decoded trees
+	xgboostDump := `[
+		"{\"nodeid\": 0, \"split\": \"cpu_cycles\", \"split_condition\": 100, \"yes\": 1, \"no\": 2, \"missing\": 1, \"children\": [{\"nodeid\": 1, \"leaf\": 1.0}, {\"nodeid\": 2, \"leaf\": 2.0}]}",
+		{"nodeid": 0, "leaf": 0.5}
+	]`
+	var weights NonLinearModelWeights
+	g.Expect(json.Unmarshal([]byte(`{"Tree_Ensemble": `+xgboostDump+`}`), &weights)).To(Succeed())
+	g.Expect(weights.TreeEnsemble.Trees).To(HaveLen(2))
+	powers := weights.predict(types.TreeEnsembleEstimator, []string{"cpu_cycles"}, [][]float64{{50}, {150}}, nil, nil)
+	g.Expect(powers).To(Equal([]float64{1.5, 2.5}))
+
+	// the LightGBM dump_model(), the missing values are 0 with the None missing type and the zeros are missing with the Zero missing type
+	lightGBMDump := `{
+		"name": "tree",
+		"feature_names": ["cpu_cycles", "cache_miss"],
+		"tree_info": [
+			{"tree_index": 0, "tree_structure": {"split_index": 0, "split_feature": 0, "threshold": 10, "decision_type": "<=",
+				"default_left": false, "missing_type": "None",
+				"left_child": {"leaf_index": 0, "leaf_value": 1}, "right_child": {"leaf_index": 1, "leaf_value": 2}}},
+			{"tree_index": 1, "tree_structure": {"split_index": 0, "split_feature": 1, "threshold": 10, "decision_type": "<=",
+				"default_left": false, "missing_type": "Zero",
+				"left_child": {"leaf_index": 0, "leaf_value": 0.25}, "right_child": {"leaf_index": 1, "leaf_value": 0.5}}}
+		]
+	}`
+	weights = NonLinearModelWeights{}
+	g.Expect(json.Unmarshal([]byte(`{"Tree_Ensemble": `+lightGBMDump+`}`), &weights)).To(Succeed())
+	g.Expect(weights.TreeEnsemble.FeatureNames).To(Equal([]string{"cpu_cycles", "cache_miss"}))
+	powers = weights.predict(types.TreeEnsembleEstimator, []string{"cpu_cycles", "cache_miss"}, [][]float64{{20, 5}, {20, 0}}, nil, nil)
+	g.Expect(powers).To(Equal([]float64{2 + 0.25, 2 + 0.5}))
+	powers = weights.predict(types.TreeEnsembleEstimator, []string{"cache_miss"}, [][]float64{{5}}, nil, nil)
+	g.Expect(powers).To(Equal([]float64{1 + 0.25}))
+}
+
+func TestPolynomialAndPiecewiseLinear(t *testing.T) {
+	g := NewWithT(t)
+	weights := NonLinearModelWeights{
+		Polynomial: &Polynomial{
+			BiasWeight: 1,
+			Terms: []PolynomialTerm{
+				{Weight: 2, Powers: map[string]float64{"cpu_cycles": 2}},
+				{Weight: 0.5, Powers: map[string]float64{"cpu_cycles": 1, "cache_miss": 1}},
+			},
+		},
+		PiecewiseLinear: &PiecewiseLinear{
+			BiasWeight: 1,
+			NumericalVariables: map[string]PiecewiseLinearFeature{
+				"cpu_cycles": {Breakpoints: []float64{0, 10, 20}, Values: []float64{0, 10, 15}},
+			},
+		},
+	}
+	metrics := []string{"cpu_cycles", "cache_miss"}
+	powers := weights.predict(types.PolynomialEstimator, metrics, [][]float64{{3, 4}}, nil, nil)
+	g.Expect(powers).To(Equal([]float64{1 + 2*9 + 0.5*12}))
+
+	// the function is constant beyond the first and the last breakpoints
+	powers = weights.predict(types.PiecewiseLinearEstimator, metrics, [][]float64{{-5, 0}, {5, 0}, {10, 0}, {14, 0}, {30, 0}}, nil, nil)
+	g.Expect(powers).To(Equal([]float64{1, 6, 11, 13, 16}))
+
+	weights.PiecewiseLinear.NumericalVariables["cache_miss"] = PiecewiseLinearFeature{Breakpoints: []float64{10, 0}, Values: []float64{0, 1}}
+	_, err := weights.getModel(types.PiecewiseLinearEstimator)
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestNonLinearRegressorInit(t *testing.T) {
+	g := NewWithT(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"core": ` + sampleTreeEnsemble + `, "dram": ` + sampleTreeEnsemble + `}`))
+	}))
+	defer server.Close()
+
+	r := NonLinearRegressor{
+		EstimatorType:  types.TreeEnsembleEstimator,
+		UsageMetrics:   []string{"cpu_cycles", "cache_miss"},
+		OutputType:     types.DynComponentModelWeight,
+		SystemFeatures: systemFeatures,
+		InitModelURL:   server.URL,
+	}
+	g.Expect(r.Init()).To(BeTrue())
+	powers, err := r.GetComponentPower([][]float64{{50, 0}}, systemValues)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(powers).To(HaveKeyWithValue("core", []float64{2.75}))
+	g.Expect(powers).To(HaveKeyWithValue("dram", []float64{2.75}))
+
+	// the weights do not hold a polynomial model
+	r.EstimatorType = types.PolynomialEstimator
+	g.Expect(r.Init()).To(BeFalse())
+	_, err = r.GetComponentPower([][]float64{{50, 0}}, systemValues)
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestNonLinearRegressorModelRequest(t *testing.T) {
+	g := NewWithT(t)
+	var request ModelRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`{"core": ` + sampleTreeEnsemble + `}`))
+	}))
+	defer server.Close()
+	defer config.SetModelServerEndpoint(config.ModelServerEndpoint)
+	config.SetModelServerEndpoint(server.URL)
+
+	r := NonLinearRegressor{
+		EstimatorType:  types.TreeEnsembleEstimator,
+		Endpoint:       server.URL,
+		UsageMetrics:   []string{"cpu_cycles", "cache_miss"},
+		OutputType:     types.DynComponentModelWeight,
+		SystemFeatures: systemFeatures,
+	}
+	g.Expect(r.Init()).To(BeTrue())
+	// the server selects the model of the estimator type
+	g.Expect(request.EstimatorType).To(Equal(types.TreeEnsembleEstimator))
+	g.Expect(request.OutputType).To(Equal(types.DynComponentModelWeight.String()))
+}
@@ -44,76 +44,191 @@ func getSumMetricValues(containerMetricValues [][]float64) (sumMetricValues []fl
 	return
 }
 
-func getEnergyRatio(containerResUsage, nodeTotalResUsage, nodeResEnergyUtilization, containerNumber float64) uint64 {
-	var power float64
-	if nodeTotalResUsage > 0 {
-		power = (containerResUsage / nodeTotalResUsage) * nodeResEnergyUtilization
-	} else {
+// getEvenShares divides evenly across the containers that ran in the period, or across all the containers if none ran
+func getEvenShares(containersMetrics map[string]*collector_metric.ContainerMetrics) map[string]float64 {
+	activeContainers := 0
+	for _, container := range containersMetrics {
+		if container.IsActive() {
+			activeContainers++
+		}
+	}
+	shares := make(map[string]float64, len(containersMetrics))
+	for containerID, container := range containersMetrics {
+		if activeContainers == 0 {
+			shares[containerID] = 1 / float64(len(containersMetrics))
+		} else if container.IsActive() {
+			shares[containerID] = 1 / float64(activeContainers)
+		}
+	}
+	return shares
+}
+
+// getWeightedShares divides by the weight of each container, or evenly if no container has weight
+func getWeightedShares(containersMetrics map[string]*collector_metric.ContainerMetrics, weight func(*collector_metric.ContainerMetrics) float64) map[string]float64 {
+	totalWeight := float64(0)
+	for _, container := range containersMetrics {
+		totalWeight += weight(container)
+	}
+	if totalWeight <= 0 {
 		// TODO: we should not equaly divide the energy consumptio across the containers. If a hardware counter metrics is not available we should use cgroup metrics.
-		power = nodeResEnergyUtilization / containerNumber
+		return getEvenShares(containersMetrics)
+	}
+	shares := make(map[string]float64, len(containersMetrics))
+	for containerID, container := range containersMetrics {
+		shares[containerID] = weight(container) / totalWeight
+	}
+	return shares
+}
+
+// getRequestShares divides by the CPU requests of the containers, or by the memory requests for DRAM
+func getRequestShares(component string, containersMetrics map[string]*collector_metric.ContainerMetrics) map[string]float64 {
+	return getWeightedShares(containersMetrics, func(container *collector_metric.ContainerMetrics) float64 {
+		if component == "dram" {
+			return container.MemoryRequest
+		}
+		return container.CPURequest
+	})
+}
+
+// getAttributionShares returns the share of each container in the component energy with the attribution policy of the component,
+// the usage policy divides by the usage metric chosen for the component or evenly if none is collected
+func getAttributionShares(component, usageMetric string, containersMetrics map[string]*collector_metric.ContainerMetrics) map[string]float64 {
+	weights, err := config.ParseAttributionPolicy(config.AttributionPolicies[component])
+	if err != nil {
+		klog.V(3).Infof("%v, the %s energy is divided evenly", err, component)
+		weights = map[string]float64{config.AttributionPolicyEvenly: 1}
+	}
+	shares := make(map[string]float64, len(containersMetrics))
+	for policy, weight := range weights {
+		var policyShares map[string]float64
+		switch policy {
+		case config.AttributionPolicyUsage:
+			policyShares = getWeightedShares(containersMetrics, func(container *collector_metric.ContainerMetrics) float64 {
+				return container.GetResUsage(usageMetric)
+			})
+		case config.AttributionPolicyRequests:
+			policyShares = getRequestShares(component, containersMetrics)
+		default:
+			policyShares = getEvenShares(containersMetrics)
+		}
+		for containerID, share := range policyShares {
+			shares[containerID] += weight * share
+		}
+	}
+	return shares
+}
+
+// getIdleShares returns the share of each container in the node idle energy of the component with the configured idle power policy.
+// An unknown policy divides the idle energy like the dynamic energy.
+func getIdleShares(component string, attributionShares map[string]float64, containersMetrics map[string]*collector_metric.ContainerMetrics) map[string]float64 {
+	switch config.IdlePowerPolicy {
+	case config.IdlePowerPolicyNone:
+		return map[string]float64{}
+	case config.IdlePowerPolicyEvenly:
+		// the idle energy is shared by all the containers, even the ones that did not run in the period
+		shares := make(map[string]float64, len(containersMetrics))
+		for containerID := range containersMetrics {
+			shares[containerID] = 1 / float64(len(containersMetrics))
+		}
+		return shares
+	case config.IdlePowerPolicyRequests:
+		return getRequestShares(component, containersMetrics)
 	}
-	return uint64(math.Ceil(power))
+	return attributionShares
 }
 
-// UpdateContainerEnergyByRatioPowerModel calculates the container energy consumption based on the resource utilization ratio
+// getEnergyShares returns the container dynamic energy, its share of the node energy above the idle baseline, and its share of the node idle energy
+func getEnergyShares(dynShare, idleShare, nodeEnergy, nodeIdleEnergy float64) (dynEnergy, idleEnergy uint64) {
+	nodeIdleEnergy = math.Min(nodeIdleEnergy, nodeEnergy)
+	dynEnergy = uint64(math.Ceil(dynShare * (nodeEnergy - nodeIdleEnergy)))
+	idleEnergy = uint64(math.Ceil(idleShare * nodeIdleEnergy))
+	return
+}
+
+func getContainerEnergyStat(container *collector_metric.ContainerMetrics, component string) *collector_metric.UInt64Stat {
+	switch component {
+	case "pkg":
+		return container.EnergyInPkg
+	case "core":
+		return container.EnergyInCore
+	case "uncore":
+		return container.EnergyInUncore
+	case "dram":
+		return container.EnergyInDRAM
+	case "gpu":
+		return container.EnergyInGPU
+	}
+	return container.EnergyInOther
+}
+
+// UpdateContainerEnergyByRatioPowerModel calculates the container energy consumption based on the attribution policy of each component.
+// The node energy above the idle baseline is divided with the attribution policy and the idle energy with the idle power policy.
 func UpdateContainerEnergyByRatioPowerModel(containersMetrics map[string]*collector_metric.ContainerMetrics, nodeMetrics collector_metric.NodeMetrics) {
 	nodeTotalEnergyPerComponent := nodeMetrics.GetNodeTotalEnergyPerComponent()
-	containerNumber := float64(len(containersMetrics))
+	nodeEnergyPerComponent := map[string]uint64{
+		"pkg":    nodeTotalEnergyPerComponent.Pkg,
+		"core":   nodeTotalEnergyPerComponent.Core,
+		"uncore": nodeTotalEnergyPerComponent.Uncore,
+		"dram":   nodeTotalEnergyPerComponent.DRAM,
+		"other":  nodeMetrics.GetNodeTotalOtherComponentsEnergy(),
+	}
+	if accelerator.IsGPUCollectionSupported() {
+		nodeEnergyPerComponent["gpu"] = nodeMetrics.GetNodeTotalGPUEnergy()
+	}
 
-	for containerID, container := range containersMetrics {
-		var containerResUsage, nodeTotalResUsage, nodeResEnergyUtilization float64
-
-		// calculate the container package/socket energy consumption
-		if _, ok := container.CounterStats[config.CoreUsageMetric]; ok {
-			containerResUsage = float64(container.CounterStats[config.CoreUsageMetric].Curr)
-			nodeTotalResUsage = nodeMetrics.GetNodeResUsagePerResType(config.CoreUsageMetric)
-			nodeResEnergyUtilization = float64(nodeTotalEnergyPerComponent.Pkg)
-			containerPkgEnergy := getEnergyRatio(containerResUsage, nodeTotalResUsage, nodeResEnergyUtilization, containerNumber)
-			if err := containersMetrics[containerID].EnergyInPkg.AddNewCurr(containerPkgEnergy); err != nil {
-				klog.Infoln(err)
+	attributionShares := make(map[string]map[string]float64)
+	for component, nodeEnergy := range nodeEnergyPerComponent {
+		// the package energy follows the core attribution policy
+		policyComponent := component
+		if component == "pkg" {
+			policyComponent = "core"
+		}
+		if _, exists := attributionShares[policyComponent]; !exists {
+			usageMetric := nodeMetrics.UsageMetrics[policyComponent]
+			// the SMT-aware attribution splits the core energy by the core time
+			if policyComponent == "core" && config.SMTAwareAttribution {
+				usageMetric = collector_metric.CoreTimeLabel
 			}
-
-			// calculate the container core energy consumption
-			nodeResEnergyUtilization = float64(nodeTotalEnergyPerComponent.Core)
-			containerCoreEnergy := getEnergyRatio(containerResUsage, nodeTotalResUsage, nodeResEnergyUtilization, containerNumber)
-			if err := containersMetrics[containerID].EnergyInCore.AddNewCurr(containerCoreEnergy); err != nil {
-				klog.Infoln(err)
+			attributionShares[policyComponent] = getAttributionShares(policyComponent, usageMetric, containersMetrics)
+		}
+		dynShares := attributionShares[policyComponent]
+		nodeIdleEnergy := float64(nodeMetrics.GetNodeIdleEnergy(component))
+
+		// the package, core and DRAM energy of each socket is attributed to the containers on the socket
+		if packageEnergy, fractions := getSocketEnergy(component, containersMetrics, &nodeMetrics); len(packageEnergy) > 1 {
+			totalEnergy := float64(0)
+			for _, energy := range packageEnergy {
+				totalEnergy += float64(energy)
+			}
+			if totalEnergy > 0 {
+				for pkgID, energy := range packageEnergy {
+					socketShares := getSocketShares(dynShares, fractions, pkgID)
+					// the idle baseline is divided across the sockets by their energy
+					socketIdleEnergy := nodeIdleEnergy * float64(energy) / totalEnergy
+					addContainerEnergy(containersMetrics, component, socketShares, getIdleShares(policyComponent, socketShares, containersMetrics), float64(energy), socketIdleEnergy)
+				}
+				continue
 			}
 		}
+		addContainerEnergy(containersMetrics, component, dynShares, getIdleShares(policyComponent, dynShares, containersMetrics), float64(nodeEnergy), nodeIdleEnergy)
+	}
+}
 
-		// calculate the container uncore energy consumption
-		nodeResEnergyUtilization = float64(nodeTotalEnergyPerComponent.Uncore)
-		containerUncoreEnergy := uint64(math.Ceil(nodeResEnergyUtilization / containerNumber))
-		if err := containersMetrics[containerID].EnergyInUncore.AddNewCurr(containerUncoreEnergy); err != nil {
+// addContainerEnergy adds the container shares of the dynamic and idle energy of the component
+func addContainerEnergy(containersMetrics map[string]*collector_metric.ContainerMetrics, component string, dynShares, idleShares map[string]float64, nodeEnergy, nodeIdleEnergy float64) {
+	for containerID, container := range containersMetrics {
+		dynEnergy, idleEnergy := getEnergyShares(dynShares[containerID], idleShares[containerID], nodeEnergy, nodeIdleEnergy)
+		if err := getContainerEnergyStat(container, component).AddNewCurr(dynEnergy + idleEnergy); err != nil {
 			klog.Infoln(err)
 		}
-
-		// calculate the container dram energy consumption
-		if _, ok := container.CounterStats[config.DRAMUsageMetric]; ok {
-			containerResUsage = float64(container.CounterStats[config.DRAMUsageMetric].Curr)
-			nodeTotalResUsage = nodeMetrics.GetNodeResUsagePerResType(config.DRAMUsageMetric)
-			nodeResEnergyUtilization = float64(nodeTotalEnergyPerComponent.DRAM)
-			containerDramEnergy := getEnergyRatio(containerResUsage, nodeTotalResUsage, nodeResEnergyUtilization, containerNumber)
-			if err := containersMetrics[containerID].EnergyInDRAM.AddNewCurr(containerDramEnergy); err != nil {
-				klog.Infoln(err)
-			}
+		// the dynamic and idle energy of the container is the sum of the package, DRAM, GPU and other energy
+		if component == "core" || component == "uncore" {
+			continue
 		}
-
-		// calculate the container gpu energy consumption
-		if accelerator.IsGPUCollectionSupported() {
-			containerResUsage = float64(container.CounterStats[config.GpuUsageMetric].Curr)
-			nodeTotalResUsage = nodeMetrics.GetNodeResUsagePerResType(config.GpuUsageMetric)
-			nodeResEnergyUtilization = float64(nodeMetrics.GetNodeTotalGPUEnergy())
-			containerGPUEnergy := getEnergyRatio(containerResUsage, nodeTotalResUsage, nodeResEnergyUtilization, containerNumber)
-			if err := containersMetrics[containerID].EnergyInGPU.AddNewCurr(containerGPUEnergy); err != nil {
-				klog.Infoln(err)
-			}
+		if err := container.DynEnergy.AddNewCurr(dynEnergy); err != nil {
+			klog.Infoln(err)
 		}
-
-		// calculate the container host other components energy consumption
-		nodeResEnergyUtilization = float64(nodeMetrics.GetNodeTotalOtherComponentsEnergy())
-		containerOtherHostComponentsEnergy := uint64(math.Ceil(nodeResEnergyUtilization / containerNumber))
-		if err := containersMetrics[containerID].EnergyInOther.AddNewCurr(containerOtherHostComponentsEnergy); err != nil {
+		if err := container.IdleEnergy.AddNewCurr(idleEnergy); err != nil {
 			klog.Infoln(err)
 		}
 	}
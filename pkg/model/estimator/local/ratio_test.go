@@ -17,6 +17,9 @@ limitations under the License.
 package local
 
 import (
+	"testing"
+	"time"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
@@ -43,15 +46,15 @@ var _ = Describe("Test Ratio Unit", func() {
 
 		containersMetrics := map[string]*collector_metric.ContainerMetrics{}
 		containersMetrics["containerA"] = collector_metric.NewContainerMetrics("containerA", "podA", "test")
-		err := containersMetrics["containerA"].CounterStats[config.CoreUsageMetric].AddNewCurr(100)
+		err := containersMetrics["containerA"].CounterStats[config.CoreUsageMetrics[0]].AddNewCurr(100)
 		Expect(err).NotTo(HaveOccurred())
 		containersMetrics["containerB"] = collector_metric.NewContainerMetrics("containerB", "podB", "test")
-		err = containersMetrics["containerB"].CounterStats[config.CoreUsageMetric].AddNewCurr(100)
+		err = containersMetrics["containerB"].CounterStats[config.CoreUsageMetrics[0]].AddNewCurr(100)
 		Expect(err).NotTo(HaveOccurred())
 
 		nodeMetrics := *collector_metric.NewNodeMetrics()
 		nodeMetrics.AddNodeResUsageFromContainerResUsage(containersMetrics)
-		Expect(nodeMetrics.ResourceUsage[config.CoreUsageMetric]).Should(BeEquivalentTo(200))
+		Expect(nodeMetrics.ResourceUsage[config.CoreUsageMetrics[0]]).Should(BeEquivalentTo(200))
 
 		componentsEnergies := make(map[int]source.NodeComponentsEnergy)
 		componentsEnergies[0] = source.NodeComponentsEnergy{
@@ -75,3 +78,136 @@ var _ = Describe("Test Ratio Unit", func() {
 		Expect(containersMetrics["containerA"].EnergyInPkg).Should(BeEquivalentTo(10))
 	})
 })
+
+func TestIdlePowerPolicy(t *testing.T) {
+	g := NewWithT(t)
+	defer config.SetIdlePowerPolicy(config.IdlePowerPolicyUsage)
+
+	// the first period learns an idle baseline of 20 mJ, the second period consumes 40 mJ
+	nodeMetrics := collector_metric.NewNodeMetrics()
+	for _, pkgEnergy := range []uint64{100, 120, 160} {
+		nodeMetrics.ResetCurr()
+		nodeMetrics.AddNodeComponentsEnergy(map[int]source.NodeComponentsEnergy{0: {Pkg: pkgEnergy}})
+		nodeMetrics.UpdateIdleEnergy(time.Second)
+	}
+	g.Expect(nodeMetrics.EnergyInPkg.Curr()).To(BeEquivalentTo(40))
+	g.Expect(nodeMetrics.GetNodeIdleEnergy("pkg")).To(BeEquivalentTo(20))
+
+	// containerA has 75% of the usage and 25% of the CPU requests
+	newContainersMetrics := func() map[string]*collector_metric.ContainerMetrics {
+		containersMetrics := map[string]*collector_metric.ContainerMetrics{}
+		for name, usage := range map[string]uint64{"containerA": 300, "containerB": 100} {
+			containersMetrics[name] = collector_metric.NewContainerMetrics(name, "pod", "test")
+			containersMetrics[name].CounterStats[config.CoreUsageMetrics[0]] = &collector_metric.UInt64Stat{Curr: usage}
+		}
+		containersMetrics["containerA"].CPURequest = 0.5
+		containersMetrics["containerB"].CPURequest = 1.5
+		nodeMetrics.SelectUsageMetrics(containersMetrics)
+		return containersMetrics
+	}
+
+	expectedIdleEnergy := map[string]uint64{
+		config.IdlePowerPolicyNone:     0,
+		config.IdlePowerPolicyEvenly:   10,
+		config.IdlePowerPolicyRequests: 5,
+		config.IdlePowerPolicyUsage:    15,
+	}
+	for policy, idleEnergy := range expectedIdleEnergy {
+		config.SetIdlePowerPolicy(policy)
+		containersMetrics := newContainersMetrics()
+		UpdateContainerEnergyByRatioPowerModel(containersMetrics, *nodeMetrics)
+		containerA := containersMetrics["containerA"]
+		g.Expect(containerA.DynEnergy.Curr).To(BeEquivalentTo(15), policy)
+		g.Expect(containerA.IdleEnergy.Curr).To(Equal(idleEnergy), policy)
+		g.Expect(containerA.EnergyInPkg.Curr).To(Equal(15+idleEnergy), policy)
+	}
+}
+
+func TestAttributionPolicies(t *testing.T) {
+	g := NewWithT(t)
+	defer func(uncorePolicy string) { config.AttributionPolicies["uncore"] = uncorePolicy }(config.AttributionPolicies["uncore"])
+
+	nodeMetrics := collector_metric.NewNodeMetrics()
+	for _, uncoreEnergy := range []uint64{100, 160} {
+		nodeMetrics.ResetCurr()
+		nodeMetrics.AddNodeComponentsEnergy(map[int]source.NodeComponentsEnergy{0: {Uncore: uncoreEnergy}})
+	}
+
+	// containerA and containerB ran in the period, the sidecar did not
+	newContainersMetrics := func() map[string]*collector_metric.ContainerMetrics {
+		containersMetrics := map[string]*collector_metric.ContainerMetrics{}
+		for name, cpuTime := range map[string]uint64{"containerA": 30, "containerB": 10, "sidecar": 0} {
+			containersMetrics[name] = collector_metric.NewContainerMetrics(name, "pod", "test")
+			g.Expect(containersMetrics[name].CPUTime.AddNewCurr(cpuTime)).To(Succeed())
+		}
+		containersMetrics["containerA"].CPURequest = 1
+		containersMetrics["containerB"].CPURequest = 1
+		containersMetrics["sidecar"].CPURequest = 2
+		nodeMetrics.SelectUsageMetrics(containersMetrics)
+		return containersMetrics
+	}
+
+	expectedUncoreEnergy := map[string][]uint64{
+		config.AttributionPolicyEvenly:          {30, 30, 0},
+		config.AttributionPolicyRequests:        {15, 15, 30},
+		"evenly:0.5,requests:0.5":               {23, 23, 15},
+		config.AttributionPolicyUsage:           {30, 30, 0}, // the uncore has no usage metric
+		config.AttributionPolicyUsage + ":0.25": {30, 30, 0},
+	}
+	for policy, uncoreEnergy := range expectedUncoreEnergy {
+		config.AttributionPolicies["uncore"] = policy
+		containersMetrics := newContainersMetrics()
+		UpdateContainerEnergyByRatioPowerModel(containersMetrics, *nodeMetrics)
+		g.Expect(containersMetrics["containerA"].EnergyInUncore.Curr).To(Equal(uncoreEnergy[0]), policy)
+		g.Expect(containersMetrics["containerB"].EnergyInUncore.Curr).To(Equal(uncoreEnergy[1]), policy)
+		g.Expect(containersMetrics["sidecar"].EnergyInUncore.Curr).To(Equal(uncoreEnergy[2]), policy)
+	}
+
+	// the uncore energy is divided by the CPU time of the containers
+	defer func(metrics []string) { config.UncoreUsageMetrics = metrics }(config.UncoreUsageMetrics)
+	config.UncoreUsageMetrics = []string{collector_metric.CPUTimeLabel}
+	config.AttributionPolicies["uncore"] = config.AttributionPolicyUsage
+	containersMetrics := newContainersMetrics()
+	UpdateContainerEnergyByRatioPowerModel(containersMetrics, *nodeMetrics)
+	g.Expect(containersMetrics["containerA"].EnergyInUncore.Curr).To(BeEquivalentTo(45))
+	g.Expect(containersMetrics["containerB"].EnergyInUncore.Curr).To(BeEquivalentTo(15))
+}
+
+func TestSMTAwareAttribution(t *testing.T) {
+	g := NewWithT(t)
+	defer func(corePolicy string) { config.AttributionPolicies["core"] = corePolicy }(config.AttributionPolicies["core"])
+	defer config.SetSMTAwareAttribution(config.SMTAwareAttribution)
+	config.AttributionPolicies["core"] = config.AttributionPolicyUsage
+
+	nodeMetrics := collector_metric.NewNodeMetrics()
+	for _, coreEnergy := range []uint64{100, 180} {
+		nodeMetrics.ResetCurr()
+		nodeMetrics.AddNodeComponentsEnergy(map[int]source.NodeComponentsEnergy{0: {Core: coreEnergy}})
+	}
+
+	// the containers have the same core usage metric, containerA has 75% of the core time
+	newContainersMetrics := func() map[string]*collector_metric.ContainerMetrics {
+		containersMetrics := map[string]*collector_metric.ContainerMetrics{}
+		for name, coreTime := range map[string]uint64{"containerA": 30, "containerB": 10} {
+			containersMetrics[name] = collector_metric.NewContainerMetrics(name, "pod", "test")
+			containersMetrics[name].CounterStats[config.CoreUsageMetrics[0]] = &collector_metric.UInt64Stat{Curr: 100}
+			g.Expect(containersMetrics[name].CoreTime.AddNewCurr(coreTime)).To(Succeed())
+		}
+		nodeMetrics.SelectUsageMetrics(containersMetrics)
+		return containersMetrics
+	}
+
+	config.SetSMTAwareAttribution(false)
+	containersMetrics := newContainersMetrics()
+	UpdateContainerEnergyByRatioPowerModel(containersMetrics, *nodeMetrics)
+	g.Expect(containersMetrics["containerA"].EnergyInCore.Curr).To(BeEquivalentTo(40))
+
+	// the configured core usage metrics are not changed
+	coreUsageMetrics := config.CoreUsageMetrics
+	config.SetSMTAwareAttribution(true)
+	g.Expect(config.CoreUsageMetrics).To(Equal(coreUsageMetrics))
+	containersMetrics = newContainersMetrics()
+	UpdateContainerEnergyByRatioPowerModel(containersMetrics, *nodeMetrics)
+	g.Expect(containersMetrics["containerA"].EnergyInCore.Curr).To(BeEquivalentTo(60))
+	g.Expect(containersMetrics["containerB"].EnergyInCore.Curr).To(BeEquivalentTo(20))
+}
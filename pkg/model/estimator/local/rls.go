@@ -0,0 +1,254 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+rls.go
+calibrate a linear model of the node component energy on the node resource usage online by recursive least squares on nodes with
+measured energy, e.g. RAPL. The fitted weights are in the ModelWeights format to be loaded by the estimators of the nodes without measurement.
+*/
+
+package local
+
+import (
+	"math"
+	"sync"
+)
+
+const (
+	// calibrationWarmUpSamples is the number of samples that set the normalization of the features before the fitting starts
+	calibrationWarmUpSamples = 30
+	// rlsInitialCovariance is the initial diagonal of the inverse correlation matrix, a large value for a fast convergence
+	rlsInitialCovariance = 1000
+	// rlsMaxCovariance bounds the trace of the inverse correlation matrix per feature. With forgetting, the directions that the samples do
+	// not excite, e.g. a constant usage on an idle node, grow by 1/lambda at each update until the weights blow up on the next change.
+	rlsMaxCovariance = rlsInitialCovariance
+)
+
+// OnlineCalibrator fits a linear model of the energy of each node component by recursive least squares with exponential forgetting
+type OnlineCalibrator struct {
+	lock             sync.Mutex
+	features         []string
+	forgettingFactor float64
+	// warmUp holds the first samples to compute the mean and the variance that normalize the features
+	warmUp   []calibrationSample
+	mean     []float64
+	variance []float64
+	models   map[string]*rlsModel
+	samples  int
+}
+
+type calibrationSample struct {
+	usage  []float64
+	energy map[string]float64
+}
+
+// rlsModel holds the weights, the bias first, and the inverse correlation matrix of the normalized features
+type rlsModel struct {
+	theta []float64
+	p     [][]float64
+}
+
+// NewOnlineCalibrator returns a calibrator on the features, the forgetting factor in (0, 1] discounts the older samples to follow the drift
+func NewOnlineCalibrator(features []string, forgettingFactor float64) *OnlineCalibrator {
+	if forgettingFactor <= 0 || forgettingFactor > 1 {
+		forgettingFactor = 1
+	}
+	return &OnlineCalibrator{
+		features:         features,
+		forgettingFactor: forgettingFactor,
+		models:           make(map[string]*rlsModel),
+	}
+}
+
+// AddSample fits the models with the resource usage of the node and the measured energy of its components in the same period
+func (c *OnlineCalibrator) AddSample(usage map[string]float64, componentsEnergy map[string]float64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	sample := calibrationSample{usage: make([]float64, len(c.features)), energy: componentsEnergy}
+	for i, feature := range c.features {
+		sample.usage[i] = usage[feature]
+	}
+	if c.mean == nil {
+		c.warmUp = append(c.warmUp, sample)
+		if len(c.warmUp) < calibrationWarmUpSamples {
+			return
+		}
+		c.setNormalization()
+		for _, s := range c.warmUp {
+			c.fit(s)
+		}
+		c.warmUp = nil
+		return
+	}
+	c.fit(sample)
+}
+
+// setNormalization sets the mean and the variance of the features over the warm-up samples
+func (c *OnlineCalibrator) setNormalization() {
+	n := float64(len(c.warmUp))
+	c.mean = make([]float64, len(c.features))
+	c.variance = make([]float64, len(c.features))
+	for _, s := range c.warmUp {
+		for i, x := range s.usage {
+			c.mean[i] += x / n
+		}
+	}
+	for _, s := range c.warmUp {
+		for i, x := range s.usage {
+			c.variance[i] += (x - c.mean[i]) * (x - c.mean[i]) / n
+		}
+	}
+	for i := range c.variance {
+		// a constant feature is not scaled
+		if c.variance[i] == 0 {
+			c.variance[i] = 1
+		}
+	}
+}
+
+func (c *OnlineCalibrator) fit(s calibrationSample) {
+	z := make([]float64, len(c.features)+1)
+	z[0] = 1
+	for i, x := range s.usage {
+		z[i+1] = (x - c.mean[i]) / math.Sqrt(c.variance[i])
+	}
+	if !allFinite(z) {
+		return
+	}
+	fitted := false
+	for component, energy := range s.energy {
+		model, found := c.models[component]
+		if !found {
+			model = newRLSModel(len(z))
+			c.models[component] = model
+		}
+		if model.update(z, energy, c.forgettingFactor) {
+			fitted = true
+		}
+	}
+	if fitted {
+		c.samples++
+	}
+}
+
+func newRLSModel(n int) *rlsModel {
+	m := &rlsModel{theta: make([]float64, n), p: make([][]float64, n)}
+	for i := range m.p {
+		m.p[i] = make([]float64, n)
+		m.p[i][i] = rlsInitialCovariance
+	}
+	return m
+}
+
+// update applies the recursive least squares update with the sample z and the target y, the trace of P is bounded.
+// It returns false if the update is not finite, e.g. a NaN energy, then the model is not changed.
+func (m *rlsModel) update(z []float64, y, lambda float64) bool {
+	if math.IsNaN(y) || math.IsInf(y, 0) {
+		return false
+	}
+	n := len(z)
+	// pz = P z, the gain is k = P z / (lambda + z' P z)
+	pz := make([]float64, n)
+	denominator := lambda
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			pz[i] += m.p[i][j] * z[j]
+		}
+		denominator += z[i] * pz[i]
+	}
+	prediction := 0.0
+	for i := 0; i < n; i++ {
+		prediction += m.theta[i] * z[i]
+	}
+	if !(denominator > 0) || math.IsInf(denominator, 0) {
+		return false
+	}
+	e := y - prediction
+	theta := make([]float64, n)
+	for i := 0; i < n; i++ {
+		theta[i] = m.theta[i] + pz[i]/denominator*e
+	}
+	// P = (P - k z' P) / lambda, P is symmetric so z' P = (P z)'
+	p := make([][]float64, n)
+	trace := 0.0
+	for i := 0; i < n; i++ {
+		p[i] = make([]float64, n)
+		for j := 0; j < n; j++ {
+			p[i][j] = (m.p[i][j] - pz[i]*pz[j]/denominator) / lambda
+		}
+		trace += p[i][i]
+	}
+	// scaling P keeps the directions that the samples excited relative to the others
+	if maxTrace := rlsMaxCovariance * float64(n); trace > maxTrace {
+		for i := range p {
+			for j := range p[i] {
+				p[i][j] *= maxTrace / trace
+			}
+		}
+	}
+	if !allFinite(theta) {
+		return false
+	}
+	for i := range p {
+		if !allFinite(p[i]) {
+			return false
+		}
+	}
+	m.theta, m.p = theta, p
+	return true
+}
+
+func allFinite(values []float64) bool {
+	for _, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// GetWeights returns the fitted weights of the components and the number of fitted samples, no weights before the warm-up completes.
+// The weights of the system features, e.g. the CPU architecture of the node, are zero to record what the model was fitted on.
+func (c *OnlineCalibrator) GetWeights(systemFeatures, systemValues []string) (ComponentModelWeights, int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.samples == 0 {
+		return nil, 0
+	}
+	categoricalVariables := make(map[string]map[string]CategoricalFeature, len(systemFeatures))
+	for i, feature := range systemFeatures {
+		if i < len(systemValues) {
+			categoricalVariables[feature] = map[string]CategoricalFeature{systemValues[i]: {Weight: 0}}
+		}
+	}
+	weights := make(ComponentModelWeights, len(c.models))
+	for component, model := range c.models {
+		numericalVariables := make(map[string]NormalizedNumericalFeature, len(c.features))
+		for i, feature := range c.features {
+			numericalVariables[feature] = NormalizedNumericalFeature{
+				Mean:     c.mean[i],
+				Variance: c.variance[i],
+				Weight:   model.theta[i+1],
+			}
+		}
+		weights[component] = ModelWeights{AllWeights{
+			BiasWeight:           model.theta[0],
+			CategoricalVariables: categoricalVariables,
+			NumericalVariables:   numericalVariables,
+		}}
+	}
+	return weights, c.samples
+}
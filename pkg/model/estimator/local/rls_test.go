@@ -0,0 +1,82 @@
+package local
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestOnlineCalibrator(t *testing.T) {
+	g := NewWithT(t)
+	features := []string{"cpu_instr", "cache_miss"}
+	c := NewOnlineCalibrator(features, 1)
+
+	// the core energy is 500 + 2e-6 per instruction, the dram energy 100 + 1e-3 per cache miss
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		instructions, cacheMisses := r.Float64()*1e9, r.Float64()*1e6
+		c.AddSample(map[string]float64{"cpu_instr": instructions, "cache_miss": cacheMisses},
+			map[string]float64{"core": 500 + 2e-6*instructions, "dram": 100 + 1e-3*cacheMisses})
+		if i < calibrationWarmUpSamples-1 {
+			weights, samples := c.GetWeights(systemFeatures, systemValues)
+			g.Expect(weights).To(BeNil())
+			g.Expect(samples).To(BeZero())
+		}
+	}
+
+	weights, samples := c.GetWeights(systemFeatures, systemValues)
+	g.Expect(samples).To(Equal(200))
+	g.Expect(weights).To(HaveKey("core"))
+	g.Expect(weights).To(HaveKey("dram"))
+	usageValues := [][]float64{{5e8, 2e5}, {0, 0}}
+	g.Expect(weights["core"].predict(features, usageValues, systemFeatures, systemValues)).To(
+		ConsistOf(BeNumerically("~", 1500, 1), BeNumerically("~", 500, 1)))
+	g.Expect(weights["dram"].predict(features, usageValues, systemFeatures, systemValues)).To(
+		ConsistOf(BeNumerically("~", 300, 1), BeNumerically("~", 100, 1)))
+}
+
+func TestOnlineCalibratorConstantUsage(t *testing.T) {
+	g := NewWithT(t)
+	features := []string{"cpu_instr"}
+	c := NewOnlineCalibrator(features, 0.9)
+	trace := func() float64 {
+		p := c.models["core"].p
+		sum := 0.0
+		for i := range p {
+			sum += p[i][i]
+		}
+		return sum
+	}
+
+	// the core energy is 500 + 2e-6 per instruction
+	r := rand.New(rand.NewSource(1))
+	addSample := func(instructions float64) {
+		c.AddSample(map[string]float64{"cpu_instr": instructions}, map[string]float64{"core": 500 + 2e-6*instructions})
+	}
+	for i := 0; i < 100; i++ {
+		addSample(r.Float64() * 1e9)
+	}
+	// the node is idle for a long time, the usage does not excite the instruction weight
+	for i := 0; i < 5000; i++ {
+		addSample(0)
+		g.Expect(trace()).To(BeNumerically("<=", 2*rlsInitialCovariance*(1+1e-9)))
+	}
+	// the weights do not blow up when the usage changes
+	for i := 0; i < 50; i++ {
+		addSample(r.Float64() * 1e9)
+	}
+	weights, _ := c.GetWeights(systemFeatures, systemValues)
+	g.Expect(weights["core"].predict(features, [][]float64{{5e8}, {0}}, systemFeatures, systemValues)).To(
+		ConsistOf(BeNumerically("~", 1500, 1), BeNumerically("~", 500, 1)))
+
+	// the non-finite samples are rejected
+	_, samples := c.GetWeights(systemFeatures, systemValues)
+	c.AddSample(map[string]float64{"cpu_instr": 1e8}, map[string]float64{"core": math.NaN()})
+	c.AddSample(map[string]float64{"cpu_instr": math.Inf(1)}, map[string]float64{"core": 700})
+	weights, rejected := c.GetWeights(systemFeatures, systemValues)
+	g.Expect(rejected).To(Equal(samples))
+	g.Expect(weights["core"].predict(features, [][]float64{{5e8}}, systemFeatures, systemValues)).To(
+		ConsistOf(BeNumerically("~", 1500, 1)))
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+socket.go
+attribute the package, core and DRAM energy of each socket to the containers running on the socket.
+*/
+
+package local
+
+import (
+	"strconv"
+
+	collector_metric "github.com/sustainable-computing-io/kepler/pkg/collector/metric"
+	"k8s.io/klog/v2"
+)
+
+// getSocketEnergy returns the energy of the component on each package and the fraction of each container on each package.
+// The fraction is the CPU time of the container on the CPUs of the package for the package and core energy,
+// and its memory on the NUMA nodes of the package for the DRAM energy. The energy sources key the energy by the physical
+// package ID, no energy is returned if the topology is unknown or does not have all the packages of the energy.
+func getSocketEnergy(component string, containersMetrics map[string]*collector_metric.ContainerMetrics, nodeMetrics *collector_metric.NodeMetrics) (packageEnergy map[string]uint64, fractions map[string]map[string]float64) {
+	var packageWeights func(*collector_metric.ContainerMetrics) map[string]float64
+	var topology map[int32]int
+	switch component {
+	case "pkg", "core":
+		if len(nodeMetrics.CPUPackages) == 0 {
+			return
+		}
+		topology = nodeMetrics.CPUPackages
+		packageWeights = func(container *collector_metric.ContainerMetrics) map[string]float64 {
+			weights := make(map[string]float64)
+			for cpu, cpuTime := range container.CurrCPUTimePerCPU {
+				if pkgID, exists := nodeMetrics.CPUPackages[int32(cpu)]; exists {
+					weights[strconv.Itoa(pkgID)] += float64(cpuTime)
+				}
+			}
+			return weights
+		}
+	case "dram":
+		if len(nodeMetrics.NUMANodePackages) == 0 {
+			return
+		}
+		topology = nodeMetrics.NUMANodePackages
+		packageWeights = func(container *collector_metric.ContainerMetrics) map[string]float64 {
+			weights := make(map[string]float64)
+			for node, memory := range container.NUMAMemory {
+				if pkgID, exists := nodeMetrics.NUMANodePackages[node]; exists {
+					weights[strconv.Itoa(pkgID)] += float64(memory)
+				}
+			}
+			return weights
+		}
+	default:
+		return
+	}
+
+	packageEnergy = getPackageEnergy(component, nodeMetrics)
+	topologyPackages := make(map[string]bool)
+	for _, pkgID := range topology {
+		topologyPackages[strconv.Itoa(pkgID)] = true
+	}
+	for pkgID := range packageEnergy {
+		if !topologyPackages[pkgID] {
+			klog.V(3).Infof("the %s energy of the package %s is not in the CPU topology, it is not attributed per socket", component, pkgID)
+			return nil, nil
+		}
+	}
+	fractions = make(map[string]map[string]float64, len(containersMetrics))
+	for containerID, container := range containersMetrics {
+		weights := packageWeights(container)
+		totalWeight := float64(0)
+		for pkgID := range packageEnergy {
+			totalWeight += weights[pkgID]
+		}
+		fractions[containerID] = make(map[string]float64, len(packageEnergy))
+		for pkgID := range packageEnergy {
+			if totalWeight > 0 {
+				fractions[containerID][pkgID] = weights[pkgID] / totalWeight
+			} else {
+				// the container did not run or has no memory information, it is spread across the packages
+				fractions[containerID][pkgID] = 1 / float64(len(packageEnergy))
+			}
+		}
+	}
+	return packageEnergy, fractions
+}
+
+// getPackageEnergy returns the energy of the component on each package, the core energy is the package energy without the uncore if it is not reported
+func getPackageEnergy(component string, nodeMetrics *collector_metric.NodeMetrics) map[string]uint64 {
+	packageEnergy := make(map[string]uint64)
+	switch component {
+	case "pkg":
+		for pkgID, pkgStat := range nodeMetrics.EnergyInPkg.Stat {
+			packageEnergy[pkgID] = pkgStat.Curr
+		}
+	case "core":
+		// the same core energy as the node core energy, see NodeMetrics.GetNodeTotalEnergyPerComponent
+		for pkgID := range nodeMetrics.EnergyInPkg.Stat {
+			if coreEnergy := nodeMetrics.GetPackageCoreEnergy(pkgID); coreEnergy > 0 {
+				packageEnergy[pkgID] = coreEnergy
+			}
+		}
+	case "dram":
+		for pkgID, dramStat := range nodeMetrics.EnergyInDRAM.Stat {
+			packageEnergy[pkgID] = dramStat.Curr
+		}
+	}
+	return packageEnergy
+}
+
+// getSocketShares weights the attribution shares by the fraction of each container on the package,
+// the attribution shares are kept if no container with a share is on the package
+func getSocketShares(shares map[string]float64, fractions map[string]map[string]float64, pkgID string) map[string]float64 {
+	socketShares := make(map[string]float64, len(shares))
+	totalShare := float64(0)
+	for containerID, share := range shares {
+		socketShares[containerID] = share * fractions[containerID][pkgID]
+		totalShare += socketShares[containerID]
+	}
+	if totalShare <= 0 {
+		return shares
+	}
+	for containerID := range socketShares {
+		socketShares[containerID] /= totalShare
+	}
+	return socketShares
+}
@@ -0,0 +1,90 @@
+package local
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	collector_metric "github.com/sustainable-computing-io/kepler/pkg/collector/metric"
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/power/components/source"
+)
+
+func TestSocketAttribution(t *testing.T) {
+	g := NewWithT(t)
+	defer func(coreMetrics, dramMetrics []string) {
+		config.CoreUsageMetrics, config.DRAMUsageMetrics = coreMetrics, dramMetrics
+	}(config.CoreUsageMetrics, config.DRAMUsageMetrics)
+	config.CoreUsageMetrics = []string{collector_metric.CPUTimeLabel}
+	config.DRAMUsageMetrics = []string{collector_metric.CPUTimeLabel}
+
+	// the package 0 consumes 30 mJ and the package 1 10 mJ, the cpu0 and the NUMA node 0 are in the package 0
+	nodeMetrics := collector_metric.NewNodeMetrics()
+	nodeMetrics.AddNodeComponentsEnergy(map[int]source.NodeComponentsEnergy{0: {Pkg: 100, DRAM: 100}, 1: {Pkg: 100, DRAM: 100}})
+	nodeMetrics.AddNodeComponentsEnergy(map[int]source.NodeComponentsEnergy{0: {Pkg: 130, DRAM: 106}, 1: {Pkg: 110, DRAM: 102}})
+	nodeMetrics.CPUPackages = map[int32]int{0: 0, 1: 1}
+	nodeMetrics.NUMANodePackages = map[int32]int{0: 0, 1: 1}
+
+	// the containers have the same usage, containerA runs and has its memory on the package 0, containerB on the package 1
+	containersMetrics := map[string]*collector_metric.ContainerMetrics{}
+	for name, cpu := range map[string]uint32{"containerA": 0, "containerB": 1} {
+		containersMetrics[name] = collector_metric.NewContainerMetrics(name, "pod", "test")
+		g.Expect(containersMetrics[name].CPUTime.AddNewCurr(100)).To(Succeed())
+		containersMetrics[name].CurrCPUTimePerCPU[cpu] = 100000
+		containersMetrics[name].NUMAMemory[int32(cpu)] = 4096
+	}
+	nodeMetrics.SelectUsageMetrics(containersMetrics)
+
+	UpdateContainerEnergyByRatioPowerModel(containersMetrics, *nodeMetrics)
+	g.Expect(containersMetrics["containerA"].EnergyInPkg.Curr).To(BeEquivalentTo(30))
+	g.Expect(containersMetrics["containerB"].EnergyInPkg.Curr).To(BeEquivalentTo(10))
+	g.Expect(containersMetrics["containerA"].EnergyInCore.Curr).To(BeEquivalentTo(30))
+	g.Expect(containersMetrics["containerA"].EnergyInDRAM.Curr).To(BeEquivalentTo(6))
+	g.Expect(containersMetrics["containerB"].EnergyInDRAM.Curr).To(BeEquivalentTo(2))
+
+	// without the topology the energy is divided by the usage
+	for _, cpuPackages := range []map[int32]int{{}, {0: 0, 1: 2}} {
+		// the package 1 of the energy is not in the topology
+		nodeMetrics.CPUPackages = cpuPackages
+		for _, container := range containersMetrics {
+			container.EnergyInPkg.ResetCurr()
+		}
+		UpdateContainerEnergyByRatioPowerModel(containersMetrics, *nodeMetrics)
+		g.Expect(containersMetrics["containerA"].EnergyInPkg.Curr).To(BeEquivalentTo(20))
+		g.Expect(containersMetrics["containerB"].EnergyInPkg.Curr).To(BeEquivalentTo(20))
+	}
+}
+
+func TestSocketCoreEnergyWithoutCoreReporting(t *testing.T) {
+	g := NewWithT(t)
+	defer func(coreMetrics []string) { config.CoreUsageMetrics = coreMetrics }(config.CoreUsageMetrics)
+	config.CoreUsageMetrics = []string{collector_metric.CPUTimeLabel}
+
+	// the core energy is not reported, it is the package energy without the uncore energy on the single and the multiple packages
+	for _, energy := range []map[int]source.NodeComponentsEnergy{
+		{0: {Pkg: 130, Uncore: 110}},
+		{0: {Pkg: 130, Uncore: 110}, 1: {Pkg: 110, Uncore: 104}},
+	} {
+		nodeMetrics := collector_metric.NewNodeMetrics()
+		initial := map[int]source.NodeComponentsEnergy{}
+		for pkgID := range energy {
+			initial[pkgID] = source.NodeComponentsEnergy{Pkg: 100, Uncore: 100}
+		}
+		nodeMetrics.AddNodeComponentsEnergy(initial)
+		nodeMetrics.AddNodeComponentsEnergy(energy)
+		nodeMetrics.CPUPackages = map[int32]int{0: 0, 1: 1}
+
+		containersMetrics := map[string]*collector_metric.ContainerMetrics{}
+		for name, cpu := range map[string]uint32{"containerA": 0, "containerB": 1} {
+			containersMetrics[name] = collector_metric.NewContainerMetrics(name, "pod", "test")
+			g.Expect(containersMetrics[name].CPUTime.AddNewCurr(100)).To(Succeed())
+			containersMetrics[name].CurrCPUTimePerCPU[cpu] = 100000
+		}
+		nodeMetrics.SelectUsageMetrics(containersMetrics)
+
+		UpdateContainerEnergyByRatioPowerModel(containersMetrics, *nodeMetrics)
+		nodeCoreEnergy := nodeMetrics.GetNodeTotalEnergyPerComponent().Core
+		g.Expect(nodeCoreEnergy).To(BeEquivalentTo(20 + 6*(len(energy)-1)))
+		g.Expect(containersMetrics["containerA"].EnergyInCore.Curr + containersMetrics["containerB"].EnergyInCore.Curr).To(Equal(nodeCoreEnergy))
+	}
+}
@@ -0,0 +1,307 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+tree.go
+evaluate gradient-boosted tree ensembles dumped in JSON by XGBoost (Booster.get_dump(dump_format="json")) or by LightGBM (Booster.dump_model()).
+*/
+
+package local
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+/*
+TreeEnsemble defines the structure of a tree ensemble, the trees are in either the XGBoost or the LightGBM node format
+{
+"Base_Score": 0.5,
+"Feature_Names": ["cpu_cycles", "cache_miss"],
+"Trees": [
+
+	{"nodeid": 0, "split": "cpu_cycles", "split_condition": 100, "yes": 1, "no": 2, "missing": 1, "children": [{"nodeid": 1, "leaf": 1.0}, {"nodeid": 2, "leaf": 2.0}]},
+	{"split_feature": 1, "threshold": 10, "decision_type": "<=", "default_left": true, "left_child": {"leaf_value": 0.1}, "right_child": {"leaf_value": 0.2}}
+	]
+
+}
+The features of the splits are referred by name or by index in Feature_Names, i.e. f<index> in XGBoost and split_feature in LightGBM.
+The prediction is Base_Score plus the sum of the leaf values of the trees.
+
+The dumps of the libraries are also accepted as they are:
+  - the list of XGBoost trees of get_dump(dump_format="json"), either the JSON strings or the decoded trees, the Base_Score is then 0
+    since XGBoost does not dump it, the booster must be trained with base_score=0 or the dump must be wrapped with its Base_Score
+  - the LightGBM model of dump_model(), its feature_names and the tree_structure of each tree of tree_info are used, LightGBM adds
+    the initial score to the first tree
+*/
+type TreeEnsemble struct {
+	BaseScore    float64    `json:"Base_Score"`
+	FeatureNames []string   `json:"Feature_Names"`
+	Trees        []TreeNode `json:"Trees"`
+}
+
+type TreeNode struct {
+	// XGBoost node format, the children are referred by node id
+	NodeID         int        `json:"nodeid"`
+	Split          string     `json:"split"`
+	SplitCondition float64    `json:"split_condition"`
+	Yes            int        `json:"yes"`
+	No             int        `json:"no"`
+	Missing        *int       `json:"missing"`
+	Children       []TreeNode `json:"children"`
+	Leaf           *float64   `json:"leaf"`
+	// LightGBM node format
+	SplitFeature *int      `json:"split_feature"`
+	Threshold    float64   `json:"threshold"`
+	DecisionType string    `json:"decision_type"`
+	DefaultLeft  bool      `json:"default_left"`
+	LeftChild    *TreeNode `json:"left_child"`
+	RightChild   *TreeNode `json:"right_child"`
+	LeafValue    *float64  `json:"leaf_value"`
+	// MissingType is None, Zero or NaN, with None the missing values are 0, with Zero the zeros are missing too
+	MissingType string `json:"missing_type"`
+}
+
+// UnmarshalJSON decodes the tree ensemble or the dump of XGBoost or LightGBM
+func (e *TreeEnsemble) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		return e.unmarshalXGBoostDump(data)
+	}
+	// the alias type does not have the UnmarshalJSON method
+	type treeEnsemble TreeEnsemble
+	var ensemble struct {
+		treeEnsemble
+		// LightGBM dump_model() format
+		LightGBMFeatureNames []string `json:"feature_names"`
+		TreeInfo             []struct {
+			TreeStructure TreeNode `json:"tree_structure"`
+		} `json:"tree_info"`
+	}
+	if err := json.Unmarshal(data, &ensemble); err != nil {
+		return err
+	}
+	*e = TreeEnsemble(ensemble.treeEnsemble)
+	if len(ensemble.TreeInfo) > 0 {
+		e.FeatureNames = ensemble.LightGBMFeatureNames
+		e.Trees = make([]TreeNode, 0, len(ensemble.TreeInfo))
+		for _, info := range ensemble.TreeInfo {
+			e.Trees = append(e.Trees, info.TreeStructure)
+		}
+	}
+	return nil
+}
+
+// unmarshalXGBoostDump decodes the list of trees of XGBoost get_dump, the trees are JSON objects or the JSON strings returned by get_dump
+func (e *TreeEnsemble) unmarshalXGBoostDump(data []byte) error {
+	var dump []json.RawMessage
+	if err := json.Unmarshal(data, &dump); err != nil {
+		return err
+	}
+	*e = TreeEnsemble{Trees: make([]TreeNode, len(dump))}
+	for i, tree := range dump {
+		if tree = bytes.TrimSpace(tree); len(tree) > 0 && tree[0] == '"' {
+			var treeString string
+			if err := json.Unmarshal(tree, &treeString); err != nil {
+				return fmt.Errorf("tree %d: %v", i, err)
+			}
+			tree = []byte(treeString)
+		}
+		if err := json.Unmarshal(tree, &e.Trees[i]); err != nil {
+			return fmt.Errorf("tree %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// validate checks that every split of the trees has its children and refers to a valid feature
+func (e *TreeEnsemble) validate() error {
+	if len(e.Trees) == 0 {
+		return fmt.Errorf("tree ensemble has no tree")
+	}
+	for i := range e.Trees {
+		if err := e.validateNode(&e.Trees[i]); err != nil {
+			return fmt.Errorf("tree %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+func (e *TreeEnsemble) validateNode(n *TreeNode) error {
+	switch {
+	case n.Leaf != nil || n.LeafValue != nil:
+		return nil
+	case n.SplitFeature != nil:
+		if *n.SplitFeature < 0 || *n.SplitFeature >= len(e.FeatureNames) {
+			return fmt.Errorf("split on feature %d out of the %d feature names", *n.SplitFeature, len(e.FeatureNames))
+		}
+		if n.LeftChild == nil || n.RightChild == nil {
+			return fmt.Errorf("split on feature %d without two children", *n.SplitFeature)
+		}
+		if err := e.validateNode(n.LeftChild); err != nil {
+			return err
+		}
+		return e.validateNode(n.RightChild)
+	case n.Split != "":
+		if index, isIndex := featureIndex(n.Split); isIndex && index < 0 {
+			return fmt.Errorf("node %d splits on the negative feature index %s", n.NodeID, n.Split)
+		}
+		if n.child(n.Yes) == nil || n.child(n.No) == nil {
+			return fmt.Errorf("node %d splits on %s without the children %d and %d", n.NodeID, n.Split, n.Yes, n.No)
+		}
+		for i := range n.Children {
+			if err := e.validateNode(&n.Children[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("node %d is neither a split nor a leaf", n.NodeID)
+}
+
+// child returns the XGBoost child node with the id
+func (n *TreeNode) child(nodeID int) *TreeNode {
+	for i := range n.Children {
+		if n.Children[i].NodeID == nodeID {
+			return &n.Children[i]
+		}
+	}
+	return nil
+}
+
+// featureIndex returns the index of a split feature given by index, e.g. f0
+func featureIndex(split string) (int, bool) {
+	if !strings.HasPrefix(split, "f") {
+		return 0, false
+	}
+	index, err := strconv.Atoi(split[1:])
+	return index, err == nil
+}
+
+// featureName resolves the feature of a split given by name or by index, e.g. f0
+func (e *TreeEnsemble) featureName(split string) string {
+	if index, isIndex := featureIndex(split); isIndex && index >= 0 && index < len(e.FeatureNames) {
+		return e.FeatureNames[index]
+	}
+	return split
+}
+
+func (e *TreeEnsemble) addFeatures(set map[string]bool) {
+	for i := range e.Trees {
+		e.addTreeFeatures(&e.Trees[i], set)
+	}
+}
+
+func (e *TreeEnsemble) addTreeFeatures(n *TreeNode, set map[string]bool) {
+	switch {
+	case n.SplitFeature != nil:
+		if *n.SplitFeature >= 0 && *n.SplitFeature < len(e.FeatureNames) {
+			set[e.FeatureNames[*n.SplitFeature]] = true
+		}
+	case n.Split != "":
+		set[e.featureName(n.Split)] = true
+	}
+	if n.LeftChild != nil {
+		e.addTreeFeatures(n.LeftChild, set)
+	}
+	if n.RightChild != nil {
+		e.addTreeFeatures(n.RightChild, set)
+	}
+	for i := range n.Children {
+		e.addTreeFeatures(&n.Children[i], set)
+	}
+}
+
+// evaluate returns the prediction of the ensemble, the features missing in the values follow the default direction of the splits
+func (e *TreeEnsemble) evaluate(values map[string]float64) float64 {
+	prediction := e.BaseScore
+	for i := range e.Trees {
+		prediction += e.evaluateTree(&e.Trees[i], values)
+	}
+	return prediction
+}
+
+func (e *TreeEnsemble) evaluateTree(n *TreeNode, values map[string]float64) float64 {
+	for {
+		switch {
+		case n.Leaf != nil:
+			return *n.Leaf
+		case n.LeafValue != nil:
+			return *n.LeafValue
+		case n.SplitFeature != nil:
+			name := ""
+			if *n.SplitFeature >= 0 && *n.SplitFeature < len(e.FeatureNames) {
+				name = e.FeatureNames[*n.SplitFeature]
+			}
+			value, found := values[name]
+			missing := !found || math.IsNaN(value)
+			switch n.MissingType {
+			case "None":
+				// LightGBM compares the missing values as 0
+				if missing {
+					value, missing = 0, false
+				}
+			case "Zero":
+				missing = missing || value == 0
+			}
+			if missing {
+				if n.DefaultLeft {
+					n = n.LeftChild
+				} else {
+					n = n.RightChild
+				}
+			} else if lightGBMGoesLeft(n.DecisionType, value, n.Threshold) {
+				n = n.LeftChild
+			} else {
+				n = n.RightChild
+			}
+		default:
+			value, found := values[e.featureName(n.Split)]
+			nextID := n.No
+			if !found || math.IsNaN(value) {
+				if n.Missing != nil {
+					nextID = *n.Missing
+				}
+			} else if value < n.SplitCondition {
+				nextID = n.Yes
+			}
+			n = n.child(nextID)
+		}
+		if n == nil {
+			// the trees are validated when loaded
+			return 0
+		}
+	}
+}
+
+// lightGBMGoesLeft compares the value with the threshold of a numerical LightGBM split
+func lightGBMGoesLeft(decisionType string, value, threshold float64) bool {
+	switch decisionType {
+	case "<":
+		return value < threshold
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "==":
+		return value == threshold
+	}
+	return value <= threshold
+}
@@ -17,40 +17,70 @@ limitations under the License.
 /*
 estimate.go
 estimate (node/pod) component and total power by calling Kepler estimator sidecar when it is available.
+
+The estimator sidecar listens on a Unix socket. Each message is a JSON document prefixed by its length as a 4-byte big-endian
+unsigned integer, in both directions. The connection is kept open and requests are sent one at a time, each one waits
+for its response. A request carries one record per usage vector (a node or a container), identified by a key, e.g. the container ID.
+The response returns the powers by the same keys, so the results do not depend on the order of the records.
+Both messages carry the protocol version, a response of another version or an unframed response of an older sidecar is an error.
 */
 
 package sidecar
 
 import (
+	"bufio"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/sustainable-computing-io/kepler/pkg/model/types"
 	"k8s.io/klog/v2"
 )
 
+const (
+	// maxMessageSize bounds the size of a message to not allocate an arbitrary buffer on a corrupted length prefix
+	maxMessageSize = 64 << 20
+	// defaultTimeout bounds a request, from writing it to reading its response, if the connector has no timeout
+	defaultTimeout = 5 * time.Second
+	// protocolVersion is the version of the framed and keyed protocol
+	protocolVersion = 1
+)
+
+// UsageRecord is the usage vector of a node or of a container, identified by its key
+type UsageRecord struct {
+	Key    string    `json:"key"`
+	Values []float64 `json:"values"`
+}
+
 // PowerRequest defines a request to Kepler Estimator to get estimated powers
 type PowerRequest struct {
-	UsageMetrics   []string    `json:"metrics"`
-	UsageValues    [][]float64 `json:"values"`
-	OutputType     string      `json:"output_type"`
-	SystemFeatures []string    `json:"system_features"`
-	SystemValues   []string    `json:"system_values"`
-	ModelName      string      `json:"model_name"`
-	SelectFilter   string      `json:"filter"`
+	Version        int           `json:"version"`
+	UsageMetrics   []string      `json:"metrics"`
+	Records        []UsageRecord `json:"records"`
+	OutputType     string        `json:"output_type"`
+	SystemFeatures []string      `json:"system_features"`
+	SystemValues   []string      `json:"system_values"`
+	ModelName      string        `json:"model_name"`
+	SelectFilter   string        `json:"filter"`
 }
 
-// TotalPowerResponse defines a response of a list of total powers from Kepler Estimator
-type TotalPowerResponse struct {
-	Powers  []float64 `json:"powers"`
-	Message string    `json:"msg"`
+// PowerRecord is the estimated power of a record of the request, the total power or the power of each component according to the output type
+type PowerRecord struct {
+	Key        string             `json:"key"`
+	Power      float64            `json:"power,omitempty"`
+	Components map[string]float64 `json:"components,omitempty"`
 }
 
-// ComponentPowerResponse defines a response of a map of component powers from Kepler Estimator
-type ComponentPowerResponse struct {
-	Powers  map[string][]float64 `json:"powers"`
-	Message string               `json:"msg"`
+// PowerResponse defines a response of the estimated powers by the keys of the request records from Kepler Estimator
+type PowerResponse struct {
+	Version int           `json:"version"`
+	Records []PowerRecord `json:"records"`
+	Message string        `json:"msg"`
 }
 
 // EstimatorSidecarConnector defines power estimator with Kepler Estimator sidecar
@@ -61,8 +91,34 @@ type EstimatorSidecarConnector struct {
 	SystemFeatures []string
 	ModelName      string
 	SelectFilter   string
-	valid          bool
-	isComponent    bool
+	// Timeout bounds each request to the sidecar
+	Timeout     time.Duration
+	valid       bool
+	isComponent bool
+}
+
+// sidecarClient holds the persistent connection to a sidecar socket, shared by the connectors of all output types
+type sidecarClient struct {
+	socket string
+	conn   net.Conn
+	reader *bufio.Reader
+	lock   sync.Mutex
+}
+
+var (
+	clients     = map[string]*sidecarClient{}
+	clientsLock sync.Mutex
+)
+
+func getClient(socket string) *sidecarClient {
+	clientsLock.Lock()
+	defer clientsLock.Unlock()
+	client, ok := clients[socket]
+	if !ok {
+		client = &sidecarClient{socket: socket}
+		clients[socket] = client
+	}
+	return client
 }
 
 // Init returns valid if estimator is connected and has compatible power model
@@ -70,21 +126,36 @@ func (c *EstimatorSidecarConnector) Init(systemValues []string) bool {
 	zeros := make([]float64, len(c.UsageMetrics))
 	usageValues := [][]float64{zeros}
 	c.isComponent = types.IsComponentType(c.OutputType)
-	_, err := c.makeRequest(usageValues, systemValues)
+	_, err := c.makeRequest(toUsageRecords(nil, usageValues), systemValues)
 	if err == nil {
 		c.valid = true
 	} else {
+		klog.V(3).Infof("cannot init the estimator sidecar for %s: %v", c.OutputType.String(), err)
 		c.valid = false
 	}
 	return c.valid
 }
 
-// makeRequest makes a request to Kepler Estimator Sidecar to apply archived model and get predicted powers
-func (c *EstimatorSidecarConnector) makeRequest(usageValues [][]float64, systemValues []string) (interface{}, error) {
+// toUsageRecords keys the usage vectors by the keys in the same order, e.g. the container IDs, or by their index without keys
+func toUsageRecords(keys []string, usageValues [][]float64) []UsageRecord {
+	records := make([]UsageRecord, len(usageValues))
+	for i, values := range usageValues {
+		key := strconv.Itoa(i)
+		if i < len(keys) {
+			key = keys[i]
+		}
+		records[i] = UsageRecord{Key: key, Values: values}
+	}
+	return records
+}
+
+// makeRequest makes a request to Kepler Estimator Sidecar to apply archived model and get predicted powers by the record keys
+func (c *EstimatorSidecarConnector) makeRequest(records []UsageRecord, systemValues []string) (map[string]PowerRecord, error) {
 	powerRequest := PowerRequest{
+		Version:        protocolVersion,
 		ModelName:      c.ModelName,
 		UsageMetrics:   c.UsageMetrics,
-		UsageValues:    usageValues,
+		Records:        records,
 		OutputType:     c.OutputType.String(),
 		SystemFeatures: c.SystemFeatures,
 		SystemValues:   systemValues,
@@ -92,66 +163,152 @@ func (c *EstimatorSidecarConnector) makeRequest(usageValues [][]float64, systemV
 	}
 	powerRequestJSON, err := json.Marshal(powerRequest)
 	if err != nil {
-		klog.V(4).Infof("marshal error: %v (%v)", err, powerRequest)
-		return nil, err
+		return nil, fmt.Errorf("marshal error: %v", err)
 	}
-
-	conn, err := net.Dial("unix", c.Socket)
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	data, err := getClient(c.Socket).call(powerRequestJSON, timeout)
 	if err != nil {
-		klog.V(4).Infof("dial error: %v", err)
 		return nil, err
 	}
-	defer conn.Close()
+	var powerResponse PowerResponse
+	if err = json.Unmarshal(data, &powerResponse); err != nil {
+		return nil, fmt.Errorf("estimator unmarshal error: %v", err)
+	}
+	if powerResponse.Version != protocolVersion {
+		return nil, fmt.Errorf("estimator protocol version %d is not supported, expected %d: %s", powerResponse.Version, protocolVersion, powerResponse.Message)
+	}
+	powers := make(map[string]PowerRecord, len(powerResponse.Records))
+	for _, record := range powerResponse.Records {
+		powers[record.Key] = record
+	}
+	for _, record := range records {
+		if _, ok := powers[record.Key]; !ok {
+			return nil, fmt.Errorf("estimator response has no power of %q: %s", record.Key, powerResponse.Message)
+		}
+	}
+	return powers, nil
+}
 
-	_, err = conn.Write(powerRequestJSON)
+// call sends the request on the persistent connection and returns the response, the request is sent again on a new connection
+// if the connection was closed by the sidecar, e.g. when it restarted
+func (s *sidecarClient) call(request []byte, timeout time.Duration) ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	reused := s.conn != nil
+	response, err := s.roundTrip(request, timeout)
+	if err != nil && reused {
+		klog.V(4).Infof("estimator connection error: %v, reconnecting", err)
+		response, err = s.roundTrip(request, timeout)
+	}
+	return response, err
+}
 
+func (s *sidecarClient) roundTrip(request []byte, timeout time.Duration) ([]byte, error) {
+	if s.conn == nil {
+		conn, err := net.DialTimeout("unix", s.socket, timeout)
+		if err != nil {
+			return nil, fmt.Errorf("dial error: %v", err)
+		}
+		s.conn = conn
+		s.reader = bufio.NewReader(conn)
+	}
+	response, err := s.exchange(request, timeout)
 	if err != nil {
-		klog.V(4).Infof("estimator write error: %v", err)
+		// the state of the stream is unknown after an error, e.g. a timeout in the middle of a response
+		s.conn.Close()
+		s.conn = nil
+		s.reader = nil
+	}
+	return response, err
+}
+
+func (s *sidecarClient) exchange(request []byte, timeout time.Duration) ([]byte, error) {
+	if err := s.conn.SetDeadline(time.Now().Add(timeout)); err != nil {
 		return nil, err
 	}
-	buf := make([]byte, 4096)
-	n, err := conn.Read(buf)
+	if err := writeMessage(s.conn, request); err != nil {
+		return nil, fmt.Errorf("estimator write error: %v", err)
+	}
+	response, err := readMessage(s.reader)
 	if err != nil {
-		klog.V(4).Infof("estimator read error: %v", err)
+		return nil, fmt.Errorf("estimator read error: %v", err)
+	}
+	return response, nil
+}
+
+// writeMessage writes the length prefix and the message
+func writeMessage(w io.Writer, message []byte) error {
+	if len(message) > maxMessageSize {
+		return fmt.Errorf("message of %d bytes exceeds the maximum size %d", len(message), maxMessageSize)
+	}
+	frame := make([]byte, 4+len(message))
+	binary.BigEndian.PutUint32(frame, uint32(len(message)))
+	copy(frame[4:], message)
+	_, err := w.Write(frame)
+	return err
+}
+
+// readMessage reads a length-prefixed message
+func readMessage(r io.Reader) ([]byte, error) {
+	var prefix [4]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
 		return nil, err
 	}
-	var powers interface{}
-	if c.isComponent {
-		var powerResponse ComponentPowerResponse
-		err = json.Unmarshal(buf[0:n], &powerResponse)
-		powers = powerResponse.Powers
-	} else {
-		var powerResponse TotalPowerResponse
-		err = json.Unmarshal(buf[0:n], &powerResponse)
-		powers = powerResponse.Powers
+	if prefix[0] == '{' || prefix[0] == '[' {
+		// an older sidecar writes the JSON document without the length prefix
+		return nil, fmt.Errorf("unframed message, the estimator does not use the protocol version %d", protocolVersion)
 	}
-	if err != nil {
-		klog.V(4).Info("estimator unmarshal error: %v (%s)", err, string(buf[0:n]))
+	size := binary.BigEndian.Uint32(prefix[:])
+	if size > maxMessageSize {
+		return nil, fmt.Errorf("message of %d bytes exceeds the maximum size %d", size, maxMessageSize)
+	}
+	message := make([]byte, size)
+	if _, err := io.ReadFull(r, message); err != nil {
 		return nil, err
 	}
-	return powers, nil
+	return message, nil
 }
 
-// GetTotalPower makes a request to Kepler Estimator Sidecar and returns a list of total powers
-func (c *EstimatorSidecarConnector) GetTotalPower(usageValues [][]float64, systemValues []string) ([]float64, error) {
+// GetTotalPower makes a request to Kepler Estimator Sidecar and returns a list of total powers in the order of the usage values.
+// The records are keyed by the keys, e.g. the container IDs, or by their index if keys is nil.
+func (c *EstimatorSidecarConnector) GetTotalPower(keys []string, usageValues [][]float64, systemValues []string) ([]float64, error) {
 	if !c.valid {
 		return []float64{}, fmt.Errorf("invalid power model call: %s", c.OutputType.String())
 	}
-	powers, err := c.makeRequest(usageValues, systemValues)
+	records := toUsageRecords(keys, usageValues)
+	powers, err := c.makeRequest(records, systemValues)
 	if err != nil {
 		return []float64{}, err
 	}
-	return powers.([]float64), err
+	totalPowers := make([]float64, len(records))
+	for i, record := range records {
+		totalPowers[i] = powers[record.Key].Power
+	}
+	return totalPowers, nil
 }
 
-// GetComponentPower makes a request to Kepler Estimator Sidecar and return a list of total powers
-func (c *EstimatorSidecarConnector) GetComponentPower(usageValues [][]float64, systemValues []string) (map[string][]float64, error) {
+// GetComponentPower makes a request to Kepler Estimator Sidecar and return a map of component powers in the order of the usage values.
+// The records are keyed by the keys, e.g. the container IDs, or by their index if keys is nil.
+func (c *EstimatorSidecarConnector) GetComponentPower(keys []string, usageValues [][]float64, systemValues []string) (map[string][]float64, error) {
 	if !c.valid {
 		return map[string][]float64{}, fmt.Errorf("invalid power model call: %s", c.OutputType.String())
 	}
-	powers, err := c.makeRequest(usageValues, systemValues)
+	records := toUsageRecords(keys, usageValues)
+	powers, err := c.makeRequest(records, systemValues)
 	if err != nil {
 		return map[string][]float64{}, err
 	}
-	return powers.(map[string][]float64), err
+	componentPowers := map[string][]float64{}
+	for i, record := range records {
+		for component, power := range powers[record.Key].Components {
+			if _, ok := componentPowers[component]; !ok {
+				componentPowers[component] = make([]float64, len(records))
+			}
+			componentPowers[component][i] = power
+		}
+	}
+	return componentPowers, nil
 }
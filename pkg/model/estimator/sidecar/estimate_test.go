@@ -17,11 +17,13 @@ limitations under the License.
 package sidecar
 
 import (
+	"bufio"
 	"encoding/json"
 	"fmt"
 	"net"
 	"os"
 	"strings"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -35,10 +37,14 @@ var (
 	systemFeatures = []string{"cpu_architecture"}
 	usageValues    = [][]float64{{1, 1, 1, 1, 1, 1, 1, 1, 1, 1}, {1, 1, 1, 1, 1, 1, 1, 1, 1, 1}}
 	nodeUsageValue = usageValues[0]
+	containerIDs   = []string{"containerA", "containerB"}
 	systemValues   = []string{"Sandy Bridge"}
 )
 
-func dummyEstimator(serveSocket string, start, quit chan bool) {
+// dummyEstimator serves the framed protocol, the power of a record is SampleDynPowerValue plus its first value minus one
+// and the records are returned in the reverse order. It closes the connection after each response if closeAfterResponse
+// and waits for the delay before responding.
+func dummyEstimator(serveSocket string, start, quit chan bool, closeAfterResponse bool, delay time.Duration) {
 	cleanup := func() {
 		if _, err := os.Stat(serveSocket); err == nil {
 			if err := os.RemoveAll(serveSocket); err != nil {
@@ -56,6 +62,7 @@ func dummyEstimator(serveSocket string, start, quit chan bool) {
 
 	go func() {
 		<-quit
+		listener.Close()
 		cleanup()
 	}()
 
@@ -67,45 +74,82 @@ func dummyEstimator(serveSocket string, start, quit chan bool) {
 			fmt.Printf("Close dummy estimator %v\n", err)
 			break
 		}
-		buf := make([]byte, 4096)
-		n, err := conn.Read(buf)
+		go serveEstimatorConn(conn, closeAfterResponse, delay)
+	}
+}
+
+func serveEstimatorConn(conn net.Conn, closeAfterResponse bool, delay time.Duration) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		request, err := readMessage(reader)
 		if err != nil {
-			panic(err)
+			return
 		}
 		var powerRequest PowerRequest
-		err = json.Unmarshal(buf[0:n], &powerRequest)
+		err = json.Unmarshal(request, &powerRequest)
 		if err != nil {
 			panic(err)
 		}
-		fmt.Printf("%v\n", powerRequest)
-		powers := make([]float64, len(powerRequest.UsageValues))
-		powers[0] = SampleDynPowerValue
-		msg := ""
-		var powerResponseJSON []byte
-		if strings.Contains(powerRequest.OutputType, "Component") {
-			powerResponse := ComponentPowerResponse{
-				Powers:  map[string][]float64{"pkg": powers},
-				Message: msg,
-			}
-			powerResponseJSON, err = json.Marshal(powerResponse)
-		} else {
-			powerResponse := TotalPowerResponse{
-				Powers:  powers,
-				Message: msg,
+		powerResponse := PowerResponse{Version: powerRequest.Version}
+		for i := len(powerRequest.Records) - 1; i >= 0; i-- {
+			record := powerRequest.Records[i]
+			power := SampleDynPowerValue + record.Values[0] - 1
+			if strings.Contains(powerRequest.OutputType, "Component") {
+				powerResponse.Records = append(powerResponse.Records, PowerRecord{Key: record.Key, Components: map[string]float64{"pkg": power}})
+			} else {
+				powerResponse.Records = append(powerResponse.Records, PowerRecord{Key: record.Key, Power: power})
 			}
-			powerResponseJSON, err = json.Marshal(powerResponse)
 		}
+		powerResponseJSON, err := json.Marshal(powerResponse)
 		if err != nil {
 			panic(err)
 		}
-		_, err = conn.Write(powerResponseJSON)
-		if err != nil {
-			panic(err)
+		time.Sleep(delay)
+		if err = writeMessage(conn, powerResponseJSON); err != nil {
+			return
+		}
+		if closeAfterResponse {
+			return
 		}
-		conn.Close()
 	}
 }
 
+// fixedEstimator answers each request with the response, it is written without the length prefix if unframed
+func fixedEstimator(serveSocket string, response []byte, unframed bool) net.Listener {
+	_ = os.RemoveAll(serveSocket)
+	listener, err := net.Listen("unix", serveSocket)
+	if err != nil {
+		panic(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				for {
+					if _, err := readMessage(reader); err != nil {
+						return
+					}
+					if unframed {
+						_, err = conn.Write(response)
+					} else {
+						err = writeMessage(conn, response)
+					}
+					if err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return listener
+}
+
 func genEstimatorSidecarConnector(serveSocket string, outputType types.ModelOutputType) EstimatorSidecarConnector {
 	return EstimatorSidecarConnector{
 		Socket:         serveSocket,
@@ -122,13 +166,13 @@ var _ = Describe("Test Estimate Unit", func() {
 		quit := make(chan bool)
 		defer close(quit)
 		defer close(start)
-		go dummyEstimator(serveSocket, start, quit)
+		go dummyEstimator(serveSocket, start, quit, false, 0)
 		<-start
 
 		c := genEstimatorSidecarConnector(serveSocket, types.AbsPower)
 		valid := c.Init(systemValues)
 		Expect(valid).To(Equal(true))
-		powers, err := c.GetTotalPower([][]float64{nodeUsageValue}, systemValues)
+		powers, err := c.GetTotalPower(nil, [][]float64{nodeUsageValue}, systemValues)
 		Expect(err).NotTo(HaveOccurred())
 		Expect(len(powers)).Should(Equal(1))
 		Expect(powers[0]).Should(Equal(SampleDynPowerValue))
@@ -140,13 +184,13 @@ var _ = Describe("Test Estimate Unit", func() {
 		quit := make(chan bool)
 		defer close(quit)
 		defer close(start)
-		go dummyEstimator(serveSocket, start, quit)
+		go dummyEstimator(serveSocket, start, quit, false, 0)
 		<-start
 
 		c := genEstimatorSidecarConnector(serveSocket, types.DynPower)
 		valid := c.Init(systemValues)
 		Expect(valid).To(Equal(true))
-		powers, err := c.GetTotalPower(usageValues, systemValues)
+		powers, err := c.GetTotalPower(containerIDs, usageValues, systemValues)
 		Expect(err).NotTo(HaveOccurred())
 		Expect(len(powers)).Should(Equal(len(usageValues)))
 		Expect(powers[0]).Should(Equal(SampleDynPowerValue))
@@ -158,13 +202,13 @@ var _ = Describe("Test Estimate Unit", func() {
 		quit := make(chan bool)
 		defer close(quit)
 		defer close(start)
-		go dummyEstimator(serveSocket, start, quit)
+		go dummyEstimator(serveSocket, start, quit, false, 0)
 		<-start
 
 		c := genEstimatorSidecarConnector(serveSocket, types.AbsComponentPower)
 		valid := c.Init(systemValues)
 		Expect(valid).To(Equal(true))
-		powers, err := c.GetComponentPower([][]float64{nodeUsageValue}, systemValues)
+		powers, err := c.GetComponentPower(nil, [][]float64{nodeUsageValue}, systemValues)
 		Expect(err).NotTo(HaveOccurred())
 		pkgPowers, ok := powers["pkg"]
 		Expect(ok).To(Equal(true))
@@ -178,13 +222,13 @@ var _ = Describe("Test Estimate Unit", func() {
 		quit := make(chan bool)
 		defer close(quit)
 		defer close(start)
-		go dummyEstimator(serveSocket, start, quit)
+		go dummyEstimator(serveSocket, start, quit, false, 0)
 		<-start
 
 		c := genEstimatorSidecarConnector(serveSocket, types.DynComponentPower)
 		valid := c.Init(systemValues)
 		Expect(valid).To(Equal(true))
-		powers, err := c.GetComponentPower(usageValues, systemValues)
+		powers, err := c.GetComponentPower(containerIDs, usageValues, systemValues)
 		Expect(err).NotTo(HaveOccurred())
 		pkgPowers, ok := powers["pkg"]
 		Expect(ok).To(Equal(true))
@@ -192,4 +236,92 @@ var _ = Describe("Test Estimate Unit", func() {
 		Expect(pkgPowers[0]).Should(Equal(SampleDynPowerValue))
 		quit <- true
 	})
+	It("GetPodTotalPowerByEstimator with a large response in the order of the request", func() {
+		serveSocket := "/tmp/pod-total-power-large.sock"
+		start := make(chan bool)
+		quit := make(chan bool)
+		defer close(quit)
+		defer close(start)
+		go dummyEstimator(serveSocket, start, quit, false, 0)
+		<-start
+
+		c := genEstimatorSidecarConnector(serveSocket, types.DynPower)
+		Expect(c.Init(systemValues)).To(Equal(true))
+		// the response is much larger than a single read buffer
+		manyUsageValues := make([][]float64, 1000)
+		for i := range manyUsageValues {
+			manyUsageValues[i] = make([]float64, len(usageMetrics))
+			manyUsageValues[i][0] = float64(i + 1)
+		}
+		powers, err := c.GetTotalPower(nil, manyUsageValues, systemValues)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(len(powers)).Should(Equal(len(manyUsageValues)))
+		for i, power := range powers {
+			Expect(power).Should(Equal(SampleDynPowerValue + float64(i)))
+		}
+		quit <- true
+	})
+	It("GetPodTotalPowerByEstimator reconnects when the estimator closed the connection", func() {
+		serveSocket := "/tmp/pod-total-power-reconnect.sock"
+		start := make(chan bool)
+		quit := make(chan bool)
+		defer close(quit)
+		defer close(start)
+		go dummyEstimator(serveSocket, start, quit, true, 0)
+		<-start
+
+		c := genEstimatorSidecarConnector(serveSocket, types.DynPower)
+		Expect(c.Init(systemValues)).To(Equal(true))
+		for i := 0; i < 3; i++ {
+			powers, err := c.GetTotalPower(containerIDs, usageValues, systemValues)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(powers).Should(Equal([]float64{SampleDynPowerValue, SampleDynPowerValue}))
+		}
+		quit <- true
+	})
+	It("GetPodTotalPowerByEstimator times out", func() {
+		serveSocket := "/tmp/pod-total-power-timeout.sock"
+		start := make(chan bool)
+		quit := make(chan bool)
+		defer close(quit)
+		defer close(start)
+		go dummyEstimator(serveSocket, start, quit, false, 200*time.Millisecond)
+		<-start
+
+		c := genEstimatorSidecarConnector(serveSocket, types.DynPower)
+		c.Timeout = 50 * time.Millisecond
+		Expect(c.Init(systemValues)).To(Equal(false))
+		quit <- true
+	})
+	It("GetPodTotalPowerByEstimator keys the records by the container IDs", func() {
+		serveSocket := "/tmp/pod-total-power-keys.sock"
+		response := `{"version": 1, "records": [{"key": "containerB", "power": 20}, {"key": "containerA", "power": 10}]}`
+		listener := fixedEstimator(serveSocket, []byte(response), false)
+		defer listener.Close()
+
+		c := genEstimatorSidecarConnector(serveSocket, types.DynPower)
+		c.valid = true
+		powers, err := c.GetTotalPower(containerIDs, usageValues, systemValues)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(powers).Should(Equal([]float64{10, 20}))
+		// the response has no power of the records keyed by their index
+		_, err = c.GetTotalPower(nil, usageValues, systemValues)
+		Expect(err).To(HaveOccurred())
+	})
+	It("GetPodTotalPowerByEstimator rejects the responses of another protocol", func() {
+		serveSocket := "/tmp/pod-total-power-version.sock"
+		listener := fixedEstimator(serveSocket, []byte(`{"records": [{"key": "0", "power": 10}]}`), false)
+		c := genEstimatorSidecarConnector(serveSocket, types.DynPower)
+		Expect(c.Init(systemValues)).To(Equal(false))
+		listener.Close()
+
+		// an older sidecar answers without the length prefix
+		serveSocket = "/tmp/pod-total-power-unframed.sock"
+		listener = fixedEstimator(serveSocket, []byte(`{"powers": [10], "msg": ""}`), true)
+		defer listener.Close()
+		c = genEstimatorSidecarConnector(serveSocket, types.DynPower)
+		c.valid = true
+		_, err := c.GetTotalPower(nil, usageValues, systemValues)
+		Expect(err).To(MatchError(ContainSubstring("unframed")))
+	})
 })
@@ -17,9 +17,16 @@ limitations under the License.
 package model
 
 import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sustainable-computing-io/kepler/pkg/config"
 	"github.com/sustainable-computing-io/kepler/pkg/model/estimator/local"
 	"github.com/sustainable-computing-io/kepler/pkg/model/estimator/sidecar"
 	"github.com/sustainable-computing-io/kepler/pkg/model/types"
+	"k8s.io/klog/v2"
 )
 
 var (
@@ -27,17 +34,55 @@ var (
 
 	// TODO: be configured by config package
 	modelServerEndpoint = "http://kepler-model-server.monitoring.cluster.local:8100/model"
+
+	// modelStatuses holds the status of each power model estimator, keyed by the power output type
+	modelStatuses     = map[string]types.ModelStatus{}
+	modelStatusesLock sync.RWMutex
+
+	// estimatorLock guards the valid flags and the estimate functions of the power models, which are swapped when the models are refreshed
+	estimatorLock sync.RWMutex
 )
 
-// InitEstimateFunctions checks validity of power model and set estimate functions
+// InitEstimateFunctions checks validity of power model and set estimate functions.
+// The failed model requests are not retried to not block the start, StartModelRefresh reloads the models that failed to load.
 func InitEstimateFunctions(usageMetrics, systemFeatures, systemValues []string) {
-	InitNodeTotalPowerEstimator(usageMetrics, systemFeatures, systemValues)
-	InitNodeComponentPowerEstimator(usageMetrics, systemFeatures, systemValues)
-	InitContainerPowerEstimator(usageMetrics, systemFeatures, systemValues)
+	loadEstimateFunctions(0, usageMetrics, systemFeatures, systemValues)
+}
+
+// loadEstimateFunctions loads the power models, a failed model request is retried up to retries times
+func loadEstimateFunctions(retries int, usageMetrics, systemFeatures, systemValues []string) {
+	InitNodeTotalPowerEstimator(usageMetrics, systemFeatures, systemValues, retries)
+	InitNodeComponentPowerEstimator(usageMetrics, systemFeatures, systemValues, retries)
+	InitContainerPowerEstimator(usageMetrics, systemFeatures, systemValues, retries)
+}
+
+// StartModelRefresh reloads the power models in the background, a power model keeps its estimator until a valid one is loaded.
+// The models that failed to load at start are reloaded at once with retries, it recovers the power models whose model server was
+// unreachable at start. Then the models are reloaded every interval to pick up the improved models, 0 disables the periodic refresh.
+func StartModelRefresh(interval time.Duration, usageMetrics, systemFeatures, systemValues []string) {
+	failedAtStart := hasInvalidModel()
+	if !failedAtStart && interval <= 0 {
+		return
+	}
+	go func() {
+		if failedAtStart {
+			klog.V(3).Infof("reloading the power models that failed to load")
+			loadEstimateFunctions(config.ModelServerRetries, usageMetrics, systemFeatures, systemValues)
+		}
+		if interval <= 0 {
+			return
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			klog.V(3).Infof("refreshing the power models")
+			loadEstimateFunctions(config.ModelServerRetries, usageMetrics, systemFeatures, systemValues)
+		}
+	}()
 }
 
 // initEstimateFunction called by InitEstimateFunctions to initiate estimate function for each power model
-func initEstimateFunction(modelConfig types.ModelConfig, archiveType, modelWeightType types.ModelOutputType, usageMetrics, systemFeatures, systemValues []string, isTotalPower bool) (valid bool, estimateFunc interface{}) {
+func initEstimateFunction(modelConfig types.ModelConfig, archiveType, modelWeightType types.ModelOutputType, usageMetrics, systemFeatures, systemValues []string, isTotalPower bool, retries int) (valid bool, estimateFunc interface{}) {
 	if modelConfig.UseEstimatorSidecar {
 		// try init EstimatorSidecarConnector
 		c := sidecar.EstimatorSidecarConnector{
@@ -47,9 +92,11 @@ func initEstimateFunction(modelConfig types.ModelConfig, archiveType, modelWeigh
 			SystemFeatures: systemFeatures,
 			ModelName:      modelConfig.SelectedModel,
 			SelectFilter:   modelConfig.SelectFilter,
+			Timeout:        config.EstimatorSidecarTimeout,
 		}
 		valid = c.Init(systemValues)
 		if valid {
+			setModelStatus(archiveType, true, types.ModelInfo{EstimatorType: types.SidecarEstimator, Name: modelConfig.SelectedModel, Source: EstimatorSidecarSocket}, types.FeatureStatus{}, nil)
 			if isTotalPower {
 				estimateFunc = c.GetTotalPower
 			} else {
@@ -60,6 +107,34 @@ func initEstimateFunction(modelConfig types.ModelConfig, archiveType, modelWeigh
 	}
 	// set UseEstimatorSidecar to false as cannot init valid EstimatorSidecarConnector
 	modelConfig.UseEstimatorSidecar = false
+	if modelConfig.EstimatorType == "" {
+		modelConfig.EstimatorType = config.EstimatorType
+	}
+	if modelConfig.EstimatorType != types.LinearRegressorEstimator {
+		// try init NonLinearRegressor of the estimator type
+		r := local.NonLinearRegressor{
+			EstimatorType:  modelConfig.EstimatorType,
+			Endpoint:       modelServerEndpoint,
+			UsageMetrics:   usageMetrics,
+			OutputType:     modelWeightType,
+			SystemFeatures: systemFeatures,
+			ModelName:      modelConfig.SelectedModel,
+			SelectFilter:   modelConfig.SelectFilter,
+			InitModelURL:   modelConfig.InitModelURL,
+			Retries:        retries,
+		}
+		valid = r.Init()
+		if valid {
+			setModelStatus(archiveType, true, r.ModelInfo, r.FeatureStatus, nil)
+			if isTotalPower {
+				estimateFunc = totalPowerFuncWithKeys(r.GetTotalPower)
+			} else {
+				estimateFunc = componentPowerFuncWithKeys(r.GetComponentPower)
+			}
+			return
+		}
+		klog.V(3).Infof("cannot init %s model (%s): %v, fall back to LinearRegressor", modelConfig.EstimatorType, modelWeightType.String(), r.LoadError)
+	}
 	// try init LinearRegressor
 	r := local.LinearRegressor{
 		Endpoint:       modelServerEndpoint,
@@ -69,12 +144,81 @@ func initEstimateFunction(modelConfig types.ModelConfig, archiveType, modelWeigh
 		ModelName:      modelConfig.SelectedModel,
 		SelectFilter:   modelConfig.SelectFilter,
 		InitModelURL:   modelConfig.InitModelURL,
+		Retries:        retries,
 	}
 	valid = r.Init()
+	setModelStatus(archiveType, valid, r.ModelInfo, r.FeatureStatus, r.LoadError)
 	if isTotalPower {
-		estimateFunc = r.GetTotalPower
+		estimateFunc = totalPowerFuncWithKeys(r.GetTotalPower)
 	} else {
-		estimateFunc = r.GetComponentPower
+		estimateFunc = componentPowerFuncWithKeys(r.GetComponentPower)
 	}
 	return valid, estimateFunc
 }
+
+// totalPowerFuncWithKeys adapts the estimate function of a local estimator, it returns the powers in the order of the usage values
+// and does not need the keys of the values
+func totalPowerFuncWithKeys(estimate func([][]float64, []string) ([]float64, error)) func([]string, [][]float64, []string) ([]float64, error) {
+	return func(_ []string, usageValues [][]float64, systemValues []string) ([]float64, error) {
+		return estimate(usageValues, systemValues)
+	}
+}
+
+// componentPowerFuncWithKeys is totalPowerFuncWithKeys for the component powers
+func componentPowerFuncWithKeys(estimate func([][]float64, []string) (map[string][]float64, error)) func([]string, [][]float64, []string) (map[string][]float64, error) {
+	return func(_ []string, usageValues [][]float64, systemValues []string) (map[string][]float64, error) {
+		return estimate(usageValues, systemValues)
+	}
+}
+
+// setModelStatus records the result of a model load, a failed load keeps the previous model of the estimator
+func setModelStatus(archiveType types.ModelOutputType, valid bool, info types.ModelInfo, featureStatus types.FeatureStatus, err error) {
+	modelStatusesLock.Lock()
+	defer modelStatusesLock.Unlock()
+	status := modelStatuses[archiveType.String()]
+	prevMissingFeatures := status.MissingFeatures
+	status.OutputType = archiveType.String()
+	status.LastError = ""
+	if err != nil {
+		status.LastError = err.Error()
+	}
+	if valid {
+		if !status.Valid || status.Model != info {
+			klog.Infof("%s power model: %s %s (%s) loaded from %s, checksum %s", archiveType.String(), info.EstimatorType, info.Name, info.Version, info.Source, info.Checksum)
+		}
+		status.Valid = true
+		status.Model = info
+		status.FeatureStatus = featureStatus
+	} else if !status.Valid {
+		// show the features of the rejected model
+		status.FeatureStatus = featureStatus
+	}
+	if len(status.MissingFeatures) > 0 && strings.Join(status.MissingFeatures, ",") != strings.Join(prevMissingFeatures, ",") {
+		klog.Warningf("%s power model: features %v are not collected on the node, they are estimated as zero", archiveType.String(), status.MissingFeatures)
+	}
+	modelStatuses[archiveType.String()] = status
+}
+
+// hasInvalidModel returns true if a power model estimator failed to load a model
+func hasInvalidModel() bool {
+	modelStatusesLock.RLock()
+	defer modelStatusesLock.RUnlock()
+	for _, status := range modelStatuses {
+		if !status.Valid {
+			return true
+		}
+	}
+	return false
+}
+
+// GetModelStatuses returns the status of the power model estimators sorted by the power output type
+func GetModelStatuses() []types.ModelStatus {
+	modelStatusesLock.RLock()
+	defer modelStatusesLock.RUnlock()
+	statuses := make([]types.ModelStatus, 0, len(modelStatuses))
+	for _, status := range modelStatuses {
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].OutputType < statuses[j].OutputType })
+	return statuses
+}
@@ -17,9 +17,12 @@ limitations under the License.
 package model
 
 import (
+	"fmt"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	collector_metric "github.com/sustainable-computing-io/kepler/pkg/collector/metric"
+	"github.com/sustainable-computing-io/kepler/pkg/model/types"
 	"github.com/sustainable-computing-io/kepler/pkg/power/components/source"
 )
 
@@ -128,4 +131,24 @@ var _ = Describe("Test Model Unit", func() {
 		// The test is return 1323 for EnergyInPkg, dosen't matter the input
 		Expect(containersMetrics["containerA"].EnergyInPkg.Curr).ShouldNot(BeNil())
 	})
+
+	It("should report the power models that failed to load", func() {
+		modelStatusesLock.Lock()
+		saved := modelStatuses
+		modelStatuses = map[string]types.ModelStatus{}
+		modelStatusesLock.Unlock()
+		defer func() {
+			modelStatusesLock.Lock()
+			modelStatuses = saved
+			modelStatusesLock.Unlock()
+		}()
+
+		setModelStatus(types.AbsPower, true, types.ModelInfo{Name: "sample"}, types.FeatureStatus{}, nil)
+		Expect(hasInvalidModel()).To(BeFalse())
+		setModelStatus(types.DynPower, false, types.ModelInfo{}, types.FeatureStatus{}, fmt.Errorf("connection error"))
+		Expect(hasInvalidModel()).To(BeTrue())
+		// a later load recovers the model
+		setModelStatus(types.DynPower, true, types.ModelInfo{Name: "sample"}, types.FeatureStatus{}, nil)
+		Expect(hasInvalidModel()).To(BeFalse())
+	})
 })
@@ -17,30 +17,46 @@ limitations under the License.
 package model
 
 import (
+	"sync"
+
 	collector_metric "github.com/sustainable-computing-io/kepler/pkg/collector/metric"
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/model/estimator/local"
 	"github.com/sustainable-computing-io/kepler/pkg/model/types"
 	"github.com/sustainable-computing-io/kepler/pkg/power/components/source"
 )
 
 var (
 	NodeComponentPowerModelEnabled bool
-	NodeComponentPowerModelFunc    func([][]float64, []string) (map[string][]float64, error)
+	NodeComponentPowerModelFunc    func([]string, [][]float64, []string) (map[string][]float64, error)
 
 	// TODO: be configured by config package
 	NodeComponentPowerModelConfig types.ModelConfig = types.ModelConfig{UseEstimatorSidecar: false}
+
+	// nodeComponentCalibrator fits the node component model online on the measured energy
+	nodeComponentCalibrator *local.OnlineCalibrator
+	calibratorLock          sync.RWMutex
 )
 
-func InitNodeComponentPowerEstimator(usageMetrics, systemFeatures, systemValues []string) {
-	var estimateFunc interface{}
+func InitNodeComponentPowerEstimator(usageMetrics, systemFeatures, systemValues []string, retries int) {
+	if config.NodeComponentsInitModel != "" {
+		NodeComponentPowerModelConfig.InitModelURL = config.NodeComponentsInitModel
+	}
 	// init func for NodeComponentPower
-	NodeComponentPowerModelEnabled, estimateFunc = initEstimateFunction(NodeComponentPowerModelConfig, types.AbsComponentPower, types.AbsComponentModelWeight, usageMetrics, systemFeatures, systemValues, false)
-	if NodeComponentPowerModelEnabled {
-		NodeComponentPowerModelFunc = estimateFunc.(func([][]float64, []string) (map[string][]float64, error))
+	valid, estimateFunc := initEstimateFunction(NodeComponentPowerModelConfig, types.AbsComponentPower, types.AbsComponentModelWeight, usageMetrics, systemFeatures, systemValues, false, retries)
+	// the estimator is kept until a valid one is loaded
+	if valid {
+		estimatorLock.Lock()
+		NodeComponentPowerModelEnabled = true
+		NodeComponentPowerModelFunc = estimateFunc.(func([]string, [][]float64, []string) (map[string][]float64, error))
+		estimatorLock.Unlock()
 	}
 }
 
 // IsNodeComponentPowerModelEnabled returns if the estimator has been enabled or not
 func IsNodeComponentPowerModelEnabled() bool {
+	estimatorLock.RLock()
+	defer estimatorLock.RUnlock()
 	return NodeComponentPowerModelEnabled
 }
 
@@ -50,18 +66,70 @@ func GetNodeComponentPowers(nodeMetrics collector_metric.NodeMetrics) (nodeCompo
 	nodeComponentsEnergy = map[int]source.NodeComponentsEnergy{}
 	// TODO: make the estimator also retrieve the socket ID, we are estimating that the node will have only socket
 	socketID := 0
-	if NodeComponentPowerModelEnabled {
+	estimatorLock.RLock()
+	enabled, estimateFunc := NodeComponentPowerModelEnabled, NodeComponentPowerModelFunc
+	estimatorLock.RUnlock()
+	if enabled {
 		nodeMetricResourceUsageValuesOnly := nodeMetricsToArray(nodeMetrics)
-		powers, err := NodeComponentPowerModelFunc(nodeMetricResourceUsageValuesOnly, collector_metric.NodeMetadataValues)
+		powers, err := estimateFunc(nil, nodeMetricResourceUsageValuesOnly, collector_metric.NodeMetadataValues)
 		if err != nil {
 			return
 		}
-		pkgPower := getComponentPower(powers, "pkg", socketID)
-		corePower := getComponentPower(powers, "core", socketID)
-		uncorePower := getComponentPower(powers, "uncore", socketID)
-		dramPower := getComponentPower(powers, "dram", socketID)
+		guard := newPowerGuard(types.AbsComponentPower)
+		pkgPower := getComponentPower(guard, powers, "pkg", socketID)
+		corePower := getComponentPower(guard, powers, "core", socketID)
+		uncorePower := getComponentPower(guard, powers, "uncore", socketID)
+		dramPower := getComponentPower(guard, powers, "dram", socketID)
+		if guard.rejected {
+			return
+		}
 		nodeComponentsEnergy[socketID] = fillRAPLPower(pkgPower, corePower, uncorePower, dramPower)
 		return
 	}
 	return
 }
+
+// InitNodeComponentCalibration starts the online calibration of the node component model on the usage metrics
+func InitNodeComponentCalibration(usageMetrics []string) {
+	calibratorLock.Lock()
+	defer calibratorLock.Unlock()
+	nodeComponentCalibrator = local.NewOnlineCalibrator(usageMetrics, config.CalibrationForgettingFactor)
+}
+
+// UpdateNodeComponentCalibration fits the node component model with the resource usage and the measured energy of the node in the last period
+func UpdateNodeComponentCalibration(nodeMetrics collector_metric.NodeMetrics) {
+	calibratorLock.RLock()
+	calibrator := nodeComponentCalibrator
+	calibratorLock.RUnlock()
+	if calibrator == nil {
+		return
+	}
+	componentsEnergy := map[string]float64{
+		"pkg":    float64(nodeMetrics.EnergyInPkg.Curr()),
+		"core":   float64(nodeMetrics.EnergyInCore.Curr()),
+		"uncore": float64(nodeMetrics.EnergyInUncore.Curr()),
+		"dram":   float64(nodeMetrics.EnergyInDRAM.Curr()),
+	}
+	// the energy of the first period is not measured yet
+	if componentsEnergy["pkg"] == 0 {
+		return
+	}
+	for component, energy := range componentsEnergy {
+		// the component is not measured on the node, e.g. uncore
+		if energy == 0 {
+			delete(componentsEnergy, component)
+		}
+	}
+	calibrator.AddSample(nodeMetrics.ResourceUsage, componentsEnergy)
+}
+
+// GetCalibratedNodeComponentWeights returns the weights of the node component model fitted online and the number of fitted samples
+func GetCalibratedNodeComponentWeights() (local.ComponentModelWeights, int) {
+	calibratorLock.RLock()
+	calibrator := nodeComponentCalibrator
+	calibratorLock.RUnlock()
+	if calibrator == nil {
+		return nil, 0
+	}
+	return calibrator.GetWeights(collector_metric.NodeMetadataNames, collector_metric.NodeMetadataValues)
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package model
 
 import (
+	"github.com/sustainable-computing-io/kepler/pkg/config"
 	"github.com/sustainable-computing-io/kepler/pkg/model/types"
 
 	collector_metric "github.com/sustainable-computing-io/kepler/pkg/collector/metric"
@@ -28,38 +29,52 @@ const (
 
 var (
 	NodePlatformPowerModelEnabled bool
-	NodeTotalPowerModelFunc       func([][]float64, []string) ([]float64, error)
+	NodeTotalPowerModelFunc       func([]string, [][]float64, []string) ([]float64, error)
 
 	// TODO: be configured by config package
 	NodePlatformPowerModelConfig types.ModelConfig = types.ModelConfig{UseEstimatorSidecar: false}
 )
 
-func InitNodeTotalPowerEstimator(usageMetrics, systemFeatures, systemValues []string) {
-	var estimateFunc interface{}
+func InitNodeTotalPowerEstimator(usageMetrics, systemFeatures, systemValues []string, retries int) {
+	if config.NodeTotalInitModel != "" {
+		NodePlatformPowerModelConfig.InitModelURL = config.NodeTotalInitModel
+	}
 	// init func for NodeTotalPower
-	NodePlatformPowerModelEnabled, estimateFunc = initEstimateFunction(NodePlatformPowerModelConfig, types.AbsPower, types.AbsModelWeight, usageMetrics, systemFeatures, systemValues, true)
-	if NodePlatformPowerModelEnabled {
-		NodeTotalPowerModelFunc = estimateFunc.(func([][]float64, []string) ([]float64, error))
+	valid, estimateFunc := initEstimateFunction(NodePlatformPowerModelConfig, types.AbsPower, types.AbsModelWeight, usageMetrics, systemFeatures, systemValues, true, retries)
+	// the estimator is kept until a valid one is loaded
+	if valid {
+		estimatorLock.Lock()
+		NodePlatformPowerModelEnabled = true
+		NodeTotalPowerModelFunc = estimateFunc.(func([]string, [][]float64, []string) ([]float64, error))
+		estimatorLock.Unlock()
 	}
 }
 
 // IsNodePlatformPowerModelEnabled returns if the estimator has been enabled or not
 func IsNodePlatformPowerModelEnabled() bool {
+	estimatorLock.RLock()
+	defer estimatorLock.RUnlock()
 	return NodePlatformPowerModelEnabled
 }
 
 // GetNodeTotalEnergy returns a single estimated value of node total power
 func GetEstimatedNodePlatformPower(nodeMetrics collector_metric.NodeMetrics) (platformEnergy map[string]float64) {
+	// the estimate is only set when it is valid, an empty map does not update the platform energy
 	platformEnergy = map[string]float64{}
-	platformEnergy[estimatorACPISensorID] = 0
-	if NodePlatformPowerModelEnabled {
+	estimatorLock.RLock()
+	enabled, estimateFunc := NodePlatformPowerModelEnabled, NodeTotalPowerModelFunc
+	estimatorLock.RUnlock()
+	if enabled {
 		// convert the resource usage map to an array since the model server does not receive structured data
 		nodeMetricResourceUsageValuesOnly := nodeMetricsToArray(nodeMetrics)
-		powers, err := NodeTotalPowerModelFunc(nodeMetricResourceUsageValuesOnly, collector_metric.NodeMetadataValues)
+		powers, err := estimateFunc(nil, nodeMetricResourceUsageValuesOnly, collector_metric.NodeMetadataValues)
 		if err != nil || len(powers) == 0 {
 			return
 		}
-		platformEnergy[estimatorACPISensorID] = powers[0]
+		guard := newPowerGuard(types.AbsPower)
+		if energy := guard.check(powers[0]); !guard.rejected {
+			platformEnergy[estimatorACPISensorID] = float64(energy)
+		}
 		return
 	}
 	return
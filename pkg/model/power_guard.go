@@ -0,0 +1,128 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package model
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/model/types"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// RejectionNegative counts the negative estimates, clamped to zero
+	RejectionNegative = "negative"
+	// RejectionInvalid counts the estimates that are not a number or infinite
+	RejectionInvalid = "invalid"
+	// RejectionImplausible counts the estimates outside the power bounds of the node
+	RejectionImplausible = "implausible"
+	// RejectionInconsistent counts the container total power estimates below the sum of their component estimates
+	RejectionInconsistent = "inconsistent"
+)
+
+var (
+	// SamplePeriodSec is the collection interval of the estimated energy, set by the collector manager
+	SamplePeriodSec float64 = 3
+
+	rejections     = map[string]map[string]uint64{}
+	rejectionsLock sync.Mutex
+)
+
+// powerGuard validates the estimates of a power model in a collection interval, the estimates are expected in millijoules
+// of the interval and bounded by the maximum power of the node (config.GetNodePowerBounds) in this interval. The minimum
+// power of the node only bounds the node platform power, a container or a component may use less.
+type powerGuard struct {
+	outputType types.ModelOutputType
+	minEnergy  float64
+	maxEnergy  float64
+	// rejected is set when an estimate cannot be used, the estimates of the interval should be discarded
+	rejected bool
+}
+
+func newPowerGuard(outputType types.ModelOutputType) *powerGuard {
+	minPower, maxPower := config.GetNodePowerBounds()
+	guard := &powerGuard{outputType: outputType, maxEnergy: maxPower * SamplePeriodSec * 1000}
+	if outputType == types.AbsPower {
+		guard.minEnergy = minPower * SamplePeriodSec * 1000
+	}
+	return guard
+}
+
+// check returns the estimate as energy, a negative estimate is clamped to zero and an invalid or implausible estimate is rejected
+func (g *powerGuard) check(power float64) uint64 {
+	switch {
+	case math.IsNaN(power) || math.IsInf(power, 0):
+		g.reject(RejectionInvalid, power)
+		return 0
+	case g.minEnergy > 0 && power < g.minEnergy:
+		g.reject(RejectionImplausible, power)
+		return 0
+	case power < 0:
+		countRejection(g.outputType, RejectionNegative)
+		return 0
+	case g.maxEnergy > 0 && power > g.maxEnergy:
+		g.reject(RejectionImplausible, power)
+		return 0
+	}
+	return uint64(power)
+}
+
+func (g *powerGuard) reject(reason string, power float64) {
+	klog.V(3).Infof("%s power model: rejected %s estimate %v", g.outputType.String(), reason, power)
+	countRejection(g.outputType, reason)
+	g.rejected = true
+}
+
+func countRejection(outputType types.ModelOutputType, reason string) {
+	rejectionsLock.Lock()
+	defer rejectionsLock.Unlock()
+	counts, ok := rejections[outputType.String()]
+	if !ok {
+		counts = map[string]uint64{}
+		rejections[outputType.String()] = counts
+	}
+	counts[reason]++
+}
+
+// PowerRejection is the number of estimates of a power model clamped or rejected for a reason
+type PowerRejection struct {
+	OutputType string
+	Reason     string
+	Count      uint64
+}
+
+// GetPowerRejections returns the number of clamped or rejected estimates by power output type and reason
+func GetPowerRejections() []PowerRejection {
+	rejectionsLock.Lock()
+	defer rejectionsLock.Unlock()
+	var result []PowerRejection
+	for outputType, counts := range rejections {
+		for reason, count := range counts {
+			result = append(result, PowerRejection{OutputType: outputType, Reason: reason, Count: count})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].OutputType != result[j].OutputType {
+			return result[i].OutputType < result[j].OutputType
+		}
+		return result[i].Reason < result[j].Reason
+	})
+	return result
+}
@@ -0,0 +1,100 @@
+package model
+
+import (
+	"math"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	collector_metric "github.com/sustainable-computing-io/kepler/pkg/collector/metric"
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/model/types"
+)
+
+func getRejections(outputType types.ModelOutputType) map[string]uint64 {
+	counts := map[string]uint64{}
+	for _, rejection := range GetPowerRejections() {
+		if rejection.OutputType == outputType.String() {
+			counts[rejection.Reason] = rejection.Count
+		}
+	}
+	return counts
+}
+
+var _ = Describe("Test Power Guard", func() {
+	BeforeEach(func() {
+		rejections = map[string]map[string]uint64{}
+		config.MaxNodePower = 100
+		SamplePeriodSec = 3
+	})
+	AfterEach(func() {
+		config.MaxNodePower = 5000
+		config.MinNodePower = 0
+		config.NodePowerBounds = map[string]config.PowerBounds{}
+	})
+
+	It("Clamp negative estimates and reject invalid or implausible estimates", func() {
+		guard := newPowerGuard(types.AbsPower)
+		Expect(guard.check(1000)).To(Equal(uint64(1000)))
+		Expect(guard.check(-50)).To(Equal(uint64(0)))
+		Expect(guard.rejected).To(BeFalse())
+		// 100 W in 3 seconds is 300000 mJ
+		Expect(guard.check(300001)).To(Equal(uint64(0)))
+		Expect(guard.rejected).To(BeTrue())
+		Expect(newPowerGuard(types.AbsPower).check(math.NaN())).To(Equal(uint64(0)))
+		Expect(getRejections(types.AbsPower)).To(Equal(map[string]uint64{RejectionNegative: 1, RejectionImplausible: 1, RejectionInvalid: 1}))
+	})
+
+	It("Reject the node platform estimates below the minimum node power", func() {
+		config.MinNodePower = 10
+		// 10 W in 3 seconds is 30000 mJ
+		guard := newPowerGuard(types.AbsPower)
+		Expect(guard.check(30000)).To(Equal(uint64(30000)))
+		Expect(guard.rejected).To(BeFalse())
+		Expect(guard.check(-50)).To(Equal(uint64(0)))
+		Expect(guard.rejected).To(BeTrue())
+		// the minimum power does not bound the containers
+		guard = newPowerGuard(types.DynComponentPower)
+		Expect(guard.check(1)).To(Equal(uint64(1)))
+		Expect(guard.rejected).To(BeFalse())
+	})
+
+	It("Use the power bounds of the node", func() {
+		os.Setenv("NODE_NAME", "node-a")
+		defer os.Unsetenv("NODE_NAME")
+		config.NodePowerBounds = map[string]config.PowerBounds{"node-a": {Min: 20, Max: -1}, "node-b": {Min: -1, Max: 1}}
+		guard := newPowerGuard(types.AbsPower)
+		Expect(guard.minEnergy).To(Equal(float64(60000)))
+		Expect(guard.maxEnergy).To(Equal(float64(300000)))
+	})
+
+	It("Do not set a rejected node platform estimate", func() {
+		NodePlatformPowerModelEnabled = true
+		NodeTotalPowerModelFunc = func([]string, [][]float64, []string) ([]float64, error) {
+			return []float64{1e9}, nil
+		}
+		defer func() { NodePlatformPowerModelEnabled = false }()
+
+		Expect(GetEstimatedNodePlatformPower(collector_metric.NodeMetrics{})).To(BeEmpty())
+		NodeTotalPowerModelFunc = func([]string, [][]float64, []string) ([]float64, error) {
+			return []float64{1000}, nil
+		}
+		Expect(GetEstimatedNodePlatformPower(collector_metric.NodeMetrics{})).To(Equal(map[string]float64{estimatorACPISensorID: 1000}))
+	})
+
+	It("Reject the container estimates above the maximum node power", func() {
+		ContainerComponentPowerModelValid = true
+		ContainerComponentPowerModelFunc = func([]string, [][]float64, []string) (map[string][]float64, error) {
+			return map[string][]float64{"pkg": {100, 1e9}, "dram": {-10, 10}}, nil
+		}
+		defer func() { ContainerComponentPowerModelValid = false }()
+
+		enabled, powers, rejected := getContainerComponentPowers([]string{"containerA", "containerB"}, [][]float64{{1}, {2}})
+		Expect(enabled).To(BeTrue())
+		Expect(rejected).To(BeTrue())
+		Expect(powers[0].Pkg).To(Equal(uint64(100)))
+		Expect(powers[0].DRAM).To(Equal(uint64(0)))
+		Expect(getRejections(types.DynComponentPower)).To(Equal(map[string]uint64{RejectionNegative: 1, RejectionImplausible: 1}))
+	})
+})
@@ -21,6 +21,8 @@ import (
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+
+	"github.com/sustainable-computing-io/kepler/pkg/config"
 )
 
 var (
@@ -33,6 +35,8 @@ func TestModels(t *testing.T) {
 }
 
 var _ = BeforeSuite(func() {
+	// the initial model URL is requested once, without waiting for the retries when it is unreachable
+	config.ModelServerRetries = 0
 })
 
 var _ = AfterSuite(func() {
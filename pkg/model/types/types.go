@@ -58,9 +58,56 @@ func IsComponentType(outputType ModelOutputType) bool {
 	return false
 }
 
+// the estimator types evaluated locally, without the estimator sidecar
+const (
+	LinearRegressorEstimator = "LinearRegressor"
+	TreeEnsembleEstimator    = "TreeEnsemble"
+	PolynomialEstimator      = "Polynomial"
+	PiecewiseLinearEstimator = "PiecewiseLinear"
+)
+
+// SidecarEstimator is the estimator type of the models evaluated by the estimator sidecar
+const SidecarEstimator = "EstimatorSidecar"
+
 type ModelConfig struct {
 	UseEstimatorSidecar bool
-	SelectedModel       string
-	SelectFilter        string
-	InitModelURL        string
+	// EstimatorType selects the local estimator when the sidecar is not used, the linear regressor if empty
+	EstimatorType string
+	SelectedModel string
+	SelectFilter  string
+	InitModelURL  string
+}
+
+// ModelInfo describes the model loaded by an estimator
+type ModelInfo struct {
+	EstimatorType string `json:"estimator"`
+	Name          string `json:"name"`
+	Version       string `json:"version"`
+	// Source is the model server endpoint, the URL or the local path the model was loaded from
+	Source string `json:"source"`
+	// Checksum is the SHA-256 of the loaded model
+	Checksum string `json:"checksum"`
+}
+
+// FeatureStatus compares the usage metrics of a model with the ones collected on the node
+type FeatureStatus struct {
+	// Features are the usage metrics the model uses
+	Features []string `json:"features"`
+	// MissingFeatures are the features of the model that the node does not collect
+	MissingFeatures []string `json:"missing_features"`
+	// UnusedFeatures are the usage metrics collected on the node that the model does not use
+	UnusedFeatures []string `json:"unused_features"`
+	// Coverage is the ratio of the features of the model collected on the node
+	Coverage float64 `json:"coverage"`
+}
+
+// ModelStatus describes the estimator of a power output type for the diagnostics
+type ModelStatus struct {
+	OutputType string `json:"output_type"`
+	// Valid is true if the estimator has loaded a model, the model is kept when the later loads fail
+	Valid bool      `json:"valid"`
+	Model ModelInfo `json:"model"`
+	FeatureStatus
+	// LastError is the error of the last load if it failed, e.g. the features of the model are not collected on the node
+	LastError string `json:"last_error,omitempty"`
 }
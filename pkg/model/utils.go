@@ -21,13 +21,14 @@ import (
 	"github.com/sustainable-computing-io/kepler/pkg/power/components/source"
 )
 
-// getComponentPower called by getPodComponentPowers to check if component key is present in powers response and fills with single 0
-func getComponentPower(powers map[string][]float64, componentKey string, index int) uint64 {
+// getComponentPower called by getPodComponentPowers to check if component key is present in powers response and fills with single 0,
+// the power is validated by the guard
+func getComponentPower(guard *powerGuard, powers map[string][]float64, componentKey string, index int) uint64 {
 	values := powers[componentKey]
 	if index >= len(values) {
 		return 0
 	} else {
-		return uint64(values[index])
+		return guard.check(values[index])
 	}
 }
 
@@ -48,9 +49,8 @@ func fillRAPLPower(pkgPower, corePower, uncorePower, dramPower uint64) source.No
 }
 
 // containerMetricsToArray converts to container metrics map to array
-// The current implementation from the model server use this arry and returns an array with the container energy.
-// The list follows the order of the container list for the container id...
-// TODO: make model server return a list of elemets that also contains the containerID to enforce consistency
+// The estimators return the container powers in the order of the array, the container id list holds the container of each row.
+// The estimator sidecar keys each row of the request and of the response, so its results do not depend on the order either.
 func containerMetricsToArray(containersMetrics map[string]*collector_metric.ContainerMetrics) (containerMetricValuesOnly [][]float64, containerIDList []string) {
 	for containerID, c := range containersMetrics {
 		values := c.ToEstimatorValues()
@@ -60,7 +60,7 @@ func containerMetricsToArray(containersMetrics map[string]*collector_metric.Cont
 	return
 }
 
-// TODO: as in containerMetricsToArray, consider exchange a protobuf stricture istead of simple arrays to make it more predictable and consistent
+// nodeMetricsToArray converts the node resource usage to a single row in the order of the container metric names
 func nodeMetricsToArray(nodeMetrics collector_metric.NodeMetrics) [][]float64 {
 	nodeMetricResourceUsageValuesOnly := []float64{}
 	for _, metricName := range collector_metric.ContainerMetricNames {
@@ -0,0 +1,113 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package acpi
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	CPUPathDir = "/sys/devices/system/cpu/"
+)
+
+// CPUIdleReader reads the time that each CPU spent in each idle state (C-state) from cpuidle,
+// i.e. /sys/devices/system/cpu/cpu<N>/cpuidle/state<M>/{name,time}, the time is in microseconds since boot
+type CPUIdleReader struct {
+	cpuPath string
+	// prevTime holds the residency of the previous read per CPU and state name
+	prevTime map[int32]map[string]uint64
+	prevRead time.Time
+}
+
+func NewCPUIdleReader(cpuPath string) *CPUIdleReader {
+	r := &CPUIdleReader{cpuPath: cpuPath}
+	r.prevTime = r.readResidency()
+	r.prevRead = time.Now()
+	return r
+}
+
+// IsSupported returns if the cpuidle residency is exposed, e.g. it is not in most virtual machines
+func (r *CPUIdleReader) IsSupported() bool {
+	return len(r.prevTime) > 0
+}
+
+// ReadResidency returns the time in microseconds that each CPU spent in each idle state since the previous call and the elapsed time
+func (r *CPUIdleReader) ReadResidency() (map[int32]map[string]uint64, time.Duration) {
+	now := time.Now()
+	curr := r.readResidency()
+	residency := make(map[int32]map[string]uint64)
+	for cpu, states := range curr {
+		residency[cpu] = make(map[string]uint64)
+		for state, time := range states {
+			// the counters of a CPU restart when it is brought back online
+			if prev := r.prevTime[cpu][state]; time >= prev {
+				residency[cpu][state] = time - prev
+			}
+		}
+	}
+	elapsed := now.Sub(r.prevRead)
+	r.prevTime = curr
+	r.prevRead = now
+	return residency, elapsed
+}
+
+func (r *CPUIdleReader) readResidency() map[int32]map[string]uint64 {
+	residency := make(map[int32]map[string]uint64)
+	statePaths, err := filepath.Glob(filepath.Join(r.cpuPath, "cpu[0-9]*", "cpuidle", "state[0-9]*"))
+	if err != nil {
+		klog.V(5).Infof("failed to list the cpuidle states: %v", err)
+		return residency
+	}
+	for _, statePath := range statePaths {
+		cpu, err := parseCPUID(filepath.Base(filepath.Dir(filepath.Dir(statePath))))
+		if err != nil {
+			continue
+		}
+		name, err := os.ReadFile(filepath.Join(statePath, "name"))
+		if err != nil {
+			continue
+		}
+		time, err := readUint64(filepath.Join(statePath, "time"))
+		if err != nil {
+			continue
+		}
+		if _, exists := residency[cpu]; !exists {
+			residency[cpu] = make(map[string]uint64)
+		}
+		residency[cpu][strings.TrimSpace(string(name))] += time
+	}
+	return residency
+}
+
+func parseCPUID(name string) (int32, error) {
+	cpu, err := strconv.ParseInt(strings.TrimPrefix(name, "cpu"), 10, 32)
+	return int32(cpu), err
+}
+
+func readUint64(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
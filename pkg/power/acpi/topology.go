@@ -0,0 +1,127 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package acpi
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	NodePathDir = "/sys/devices/system/node/"
+)
+
+// CPUTopology maps the CPUs and the NUMA nodes to their physical package (socket)
+type CPUTopology struct {
+	// CPUPackages maps each CPU to its physical package
+	CPUPackages map[int32]int
+	// NUMANodePackages maps each NUMA node with CPUs to the package of its CPUs, the nodes without CPUs (e.g. memory expanders) are not listed
+	NUMANodePackages map[int32]int
+	// ThreadSiblings maps each CPU to the hardware threads of its physical core, itself included
+	ThreadSiblings map[int32][]int32
+}
+
+// ReadCPUTopology reads the package and the thread siblings of each CPU from cpu<N>/topology/{physical_package_id,thread_siblings_list}
+// and the CPUs of each NUMA node from node<N>/cpulist
+func ReadCPUTopology(cpuPath, nodePath string) *CPUTopology {
+	t := &CPUTopology{
+		CPUPackages:      readCPUPackages(cpuPath),
+		NUMANodePackages: make(map[int32]int),
+		ThreadSiblings:   readThreadSiblings(cpuPath),
+	}
+	nodePaths, err := filepath.Glob(filepath.Join(nodePath, "node[0-9]*"))
+	if err != nil {
+		return t
+	}
+	for _, path := range nodePaths {
+		node, err := strconv.ParseInt(strings.TrimPrefix(filepath.Base(path), "node"), 10, 32)
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(path, "cpulist"))
+		if err != nil {
+			continue
+		}
+		for _, cpu := range parseCPUList(strings.TrimSpace(string(data))) {
+			if pkg, exists := t.CPUPackages[cpu]; exists {
+				t.NUMANodePackages[int32(node)] = pkg
+				break
+			}
+		}
+	}
+	return t
+}
+
+func readCPUPackages(cpuPath string) map[int32]int {
+	packages := make(map[int32]int)
+	cpuPaths, err := filepath.Glob(filepath.Join(cpuPath, "cpu[0-9]*"))
+	if err != nil {
+		return packages
+	}
+	for _, path := range cpuPaths {
+		cpu, err := parseCPUID(filepath.Base(path))
+		if err != nil {
+			continue
+		}
+		if pkg, err := readUint64(filepath.Join(path, "topology", "physical_package_id")); err == nil {
+			packages[cpu] = int(pkg)
+		}
+	}
+	return packages
+}
+
+func readThreadSiblings(cpuPath string) map[int32][]int32 {
+	siblings := make(map[int32][]int32)
+	cpuPaths, err := filepath.Glob(filepath.Join(cpuPath, "cpu[0-9]*"))
+	if err != nil {
+		return siblings
+	}
+	for _, path := range cpuPaths {
+		cpu, err := parseCPUID(filepath.Base(path))
+		if err != nil {
+			continue
+		}
+		if data, err := os.ReadFile(filepath.Join(path, "topology", "thread_siblings_list")); err == nil {
+			siblings[cpu] = parseCPUList(strings.TrimSpace(string(data)))
+		}
+	}
+	return siblings
+}
+
+// parseCPUList parses a CPU list such as 0-3,8,10-11
+func parseCPUList(list string) []int32 {
+	var cpus []int32
+	for _, item := range strings.Split(list, ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(item), "-")
+		start, err := strconv.ParseInt(first, 10, 32)
+		if err != nil {
+			continue
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.ParseInt(last, 10, 32); err != nil {
+				continue
+			}
+		}
+		for cpu := start; cpu <= end; cpu++ {
+			cpus = append(cpus, int32(cpu))
+		}
+	}
+	return cpus
+}
@@ -17,8 +17,12 @@ limitations under the License.
 package components
 
 import (
+	"sync"
+
 	"k8s.io/klog/v2"
 
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"github.com/sustainable-computing-io/kepler/pkg/power/acpi"
 	"github.com/sustainable-computing-io/kepler/pkg/power/components/source"
 )
 
@@ -47,6 +51,16 @@ var (
 	useMSR                   = false // it looks MSR on kvm or hyper-v is not working
 )
 
+var (
+	// powerEstimate estimates the power from the CPU utilization when the node has no power measurement, it is nil if the node has a
+	// power measurement or if the power cannot be estimated
+	powerEstimate *source.PowerEstimate
+	// powerEstimated is set while the power is estimated from the CPU utilization
+	powerEstimated = false
+	// powerLock guards powerImpl and powerEstimated that are switched while no trained power model of the node is loaded
+	powerLock sync.RWMutex
+)
+
 func init() {
 	if sysfsImpl.IsSystemCollectionSupported() /*&& false*/ {
 		klog.V(1).Infoln("use sysfs to obtain power")
@@ -62,30 +76,98 @@ func init() {
 	}
 }
 
+// InitPowerEstimate sets up the estimation of the power from the CPU utilization on the nodes without power measurement,
+// it is called by the exporter before the collection starts
+func InitPowerEstimate() {
+	powerLock.Lock()
+	defer powerLock.Unlock()
+	if powerImpl != dummyImpl || powerEstimate != nil {
+		return
+	}
+	if powerEstimate = getPowerEstimate(); powerEstimate != nil {
+		klog.V(1).Infoln("use the CPU utilization to estimate power while no trained power model of the node is loaded")
+		powerImpl = powerEstimate
+		powerEstimated = true
+	}
+}
+
+// getPowerEstimate returns the estimator of the power from the CPU utilization if the node has no hwmon power meter either
+func getPowerEstimate() *source.PowerEstimate {
+	if config.PowerEstimator == config.PowerEstimatorNone || acpi.NewACPIPowerMeter().IsPowerSupported() {
+		return nil
+	}
+	estimateImpl, err := source.NewPowerEstimate(config.PowerCurve, config.MemoryPowerPerGB)
+	if err != nil {
+		klog.V(1).Infof("cannot estimate power from the CPU utilization: %v", err)
+		return nil
+	}
+	return estimateImpl
+}
+
 func GetEnergyFromDram() (uint64, error) {
+	powerLock.RLock()
+	defer powerLock.RUnlock()
 	return powerImpl.GetEnergyFromDram()
 }
 
 func GetEnergyFromCore() (uint64, error) {
+	powerLock.RLock()
+	defer powerLock.RUnlock()
 	return powerImpl.GetEnergyFromCore()
 }
 
 func GetEnergyFromUncore() (uint64, error) {
+	powerLock.RLock()
+	defer powerLock.RUnlock()
 	return powerImpl.GetEnergyFromUncore()
 }
 
 func GetEnergyFromPackage() (uint64, error) {
+	powerLock.RLock()
+	defer powerLock.RUnlock()
 	return powerImpl.GetEnergyFromPackage()
 }
 
 func GetNodeComponentsEnergy() map[int]source.NodeComponentsEnergy {
+	powerLock.RLock()
+	defer powerLock.RUnlock()
 	return powerImpl.GetNodeComponentsEnergy()
 }
 
 func IsSystemCollectionSupported() bool {
+	powerLock.RLock()
+	defer powerLock.RUnlock()
 	return powerImpl.IsSystemCollectionSupported()
 }
 
+// IsPowerEstimated returns if the node components energy is estimated from the CPU utilization instead of measured
+func IsPowerEstimated() bool {
+	powerLock.RLock()
+	defer powerLock.RUnlock()
+	return powerEstimated
+}
+
+// SetPowerEstimate enables the estimation of the power from the CPU utilization on the nodes without power measurement, it is disabled
+// when a trained power model of the node is loaded so that the node energy is estimated by the model
+func SetPowerEstimate(enabled bool) {
+	powerLock.Lock()
+	defer powerLock.Unlock()
+	if powerEstimate == nil || enabled == powerEstimated {
+		return
+	}
+	if enabled {
+		klog.V(1).Infoln("use the CPU utilization to estimate power")
+		powerEstimate.Restart()
+		powerImpl = powerEstimate
+	} else {
+		klog.V(1).Infoln("use the trained power model of the node instead of the CPU utilization to estimate power")
+		powerImpl = dummyImpl
+	}
+	powerEstimated = enabled
+}
+
 func StopPower() {
+	powerLock.RLock()
+	defer powerLock.RUnlock()
 	powerImpl.StopPower()
 }
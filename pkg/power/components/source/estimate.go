@@ -17,6 +17,7 @@ limitations under the License.
 package source
 
 import (
+	"bufio"
 	"encoding/csv"
 	"fmt"
 	"io"
@@ -24,32 +25,54 @@ import (
 	"os/exec"
 	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/jszwec/csvutil"
 	"k8s.io/klog/v2"
 )
 
-type PowerEstimate struct{}
+// PowerEstimate estimates the node power from the CPU utilization for the nodes without power measurement (e.g., cloud VMs).
+// The CPU power is interpolated between the minimum and maximum power of the CPU threads of the architecture, or from a
+// user-supplied power curve, and the DRAM power is proportional to the memory size. The energy is integrated between reads.
+type PowerEstimate struct {
+	// minWatts and maxWatts are the CPU power of the node at 0% and 100% utilization
+	minWatts, maxWatts float64
+	// curve replaces the interpolation between minWatts and maxWatts if it is set
+	curve     []PowerCurvePoint
+	dramWatts float64
+
+	statPath            string
+	lastIdle, lastTotal uint64
+	lastTime            time.Time
+	// coreEnergy and dramEnergy are the accumulated energy in mJ
+	coreEnergy, dramEnergy float64
+	mu                     sync.Mutex
+}
+
+// PowerCurvePoint is a point of a SPECpower-style power curve, the CPU power in watts of the node at the utilization in percent
+type PowerCurvePoint struct {
+	Utilization float64
+	Watts       float64
+}
 
 var (
 	cpuModelDataPath = "/var/lib/kepler/data/normalized_cpu_arch.csv"
 	powerDataPath    = "/var/lib/kepler/data/power_data.csv" // obtained from https://github.com/cloud-carbon-footprint/cloud-carbon-coefficients/blob/main/output/coefficients-aws-use.csv
+	procStatPath     = "/proc/stat"
 	dramRegex        = "^MemTotal:[\\s]+([0-9]+)"
 
-	dramInGB                                                                 int
-	cpuCores                                                                 = runtime.NumCPU()
-	startTime                                                                = time.Now()
-	perThreadMinPowerEstimate, perThreadMaxPowerEstimate, perGBPowerEstimate float64
+	cpuThreads = runtime.NumCPU()
 )
 
 type PowerEstimateData struct {
 	Architecture string  `csv:"Architecture"`
 	MinWatts     float64 `csv:"Min Watts"`
 	MaxWatts     float64 `csv:"Max Watts"`
-	PerGBWatts   float64 `csv:"GB/Chip"`
+	GBPerChip    float64 `csv:"GB/Chip"`
 }
 
 type CPUModelData struct {
@@ -57,6 +80,156 @@ type CPUModelData struct {
 	Architecture string `csv:"Architecture"`
 }
 
+// NewPowerEstimate returns the estimator of the node with the power curve, e.g. "0:50,50:100,100:150", or the power data of the CPU architecture
+// if there is no curve, and the DRAM power per GB of memory
+func NewPowerEstimate(powerCurve string, dramWattsPerGB float64) (*PowerEstimate, error) {
+	r := &PowerEstimate{statPath: procStatPath}
+	if powerCurve != "" {
+		curve, err := ParsePowerCurve(powerCurve)
+		if err != nil {
+			return nil, err
+		}
+		r.curve = curve
+	} else {
+		cpu, err := GetCPUArchitecture()
+		if err != nil {
+			return nil, err
+		}
+		perThreadMinWatts, perThreadMaxWatts, err := getCPUPowerEstimate(cpu)
+		if err != nil {
+			return nil, err
+		}
+		r.minWatts = float64(cpuThreads) * perThreadMinWatts
+		r.maxWatts = float64(cpuThreads) * perThreadMaxWatts
+	}
+	if dramInGB, err := getDram(); err == nil {
+		r.dramWatts = float64(dramInGB) * dramWattsPerGB
+	} else {
+		klog.V(1).Infof("cannot estimate the DRAM power: %v", err)
+	}
+	if _, _, err := readCPUStat(r.statPath); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ParsePowerCurve parses the comma-separated utilization:watts points of a power curve, sorted by utilization
+func ParsePowerCurve(powerCurve string) ([]PowerCurvePoint, error) {
+	var curve []PowerCurvePoint
+	for _, point := range strings.Split(powerCurve, ",") {
+		utilization, watts, found := strings.Cut(strings.TrimSpace(point), ":")
+		if !found {
+			return nil, fmt.Errorf("invalid power curve point %q, expected utilization:watts", point)
+		}
+		u, err := strconv.ParseFloat(strings.TrimSpace(utilization), 64)
+		if err != nil || u < 0 || u > 100 {
+			return nil, fmt.Errorf("invalid utilization %q of the power curve, expected a percent", utilization)
+		}
+		w, err := strconv.ParseFloat(strings.TrimSpace(watts), 64)
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("invalid watts %q of the power curve", watts)
+		}
+		curve = append(curve, PowerCurvePoint{Utilization: u, Watts: w})
+	}
+	if len(curve) < 2 {
+		return nil, fmt.Errorf("the power curve needs at least two points")
+	}
+	sort.Slice(curve, func(i, j int) bool { return curve[i].Utilization < curve[j].Utilization })
+	return curve, nil
+}
+
+// getCPUPower returns the CPU power of the node at the utilization, between 0 and 1
+func (r *PowerEstimate) getCPUPower(utilization float64) float64 {
+	if len(r.curve) == 0 {
+		return r.minWatts + (r.maxWatts-r.minWatts)*utilization
+	}
+	percent := utilization * 100
+	if percent <= r.curve[0].Utilization {
+		return r.curve[0].Watts
+	}
+	for i := 1; i < len(r.curve); i++ {
+		if percent <= r.curve[i].Utilization {
+			lower, upper := r.curve[i-1], r.curve[i]
+			return lower.Watts + (upper.Watts-lower.Watts)*(percent-lower.Utilization)/(upper.Utilization-lower.Utilization)
+		}
+	}
+	return r.curve[len(r.curve)-1].Watts
+}
+
+// readCPUStat returns the idle (idle and iowait) and the total time of the CPUs from the first line of /proc/stat
+func readCPUStat(path string) (idle, total uint64, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() {
+		return 0, 0, fmt.Errorf("empty %s", path)
+	}
+	fields := strings.Fields(scanner.Text())
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return 0, 0, fmt.Errorf("unexpected %s line: %s", path, scanner.Text())
+	}
+	// user, nice, system, idle, iowait, irq, softirq and steal, the guest time is already counted in user and nice
+	for i, field := range fields[1:] {
+		if i >= 8 {
+			break
+		}
+		value, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+		total += value
+		if i == 3 || i == 4 {
+			idle += value
+		}
+	}
+	return idle, total, nil
+}
+
+// update adds the energy since the last update, at the CPU utilization of this interval
+func (r *PowerEstimate) update() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	idle, total, err := readCPUStat(r.statPath)
+	if err != nil {
+		klog.V(3).Infof("cannot read the CPU utilization: %v", err)
+		return
+	}
+	if !r.lastTime.IsZero() && total > r.lastTotal {
+		utilization := 1 - float64(idle-r.lastIdle)/float64(total-r.lastTotal)
+		utilization = minFloat(maxFloat(utilization, 0), 1)
+		seconds := now.Sub(r.lastTime).Seconds()
+		r.coreEnergy += r.getCPUPower(utilization) * seconds * 1000
+		r.dramEnergy += r.dramWatts * seconds * 1000
+	}
+	r.lastIdle, r.lastTotal, r.lastTime = idle, total, now
+}
+
+// Restart starts a new integration of the energy, the time since the last read is not estimated, e.g. when the estimation was not used
+func (r *PowerEstimate) Restart() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastTime = time.Time{}
+}
+
+func minFloat(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxFloat(a, b float64) float64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// GetCPUArchitecture returns the CPU architecture of the node from archspec and the CPU model data, or CPU_ARCH_OVERRIDE if it is set
 func GetCPUArchitecture() (string, error) {
 	// check if there is a CPU architecture override
 	cpuArchOverride := os.Getenv("CPU_ARCH_OVERRIDE")
@@ -73,6 +246,7 @@ func GetCPUArchitecture() (string, error) {
 	if err != nil {
 		return "", err
 	}
+	defer file.Close()
 	reader := csv.NewReader(file)
 
 	dec, err := csvutil.NewDecoder(reader)
@@ -84,6 +258,8 @@ func GetCPUArchitecture() (string, error) {
 		var p CPUModelData
 		if err := dec.Decode(&p); err == io.EOF {
 			break
+		} else if err != nil {
+			return "", err
 		}
 		if strings.HasPrefix(myCPUModel, p.Name) {
 			return p.Architecture, nil
@@ -110,50 +286,56 @@ func getDram() (int, error) {
 	return 0, fmt.Errorf("no memory info found")
 }
 
-func getCPUPowerEstimate(cpu string) (perThreadMinPowerEstimate, perThreadMaxPowerEstimate, perGBPowerEstimate float64, err error) {
-	file, _ := os.Open(powerDataPath)
+// getCPUPowerEstimate returns the minimum and maximum power of a CPU thread of the architecture
+func getCPUPowerEstimate(cpu string) (perThreadMinPowerEstimate, perThreadMaxPowerEstimate float64, err error) {
+	file, err := os.Open(powerDataPath)
+	if err != nil {
+		return 0.0, 0.0, err
+	}
+	defer file.Close()
 	reader := csv.NewReader(file)
 
 	dec, err := csvutil.NewDecoder(reader)
 	if err != nil {
-		return 0.0, 0.0, 0.0, err
+		return 0.0, 0.0, err
 	}
 
 	for {
 		var p PowerEstimateData
 		if err := dec.Decode(&p); err == io.EOF {
 			break
+		} else if err != nil {
+			return 0.0, 0.0, err
 		}
 		if p.Architecture == cpu {
-			return p.MinWatts, p.MaxWatts, p.PerGBWatts, nil
+			return p.MinWatts, p.MaxWatts, nil
 		}
 	}
 
-	return 0.0, 0.0, 0.0, fmt.Errorf("no CPU power info found")
+	return 0.0, 0.0, fmt.Errorf("no CPU power info found for architecture %s", cpu)
 }
 
-// If the Estimated Power is being used, it means that the system does not support Components Power Measurement
+// The estimated power replaces the system collection on the nodes without power measurement while no trained power model of the node
+// is loaded, see components.SetPowerEstimate
 func (r *PowerEstimate) IsSystemCollectionSupported() bool {
-	return false
+	return true
 }
 
 func (r *PowerEstimate) StopPower() {
-	startTime = time.Now()
 }
 
 func (r *PowerEstimate) GetEnergyFromDram() (uint64, error) {
-	now := time.Now()
-	diff := now.Sub(startTime)
-	seconds := diff.Seconds()
-	return uint64(float64(dramInGB)*perGBPowerEstimate*seconds) * 1000 / 3600, nil
+	r.update()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return uint64(r.dramEnergy), nil
 }
 
 func (r *PowerEstimate) GetEnergyFromCore() (uint64, error) {
-	now := time.Now()
-	diff := now.Sub(startTime)
-	seconds := diff.Seconds()
-	// TODO: use utilization
-	return uint64(float64(cpuCores)*seconds*(perThreadMinPowerEstimate+perThreadMaxPowerEstimate)/2) * 1000 / 3600, nil
+	r.update()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return uint64(r.coreEnergy), nil
 }
 
 func (r *PowerEstimate) GetEnergyFromUncore() (uint64, error) {
@@ -166,14 +348,15 @@ func (r *PowerEstimate) GetEnergyFromPackage() (uint64, error) {
 
 // No node components information, consider as 1 socket
 func (r *PowerEstimate) GetNodeComponentsEnergy() map[int]NodeComponentsEnergy {
-	coreEnergy, _ := r.GetEnergyFromCore()
-	dramEnergy, _ := r.GetEnergyFromDram()
+	r.update()
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	componentsEnergies := make(map[int]NodeComponentsEnergy)
 	componentsEnergies[0] = NodeComponentsEnergy{
-		Core:   coreEnergy,
-		DRAM:   dramEnergy,
+		Core:   uint64(r.coreEnergy),
+		DRAM:   uint64(r.dramEnergy),
 		Uncore: 0,
-		Pkg:    coreEnergy,
+		Pkg:    uint64(r.coreEnergy),
 	}
 	return componentsEnergies
 }
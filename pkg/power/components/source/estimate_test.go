@@ -0,0 +1,77 @@
+package source
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/sustainable-computing-io/kepler/pkg/utils"
+)
+
+func TestParsePowerCurve(t *testing.T) {
+	g := NewWithT(t)
+	curve, err := ParsePowerCurve("100:150, 0:50,50:110")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(curve).To(Equal([]PowerCurvePoint{{0, 50}, {50, 110}, {100, 150}}))
+
+	for _, invalid := range []string{"0:50", "0:50,150:100", "0:50,100", "0:50,100:-1"} {
+		_, err = ParsePowerCurve(invalid)
+		g.Expect(err).To(HaveOccurred(), invalid)
+	}
+}
+
+func TestGetCPUPower(t *testing.T) {
+	g := NewWithT(t)
+	r := &PowerEstimate{minWatts: 10, maxWatts: 50}
+	g.Expect(r.getCPUPower(0)).To(Equal(10.0))
+	g.Expect(r.getCPUPower(0.5)).To(Equal(30.0))
+
+	r.curve = []PowerCurvePoint{{10, 50}, {50, 110}, {100, 150}}
+	g.Expect(r.getCPUPower(0)).To(Equal(50.0))
+	g.Expect(r.getCPUPower(0.3)).To(Equal(80.0))
+	g.Expect(r.getCPUPower(0.75)).To(Equal(130.0))
+	g.Expect(r.getCPUPower(1)).To(Equal(150.0))
+}
+
+func TestPowerEstimateEnergy(t *testing.T) {
+	g := NewWithT(t)
+	statPath, err := utils.CreateTempFile("cpu  100 0 100 700 100 0 0 0 0 0\ncpu0 100 0 100 700 100 0 0 0 0 0\n")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.Remove(statPath)
+
+	idle, total, err := readCPUStat(statPath)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(idle).To(Equal(uint64(800)))
+	g.Expect(total).To(Equal(uint64(1000)))
+
+	r := &PowerEstimate{minWatts: 10, maxWatts: 50, dramWatts: 2, statPath: statPath}
+	energy := r.GetNodeComponentsEnergy()
+	g.Expect(energy[0].Pkg).To(BeZero())
+
+	// 25% utilization in the interval: 20 W of CPU power and 2 W of DRAM power
+	g.Expect(os.WriteFile(statPath, []byte("cpu  150 0 150 950 150 0 0 0 0 0\n"), 0o644)).To(Succeed())
+	r.lastTime = time.Now().Add(-time.Second)
+	energy = r.GetNodeComponentsEnergy()
+	g.Expect(float64(energy[0].Pkg)).To(BeNumerically("~", 20000, 100))
+	g.Expect(energy[0].Core).To(Equal(energy[0].Pkg))
+	g.Expect(float64(energy[0].DRAM)).To(BeNumerically("~", 2000, 10))
+}
+
+func TestPowerEstimateRestart(t *testing.T) {
+	g := NewWithT(t)
+	statPath, err := utils.CreateTempFile("cpu  100 0 100 700 100 0 0 0 0 0\n")
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.Remove(statPath)
+
+	r := &PowerEstimate{minWatts: 10, maxWatts: 50, dramWatts: 2, statPath: statPath}
+	r.update()
+	// the time since the last read is not estimated after a restart
+	r.lastTime = time.Now().Add(-time.Hour)
+	r.Restart()
+	g.Expect(os.WriteFile(statPath, []byte("cpu  150 0 150 950 150 0 0 0 0 0\n"), 0o644)).To(Succeed())
+	energy := r.GetNodeComponentsEnergy()
+	g.Expect(energy[0].Pkg).To(BeZero())
+	g.Expect(energy[0].DRAM).To(BeZero())
+}
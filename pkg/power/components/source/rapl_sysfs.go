@@ -19,6 +19,7 @@ package source
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -26,15 +27,8 @@ import (
 )
 
 const (
-	// sysfs path templates
-	numPkgPathTemplate      = "/sys/devices/system/cpu/cpu%d/topology/physical_package_id"
-	packageNamePathTemplate = "/sys/class/powercap/intel-rapl/intel-rapl:%d/"
-	eventNamePathTemplate   = "/sys/class/powercap/intel-rapl/intel-rapl:%d/intel-rapl:%d:%d/"
-	cpuInfoPath             = "/proc/cpuinfo"
-	energyFile              = "energy_uj"
-
-	// RAPL number of events (core, dram and uncore)
-	numRAPLEvents = 3
+	energyFile = "energy_uj"
+	nameFile   = "name"
 
 	// RAPL events
 	dramEvent    = "dram"
@@ -44,6 +38,9 @@ const (
 )
 
 var (
+	// powercapPath holds the RAPL domains, the package domains are intel-rapl:<n> and their subdomains intel-rapl:<n>:<m>
+	powercapPath = "/sys/class/powercap/intel-rapl"
+	// eventPaths holds the path of the events of each package domain, keyed by the domain name, e.g. package-0 or package-0-die-1
 	eventPaths map[string]map[string]string
 )
 
@@ -94,8 +91,7 @@ func readEventEnergy(eventName string) map[string]uint64 {
 type PowerSysfs struct{}
 
 func (r *PowerSysfs) IsSystemCollectionSupported() bool {
-	path := fmt.Sprintf(packageNamePathTemplate, 0)
-	_, err := os.ReadFile(path + energyFile)
+	_, err := os.ReadFile(filepath.Join(powercapPath, "intel-rapl:0", energyFile))
 	return err == nil
 }
 
@@ -115,6 +111,7 @@ func (r *PowerSysfs) GetEnergyFromPackage() (uint64, error) {
 	return getEnergy(packageEvent)
 }
 
+// GetNodeComponentsEnergy returns the energy of each package keyed by its physical package ID, the energy of the dies of a package is summed
 func (r *PowerSysfs) GetNodeComponentsEnergy() map[int]NodeComponentsEnergy {
 	packageEnergies := make(map[int]NodeComponentsEnergy)
 
@@ -123,18 +120,18 @@ func (r *PowerSysfs) GetNodeComponentsEnergy() map[int]NodeComponentsEnergy {
 	dramEnergies := readEventEnergy(dramEvent)
 	uncoreEnergies := readEventEnergy(uncoreEvent)
 
-	for pkgID, pkgEnergy := range pkgEnergies {
-		coreEnergy := coreEnergies[pkgID]
-		dramEnergy := dramEnergies[pkgID]
-		uncoreEnergy := uncoreEnergies[pkgID]
-		splits := strings.Split(pkgID, "-")
-		i, _ := strconv.Atoi(splits[len(splits)-1])
-		packageEnergies[i] = NodeComponentsEnergy{
-			Core:   coreEnergy,
-			DRAM:   dramEnergy,
-			Uncore: uncoreEnergy,
-			Pkg:    pkgEnergy,
+	for domain, pkgEnergy := range pkgEnergies {
+		pkgID, err := getRAPLPackageID(domain)
+		if err != nil {
+			klog.V(3).Infoln(err)
+			continue
 		}
+		energy := packageEnergies[pkgID]
+		energy.Core += coreEnergies[domain]
+		energy.DRAM += dramEnergies[domain]
+		energy.Uncore += uncoreEnergies[domain]
+		energy.Pkg += pkgEnergy
+		packageEnergies[pkgID] = energy
 	}
 
 	return packageEnergies
@@ -0,0 +1,63 @@
+package source
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/sustainable-computing-io/kepler/pkg/utils"
+)
+
+func TestGetRAPLPackageID(t *testing.T) {
+	g := NewWithT(t)
+	for domain, pkgID := range map[string]int{"package-0": 0, "package-1": 1, "package-1-die-1": 1} {
+		id, err := getRAPLPackageID(domain)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(id).To(Equal(pkgID), domain)
+	}
+	for _, domain := range []string{"psys", "core", "package", "package-x"} {
+		_, err := getRAPLPackageID(domain)
+		g.Expect(err).To(HaveOccurred(), domain)
+	}
+}
+
+func TestSysfsPackageEnergy(t *testing.T) {
+	g := NewWithT(t)
+	root, err := utils.CreateTempDir()
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(root)
+
+	writeDomain := func(path, name, energy string) {
+		g.Expect(os.MkdirAll(path, 0o755)).To(Succeed())
+		g.Expect(os.WriteFile(filepath.Join(path, nameFile), []byte(name+"\n"), 0o644)).To(Succeed())
+		g.Expect(os.WriteFile(filepath.Join(path, energyFile), []byte(energy+"\n"), 0o644)).To(Succeed())
+	}
+	// the package 0 has two dies, the domain intel-rapl:2 is the package 1 and intel-rapl:3 is not a package domain
+	writeDomain(filepath.Join(root, "intel-rapl:0"), "package-0-die-0", "10000")
+	writeDomain(filepath.Join(root, "intel-rapl:0", "intel-rapl:0:0"), "dram", "1000")
+	writeDomain(filepath.Join(root, "intel-rapl:1"), "package-0-die-1", "20000")
+	writeDomain(filepath.Join(root, "intel-rapl:1", "intel-rapl:1:0"), "dram", "2000")
+	writeDomain(filepath.Join(root, "intel-rapl:2"), "package-1", "40000")
+	writeDomain(filepath.Join(root, "intel-rapl:2", "intel-rapl:2:0"), "core", "30000")
+	writeDomain(filepath.Join(root, "intel-rapl:3"), "psys", "90000")
+
+	defer func(path string, paths map[string]map[string]string) {
+		powercapPath, eventPaths = path, paths
+	}(powercapPath, eventPaths)
+	powercapPath = root
+	eventPaths = map[string]map[string]string{}
+	detectEventPaths()
+	g.Expect(eventPaths).To(HaveLen(3))
+
+	r := &PowerSysfs{}
+	g.Expect(r.IsSystemCollectionSupported()).To(BeTrue())
+	g.Expect(r.GetNodeComponentsEnergy()).To(Equal(map[int]NodeComponentsEnergy{
+		0: {Pkg: 30, DRAM: 3},
+		1: {Pkg: 40, Core: 30},
+	}))
+	pkgEnergy, err := r.GetEnergyFromPackage()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(pkgEnergy).To(Equal(uint64(70)))
+}
@@ -19,68 +19,55 @@ package source
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
-
-	"k8s.io/klog/v2"
 )
 
-func getNumCPUs() int {
-	data, err := os.ReadFile(cpuInfoPath)
-	if err != nil {
-		klog.V(2).Infoln(err)
-	}
-	return strings.Count(string(data), "processor")
-}
-
-func getNumPackage() int {
-	var numPackage int
-	pkgMap := map[int]bool{}
-	numCPUs := getNumCPUs()
-	for i := 0; i < numCPUs; i++ {
-		path := fmt.Sprintf(numPkgPathTemplate, i)
-		data, err := os.ReadFile(path)
+// detectEventPaths finds the package domains and their events, the other domains like psys are not per package
+func detectEventPaths() {
+	domains, _ := filepath.Glob(filepath.Join(powercapPath, "intel-rapl:*"))
+	for _, domainPath := range domains {
+		data, err := os.ReadFile(filepath.Join(domainPath, nameFile))
 		if err != nil {
-			break
-		}
-
-		if id, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
-			if _, exist := pkgMap[id]; !exist {
-				numPackage++
-				pkgMap[id] = true
-			}
+			continue
 		}
-	}
-	return numPackage
-}
-
-func detectEventPaths() {
-	numPackage := getNumPackage()
-	for i := 0; i < numPackage; i++ {
-		packagePath := fmt.Sprintf(packageNamePathTemplate, i)
-		data, err := os.ReadFile(packagePath + "name")
 		packageName := strings.TrimSpace(string(data))
-		if err != nil {
+		if _, err := getRAPLPackageID(packageName); err != nil {
 			continue
 		}
 		eventPaths[packageName] = map[string]string{}
-		eventPaths[packageName][packageName] = packagePath
-		for j := 0; j < numRAPLEvents; j++ {
-			eventNamePath := fmt.Sprintf(eventNamePathTemplate, i, i, j)
-			data, err := os.ReadFile(eventNamePath + "name")
-			eventName := strings.TrimSpace(string(data))
+		eventPaths[packageName][packageName] = domainPath + "/"
+		subdomains, _ := filepath.Glob(filepath.Join(domainPath, filepath.Base(domainPath)+":*"))
+		for _, eventPath := range subdomains {
+			data, err := os.ReadFile(filepath.Join(eventPath, nameFile))
 			if err != nil {
 				continue
 			}
-			eventPaths[packageName][eventName] = eventNamePath
+			eventPaths[packageName][strings.TrimSpace(string(data))] = eventPath + "/"
 		}
 	}
 }
 
+// getRAPLPackageID returns the physical package ID of a package domain, the domain is named package-<id> or package-<id>-die-<die id>.
+// The index of the domain is not the package ID, e.g. the dies of a package have their own domain.
+func getRAPLPackageID(domain string) (int, error) {
+	fields := strings.Split(domain, "-")
+	if len(fields) < 2 || fields[0] != packageEvent {
+		return 0, fmt.Errorf("%q is not a RAPL package domain", domain)
+	}
+	pkgID, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return 0, fmt.Errorf("invalid package ID in the RAPL domain %q: %v", domain, err)
+	}
+	return pkgID, nil
+}
+
+// hasEvent returns if a domain has the event, the package domains are named package-<id>
 func hasEvent(event string) bool {
 	for _, subTree := range eventPaths {
 		for e := range subTree {
-			if e == event {
+			if strings.HasPrefix(e, event) {
 				return true
 			}
 		}
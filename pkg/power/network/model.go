@@ -0,0 +1,118 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package network
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	// defaultModelKey configures the model of the interfaces that do not match any other prefix
+	defaultModelKey = "default"
+
+	nanoJouleToMiliJoule = 1000000
+)
+
+// NICModel estimates the dynamic energy of the traffic in a network interface
+type NICModel struct {
+	NanoJoulesPerByte   float64
+	NanoJoulesPerPacket float64
+}
+
+var (
+	// models is keyed by the interface name prefix
+	models       = map[string]NICModel{}
+	defaultModel *NICModel
+	mutex        sync.RWMutex
+)
+
+// InitNICEnergyModel parses the NIC energy model, the format is a comma-separated list of
+// <interface-prefix>=<nJ per byte>:<nJ per packet>, e.g. "eth=6:1200,net=3:800,default=5:1000"
+func InitNICEnergyModel(spec string) error {
+	newModels := map[string]NICModel{}
+	var newDefault *NICModel
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kv := strings.SplitN(entry, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return fmt.Errorf("invalid NIC energy model entry %q", entry)
+		}
+		values := strings.Split(kv[1], ":")
+		if len(values) != 2 {
+			return fmt.Errorf("invalid NIC energy model entry %q", entry)
+		}
+		perByte, err := strconv.ParseFloat(values[0], 64)
+		if err != nil {
+			return fmt.Errorf("invalid energy per byte in %q: %v", entry, err)
+		}
+		perPacket, err := strconv.ParseFloat(values[1], 64)
+		if err != nil {
+			return fmt.Errorf("invalid energy per packet in %q: %v", entry, err)
+		}
+		if perByte < 0 || perPacket < 0 {
+			return fmt.Errorf("negative energy in NIC energy model entry %q", entry)
+		}
+		model := NICModel{NanoJoulesPerByte: perByte, NanoJoulesPerPacket: perPacket}
+		prefix := strings.TrimSpace(kv[0])
+		if prefix == defaultModelKey {
+			newDefault = &model
+		} else {
+			newModels[prefix] = model
+		}
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	models = newModels
+	defaultModel = newDefault
+	klog.V(1).Infof("NIC energy model: %v, default: %v", models, defaultModel)
+	return nil
+}
+
+// IsNICEnergyModelEnabled returns true if at least one interface has an energy model
+func IsNICEnergyModelEnabled() bool {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return len(models) > 0 || defaultModel != nil
+}
+
+// GetEnergy returns the energy in mJ of the traffic in the interface, the longest matching prefix is used
+func GetEnergy(iface string, bytes, packets uint64) float64 {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	model := defaultModel
+	matched := -1
+	for prefix := range models {
+		if strings.HasPrefix(iface, prefix) && len(prefix) > matched {
+			m := models[prefix]
+			model = &m
+			matched = len(prefix)
+		}
+	}
+	if model == nil {
+		return 0
+	}
+	return (float64(bytes)*model.NanoJoulesPerByte + float64(packets)*model.NanoJoulesPerPacket) / nanoJouleToMiliJoule
+}
@@ -0,0 +1,54 @@
+package network
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestInitNICEnergyModel(t *testing.T) {
+	g := NewWithT(t)
+	defer func() { g.Expect(InitNICEnergyModel("")).To(Succeed()) }()
+
+	g.Expect(InitNICEnergyModel("eth=6:1200, net=3:800,default=5:1000,")).To(Succeed())
+	g.Expect(IsNICEnergyModelEnabled()).To(BeTrue())
+	g.Expect(models).To(Equal(map[string]NICModel{
+		"eth": {NanoJoulesPerByte: 6, NanoJoulesPerPacket: 1200},
+		"net": {NanoJoulesPerByte: 3, NanoJoulesPerPacket: 800},
+	}))
+	g.Expect(defaultModel).To(Equal(&NICModel{NanoJoulesPerByte: 5, NanoJoulesPerPacket: 1000}))
+
+	// only the default model
+	g.Expect(InitNICEnergyModel("default=1:2")).To(Succeed())
+	g.Expect(IsNICEnergyModelEnabled()).To(BeTrue())
+	g.Expect(models).To(BeEmpty())
+
+	for _, spec := range []string{"eth", "=1:2", "eth=1", "eth=1:2:3", "eth=a:2", "eth=1:b", "eth=-1:2", "eth=1:-2"} {
+		g.Expect(InitNICEnergyModel(spec)).NotTo(Succeed(), spec)
+	}
+	// a bad entry keeps the previous model
+	g.Expect(defaultModel).To(Equal(&NICModel{NanoJoulesPerByte: 1, NanoJoulesPerPacket: 2}))
+
+	g.Expect(InitNICEnergyModel("")).To(Succeed())
+	g.Expect(IsNICEnergyModelEnabled()).To(BeFalse())
+}
+
+func TestGetEnergy(t *testing.T) {
+	g := NewWithT(t)
+	defer func() { g.Expect(InitNICEnergyModel("")).To(Succeed()) }()
+
+	g.Expect(InitNICEnergyModel("")).To(Succeed())
+	g.Expect(GetEnergy("eth0", 1000, 10)).To(BeZero())
+
+	g.Expect(InitNICEnergyModel("eth=6:1200,eth1=2:100")).To(Succeed())
+	// 1000 bytes * 6 nJ + 10 packets * 1200 nJ = 18000 nJ = 0.018 mJ
+	g.Expect(GetEnergy("eth0", 1000, 10)).To(BeNumerically("~", 0.018, 1e-12))
+	// the longest prefix wins
+	g.Expect(GetEnergy("eth1", 1000, 10)).To(BeNumerically("~", 0.003, 1e-12))
+	// no default model
+	g.Expect(GetEnergy("ens3", 1000, 10)).To(BeZero())
+
+	g.Expect(InitNICEnergyModel("eth=6:1200,default=1:1000")).To(Succeed())
+	g.Expect(GetEnergy("ens3", 1000000, 1000)).To(BeNumerically("~", 2, 1e-12))
+	g.Expect(GetEnergy("eth0", 0, 0)).To(BeZero())
+}
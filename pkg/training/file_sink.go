@@ -0,0 +1,185 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package training
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// FileSink writes the training data to a file in JSON lines or CSV, the file is rotated when it reaches the maximum size or when the schema
+// changes and the rotated files are kept as <path>.1 (the newest) to <path>.<maxFiles>. Each file starts with the schema: a JSON line
+// {"schema": ...} followed by {"record": ...} lines, or the CSV header with a row per node and per container.
+type FileSink struct {
+	path     string
+	format   string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	size     int64
+	schema   *Schema
+}
+
+// NewFileSink returns a sink writing to the path in the format, json or csv
+func NewFileSink(path, format string, maxSize int64, maxFiles int) (*FileSink, error) {
+	if format != JSONFormat && format != CSVFormat {
+		return nil, fmt.Errorf("unknown training data format %q, the formats are %s and %s", format, JSONFormat, CSVFormat)
+	}
+	// the file of a previous run and the full files are rotated, without rotated files their training data would be lost
+	if maxFiles < 1 {
+		return nil, fmt.Errorf("the training data needs at least one rotated file, got %d", maxFiles)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	return &FileSink{path: path, format: format, maxSize: maxSize, maxFiles: maxFiles}, nil
+}
+
+func (s *FileSink) Write(schema *Schema, record *Record) error {
+	if s.file == nil || !schema.equal(s.schema) || (s.maxSize > 0 && s.size >= s.maxSize) {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+		header, err := s.encodeSchema(schema)
+		if err != nil {
+			return err
+		}
+		if err := s.write(header); err != nil {
+			return err
+		}
+		s.schema = schema
+	}
+	data, err := s.encodeRecord(record)
+	if err != nil {
+		return err
+	}
+	return s.write(data)
+}
+
+func (s *FileSink) write(data []byte) error {
+	n, err := s.file.Write(data)
+	s.size += int64(n)
+	return err
+}
+
+// rotate closes the current file, shifts the rotated files and opens a new file, an existing file of a previous run is rotated too
+func (s *FileSink) rotate() error {
+	if err := s.Close(); err != nil {
+		return err
+	}
+	if info, err := os.Stat(s.path); err == nil && info.Size() > 0 {
+		for i := s.maxFiles - 1; i > 0; i-- {
+			_ = os.Rename(fmt.Sprintf("%s.%d", s.path, i), fmt.Sprintf("%s.%d", s.path, i+1))
+		}
+		if err := os.Rename(s.path, s.path+".1"); err != nil {
+			return err
+		}
+	}
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	s.file = file
+	s.size = 0
+	return nil
+}
+
+func (s *FileSink) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+func (s *FileSink) encodeSchema(schema *Schema) ([]byte, error) {
+	if s.format == JSONFormat {
+		return marshalJSONLine(jsonLine{Schema: schema})
+	}
+	header := []string{"timestamp", "period_sec", "kind", "node", "pod_name", "container_name", "namespace"}
+	header = append(header, schema.SystemFeatures...)
+	header = append(header, schema.Features...)
+	for _, component := range schema.Components {
+		header = append(header, "energy_"+component)
+	}
+	return encodeCSV([][]string{header})
+}
+
+func (s *FileSink) encodeRecord(record *Record) ([]byte, error) {
+	if s.format == JSONFormat {
+		return marshalJSONLine(jsonLine{Record: record})
+	}
+	timestamp := record.Timestamp.Format(time.RFC3339)
+	period := formatFloat(record.PeriodSec)
+	node := record.Node
+	// the containers have the system values of the node and no measured energy
+	row := []string{timestamp, period, "node", node.Name, "", "", ""}
+	row = append(row, node.SystemValues...)
+	row = append(row, formatFloats(node.Features)...)
+	row = append(row, formatFloats(node.Energy)...)
+	rows := [][]string{row}
+	for _, container := range record.Containers {
+		row = []string{timestamp, period, "container", node.Name, container.PodName, container.ContainerName, container.Namespace}
+		row = append(row, node.SystemValues...)
+		row = append(row, formatFloats(container.Features)...)
+		row = append(row, make([]string, len(node.Energy))...)
+		rows = append(rows, row)
+	}
+	return encodeCSV(rows)
+}
+
+// jsonLine is a line of the JSON lines output, either the schema or a record
+type jsonLine struct {
+	Schema *Schema `json:"schema,omitempty"`
+	Record *Record `json:"record,omitempty"`
+}
+
+func marshalJSONLine(line jsonLine) ([]byte, error) {
+	data, err := json.Marshal(line)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func encodeCSV(rows [][]string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func formatFloats(values []float64) []string {
+	strs := make([]string, len(values))
+	for i, v := range values {
+		strs[i] = formatFloat(v)
+	}
+	return strs
+}
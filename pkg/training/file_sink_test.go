@@ -0,0 +1,138 @@
+package training
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/sustainable-computing-io/kepler/pkg/utils"
+)
+
+var (
+	testSchema = NewSchema([]string{"cpu_architecture"}, []string{"cpu_instr", "cache_miss"}, []string{"pkg", "dram"})
+	testRecord = &Record{
+		Timestamp: time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC),
+		PeriodSec: 3,
+		Node: NodeRecord{
+			Name:         "node1",
+			SystemValues: []string{"Sky Lake"},
+			Features:     []float64{3000, 60},
+			Energy:       []float64{1500, 300},
+		},
+		Containers: []ContainerRecord{
+			{PodName: "pod1", ContainerName: "c1", Namespace: "ns", Features: []float64{1000, 20}},
+			{PodName: "pod2", ContainerName: "c2", Namespace: "ns", Features: []float64{2000, 40}},
+		},
+	}
+)
+
+func readLines(g *WithT, path string) []string {
+	data, err := os.ReadFile(path)
+	g.Expect(err).NotTo(HaveOccurred())
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+func TestFileSinkJSON(t *testing.T) {
+	g := NewWithT(t)
+	dir, err := utils.CreateTempDir()
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "training-data")
+
+	sink, err := NewFileSink(path, JSONFormat, 0, 2)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(sink.Write(testSchema, testRecord)).To(Succeed())
+	g.Expect(sink.Write(testSchema, testRecord)).To(Succeed())
+	g.Expect(sink.Close()).To(Succeed())
+
+	// the schema is written once before the records
+	lines := readLines(g, path)
+	g.Expect(lines).To(HaveLen(3))
+	var line struct {
+		Schema *Schema `json:"schema"`
+		Record *Record `json:"record"`
+	}
+	g.Expect(json.Unmarshal([]byte(lines[0]), &line)).To(Succeed())
+	g.Expect(line.Schema).To(Equal(testSchema))
+	g.Expect(line.Record).To(BeNil())
+	line.Schema = nil
+	g.Expect(json.Unmarshal([]byte(lines[1]), &line)).To(Succeed())
+	g.Expect(line.Schema).To(BeNil())
+	g.Expect(line.Record).To(Equal(testRecord))
+}
+
+func TestFileSinkCSV(t *testing.T) {
+	g := NewWithT(t)
+	dir, err := utils.CreateTempDir()
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "training-data.csv")
+
+	sink, err := NewFileSink(path, CSVFormat, 0, 2)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(sink.Write(testSchema, testRecord)).To(Succeed())
+	g.Expect(sink.Close()).To(Succeed())
+
+	g.Expect(readLines(g, path)).To(Equal([]string{
+		"timestamp,period_sec,kind,node,pod_name,container_name,namespace,cpu_architecture,cpu_instr,cache_miss,energy_pkg,energy_dram",
+		"2022-11-01T00:00:00Z,3,node,node1,,,,Sky Lake,3000,60,1500,300",
+		"2022-11-01T00:00:00Z,3,container,node1,pod1,c1,ns,Sky Lake,1000,20,,",
+		"2022-11-01T00:00:00Z,3,container,node1,pod2,c2,ns,Sky Lake,2000,40,,",
+	}))
+
+	_, err = NewFileSink(path, "parquet", 0, 2)
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestFileSinkRotation(t *testing.T) {
+	g := NewWithT(t)
+	dir, err := utils.CreateTempDir()
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "training-data")
+
+	// every record exceeds the maximum size, so each write after the first starts a new file
+	sink, err := NewFileSink(path, JSONFormat, 1, 2)
+	g.Expect(err).NotTo(HaveOccurred())
+	for i := 0; i < 4; i++ {
+		g.Expect(sink.Write(testSchema, testRecord)).To(Succeed())
+	}
+	g.Expect(readLines(g, path)).To(HaveLen(2))
+	g.Expect(readLines(g, path+".1")).To(HaveLen(2))
+	g.Expect(readLines(g, path+".2")).To(HaveLen(2))
+	g.Expect(path + ".3").NotTo(BeAnExistingFile())
+
+	// a new schema starts a new file with the schema line
+	newSchema := NewSchema(testSchema.SystemFeatures, []string{"cpu_instr"}, testSchema.Components)
+	g.Expect(sink.Write(newSchema, testRecord)).To(Succeed())
+	g.Expect(sink.Close()).To(Succeed())
+	lines := readLines(g, path)
+	g.Expect(lines).To(HaveLen(2))
+	g.Expect(lines[0]).To(ContainSubstring(`"features":["cpu_instr"]`))
+}
+
+func TestFileSinkRestart(t *testing.T) {
+	g := NewWithT(t)
+	dir, err := utils.CreateTempDir()
+	g.Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "training-data")
+
+	// the file of the previous run is rotated, not truncated
+	g.Expect(os.WriteFile(path, []byte("previous run\n"), 0o644)).To(Succeed())
+	sink, err := NewFileSink(path, JSONFormat, 0, 1)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(sink.Write(testSchema, testRecord)).To(Succeed())
+	g.Expect(sink.Close()).To(Succeed())
+	g.Expect(readLines(g, path+".1")).To(Equal([]string{"previous run"}))
+	g.Expect(readLines(g, path)).To(HaveLen(2))
+
+	// without rotated files the training data would be lost
+	_, err = NewFileSink(path, JSONFormat, 0, 0)
+	g.Expect(err).To(HaveOccurred())
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package training
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sustainable-computing-io/kepler/pkg/config"
+	"k8s.io/klog/v2"
+)
+
+const (
+	FileSinkName = "file"
+	HTTPSinkName = "http"
+
+	JSONFormat = "json"
+	CSVFormat  = "csv"
+
+	// schemaVersion is increased when the structure of the records changes
+	schemaVersion = 1
+)
+
+// Schema describes the values of the records, the features and the energy are arrays in the order of the schema
+type Schema struct {
+	Version int `json:"version"`
+	// SystemFeatures are the node metadata, e.g. the CPU architecture
+	SystemFeatures []string `json:"system_features"`
+	// Features are the usage metrics of the node and of the containers
+	Features []string `json:"features"`
+	// Components are the measured energy of the node components in millijoules
+	Components []string `json:"components"`
+}
+
+// NewSchema returns the schema of the records with the system features, the usage metrics and the energy components
+func NewSchema(systemFeatures, features, components []string) *Schema {
+	return &Schema{Version: schemaVersion, SystemFeatures: systemFeatures, Features: features, Components: components}
+}
+
+func (s *Schema) equal(other *Schema) bool {
+	return other != nil && s.Version == other.Version && equalStrings(s.SystemFeatures, other.SystemFeatures) &&
+		equalStrings(s.Features, other.Features) && equalStrings(s.Components, other.Components)
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Record holds the feature vectors of the node and of its containers with the measured node energy in a collection interval
+type Record struct {
+	Timestamp  time.Time         `json:"timestamp"`
+	PeriodSec  float64           `json:"period_sec"`
+	Node       NodeRecord        `json:"node"`
+	Containers []ContainerRecord `json:"containers"`
+}
+
+type NodeRecord struct {
+	Name         string    `json:"name"`
+	SystemValues []string  `json:"system_values"`
+	Features     []float64 `json:"features"`
+	Energy       []float64 `json:"energy"`
+}
+
+type ContainerRecord struct {
+	PodName       string    `json:"pod_name"`
+	ContainerName string    `json:"container_name"`
+	Namespace     string    `json:"namespace"`
+	Features      []float64 `json:"features"`
+}
+
+// Sink writes the training records, the schema is written before the first record and when it changes
+type Sink interface {
+	Write(schema *Schema, record *Record) error
+	Close() error
+}
+
+var (
+	sinks      []Sink
+	streamSink *StreamSink
+	sinksLock  sync.Mutex
+)
+
+// Init creates the configured training data sinks
+func Init() error {
+	sinksLock.Lock()
+	defer sinksLock.Unlock()
+	for _, name := range config.TrainingDataSinks {
+		switch name {
+		case FileSinkName:
+			sink, err := NewFileSink(config.TrainingDataPath, config.TrainingDataFormat, int64(config.TrainingDataMaxSizeMB)<<20, config.TrainingDataMaxFiles)
+			if err != nil {
+				return err
+			}
+			sinks = append(sinks, sink)
+			klog.Infof("writing the training data to %s (%s)", config.TrainingDataPath, config.TrainingDataFormat)
+		case HTTPSinkName:
+			streamSink = NewStreamSink()
+			sinks = append(sinks, streamSink)
+			klog.Infof("streaming the training data")
+		default:
+			return fmt.Errorf("unknown training data sink %q, the sinks are %s and %s", name, FileSinkName, HTTPSinkName)
+		}
+	}
+	return nil
+}
+
+// IsEnabled returns if a training data sink is configured
+func IsEnabled() bool {
+	sinksLock.Lock()
+	defer sinksLock.Unlock()
+	return len(sinks) > 0
+}
+
+// Write writes the record to the sinks
+func Write(schema *Schema, record *Record) {
+	sinksLock.Lock()
+	defer sinksLock.Unlock()
+	for _, sink := range sinks {
+		if err := sink.Write(schema, record); err != nil {
+			klog.V(3).Infof("failed to write the training data: %v", err)
+		}
+	}
+}
+
+// Close closes the sinks
+func Close() {
+	sinksLock.Lock()
+	defer sinksLock.Unlock()
+	for _, sink := range sinks {
+		if err := sink.Close(); err != nil {
+			klog.V(3).Infof("failed to close the training data sink: %v", err)
+		}
+	}
+	sinks = nil
+	streamSink = nil
+}
+
+// Handler streams the training data in JSON lines if the http sink is configured
+func Handler(w http.ResponseWriter, req *http.Request) {
+	sinksLock.Lock()
+	sink := streamSink
+	sinksLock.Unlock()
+	if sink == nil {
+		http.Error(w, "the training data stream is not enabled, set TRAINING_DATA_SINK=http", http.StatusNotFound)
+		return
+	}
+	sink.ServeHTTP(w, req)
+}
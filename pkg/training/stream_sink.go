@@ -0,0 +1,124 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package training
+
+import (
+	"net/http"
+	"sync"
+
+	"k8s.io/klog/v2"
+)
+
+// streamBufferSize is the number of lines buffered per client, the lines are dropped for a slower client
+const streamBufferSize = 64
+
+// StreamSink streams the training data in JSON lines to the HTTP clients, a client first receives the current schema
+type StreamSink struct {
+	lock    sync.Mutex
+	clients map[chan []byte]bool
+	schema  *Schema
+	// schemaLine is the encoded schema sent to the new clients
+	schemaLine []byte
+}
+
+func NewStreamSink() *StreamSink {
+	return &StreamSink{clients: make(map[chan []byte]bool)}
+}
+
+func (s *StreamSink) Write(schema *Schema, record *Record) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !schema.equal(s.schema) {
+		line, err := marshalJSONLine(jsonLine{Schema: schema})
+		if err != nil {
+			return err
+		}
+		s.schema = schema
+		s.schemaLine = line
+		s.broadcast(line)
+	}
+	if len(s.clients) == 0 {
+		return nil
+	}
+	line, err := marshalJSONLine(jsonLine{Record: record})
+	if err != nil {
+		return err
+	}
+	s.broadcast(line)
+	return nil
+}
+
+func (s *StreamSink) broadcast(line []byte) {
+	for client := range s.clients {
+		select {
+		case client <- line:
+		default:
+			klog.V(5).Infof("the training data client is too slow, drop a line")
+		}
+	}
+}
+
+func (s *StreamSink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for client := range s.clients {
+		close(client)
+		delete(s.clients, client)
+	}
+	return nil
+}
+
+// ServeHTTP streams the lines to the client until it disconnects
+func (s *StreamSink) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	client := make(chan []byte, streamBufferSize)
+	s.lock.Lock()
+	s.clients[client] = true
+	if s.schemaLine != nil {
+		client <- s.schemaLine
+	}
+	s.lock.Unlock()
+	defer func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		if s.clients[client] {
+			delete(s.clients, client)
+		}
+	}()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case line, open := <-client:
+			if !open {
+				return
+			}
+			if _, err := w.Write(line); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -45,6 +45,8 @@ func DetermineHostByteOrder() binary.ByteOrder {
 const (
 	SystemProcessName      string = "system_processes"
 	SystemProcessNamespace string = "system"
+	// KernelProcessName is the bucket of the kernel threads and of the time the CPUs spent in interrupts
+	KernelProcessName string = "kernel"
 )
 
 func GetPathFromPID(searchPath string, pid uint64) (string, error) {